@@ -0,0 +1,51 @@
+package client
+
+import "context"
+
+func (c cmdable) SetBit(ctx context.Context, key string, offset int64, value int) *Cmd[int64] {
+	cmd := newCmd(parseInt, "SETBIT", key, offset, value)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) GetBit(ctx context.Context, key string, offset int64) *Cmd[int64] {
+	cmd := newCmd(parseInt, "GETBIT", key, offset)
+	c(ctx, cmd)
+	return cmd
+}
+
+// BitCount counts the set bits of key, within a range given as options
+// like 0, -1, "BIT"
+func (c cmdable) BitCount(ctx context.Context, key string, opts ...any) *Cmd[int64] {
+	cmd := newCmd(parseInt, withArgs([]any{"BITCOUNT", key}, opts...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) BitPos(ctx context.Context, key string, bit int, opts ...any) *Cmd[int64] {
+	cmd := newCmd(parseInt, withArgs([]any{"BITPOS", key, bit}, opts...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// BitOp stores the result of op, like "AND" or "NOT", on keys in
+// destination
+func (c cmdable) BitOp(ctx context.Context, op, destination string, keys ...string) *Cmd[int64] {
+	cmd := newCmd(parseInt, appendStrings([]any{"BITOP", op, destination}, keys)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// BitField runs the subcommands given as arguments, like "GET", "u8", 0.
+// The replies are int64 values, nil for an overflow with OVERFLOW FAIL.
+func (c cmdable) BitField(ctx context.Context, key string, args ...any) *Cmd[[]any] {
+	cmd := newCmd(parseSlice, withArgs([]any{"BITFIELD", key}, args...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) BitFieldRO(ctx context.Context, key string, args ...any) *Cmd[[]any] {
+	cmd := newCmd(parseSlice, withArgs([]any{"BITFIELD_RO", key}, args...)...)
+	c(ctx, cmd)
+	return cmd
+}
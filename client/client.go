@@ -0,0 +1,289 @@
+// Package client is a Go client for medis. It pools connections, pipelines
+// commands, runs transactions and reconnects after the server went away.
+// Every command has a typed helper, returning a Cmd holding the converted
+// reply, and Do runs any other command.
+//
+// example:
+//
+//	c := client.New(client.Options{Addr: "localhost:6379"})
+//	defer c.Close()
+//	if err := c.Set(ctx, "key", "value", 0).Err(); err != nil { ... }
+//	value, err := c.Get(ctx, "key").Result()
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// ErrClosed is the error of the commands run once the client is closed
+var ErrClosed = errors.New("medis: client is closed")
+
+// Options configure a client, the zero value of a field picks its default
+type Options struct {
+	// "tcp", the default, or "unix" for a Unix socket
+	Network string
+	// host:port, or the socket path. Defaults to localhost:6379.
+	Addr string
+	// Database selected by every connection
+	DB int
+	// Name set with CLIENT SETNAME on every connection
+	ClientName string
+	// 3, the default, to receive push messages, or 2
+	Protocol int
+
+	// Connections open at once, 10 by default
+	PoolSize int
+	// Defaults to 5 seconds
+	DialTimeout time.Duration
+	// Time given to the replies and to the requests, 3 seconds by default.
+	// A negative value disables them, leaving the context deadline only.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// Attempts after a connection failed before the replies were read, 3
+	// by default, -1 for none. Requests the server may have received are
+	// only sent again when they only read, outside of a transaction, so
+	// that no write runs twice.
+	MaxRetries int
+
+	// OnPush receives the push messages arriving on pooled connections,
+	// like the invalidations of client side caching. Idle connections read
+	// them as they arrive, so OnPush may run on several goroutines at once.
+	OnPush func(Push)
+	// OnConnect runs on each new connection before it is used, like
+	// CLIENT TRACKING to receive invalidations
+	OnConnect func(ctx context.Context, cn *Conn) error
+}
+
+func (o *Options) setDefaults() {
+	if o.Network == "" {
+		o.Network = "tcp"
+	}
+	if o.Addr == "" {
+		o.Addr = "localhost:6379"
+	}
+	if o.Protocol == 0 {
+		o.Protocol = 3
+	}
+	if o.PoolSize <= 0 {
+		o.PoolSize = 10
+	}
+	if o.DialTimeout <= 0 {
+		o.DialTimeout = 5 * time.Second
+	}
+	if o.ReadTimeout == 0 {
+		o.ReadTimeout = 3 * time.Second
+	}
+	if o.WriteTimeout == 0 {
+		o.WriteTimeout = o.ReadTimeout
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = 3
+	}
+}
+
+// Client runs commands on a pool of connections, it is safe for concurrent
+// use
+type Client struct {
+	cmdable
+	opts Options
+	pool *pool
+}
+
+// New returns a client, connections are opened as the commands need them
+func New(opts Options) *Client {
+	opts.setDefaults()
+	c := &Client{opts: opts}
+	c.pool = newPool(opts.PoolSize, c.connect)
+	c.cmdable = c.process
+	return c
+}
+
+// Close closes the connections, the commands running get their replies
+// first
+func (c *Client) Close() error {
+	c.pool.close()
+	return nil
+}
+
+// Do runs a command and returns its reply converted to a string, an int64,
+// nil, a []any or a map[string]any. Durations are sent in milliseconds.
+func (c *Client) Do(ctx context.Context, args ...any) *Cmd[any] {
+	cmd := newCmd(parseAny, args...)
+	c.process(ctx, cmd)
+	return cmd
+}
+
+func (c *Client) process(ctx context.Context, cmd Cmder) {
+	c.processCmds(ctx, []Cmder{cmd}, false)
+}
+
+// Run the commands on a pooled connection, again on a new one when the
+// connection failed before sending them or when they only read
+func (c *Client) processCmds(ctx context.Context, cmds []Cmder, tx bool) error {
+	var err error
+	for attempt := 0; attempt <= max(c.opts.MaxRetries, 0); attempt++ {
+		if attempt > 0 {
+			if !sleep(ctx, retryBackoff(attempt)) {
+				break
+			}
+			for _, cmd := range cmds {
+				cmd.reset()
+			}
+		}
+
+		var cn *conn
+		var sent bool
+		cn, err = c.pool.get(ctx)
+		if err == nil {
+			err = cn.roundTrip(ctx, &c.opts, cmds, tx)
+			sent = cn.sent
+			c.pool.put(cn)
+		}
+		if err == nil || !retryable(err) || ctx.Err() != nil {
+			break
+		}
+		// The server went away, the idle connections are gone as well
+		c.pool.dropIdle()
+		if sent && !resendable(cmds, tx) {
+			break
+		}
+	}
+	if err != nil {
+		for _, cmd := range cmds {
+			if cmd.Err() == nil {
+				cmd.setReply(nil, err)
+			}
+		}
+	}
+	return err
+}
+
+// Dial a connection for the pool
+func (c *Client) connect(ctx context.Context) (*conn, error) {
+	cn, err := dial(ctx, &c.opts)
+	if err != nil {
+		return nil, err
+	}
+	if c.opts.OnConnect != nil {
+		if err := c.opts.OnConnect(ctx, newConn(c, cn)); err != nil {
+			cn.close()
+			return nil, err
+		}
+		if cn.broken {
+			cn.close()
+			return nil, errors.New("medis: connection failed in OnConnect")
+		}
+	}
+	return cn, nil
+}
+
+// Errors of connections closed or refused, the ones a new connection may
+// not run into
+func retryable(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return false
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, net.ErrClosed)
+}
+
+// Whether the commands can be sent again after the server may have run
+// them: they only read, and a transaction is never run twice
+func resendable(cmds []Cmder, tx bool) bool {
+	if tx {
+		return false
+	}
+	for _, cmd := range cmds {
+		if !cmd.readOnly() {
+			return false
+		}
+	}
+	return true
+}
+
+// Wait longer after each failed attempt, up to half a second
+func retryBackoff(attempt int) time.Duration {
+	return min(time.Duration(attempt*attempt)*10*time.Millisecond, 500*time.Millisecond)
+}
+
+// Sleep for d unless ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Conn is a single connection, for the commands changing its state
+type Conn struct {
+	cmdable
+	statefulCmdable
+	client *Client
+	cn     *conn
+}
+
+func newConn(c *Client, cn *conn) *Conn {
+	conn := &Conn{client: c, cn: cn}
+	conn.cmdable = conn.process
+	conn.statefulCmdable = conn.process
+	return conn
+}
+
+// Conn takes a connection out of the pool for the caller alone, to run
+// commands changing its state. Close it once done, it is not reused.
+func (c *Client) Conn(ctx context.Context) (*Conn, error) {
+	cn, err := c.pool.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newConn(c, cn), nil
+}
+
+// Close closes the connection. The connection given to OnConnect belongs to
+// the pool and must not be closed.
+func (c *Conn) Close() error {
+	c.cn.broken = true
+	c.client.pool.put(c.cn)
+	return nil
+}
+
+func (c *Conn) process(ctx context.Context, cmd Cmder) {
+	c.cn.roundTrip(ctx, &c.client.opts, []Cmder{cmd}, false)
+}
+
+// Do runs a command on the connection, like Client.Do
+func (c *Conn) Do(ctx context.Context, args ...any) *Cmd[any] {
+	cmd := newCmd(parseAny, args...)
+	c.process(ctx, cmd)
+	return cmd
+}
+
+// Push is a message the server sends outside of command replies, like a
+// pub/sub message or an invalidation
+type Push struct {
+	Kind string // "message", "invalidate", ...
+	Data []any
+}
+
+func newPush(p *resp.Push) Push {
+	values, _ := parseSlice(p)
+	var push Push
+	if len(values) > 0 {
+		push.Kind, _ = values[0].(string)
+		push.Data = values[1:]
+	}
+	return push
+}
@@ -0,0 +1,473 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/resp"
+	"github.com/mmnalaka/medis/internal/server"
+)
+
+// Start a server on port, a free one when zero, until the test ends or
+// stop is called. It returns the address and a function stopping the
+// server and waiting for it.
+func startServer(t *testing.T, port int) (addr string, stop func()) {
+	t.Helper()
+	if port == 0 {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port = l.Addr().(*net.TCPAddr).Port
+		l.Close()
+	}
+	cfg := config.Default()
+	cfg.Port = port
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- server.NewServer(cfg).Start(ctx) }()
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			cancel()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Error("server did not stop")
+			}
+		})
+	}
+	t.Cleanup(stop)
+
+	addr = "127.0.0.1:" + strconv.Itoa(port)
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return addr, stop
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("server did not start")
+	return "", nil
+}
+
+func newClient(t *testing.T, opts Options) *Client {
+	t.Helper()
+	c := New(opts)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClient_Commands(t *testing.T) {
+	ctx := context.Background()
+	addr, _ := startServer(t, 0)
+	for _, protocol := range []int{2, 3} {
+		c := newClient(t, Options{Addr: addr, Protocol: protocol})
+		c.Del(ctx, "k", "n", "h", "z", "s")
+
+		if err := c.Set(ctx, "k", "v", time.Minute).Err(); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := c.Get(ctx, "k").Result(); v != "v" || err != nil {
+			t.Errorf("RESP%d: got %q, %v", protocol, v, err)
+		}
+		if ttl := c.TTL(ctx, "k").Val(); ttl <= 0 || ttl > time.Minute {
+			t.Errorf("RESP%d: got TTL %v", protocol, ttl)
+		}
+		if _, err := c.Get(ctx, "missing").Result(); !errors.Is(err, Nil) {
+			t.Errorf("RESP%d: got %v, want Nil", protocol, err)
+		}
+		if v := c.MGet(ctx, "k", "missing").Val(); !reflect.DeepEqual(v, []any{"v", nil}) {
+			t.Errorf("RESP%d: got %v", protocol, v)
+		}
+		if n := c.Incr(ctx, "n").Val(); n != 1 {
+			t.Errorf("RESP%d: got %d", protocol, n)
+		}
+
+		var e Error
+		if err := c.Incr(ctx, "k").Err(); !errors.As(err, &e) || e.Prefix() != "ERR" {
+			t.Errorf("RESP%d: got %v, want an error reply", protocol, err)
+		}
+		if err := c.LPush(ctx, "k", "x").Err(); !errors.As(err, &e) || e.Prefix() != "WRONGTYPE" {
+			t.Errorf("RESP%d: got %v, want WRONGTYPE", protocol, err)
+		}
+
+		c.HSet(ctx, "h", "a", 1, "b", 2)
+		if v := c.HGetAll(ctx, "h").Val(); !reflect.DeepEqual(v, map[string]string{"a": "1", "b": "2"}) {
+			t.Errorf("RESP%d: got %v", protocol, v)
+		}
+		c.ZAdd(ctx, "z", Z{Member: "a", Score: 1.5}, Z{Member: "b", Score: 2})
+		if v := c.ZRangeWithScores(ctx, "z", 0, -1).Val(); !reflect.DeepEqual(v, []Z{{"a", 1.5}, {"b", 2}}) {
+			t.Errorf("RESP%d: got %v", protocol, v)
+		}
+		c.XAdd(ctx, &XAddArgs{Stream: "s", ID: "1-1", Values: []any{"f", "v"}})
+		if v := c.XRange(ctx, "s", "-", "+").Val(); len(v) != 1 || v[0].ID != "1-1" || v[0].Values["f"] != "v" {
+			t.Errorf("RESP%d: got %v", protocol, v)
+		}
+		if v := c.Do(ctx, "CONFIG", "GET", "port").Val(); !reflect.DeepEqual(v, map[string]any{"port": addr[strings.LastIndex(addr, ":")+1:]}) && !reflect.DeepEqual(v, []any{"port", addr[strings.LastIndex(addr, ":")+1:]}) {
+			t.Errorf("RESP%d: got %v", protocol, v)
+		}
+	}
+}
+
+func TestClient_Pipeline(t *testing.T) {
+	ctx := context.Background()
+	addr, _ := startServer(t, 0)
+	c := newClient(t, Options{Addr: addr})
+
+	var incr *Cmd[int64]
+	var get *Cmd[string]
+	cmds, err := c.Pipelined(ctx, func(p *Pipeline) error {
+		p.Set(ctx, "n", 10, 0)
+		incr = p.IncrBy(ctx, "n", 5)
+		get = p.Get(ctx, "n")
+		return nil
+	})
+	if err != nil || len(cmds) != 3 {
+		t.Fatalf("got %d commands, %v", len(cmds), err)
+	}
+	if incr.Val() != 15 || get.Val() != "15" {
+		t.Errorf("got %d and %q", incr.Val(), get.Val())
+	}
+
+	// The first error is returned, the other commands still run
+	p := c.Pipeline()
+	p.Get(ctx, "missing")
+	incr = p.Incr(ctx, "n")
+	if _, err := p.Exec(ctx); !errors.Is(err, Nil) {
+		t.Errorf("got %v, want Nil", err)
+	}
+	if incr.Val() != 16 || p.Len() != 0 {
+		t.Errorf("got %d, %d commands left", incr.Val(), p.Len())
+	}
+}
+
+func TestClient_Transaction(t *testing.T) {
+	ctx := context.Background()
+	addr, _ := startServer(t, 0)
+	c := newClient(t, Options{Addr: addr})
+
+	var incr *Cmd[int64]
+	_, err := c.TxPipelined(ctx, func(p *Pipeline) error {
+		p.Set(ctx, "n", 1, 0)
+		incr = p.Incr(ctx, "n")
+		return nil
+	})
+	if err != nil || incr.Val() != 2 {
+		t.Fatalf("got %d, %v", incr.Val(), err)
+	}
+
+	// A command failing to queue fails the transaction
+	p := c.TxPipeline()
+	incr = p.Incr(ctx, "n")
+	p.Do(ctx, "SET", "n")
+	if _, err := p.Exec(ctx); err == nil {
+		t.Error("got no error")
+	}
+	if err := incr.Err(); err == nil || !strings.HasPrefix(err.Error(), "EXECABORT") {
+		t.Errorf("got %v, want EXECABORT", err)
+	}
+	if n := c.Get(ctx, "n").Val(); n != "2" {
+		t.Errorf("got %q, want the transaction discarded", n)
+	}
+}
+
+func TestClient_PubSub(t *testing.T) {
+	ctx := context.Background()
+	addr, stop := startServer(t, 0)
+	port, _ := strconv.Atoi(addr[strings.LastIndex(addr, ":")+1:])
+	c := newClient(t, Options{Addr: addr})
+
+	ps, err := c.Subscribe(ctx, "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.Close()
+	if err := ps.PSubscribe(ctx, "sp*"); err != nil {
+		t.Fatal(err)
+	}
+	if v := c.PubSubNumSub(ctx, "news").Val(); v["news"] != 1 {
+		t.Errorf("got %v", v)
+	}
+
+	c.Publish(ctx, "news", "hello")
+	c.Publish(ctx, "sports", "goal")
+	expectMessage(t, ps, Message{Channel: "news", Payload: "hello"})
+	expectMessage(t, ps, Message{Pattern: "sp*", Channel: "sports", Payload: "goal"})
+
+	// The subscriptions survive a restart of the server
+	stop()
+	startServer(t, port)
+	for i := 0; ; i++ {
+		if v := c.PubSubNumSub(ctx, "news").Val(); v["news"] == 1 {
+			break
+		}
+		if i == 100 {
+			t.Fatal("did not subscribe again")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.Publish(ctx, "news", "again")
+	expectMessage(t, ps, Message{Channel: "news", Payload: "again"})
+
+	if err := ps.Unsubscribe(ctx, "news"); err != nil {
+		t.Fatal(err)
+	}
+	ps.Close()
+	for range ps.Channel() {
+	}
+	if err := ps.Subscribe(ctx, "news"); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v, want ErrClosed", err)
+	}
+}
+
+func expectMessage(t *testing.T, ps *PubSub, want Message) {
+	t.Helper()
+	select {
+	case msg := <-ps.Channel():
+		if *msg != want {
+			t.Errorf("got %+v, want %+v", *msg, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("did not receive %+v", want)
+	}
+}
+
+func TestClient_TrackingInvalidation(t *testing.T) {
+	ctx := context.Background()
+	addr, _ := startServer(t, 0)
+	pushes := make(chan Push, 10)
+	c := newClient(t, Options{
+		Addr:     addr,
+		PoolSize: 1,
+		OnConnect: func(ctx context.Context, cn *Conn) error {
+			return cn.ClientTracking(ctx, true).Err()
+		},
+		OnPush: func(p Push) { pushes <- p },
+	})
+	other := newClient(t, Options{Addr: addr})
+
+	c.Get(ctx, "k")
+	other.Set(ctx, "k", "v", 0)
+	// The invalidation is read while the connection is idle
+	select {
+	case p := <-pushes:
+		if p.Kind != "invalidate" || !reflect.DeepEqual(p.Data, []any{[]any{"k"}}) {
+			t.Errorf("got %+v", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no invalidation")
+	}
+	// Then the connection runs commands again
+	if v, err := c.Get(ctx, "k").Result(); v != "v" || err != nil {
+		t.Errorf("got %q, %v", v, err)
+	}
+	if n := c.ClientID(ctx).Val(); n == 0 {
+		t.Error("got no client ID")
+	}
+}
+
+func TestClient_Reconnect(t *testing.T) {
+	ctx := context.Background()
+	addr, stop := startServer(t, 0)
+	port, _ := strconv.Atoi(addr[strings.LastIndex(addr, ":")+1:])
+	c := newClient(t, Options{Addr: addr, PoolSize: 1, ClientName: "app", DB: 2})
+	admin := newClient(t, Options{Addr: addr})
+
+	id := c.ClientID(ctx).Val()
+	if n := admin.ClientKill(ctx, "ID", id).Val(); n != 1 {
+		t.Fatalf("killed %d clients", n)
+	}
+	// The next command runs on a new connection, set up the same way
+	if v, err := c.ClientGetName(ctx).Result(); v != "app" || err != nil {
+		t.Errorf("got %q, %v", v, err)
+	}
+	if next := c.ClientID(ctx).Val(); next == id {
+		t.Error("got the killed connection")
+	}
+	c.Set(ctx, "k", "v", 0)
+	if n := admin.Exists(ctx, "k").Val(); n != 0 {
+		t.Error("got the key in database 0")
+	}
+
+	stop()
+	startServer(t, port)
+	if err := c.Ping(ctx).Err(); err != nil {
+		t.Errorf("after a restart: %v", err)
+	}
+
+	c.Close()
+	if err := c.Ping(ctx).Err(); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v, want ErrClosed", err)
+	}
+}
+
+func TestClient_RetryReadsOnly(t *testing.T) {
+	ctx := context.Background()
+	// The server reads each request, then goes away without replying as
+	// if it crashed after running it
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	var requests atomic.Int64
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Read(make([]byte, 1024))
+			requests.Add(1)
+			conn.Close()
+		}
+	}()
+	c := newClient(t, Options{Addr: l.Addr().String(), Protocol: 2, MaxRetries: 2})
+
+	for _, tc := range []struct {
+		name     string
+		run      func() error
+		attempts int64
+	}{
+		{"write", func() error { return c.Incr(ctx, "k").Err() }, 1},
+		{"read", func() error { return c.Get(ctx, "k").Err() }, 3},
+		{"pipelined reads", func() error {
+			_, err := c.Pipelined(ctx, func(p *Pipeline) error {
+				p.Get(ctx, "k")
+				p.ClientID(ctx)
+				return nil
+			})
+			return err
+		}, 3},
+		{"pipeline with a write", func() error {
+			_, err := c.Pipelined(ctx, func(p *Pipeline) error {
+				p.Get(ctx, "k")
+				p.Incr(ctx, "k")
+				return nil
+			})
+			return err
+		}, 1},
+		{"transaction", func() error {
+			_, err := c.TxPipelined(ctx, func(p *Pipeline) error {
+				p.Get(ctx, "k")
+				return nil
+			})
+			return err
+		}, 1},
+	} {
+		requests.Store(0)
+		if err := tc.run(); err == nil {
+			t.Errorf("%s: got no error", tc.name)
+		}
+		if n := requests.Load(); n != tc.attempts {
+			t.Errorf("%s: sent %d times, want %d", tc.name, n, tc.attempts)
+		}
+	}
+}
+
+func TestClient_CancelAfterReply(t *testing.T) {
+	ctx := context.Background()
+	addr, _ := startServer(t, 0)
+	c := newClient(t, Options{Addr: addr, PoolSize: 1, MaxRetries: -1})
+
+	// The context is canceled once the reply is read, too late to stop the
+	// deadline that interrupts the exchange
+	cmdCtx, cancel := context.WithCancel(ctx)
+	cmd := newCmd(func(reply resp.RESPData) (string, error) {
+		cancel()
+		return parseString(reply)
+	}, "PING")
+	c.process(cmdCtx, cmd)
+	if err := cmd.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The deadline must not interrupt the next command
+	if err := c.Ping(ctx).Err(); err != nil {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestClient_Timeouts(t *testing.T) {
+	ctx := context.Background()
+	addr, _ := startServer(t, 0)
+	c := newClient(t, Options{Addr: addr, PoolSize: 1, ReadTimeout: 100 * time.Millisecond})
+
+	// Blocking commands wait for their timeout on top of the read timeout
+	start := time.Now()
+	if _, err := c.BLPop(ctx, 300*time.Millisecond, "list").Result(); !errors.Is(err, Nil) {
+		t.Errorf("got %v, want Nil", err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("returned after %v", elapsed)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		New(Options{Addr: addr}).RPush(ctx, "list", "x")
+	}()
+	if v, err := c.BLPop(ctx, 0, "list").Result(); !reflect.DeepEqual(v, []string{"list", "x"}) || err != nil {
+		t.Errorf("got %v, %v", v, err)
+	}
+
+	// The context interrupts a command and the connection is not reused
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := c.BLPop(timeout, 0, "list").Err(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the context deadline", err)
+	}
+	if err := c.Ping(ctx).Err(); err != nil {
+		t.Error(err)
+	}
+
+	// Pausing the clients leaves the read timeout
+	admin := newClient(t, Options{Addr: addr})
+	admin.ClientPause(ctx, time.Second)
+	defer admin.ClientUnpause(ctx)
+	var netErr net.Error
+	if err := c.Get(ctx, "k").Err(); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("got %v, want a timeout", err)
+	}
+}
+
+func TestClient_Conn(t *testing.T) {
+	ctx := context.Background()
+	addr, _ := startServer(t, 0)
+	c := newClient(t, Options{Addr: addr, PoolSize: 1})
+
+	cn, err := c.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cn.Select(ctx, 1)
+	cn.Set(ctx, "k", "v", 0)
+	cn.Close()
+
+	// The connection selecting another database is not reused
+	if n := c.Exists(ctx, "k").Val(); n != 0 {
+		t.Error("got the key in database 0")
+	}
+}
+
+func TestClient_Shutdown(t *testing.T) {
+	ctx := context.Background()
+	addr, _ := startServer(t, 0)
+	c := newClient(t, Options{Addr: addr, MaxRetries: -1})
+	if v, err := c.Shutdown(ctx, "NOSAVE").Result(); v != "OK" || err != nil {
+		t.Errorf("got %q, %v", v, err)
+	}
+	if err := c.Ping(ctx).Err(); err == nil {
+		t.Error("the server is still running")
+	}
+}
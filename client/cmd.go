@@ -0,0 +1,429 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// Nil is the error of the commands replying with a null, like GET on a
+// missing key
+var Nil = errors.New("medis: nil")
+
+// Error is an error reply from the server
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// Prefix returns the error code, like "ERR" or "WRONGTYPE"
+func (e Error) Prefix() string {
+	prefix, _, _ := strings.Cut(string(e), " ")
+	return prefix
+}
+
+// Cmder is a command queued in a pipeline, whatever the type of its reply
+type Cmder interface {
+	Args() []any
+	Err() error
+	setReply(reply resp.RESPData, err error)
+	readTimeout() (time.Duration, bool)
+	closesOnSuccess() bool
+	readOnly() bool
+	reset()
+}
+
+// Cmd is a command and, once it ran, its reply converted to T
+type Cmd[T any] struct {
+	args  []any
+	val   T
+	err   error
+	parse func(resp.RESPData) (T, error)
+
+	// Blocking commands wait for this long on top of the read timeout,
+	// forever when zero
+	block    time.Duration
+	blocking bool
+	// The connection closes instead of replying, like on SHUTDOWN
+	closeIsSuccess bool
+}
+
+func newCmd[T any](parse func(resp.RESPData) (T, error), args ...any) *Cmd[T] {
+	return &Cmd[T]{args: args, parse: parse}
+}
+
+// newBlockingCmd is a command that waits for up to timeout for a reply
+func newBlockingCmd[T any](timeout time.Duration, parse func(resp.RESPData) (T, error), args ...any) *Cmd[T] {
+	return &Cmd[T]{args: args, parse: parse, block: timeout, blocking: true}
+}
+
+// Args returns the command name and its arguments
+func (c *Cmd[T]) Args() []any { return c.args }
+
+// Val returns the reply, the zero value when the command failed
+func (c *Cmd[T]) Val() T { return c.val }
+
+// Err returns the error of the command, an Error for error replies
+func (c *Cmd[T]) Err() error { return c.err }
+
+// Result returns the reply and the error of the command
+func (c *Cmd[T]) Result() (T, error) { return c.val, c.err }
+
+func (c *Cmd[T]) String() string {
+	parts := make([]string, len(c.args))
+	for i, arg := range c.args {
+		parts[i] = string(encodeArg(arg))
+	}
+	if c.err != nil {
+		return fmt.Sprintf("%s: %v", strings.Join(parts, " "), c.err)
+	}
+	return fmt.Sprintf("%s: %v", strings.Join(parts, " "), c.val)
+}
+
+func (c *Cmd[T]) setReply(reply resp.RESPData, err error) {
+	if err != nil {
+		c.err = err
+		return
+	}
+	if e, ok := reply.(*resp.Error); ok {
+		c.err = Error(e.Data)
+		return
+	}
+	c.val, c.err = c.parse(reply)
+}
+
+func (c *Cmd[T]) readTimeout() (time.Duration, bool) {
+	return c.block, c.blocking
+}
+
+func (c *Cmd[T]) closesOnSuccess() bool { return c.closeIsSuccess }
+
+// Commands that only read, running them twice is harmless. Those with
+// subcommands that change things are listed by subcommand.
+var readOnlyCommands = map[string]bool{
+	"PING": true, "INFO": true, "GET": true, "MGET": true, "STRLEN": true,
+	"GETRANGE": true, "SUBSTR": true, "LCS": true, "EXISTS": true,
+	"TYPE": true, "OBJECT": true, "TTL": true, "PTTL": true, "GETBIT": true,
+	"BITCOUNT": true, "BITPOS": true, "PFCOUNT": true, "LLEN": true,
+	"LINDEX": true, "LRANGE": true, "SCARD": true, "SISMEMBER": true,
+	"SMEMBERS": true, "HGET": true, "HLEN": true, "HGETALL": true,
+	"ZCARD": true, "ZSCORE": true, "ZRANGE": true, "GEOPOS": true,
+	"GEODIST": true, "GEOHASH": true, "GEOSEARCH": true, "XLEN": true,
+	"XRANGE": true, "XREVRANGE": true, "XREAD": true, "XPENDING": true,
+	"XINFO": true, "PUBSUB": true,
+	"CLIENT ID": true, "CLIENT GETNAME": true, "CLIENT INFO": true,
+	"CLIENT LIST": true, "CLIENT GETREDIR": true, "CLIENT TRACKINGINFO": true,
+	"CONFIG GET": true, "SLOWLOG GET": true, "SLOWLOG LEN": true,
+	"LATENCY LATEST": true, "LATENCY HISTORY": true,
+}
+
+func (c *Cmd[T]) readOnly() bool {
+	if len(c.args) == 0 {
+		return false
+	}
+	name := strings.ToUpper(string(encodeArg(c.args[0])))
+	if readOnlyCommands[name] {
+		return true
+	}
+	return len(c.args) > 1 && readOnlyCommands[name+" "+strings.ToUpper(string(encodeArg(c.args[1])))]
+}
+
+// Forget the reply of a previous attempt
+func (c *Cmd[T]) reset() {
+	var zero T
+	c.val, c.err = zero, nil
+}
+
+// Encode a request as an array of bulk strings
+func encodeCommand(args []any) []byte {
+	items := make([]resp.RESPData, len(args))
+	for i, arg := range args {
+		items[i] = &resp.BulkString{Data: encodeArg(arg)}
+	}
+	return (&resp.Array{Data: items}).Encode()
+}
+
+// Format an argument the way the server parses it
+func encodeArg(arg any) []byte {
+	switch v := arg.(type) {
+	case string:
+		return []byte(v)
+	case []byte:
+		if v == nil {
+			return []byte{}
+		}
+		return v
+	case int:
+		return strconv.AppendInt(nil, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(nil, v, 10)
+	case int32:
+		return strconv.AppendInt(nil, int64(v), 10)
+	case uint64:
+		return strconv.AppendUint(nil, v, 10)
+	case float64:
+		return strconv.AppendFloat(nil, v, 'f', -1, 64)
+	case bool:
+		if v {
+			return []byte("1")
+		}
+		return []byte("0")
+	case time.Duration:
+		return strconv.AppendInt(nil, v.Milliseconds(), 10)
+	case fmt.Stringer:
+		return []byte(v.String())
+	default:
+		return fmt.Append(nil, v)
+	}
+}
+
+func isNull(reply resp.RESPData) bool {
+	switch r := reply.(type) {
+	case *resp.BulkString:
+		return r.Data == nil
+	case *resp.Array:
+		return r.Data == nil
+	case *resp.Nil:
+		return true
+	}
+	return false
+}
+
+// Elements of an array reply, Nil for a null one
+func items(reply resp.RESPData) ([]resp.RESPData, error) {
+	switch r := reply.(type) {
+	case *resp.Array:
+		if r.Data == nil {
+			return nil, Nil
+		}
+		return r.Data, nil
+	case *resp.Map:
+		return r.Data, nil
+	case *resp.Push:
+		return r.Data, nil
+	}
+	if isNull(reply) {
+		return nil, Nil
+	}
+	return nil, fmt.Errorf("medis: unexpected reply %T, want an array", reply)
+}
+
+// Convert a reply to a Go value: a string, an int64, nil, a []any or a
+// map[string]any
+func parseAny(reply resp.RESPData) (any, error) {
+	switch r := reply.(type) {
+	case *resp.SimpleString:
+		return r.Data, nil
+	case *resp.Error:
+		return Error(r.Data), nil
+	case *resp.Integer:
+		return r.Data, nil
+	case *resp.BulkString:
+		if r.Data == nil {
+			return nil, nil
+		}
+		return string(r.Data), nil
+	case *resp.Nil:
+		return nil, nil
+	case *resp.Array:
+		if r.Data == nil {
+			return nil, nil
+		}
+		return parseSlice(r)
+	case *resp.Push:
+		return parseSlice(r)
+	case *resp.Map:
+		return parseAnyMap(r)
+	}
+	return nil, fmt.Errorf("medis: unexpected reply %T", reply)
+}
+
+func parseSlice(reply resp.RESPData) ([]any, error) {
+	elems, err := items(reply)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, len(elems))
+	for i, elem := range elems {
+		if values[i], err = parseAny(elem); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// Convert a map, or an array of alternating keys and values
+func parseAnyMap(reply resp.RESPData) (map[string]any, error) {
+	elems, err := items(reply)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]any, len(elems)/2)
+	for i := 0; i+1 < len(elems); i += 2 {
+		key, err := parseString(elems[i])
+		if err != nil {
+			return nil, err
+		}
+		if values[key], err = parseAny(elems[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func parseString(reply resp.RESPData) (string, error) {
+	switch r := reply.(type) {
+	case *resp.SimpleString:
+		return r.Data, nil
+	case *resp.BulkString:
+		if r.Data == nil {
+			return "", Nil
+		}
+		return string(r.Data), nil
+	case *resp.Integer:
+		return strconv.FormatInt(r.Data, 10), nil
+	}
+	if isNull(reply) {
+		return "", Nil
+	}
+	return "", fmt.Errorf("medis: unexpected reply %T, want a string", reply)
+}
+
+func parseInt(reply resp.RESPData) (int64, error) {
+	if r, ok := reply.(*resp.Integer); ok {
+		return r.Data, nil
+	}
+	s, err := parseString(reply)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func parseFloat(reply resp.RESPData) (float64, error) {
+	s, err := parseString(reply)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// Integers are true unless zero, statuses are true and nulls are false,
+// like the null of SET NX on an existing key
+func parseBool(reply resp.RESPData) (bool, error) {
+	switch r := reply.(type) {
+	case *resp.Integer:
+		return r.Data != 0, nil
+	case *resp.SimpleString:
+		return true, nil
+	}
+	if isNull(reply) {
+		return false, nil
+	}
+	return false, fmt.Errorf("medis: unexpected reply %T, want a boolean", reply)
+}
+
+// Seconds, keeping the negative values of TTL as they are
+func parseSeconds(reply resp.RESPData) (time.Duration, error) {
+	n, err := parseInt(reply)
+	if n < 0 {
+		return time.Duration(n), err
+	}
+	return time.Duration(n) * time.Second, err
+}
+
+// Milliseconds, keeping the negative values of PTTL as they are
+func parseMilliseconds(reply resp.RESPData) (time.Duration, error) {
+	n, err := parseInt(reply)
+	if n < 0 {
+		return time.Duration(n), err
+	}
+	return time.Duration(n) * time.Millisecond, err
+}
+
+// Strings of an array, null elements are empty
+func parseStrings(reply resp.RESPData) ([]string, error) {
+	elems, err := items(reply)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, len(elems))
+	for i, elem := range elems {
+		if isNull(elem) {
+			continue
+		}
+		if values[i], err = parseString(elem); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// Strings of an array, an empty slice for a null one
+func parseOptionalStrings(reply resp.RESPData) ([]string, error) {
+	values, err := parseStrings(reply)
+	if errors.Is(err, Nil) {
+		return []string{}, nil
+	}
+	return values, err
+}
+
+func parseStringMap(reply resp.RESPData) (map[string]string, error) {
+	elems, err := items(reply)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(elems)/2)
+	for i := 0; i+1 < len(elems); i += 2 {
+		key, err := parseString(elems[i])
+		if err != nil {
+			return nil, err
+		}
+		if values[key], err = parseString(elems[i+1]); err != nil && !errors.Is(err, Nil) {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func parseIntMap(reply resp.RESPData) (map[string]int64, error) {
+	elems, err := items(reply)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]int64, len(elems)/2)
+	for i := 0; i+1 < len(elems); i += 2 {
+		key, err := parseString(elems[i])
+		if err != nil {
+			return nil, err
+		}
+		if values[key], err = parseInt(elems[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// Parse a pair of elements, nested in their own array or inline, depending
+// on the protocol
+func pairs(elems []resp.RESPData) ([][2]resp.RESPData, error) {
+	var result [][2]resp.RESPData
+	for i := 0; i < len(elems); i++ {
+		if nested, ok := elems[i].(*resp.Array); ok {
+			if len(nested.Data) != 2 {
+				return nil, fmt.Errorf("medis: unexpected pair of %d elements", len(nested.Data))
+			}
+			result = append(result, [2]resp.RESPData{nested.Data[0], nested.Data[1]})
+			continue
+		}
+		if i+1 >= len(elems) {
+			return nil, fmt.Errorf("medis: odd number of elements")
+		}
+		result = append(result, [2]resp.RESPData{elems[i], elems[i+1]})
+		i++
+	}
+	return result, nil
+}
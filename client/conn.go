@@ -0,0 +1,274 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// conn is a connection to the server, used by one goroutine at a time
+type conn struct {
+	netConn net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	onPush  func(Push)
+	broken  bool // Failed in the middle of a request, it can't be reused
+	sent    bool // Part of the last request reached the socket
+
+	// Reports whether the connection is still usable once the push
+	// messages stop being read in the background
+	watcherDone chan bool
+}
+
+// Dial and set up a connection: the protocol, the database and the name
+func dial(ctx context.Context, opts *Options) (*conn, error) {
+	dialer := net.Dialer{Timeout: opts.DialTimeout}
+	netConn, err := dialer.DialContext(ctx, opts.Network, opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{
+		netConn: netConn,
+		reader:  bufio.NewReader(netConn),
+		onPush:  opts.OnPush,
+	}
+	cn.writer = bufio.NewWriter(cn)
+
+	var setup []Cmder
+	if opts.Protocol == 3 {
+		setup = append(setup, newCmd(parseAny, "HELLO", 3))
+	}
+	if opts.DB != 0 {
+		setup = append(setup, newCmd(parseString, "SELECT", opts.DB))
+	}
+	if opts.ClientName != "" {
+		setup = append(setup, newCmd(parseString, "CLIENT", "SETNAME", opts.ClientName))
+	}
+	if len(setup) > 0 {
+		if err := cn.roundTrip(ctx, opts, setup, false); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+		for _, cmd := range setup {
+			if err := cmd.Err(); err != nil {
+				netConn.Close()
+				return nil, fmt.Errorf("medis: setting up connection: %w", err)
+			}
+		}
+	}
+	return cn, nil
+}
+
+func (cn *conn) close() error {
+	return cn.netConn.Close()
+}
+
+// Write to the connection, recording whether the server may have received
+// the request
+func (cn *conn) Write(p []byte) (int, error) {
+	n, err := cn.netConn.Write(p)
+	if n > 0 {
+		cn.sent = true
+	}
+	return n, err
+}
+
+// roundTrip sends the commands, wrapped in MULTI and EXEC for a
+// transaction, and reads their replies. The error is only set when the
+// connection failed, error replies are those of the commands.
+func (cn *conn) roundTrip(ctx context.Context, opts *Options, cmds []Cmder, tx bool) error {
+	// Canceling the context interrupts the reads and writes in progress
+	stop := context.AfterFunc(ctx, func() {
+		cn.netConn.SetDeadline(time.Unix(1, 0))
+	})
+
+	err := cn.exchange(ctx, opts, cmds, tx)
+	if !stop() {
+		// The context was canceled as the exchange ended, the deadline may
+		// be set at any time from now on: the connection can't be reused
+		cn.broken = true
+	}
+	if err != nil {
+		cn.broken = true
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		} else if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+			// The deadline of the connection was the one of the context,
+			// reached before the context knows
+			err = context.DeadlineExceeded
+		}
+		for _, cmd := range cmds {
+			if cmd.Err() == nil {
+				cmd.setReply(nil, err)
+			}
+		}
+	}
+	return err
+}
+
+func (cn *conn) exchange(ctx context.Context, opts *Options, cmds []Cmder, tx bool) error {
+	cn.sent = false
+	cn.netConn.SetWriteDeadline(deadline(ctx, opts.WriteTimeout, 0, false))
+	if tx {
+		cn.writer.Write(encodeCommand([]any{"MULTI"}))
+	}
+	for _, cmd := range cmds {
+		cn.writer.Write(encodeCommand(cmd.Args()))
+	}
+	if tx {
+		cn.writer.Write(encodeCommand([]any{"EXEC"}))
+	}
+	if err := cn.writer.Flush(); err != nil {
+		return err
+	}
+
+	// Blocking commands extend the read deadline by their timeout
+	var block time.Duration
+	var blocking bool
+	for _, cmd := range cmds {
+		if timeout, ok := cmd.readTimeout(); ok {
+			blocking = true
+			if timeout == 0 {
+				block = 0
+				break
+			}
+			block = max(block, timeout)
+		}
+	}
+	cn.netConn.SetReadDeadline(deadline(ctx, opts.ReadTimeout, block, blocking))
+
+	if tx {
+		return cn.readTx(cmds)
+	}
+	for _, cmd := range cmds {
+		reply, err := cn.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) && cmd.closesOnSuccess() {
+				cmd.setReply(&resp.SimpleString{Data: "OK"}, nil)
+				cn.broken = true
+				return nil
+			}
+			return err
+		}
+		cmd.setReply(reply, nil)
+	}
+	return nil
+}
+
+// Read the replies of a transaction: the one of MULTI, one per queued
+// command and the one of EXEC holding the replies of the commands
+func (cn *conn) readTx(cmds []Cmder) error {
+	if _, err := cn.read(); err != nil {
+		return err
+	}
+	for _, cmd := range cmds {
+		reply, err := cn.read()
+		if err != nil {
+			return err
+		}
+		// Commands that could not be queued fail the transaction
+		if _, ok := reply.(*resp.Error); ok {
+			cmd.setReply(reply, nil)
+		}
+	}
+
+	reply, err := cn.read()
+	if err != nil {
+		return err
+	}
+	switch r := reply.(type) {
+	case *resp.Error:
+		for _, cmd := range cmds {
+			if cmd.Err() == nil {
+				cmd.setReply(r, nil)
+			}
+		}
+	case *resp.Array:
+		if len(r.Data) != len(cmds) {
+			return fmt.Errorf("medis: EXEC replied with %d replies for %d commands", len(r.Data), len(cmds))
+		}
+		for i, cmd := range cmds {
+			cmd.setReply(r.Data[i], nil)
+		}
+	default:
+		return fmt.Errorf("medis: unexpected EXEC reply %T", reply)
+	}
+	return nil
+}
+
+// Read the next reply, handing the push messages read before it to onPush
+func (cn *conn) read() (resp.RESPData, error) {
+	for {
+		reply, err := readReply(cn.reader)
+		if err != nil {
+			return nil, err
+		}
+		push, ok := reply.(*resp.Push)
+		if !ok {
+			return reply, nil
+		}
+		if cn.onPush != nil {
+			cn.onPush(newPush(push))
+		}
+	}
+}
+
+// watch hands the push messages arriving while the connection is idle to
+// onPush, until unwatch
+func (cn *conn) watch() {
+	done := make(chan bool, 1)
+	cn.watcherDone = done
+	cn.netConn.SetReadDeadline(time.Time{})
+	go func() {
+		for {
+			// Wait without consuming anything, so unwatch interrupts the
+			// wait between messages
+			if _, err := cn.reader.Peek(1); err != nil {
+				done <- errors.Is(err, os.ErrDeadlineExceeded)
+				return
+			}
+			// Interrupted in the middle of a message, or a reply nobody
+			// asked for: the connection can't be reused
+			reply, err := readReply(cn.reader)
+			push, ok := reply.(*resp.Push)
+			if err != nil || !ok {
+				done <- false
+				return
+			}
+			cn.onPush(newPush(push))
+		}
+	}()
+}
+
+// unwatch stops watch before the connection is used again, and reports
+// whether it can be
+func (cn *conn) unwatch() bool {
+	if cn.watcherDone == nil {
+		return true
+	}
+	cn.netConn.SetReadDeadline(time.Now())
+	usable := <-cn.watcherDone
+	cn.watcherDone = nil
+	return usable
+}
+
+// The deadline of an operation taking up to timeout, plus block for a
+// blocking command. Zero block makes the blocking command wait forever. The
+// context deadline comes first.
+func deadline(ctx context.Context, timeout, block time.Duration, blocking bool) time.Time {
+	var t time.Time
+	if timeout > 0 && !(blocking && block == 0) {
+		t = time.Now().Add(timeout + block)
+	}
+	if d, ok := ctx.Deadline(); ok && (t.IsZero() || d.Before(t)) {
+		t = d
+	}
+	return t
+}
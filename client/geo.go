@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// GeoLocation is a member of a geospatial index
+type GeoLocation struct {
+	Name      string
+	Longitude float64
+	Latitude  float64
+}
+
+// GeoPos is the position of a member, nil in the reply of GEOPOS for the
+// missing ones
+type GeoPos struct {
+	Longitude float64
+	Latitude  float64
+}
+
+func parseGeoPos(reply resp.RESPData) ([]*GeoPos, error) {
+	elems, err := items(reply)
+	if err != nil {
+		return nil, err
+	}
+	positions := make([]*GeoPos, len(elems))
+	for i, elem := range elems {
+		if isNull(elem) {
+			continue
+		}
+		coords, err := items(elem)
+		if err != nil {
+			return nil, err
+		}
+		if len(coords) != 2 {
+			return nil, errors.New("medis: unexpected reply, want a longitude and a latitude")
+		}
+		pos := &GeoPos{}
+		if pos.Longitude, err = parseFloat(coords[0]); err != nil {
+			return nil, err
+		}
+		if pos.Latitude, err = parseFloat(coords[1]); err != nil {
+			return nil, err
+		}
+		positions[i] = pos
+	}
+	return positions, nil
+}
+
+// GeoAdd adds or updates locations, returning the number of new ones
+func (c cmdable) GeoAdd(ctx context.Context, key string, locations ...GeoLocation) *Cmd[int64] {
+	args := []any{"GEOADD", key}
+	for _, l := range locations {
+		args = append(args, l.Longitude, l.Latitude, l.Name)
+	}
+	cmd := newCmd(parseInt, args...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) GeoPos(ctx context.Context, key string, members ...string) *Cmd[[]*GeoPos] {
+	cmd := newCmd(parseGeoPos, appendStrings([]any{"GEOPOS", key}, members)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// GeoDist returns the distance between two members in unit, "m", "km",
+// "ft" or "mi". Nil when a member is missing.
+func (c cmdable) GeoDist(ctx context.Context, key, member1, member2, unit string) *Cmd[float64] {
+	if unit == "" {
+		unit = "m"
+	}
+	cmd := newCmd(parseFloat, "GEODIST", key, member1, member2, unit)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) GeoHash(ctx context.Context, key string, members ...string) *Cmd[[]string] {
+	cmd := newCmd(parseStrings, appendStrings([]any{"GEOHASH", key}, members)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// GeoSearch searches with options like "FROMMEMBER", "a", "BYRADIUS", 10,
+// "km". The members are strings, or arrays holding what WITHDIST,
+// WITHHASH and WITHCOORD ask for.
+func (c cmdable) GeoSearch(ctx context.Context, key string, opts ...any) *Cmd[[]any] {
+	cmd := newCmd(parseSlice, withArgs([]any{"GEOSEARCH", key}, opts...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// GeoSearchStore stores the members found in destination and returns their
+// number
+func (c cmdable) GeoSearchStore(ctx context.Context, destination, source string, opts ...any) *Cmd[int64] {
+	cmd := newCmd(parseInt, withArgs([]any{"GEOSEARCHSTORE", destination, source}, opts...)...)
+	c(ctx, cmd)
+	return cmd
+}
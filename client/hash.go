@@ -0,0 +1,35 @@
+package client
+
+import "context"
+
+// HSet sets fields and values given in turns, returning the number of new
+// fields
+func (c cmdable) HSet(ctx context.Context, key string, pairs ...any) *Cmd[int64] {
+	cmd := newCmd(parseInt, withArgs([]any{"HSET", key}, pairs...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) HGet(ctx context.Context, key, field string) *Cmd[string] {
+	cmd := newCmd(parseString, "HGET", key, field)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) HDel(ctx context.Context, key string, fields ...string) *Cmd[int64] {
+	cmd := newCmd(parseInt, appendStrings([]any{"HDEL", key}, fields)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) HLen(ctx context.Context, key string) *Cmd[int64] {
+	cmd := newCmd(parseInt, "HLEN", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) HGetAll(ctx context.Context, key string) *Cmd[map[string]string] {
+	cmd := newCmd(parseStringMap, "HGETALL", key)
+	c(ctx, cmd)
+	return cmd
+}
@@ -0,0 +1,35 @@
+package client
+
+import "context"
+
+// PFAdd returns 1 when the estimated cardinality changed
+func (c cmdable) PFAdd(ctx context.Context, key string, elements ...any) *Cmd[int64] {
+	cmd := newCmd(parseInt, withArgs([]any{"PFADD", key}, elements...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) PFCount(ctx context.Context, keys ...string) *Cmd[int64] {
+	cmd := newCmd(parseInt, appendStrings([]any{"PFCOUNT"}, keys)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) PFMerge(ctx context.Context, destination string, keys ...string) *Cmd[string] {
+	cmd := newCmd(parseString, appendStrings([]any{"PFMERGE", destination}, keys)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// PFDebug runs a debugging subcommand, like "GETREG", on key
+func (c cmdable) PFDebug(ctx context.Context, subcommand, key string) *Cmd[any] {
+	cmd := newCmd(parseAny, "PFDEBUG", subcommand, key)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) PFSelfTest(ctx context.Context) *Cmd[string] {
+	cmd := newCmd(parseString, "PFSELFTEST")
+	c(ctx, cmd)
+	return cmd
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+func (c cmdable) Del(ctx context.Context, keys ...string) *Cmd[int64] {
+	cmd := newCmd(parseInt, appendStrings([]any{"DEL"}, keys)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Unlink(ctx context.Context, keys ...string) *Cmd[int64] {
+	cmd := newCmd(parseInt, appendStrings([]any{"UNLINK"}, keys)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// Exists returns how many of the keys exist
+func (c cmdable) Exists(ctx context.Context, keys ...string) *Cmd[int64] {
+	cmd := newCmd(parseInt, appendStrings([]any{"EXISTS"}, keys)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Touch(ctx context.Context, keys ...string) *Cmd[int64] {
+	cmd := newCmd(parseInt, appendStrings([]any{"TOUCH"}, keys)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// Type returns the type of key, "none" when it is missing
+func (c cmdable) Type(ctx context.Context, key string) *Cmd[string] {
+	cmd := newCmd(parseString, "TYPE", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Rename(ctx context.Context, key, newKey string) *Cmd[string] {
+	cmd := newCmd(parseString, "RENAME", key, newKey)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) RenameNX(ctx context.Context, key, newKey string) *Cmd[bool] {
+	cmd := newCmd(parseBool, "RENAMENX", key, newKey)
+	c(ctx, cmd)
+	return cmd
+}
+
+// Copy copies source to destination, with options like "DB", 1 or
+// "REPLACE"
+func (c cmdable) Copy(ctx context.Context, source, destination string, opts ...any) *Cmd[bool] {
+	cmd := newCmd(parseBool, withArgs([]any{"COPY", source, destination}, opts...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// Sort returns the sorted elements of key, with options like "BY",
+// "weight_*", "LIMIT", 0, 10 or "ALPHA"
+func (c cmdable) Sort(ctx context.Context, key string, opts ...any) *Cmd[[]string] {
+	cmd := newCmd(parseStrings, withArgs([]any{"SORT", key}, opts...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// SortStore stores the sorted elements of key in destination and returns
+// their number
+func (c cmdable) SortStore(ctx context.Context, key, destination string, opts ...any) *Cmd[int64] {
+	args := withArgs([]any{"SORT", key}, opts...)
+	cmd := newCmd(parseInt, append(args, "STORE", destination)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) SortRO(ctx context.Context, key string, opts ...any) *Cmd[[]string] {
+	cmd := newCmd(parseStrings, withArgs([]any{"SORT_RO", key}, opts...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ObjectEncoding(ctx context.Context, key string) *Cmd[string] {
+	cmd := newCmd(parseString, "OBJECT", "ENCODING", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ObjectIdleTime(ctx context.Context, key string) *Cmd[time.Duration] {
+	cmd := newCmd(parseSeconds, "OBJECT", "IDLETIME", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ObjectRefCount(ctx context.Context, key string) *Cmd[int64] {
+	cmd := newCmd(parseInt, "OBJECT", "REFCOUNT", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+// TTL returns the time to live of key, -1 when it does not expire and -2
+// when it is missing
+func (c cmdable) TTL(ctx context.Context, key string) *Cmd[time.Duration] {
+	cmd := newCmd(parseSeconds, "TTL", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+// PTTL is TTL with a millisecond precision
+func (c cmdable) PTTL(ctx context.Context, key string) *Cmd[time.Duration] {
+	cmd := newCmd(parseMilliseconds, "PTTL", key)
+	c(ctx, cmd)
+	return cmd
+}
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// KeyValues are the elements popped from a key by LMPOP
+type KeyValues struct {
+	Key    string
+	Values []string
+}
+
+// Parse [key, [elements]]
+func parseKeyValues(reply resp.RESPData) (KeyValues, error) {
+	elems, err := items(reply)
+	if err != nil {
+		return KeyValues{}, err
+	}
+	if len(elems) != 2 {
+		return KeyValues{}, errors.New("medis: unexpected reply, want a key and its elements")
+	}
+	key, err := parseString(elems[0])
+	if err != nil {
+		return KeyValues{}, err
+	}
+	values, err := parseStrings(elems[1])
+	return KeyValues{Key: key, Values: values}, err
+}
+
+// The timeout of a blocking command in seconds, zero blocks forever
+func blockSeconds(timeout time.Duration) float64 {
+	return timeout.Seconds()
+}
+
+func (c cmdable) LPush(ctx context.Context, key string, values ...any) *Cmd[int64] {
+	cmd := newCmd(parseInt, withArgs([]any{"LPUSH", key}, values...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) RPush(ctx context.Context, key string, values ...any) *Cmd[int64] {
+	cmd := newCmd(parseInt, withArgs([]any{"RPUSH", key}, values...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) LPop(ctx context.Context, key string) *Cmd[string] {
+	cmd := newCmd(parseString, "LPOP", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) LPopCount(ctx context.Context, key string, count int64) *Cmd[[]string] {
+	cmd := newCmd(parseStrings, "LPOP", key, count)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) RPop(ctx context.Context, key string) *Cmd[string] {
+	cmd := newCmd(parseString, "RPOP", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) RPopCount(ctx context.Context, key string, count int64) *Cmd[[]string] {
+	cmd := newCmd(parseStrings, "RPOP", key, count)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) LLen(ctx context.Context, key string) *Cmd[int64] {
+	cmd := newCmd(parseInt, "LLEN", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) LIndex(ctx context.Context, key string, index int64) *Cmd[string] {
+	cmd := newCmd(parseString, "LINDEX", key, index)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) LRange(ctx context.Context, key string, start, stop int64) *Cmd[[]string] {
+	cmd := newCmd(parseStrings, "LRANGE", key, start, stop)
+	c(ctx, cmd)
+	return cmd
+}
+
+// LMove moves an element between lists, from and to are "LEFT" or "RIGHT"
+func (c cmdable) LMove(ctx context.Context, source, destination, from, to string) *Cmd[string] {
+	cmd := newCmd(parseString, "LMOVE", source, destination, from, to)
+	c(ctx, cmd)
+	return cmd
+}
+
+// LMPop pops up to count elements from the first non empty list of keys,
+// from the "LEFT" or the "RIGHT"
+func (c cmdable) LMPop(ctx context.Context, direction string, count int64, keys ...string) *Cmd[KeyValues] {
+	args := appendStrings([]any{"LMPOP", len(keys)}, keys)
+	cmd := newCmd(parseKeyValues, append(args, direction, "COUNT", count)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// BLPop waits for up to timeout for an element to pop, forever when zero.
+// The reply holds the key and the element, Nil on timeout.
+func (c cmdable) BLPop(ctx context.Context, timeout time.Duration, keys ...string) *Cmd[[]string] {
+	args := appendStrings([]any{"BLPOP"}, keys)
+	cmd := newBlockingCmd(timeout, parseStrings, append(args, blockSeconds(timeout))...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) BRPop(ctx context.Context, timeout time.Duration, keys ...string) *Cmd[[]string] {
+	args := appendStrings([]any{"BRPOP"}, keys)
+	cmd := newBlockingCmd(timeout, parseStrings, append(args, blockSeconds(timeout))...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) BLMove(ctx context.Context, source, destination, from, to string, timeout time.Duration) *Cmd[string] {
+	cmd := newBlockingCmd(timeout, parseString, "BLMOVE", source, destination, from, to, blockSeconds(timeout))
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) BLMPop(ctx context.Context, timeout time.Duration, direction string, count int64, keys ...string) *Cmd[KeyValues] {
+	args := appendStrings([]any{"BLMPOP", blockSeconds(timeout), len(keys)}, keys)
+	cmd := newBlockingCmd(timeout, parseKeyValues, append(args, direction, "COUNT", count)...)
+	c(ctx, cmd)
+	return cmd
+}
@@ -0,0 +1,86 @@
+package client
+
+import "context"
+
+// Pipeline queues commands to send them at once, in a transaction for a
+// pipeline made by TxPipeline. The typed helpers return commands that get
+// their reply on Exec.
+type Pipeline struct {
+	cmdable
+	client *Client
+	tx     bool
+	cmds   []Cmder
+}
+
+// Pipeline returns a pipeline running its commands on a pooled connection
+func (c *Client) Pipeline() *Pipeline {
+	p := &Pipeline{client: c}
+	p.cmdable = p.queue
+	return p
+}
+
+// TxPipeline returns a pipeline running its commands in MULTI and EXEC
+func (c *Client) TxPipeline() *Pipeline {
+	p := c.Pipeline()
+	p.tx = true
+	return p
+}
+
+// Pipelined runs the commands fn queues, in a single round trip
+func (c *Client) Pipelined(ctx context.Context, fn func(p *Pipeline) error) ([]Cmder, error) {
+	return c.pipelined(ctx, c.Pipeline(), fn)
+}
+
+// TxPipelined runs the commands fn queues in a transaction
+func (c *Client) TxPipelined(ctx context.Context, fn func(p *Pipeline) error) ([]Cmder, error) {
+	return c.pipelined(ctx, c.TxPipeline(), fn)
+}
+
+func (c *Client) pipelined(ctx context.Context, p *Pipeline, fn func(p *Pipeline) error) ([]Cmder, error) {
+	if err := fn(p); err != nil {
+		return nil, err
+	}
+	return p.Exec(ctx)
+}
+
+func (p *Pipeline) queue(ctx context.Context, cmd Cmder) {
+	p.cmds = append(p.cmds, cmd)
+}
+
+// Do queues any command, like Client.Do
+func (p *Pipeline) Do(ctx context.Context, args ...any) *Cmd[any] {
+	cmd := newCmd(parseAny, args...)
+	p.queue(ctx, cmd)
+	return cmd
+}
+
+// Len returns the number of commands queued
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// Discard forgets the commands queued
+func (p *Pipeline) Discard() {
+	p.cmds = nil
+}
+
+// Exec runs the commands queued and empties the pipeline. The error is the
+// one of the connection, or else the first error of the commands. In a
+// transaction, a command that could not be queued fails them all with
+// EXECABORT.
+func (p *Pipeline) Exec(ctx context.Context) ([]Cmder, error) {
+	cmds := p.cmds
+	p.cmds = nil
+	if len(cmds) == 0 {
+		return cmds, nil
+	}
+	if err := p.client.processCmds(ctx, cmds, p.tx); err != nil {
+		return cmds, err
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			return cmds, err
+		}
+	}
+	return cmds, nil
+}
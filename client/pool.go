@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"sync"
+)
+
+// pool holds the idle connections and limits the open ones
+type pool struct {
+	dial   func(ctx context.Context) (*conn, error)
+	tokens chan struct{} // One per open connection
+	idle   chan *conn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newPool(size int, dial func(ctx context.Context) (*conn, error)) *pool {
+	return &pool{
+		dial:   dial,
+		tokens: make(chan struct{}, size),
+		idle:   make(chan *conn, size),
+	}
+}
+
+// get returns an idle connection, or a new one while the pool is not full
+func (p *pool) get(ctx context.Context) (*conn, error) {
+	for {
+		cn, err := p.take(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if cn.unwatch() {
+			return cn, nil
+		}
+		// The connection failed while idle
+		p.remove(cn)
+	}
+}
+
+func (p *pool) take(ctx context.Context) (*conn, error) {
+	if p.isClosed() {
+		return nil, ErrClosed
+	}
+
+	// Idle connections come first
+	select {
+	case cn := <-p.idle:
+		return cn, nil
+	default:
+	}
+
+	select {
+	case cn := <-p.idle:
+		return cn, nil
+	case p.tokens <- struct{}{}:
+		cn, err := p.dial(ctx)
+		if err != nil {
+			<-p.tokens
+			return nil, err
+		}
+		return cn, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// put hands a connection back, closing it when it failed or the pool is
+// closed. The push messages it receives while idle are read right away.
+func (p *pool) put(cn *conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cn.broken || p.closed {
+		p.remove(cn)
+		return
+	}
+	if cn.onPush != nil {
+		cn.watch()
+	}
+	p.idle <- cn
+}
+
+func (p *pool) remove(cn *conn) {
+	cn.close()
+	<-p.tokens
+}
+
+// dropIdle closes the idle connections
+func (p *pool) dropIdle() {
+	for {
+		select {
+		case cn := <-p.idle:
+			p.remove(cn)
+		default:
+			return
+		}
+	}
+}
+
+func (p *pool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// close closes the idle connections, and the others once they are put back
+func (p *pool) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.dropIdle()
+}
@@ -0,0 +1,358 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// Publish sends message to the subscribers of channel and returns their
+// number
+func (c cmdable) Publish(ctx context.Context, channel string, message any) *Cmd[int64] {
+	cmd := newCmd(parseInt, "PUBLISH", channel, message)
+	c(ctx, cmd)
+	return cmd
+}
+
+// PubSubChannels returns the channels with subscribers, matching pattern
+// unless empty
+func (c cmdable) PubSubChannels(ctx context.Context, pattern string) *Cmd[[]string] {
+	args := []any{"PUBSUB", "CHANNELS"}
+	if pattern != "" {
+		args = append(args, pattern)
+	}
+	cmd := newCmd(parseStrings, args...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// PubSubNumSub returns the number of subscribers of each channel
+func (c cmdable) PubSubNumSub(ctx context.Context, channels ...string) *Cmd[map[string]int64] {
+	cmd := newCmd(parseIntMap, appendStrings([]any{"PUBSUB", "NUMSUB"}, channels)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// PubSubNumPat returns the number of patterns subscribed to
+func (c cmdable) PubSubNumPat(ctx context.Context) *Cmd[int64] {
+	cmd := newCmd(parseInt, "PUBSUB", "NUMPAT")
+	c(ctx, cmd)
+	return cmd
+}
+
+// Message is a message published to a channel, Pattern is the one it
+// matched for a pattern subscription
+type Message struct {
+	Channel string
+	Pattern string
+	Payload string
+}
+
+// PubSub receives the messages of channels and patterns on its own
+// connection, outside of the pool. When the connection fails, it connects
+// again and subscribes to them again, the messages published meanwhile are
+// lost.
+type PubSub struct {
+	client *Client
+	msgs   chan *Message
+	done   chan struct{}
+
+	mu       sync.Mutex
+	cn       *conn
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	// Subscriptions waiting to be acknowledged, by kind and name
+	waiters map[string][]chan struct{}
+	closed  bool
+}
+
+// Subscribe returns a PubSub subscribed to channels
+func (c *Client) Subscribe(ctx context.Context, channels ...string) (*PubSub, error) {
+	ps, err := c.newPubSub(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) > 0 {
+		if err := ps.Subscribe(ctx, channels...); err != nil {
+			ps.Close()
+			return nil, err
+		}
+	}
+	return ps, nil
+}
+
+// PSubscribe returns a PubSub subscribed to patterns
+func (c *Client) PSubscribe(ctx context.Context, patterns ...string) (*PubSub, error) {
+	ps, err := c.newPubSub(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) > 0 {
+		if err := ps.PSubscribe(ctx, patterns...); err != nil {
+			ps.Close()
+			return nil, err
+		}
+	}
+	return ps, nil
+}
+
+func (c *Client) newPubSub(ctx context.Context) (*PubSub, error) {
+	if c.pool.isClosed() {
+		return nil, ErrClosed
+	}
+	cn, err := dial(ctx, &c.opts)
+	if err != nil {
+		return nil, err
+	}
+	// Messages arrive at any time, the reads have no deadline
+	cn.netConn.SetReadDeadline(time.Time{})
+	ps := &PubSub{
+		client:   c,
+		msgs:     make(chan *Message, 100),
+		done:     make(chan struct{}),
+		cn:       cn,
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+		waiters:  make(map[string][]chan struct{}),
+	}
+	go ps.receive(cn)
+	return ps, nil
+}
+
+// Subscribe subscribes to channels, once the server acknowledged them
+func (ps *PubSub) Subscribe(ctx context.Context, channels ...string) error {
+	return ps.subscribe(ctx, "subscribe", ps.channels, channels)
+}
+
+// PSubscribe subscribes to patterns, once the server acknowledged them
+func (ps *PubSub) PSubscribe(ctx context.Context, patterns ...string) error {
+	return ps.subscribe(ctx, "psubscribe", ps.patterns, patterns)
+}
+
+// Unsubscribe unsubscribes from channels, from all of them by default
+func (ps *PubSub) Unsubscribe(ctx context.Context, channels ...string) error {
+	return ps.unsubscribe(ctx, "unsubscribe", ps.channels, channels)
+}
+
+// PUnsubscribe unsubscribes from patterns, from all of them by default
+func (ps *PubSub) PUnsubscribe(ctx context.Context, patterns ...string) error {
+	return ps.unsubscribe(ctx, "punsubscribe", ps.patterns, patterns)
+}
+
+// Channel returns the channel receiving the messages, closed by Close
+func (ps *PubSub) Channel() <-chan *Message {
+	return ps.msgs
+}
+
+// Close closes the connection and the channel of messages
+func (ps *PubSub) Close() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.closed {
+		return nil
+	}
+	ps.closed = true
+	close(ps.done)
+	return ps.cn.close()
+}
+
+func (ps *PubSub) subscribe(ctx context.Context, kind string, set map[string]struct{}, names []string) error {
+	ps.mu.Lock()
+	if ps.closed {
+		ps.mu.Unlock()
+		return ErrClosed
+	}
+	waits := make([]chan struct{}, len(names))
+	for i, name := range names {
+		set[name] = struct{}{}
+		waits[i] = make(chan struct{})
+		key := kind + ":" + name
+		ps.waiters[key] = append(ps.waiters[key], waits[i])
+	}
+	// A write failing on a broken connection is not an error: the
+	// subscriptions are sent again once connected
+	ps.write(ctx, strings.ToUpper(kind), names)
+	ps.mu.Unlock()
+
+	for _, wait := range waits {
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ps.done:
+			return ErrClosed
+		}
+	}
+	return nil
+}
+
+func (ps *PubSub) unsubscribe(ctx context.Context, kind string, set map[string]struct{}, names []string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.closed {
+		return ErrClosed
+	}
+	if len(names) == 0 {
+		clear(set)
+	}
+	for _, name := range names {
+		delete(set, name)
+	}
+	ps.write(ctx, strings.ToUpper(kind), names)
+	return nil
+}
+
+// Send a command on the connection, with ps.mu held
+func (ps *PubSub) write(ctx context.Context, name string, args []string) error {
+	cn := ps.cn
+	cn.netConn.SetWriteDeadline(deadline(ctx, ps.client.opts.WriteTimeout, 0, false))
+	cn.writer.Write(encodeCommand(appendStrings([]any{name}, args)))
+	return cn.writer.Flush()
+}
+
+// Read the messages of cn until it fails, then connect again
+func (ps *PubSub) receive(cn *conn) {
+	for {
+		reply, err := readReply(cn.reader)
+		if err != nil {
+			cn.close()
+			if cn = ps.reconnect(); cn == nil {
+				close(ps.msgs)
+				return
+			}
+			continue
+		}
+		msg := ps.handle(reply)
+		if msg == nil {
+			continue
+		}
+		select {
+		case ps.msgs <- msg:
+		case <-ps.done:
+		}
+	}
+}
+
+// Handle a reply, returning the message it holds
+func (ps *PubSub) handle(reply resp.RESPData) *Message {
+	values, err := parseStrings(reply)
+	if err != nil || len(values) == 0 {
+		return nil
+	}
+	switch kind := strings.ToLower(values[0]); kind {
+	case "message":
+		if len(values) == 3 {
+			return &Message{Channel: values[1], Payload: values[2]}
+		}
+	case "pmessage":
+		if len(values) == 4 {
+			return &Message{Pattern: values[1], Channel: values[2], Payload: values[3]}
+		}
+	case "subscribe", "psubscribe":
+		if len(values) >= 2 {
+			key := kind + ":" + values[1]
+			ps.mu.Lock()
+			for _, wait := range ps.waiters[key] {
+				close(wait)
+			}
+			delete(ps.waiters, key)
+			ps.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// Connect again and subscribe to the channels and patterns again, until it
+// works or the PubSub is closed, which returns nil
+func (ps *PubSub) reconnect() *conn {
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-time.After(retryBackoff(attempt)):
+		case <-ps.done:
+			return nil
+		}
+		cn, err := dial(context.Background(), &ps.client.opts)
+		if err != nil {
+			continue
+		}
+		cn.netConn.SetReadDeadline(time.Time{})
+
+		ps.mu.Lock()
+		if ps.closed {
+			ps.mu.Unlock()
+			cn.close()
+			return nil
+		}
+		ps.cn = cn
+		err = nil
+		if len(ps.channels) > 0 {
+			err = ps.write(context.Background(), "SUBSCRIBE", keys(ps.channels))
+		}
+		if err == nil && len(ps.patterns) > 0 {
+			err = ps.write(context.Background(), "PSUBSCRIBE", keys(ps.patterns))
+		}
+		ps.mu.Unlock()
+		if err != nil {
+			cn.close()
+			continue
+		}
+		return cn
+	}
+}
+
+func keys(set map[string]struct{}) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Monitor streams the commands the server runs, as MONITOR prints them, on
+// its own connection until ctx is done
+func (c *Client) Monitor(ctx context.Context) (<-chan string, error) {
+	if c.pool.isClosed() {
+		return nil, ErrClosed
+	}
+	cn, err := dial(ctx, &c.opts)
+	if err != nil {
+		return nil, err
+	}
+	cmd := newCmd(parseString, "MONITOR")
+	if err := cn.roundTrip(ctx, &c.opts, []Cmder{cmd}, false); err != nil {
+		cn.close()
+		return nil, err
+	}
+	if err := cmd.Err(); err != nil {
+		cn.close()
+		return nil, err
+	}
+	cn.netConn.SetReadDeadline(time.Time{})
+
+	lines := make(chan string, 100)
+	stop := context.AfterFunc(ctx, func() { cn.close() })
+	go func() {
+		defer close(lines)
+		defer stop()
+		defer cn.close()
+		for {
+			reply, err := cn.read()
+			if err != nil {
+				return
+			}
+			line, err := parseString(reply)
+			if err != nil {
+				continue
+			}
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return lines, nil
+}
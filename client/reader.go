@@ -0,0 +1,136 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// readReply reads the next reply. The RESP3 types without a counterpart in
+// package resp are read as the closest RESP2 one: null as a null bulk
+// string, doubles, big numbers and verbatim strings as bulk strings,
+// booleans as integers and sets as arrays. Attributes are skipped.
+func readReply(r *bufio.Reader) (resp.RESPData, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("medis: empty reply line")
+	}
+
+	switch prefix, payload := line[0], string(line[1:]); prefix {
+	case resp.SimpleStringPrefix:
+		return &resp.SimpleString{Data: payload}, nil
+	case resp.ErrorPrefix:
+		return &resp.Error{Data: payload}, nil
+	case resp.IntegerPrefix:
+		n, err := strconv.ParseInt(payload, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("medis: invalid integer reply %q", payload)
+		}
+		return &resp.Integer{Data: n}, nil
+	case '_':
+		return &resp.BulkString{}, nil
+	case ',', '(':
+		return &resp.BulkString{Data: []byte(payload)}, nil
+	case '#':
+		if payload == "t" {
+			return &resp.Integer{Data: 1}, nil
+		}
+		return &resp.Integer{Data: 0}, nil
+	case resp.BulkStringPrefix, '=', '!':
+		data, err := readBulk(r, payload)
+		if err != nil || data == nil {
+			return &resp.BulkString{}, err
+		}
+		switch prefix {
+		case '=':
+			// Verbatim strings start with their format, like "txt:"
+			if len(data) >= 4 {
+				data = data[4:]
+			}
+		case '!':
+			return &resp.Error{Data: string(data)}, nil
+		}
+		return &resp.BulkString{Data: data}, nil
+	case resp.ArrayPrefix, '~', resp.PushPrefix:
+		items, err := readItems(r, payload, 1)
+		if err != nil {
+			return nil, err
+		}
+		if prefix == resp.PushPrefix {
+			return &resp.Push{Data: items}, nil
+		}
+		return &resp.Array{Data: items}, nil
+	case resp.MapPrefix:
+		items, err := readItems(r, payload, 2)
+		if err != nil {
+			return nil, err
+		}
+		return &resp.Map{Data: items}, nil
+	case '|':
+		// Attributes describe the reply that follows them
+		if _, err := readItems(r, payload, 2); err != nil {
+			return nil, err
+		}
+		return readReply(r)
+	default:
+		return nil, fmt.Errorf("medis: unknown reply type %q", prefix)
+	}
+}
+
+// Read a line without its CRLF
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, fmt.Errorf("medis: reply line too long")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("medis: invalid reply line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+// Read the payload of a bulk string of the given length, nil for a null one
+func readBulk(r *bufio.Reader, length string) ([]byte, error) {
+	n, err := strconv.Atoi(length)
+	if err != nil || n < -1 {
+		return nil, fmt.Errorf("medis: invalid bulk length %q", length)
+	}
+	if n == -1 {
+		return nil, nil
+	}
+	data := make([]byte, n+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+// Read the elements of an aggregate of the given length, times per
+// element for maps. A null aggregate has nil elements.
+func readItems(r *bufio.Reader, length string, times int) ([]resp.RESPData, error) {
+	n, err := strconv.Atoi(length)
+	if err != nil || n < -1 {
+		return nil, fmt.Errorf("medis: invalid aggregate length %q", length)
+	}
+	if n == -1 {
+		return nil, nil
+	}
+	items := make([]resp.RESPData, 0, min(n*times, 1024))
+	for range n * times {
+		item, err := readReply(r)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,289 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// SlowLog is an entry of the slow log
+type SlowLog struct {
+	ID         int64
+	Time       time.Time
+	Duration   time.Duration
+	Args       []string
+	ClientAddr string
+	ClientName string
+}
+
+func parseSlowLogs(reply resp.RESPData) ([]SlowLog, error) {
+	elems, err := items(reply)
+	if err != nil {
+		return nil, err
+	}
+	logs := make([]SlowLog, len(elems))
+	for i, elem := range elems {
+		fields, err := items(elem)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) != 6 {
+			return nil, errors.New("medis: unexpected slow log entry")
+		}
+		l := &logs[i]
+		if l.ID, err = parseInt(fields[0]); err != nil {
+			return nil, err
+		}
+		unix, err := parseInt(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		l.Time = time.Unix(unix, 0)
+		micros, err := parseInt(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		l.Duration = time.Duration(micros) * time.Microsecond
+		if l.Args, err = parseStrings(fields[3]); err != nil {
+			return nil, err
+		}
+		if l.ClientAddr, err = parseString(fields[4]); err != nil {
+			return nil, err
+		}
+		if l.ClientName, err = parseString(fields[5]); err != nil {
+			return nil, err
+		}
+	}
+	return logs, nil
+}
+
+// Ping returns "PONG", or message when given
+func (c cmdable) Ping(ctx context.Context, message ...string) *Cmd[string] {
+	cmd := newCmd(parseString, appendStrings([]any{"PING"}, message)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// Info returns the sections of INFO, all of them by default
+func (c cmdable) Info(ctx context.Context, sections ...string) *Cmd[string] {
+	cmd := newCmd(parseString, appendStrings([]any{"INFO"}, sections)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// ConfigGet returns the options matching pattern and their value
+func (c cmdable) ConfigGet(ctx context.Context, pattern string) *Cmd[map[string]string] {
+	cmd := newCmd(parseStringMap, "CONFIG", "GET", pattern)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ConfigSet(ctx context.Context, option, value string) *Cmd[string] {
+	cmd := newCmd(parseString, "CONFIG", "SET", option, value)
+	c(ctx, cmd)
+	return cmd
+}
+
+// SlowLogGet returns the count latest entries of the slow log, -1 for all
+func (c cmdable) SlowLogGet(ctx context.Context, count int64) *Cmd[[]SlowLog] {
+	cmd := newCmd(parseSlowLogs, "SLOWLOG", "GET", count)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) SlowLogLen(ctx context.Context) *Cmd[int64] {
+	cmd := newCmd(parseInt, "SLOWLOG", "LEN")
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) SlowLogReset(ctx context.Context) *Cmd[string] {
+	cmd := newCmd(parseString, "SLOWLOG", "RESET")
+	c(ctx, cmd)
+	return cmd
+}
+
+// LatencyLatest returns, per event, its name, the time and latency of its
+// latest sample and its highest latency
+func (c cmdable) LatencyLatest(ctx context.Context) *Cmd[[]any] {
+	cmd := newCmd(parseSlice, "LATENCY", "LATEST")
+	c(ctx, cmd)
+	return cmd
+}
+
+// LatencyHistory returns the time and latency of the samples of event
+func (c cmdable) LatencyHistory(ctx context.Context, event string) *Cmd[[]any] {
+	cmd := newCmd(parseSlice, "LATENCY", "HISTORY", event)
+	c(ctx, cmd)
+	return cmd
+}
+
+// LatencyReset forgets the samples of events, of every event by default
+func (c cmdable) LatencyReset(ctx context.Context, events ...string) *Cmd[int64] {
+	cmd := newCmd(parseInt, appendStrings([]any{"LATENCY", "RESET"}, events)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) LatencyGraph(ctx context.Context, event string) *Cmd[string] {
+	cmd := newCmd(parseString, "LATENCY", "GRAPH", event)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) LatencyDoctor(ctx context.Context) *Cmd[string] {
+	cmd := newCmd(parseString, "LATENCY", "DOCTOR")
+	c(ctx, cmd)
+	return cmd
+}
+
+// Shutdown stops the server, with options like "NOW" or "NOSAVE". The
+// connection closes instead of a reply, which is reported as "OK".
+func (c cmdable) Shutdown(ctx context.Context, opts ...any) *Cmd[string] {
+	cmd := newCmd(parseString, withArgs([]any{"SHUTDOWN"}, opts...)...)
+	cmd.closeIsSuccess = true
+	c(ctx, cmd)
+	return cmd
+}
+
+// ClientID returns the ID of the connection running the command
+func (c cmdable) ClientID(ctx context.Context) *Cmd[int64] {
+	cmd := newCmd(parseInt, "CLIENT", "ID")
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ClientGetName(ctx context.Context) *Cmd[string] {
+	cmd := newCmd(parseString, "CLIENT", "GETNAME")
+	c(ctx, cmd)
+	return cmd
+}
+
+// ClientList lists the connections, with options like "TYPE", "pubsub"
+func (c cmdable) ClientList(ctx context.Context, opts ...any) *Cmd[string] {
+	cmd := newCmd(parseString, withArgs([]any{"CLIENT", "LIST"}, opts...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ClientInfo(ctx context.Context) *Cmd[string] {
+	cmd := newCmd(parseString, "CLIENT", "INFO")
+	c(ctx, cmd)
+	return cmd
+}
+
+// ClientKill closes the connections matching filters like "ID", 12 and
+// returns their number
+func (c cmdable) ClientKill(ctx context.Context, filters ...any) *Cmd[int64] {
+	cmd := newCmd(parseInt, withArgs([]any{"CLIENT", "KILL"}, filters...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// ClientPause suspends the clients for d, with options like "WRITE"
+func (c cmdable) ClientPause(ctx context.Context, d time.Duration, opts ...any) *Cmd[string] {
+	cmd := newCmd(parseString, withArgs([]any{"CLIENT", "PAUSE", d.Milliseconds()}, opts...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ClientUnpause(ctx context.Context) *Cmd[string] {
+	cmd := newCmd(parseString, "CLIENT", "UNPAUSE")
+	c(ctx, cmd)
+	return cmd
+}
+
+// ClientUnblock releases a client blocked in a command, as if it timed out
+// unless "ERROR" is given
+func (c cmdable) ClientUnblock(ctx context.Context, id int64, opts ...any) *Cmd[bool] {
+	cmd := newCmd(parseBool, withArgs([]any{"CLIENT", "UNBLOCK", id}, opts...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ClientGetRedir(ctx context.Context) *Cmd[int64] {
+	cmd := newCmd(parseInt, "CLIENT", "GETREDIR")
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ClientTrackingInfo(ctx context.Context) *Cmd[map[string]any] {
+	cmd := newCmd(parseAnyMap, "CLIENT", "TRACKINGINFO")
+	c(ctx, cmd)
+	return cmd
+}
+
+// statefulCmdable runs the commands changing the state of a connection,
+// which are only available on a Conn
+type statefulCmdable func(ctx context.Context, cmd Cmder)
+
+func (c statefulCmdable) Select(ctx context.Context, db int) *Cmd[string] {
+	cmd := newCmd(parseString, "SELECT", db)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c statefulCmdable) Hello(ctx context.Context, protocol int) *Cmd[map[string]any] {
+	cmd := newCmd(parseAnyMap, "HELLO", protocol)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c statefulCmdable) ClientSetName(ctx context.Context, name string) *Cmd[string] {
+	cmd := newCmd(parseString, "CLIENT", "SETNAME", name)
+	c(ctx, cmd)
+	return cmd
+}
+
+// ClientSetInfo sets an attribute, "LIB-NAME" or "LIB-VER"
+func (c statefulCmdable) ClientSetInfo(ctx context.Context, attribute, value string) *Cmd[string] {
+	cmd := newCmd(parseString, "CLIENT", "SETINFO", attribute, value)
+	c(ctx, cmd)
+	return cmd
+}
+
+// ClientTracking turns tracking on or off, with options like "BCAST" or
+// "PREFIX", "user:"
+func (c statefulCmdable) ClientTracking(ctx context.Context, on bool, opts ...any) *Cmd[string] {
+	mode := "OFF"
+	if on {
+		mode = "ON"
+	}
+	cmd := newCmd(parseString, withArgs([]any{"CLIENT", "TRACKING", mode}, opts...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c statefulCmdable) ClientCaching(ctx context.Context, yes bool) *Cmd[string] {
+	cmd := newCmd(parseString, "CLIENT", "CACHING", yesNo(yes))
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c statefulCmdable) ClientNoEvict(ctx context.Context, on bool) *Cmd[string] {
+	cmd := newCmd(parseString, "CLIENT", "NO-EVICT", onOff(on))
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c statefulCmdable) ClientNoTouch(ctx context.Context, on bool) *Cmd[string] {
+	cmd := newCmd(parseString, "CLIENT", "NO-TOUCH", onOff(on))
+	c(ctx, cmd)
+	return cmd
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "YES"
+	}
+	return "NO"
+}
+
+func onOff(b bool) string {
+	if b {
+		return "ON"
+	}
+	return "OFF"
+}
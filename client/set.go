@@ -0,0 +1,33 @@
+package client
+
+import "context"
+
+func (c cmdable) SAdd(ctx context.Context, key string, members ...any) *Cmd[int64] {
+	cmd := newCmd(parseInt, withArgs([]any{"SADD", key}, members...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) SRem(ctx context.Context, key string, members ...any) *Cmd[int64] {
+	cmd := newCmd(parseInt, withArgs([]any{"SREM", key}, members...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) SCard(ctx context.Context, key string) *Cmd[int64] {
+	cmd := newCmd(parseInt, "SCARD", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) SIsMember(ctx context.Context, key string, member any) *Cmd[bool] {
+	cmd := newCmd(parseBool, "SISMEMBER", key, member)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) SMembers(ctx context.Context, key string) *Cmd[[]string] {
+	cmd := newCmd(parseStrings, "SMEMBERS", key)
+	c(ctx, cmd)
+	return cmd
+}
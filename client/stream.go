@@ -0,0 +1,491 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// XMessage is an entry of a stream. Values is nil for the entries deleted
+// while pending in a consumer group.
+type XMessage struct {
+	ID     string
+	Values map[string]string
+}
+
+// XStream holds the entries read from a stream
+type XStream struct {
+	Stream   string
+	Messages []XMessage
+}
+
+// XAddArgs are the arguments of XADD. The stream is trimmed when MaxLen or
+// MinID is set, with ~ when Approx is set.
+type XAddArgs struct {
+	Stream     string
+	NoMkStream bool
+	MaxLen     int64
+	MinID      string
+	Approx     bool
+	Limit      int64
+	ID         string // "*", the default, to generate it
+	Values     []any  // Fields and values in turns
+}
+
+// XReadArgs are the arguments of XREAD. Block waits for entries for up to
+// that long when positive, forever when negative.
+type XReadArgs struct {
+	Streams []string // Keys, followed by as many IDs
+	Count   int64
+	Block   time.Duration
+}
+
+// XReadGroupArgs are the arguments of XREADGROUP, Block is the one of
+// XReadArgs
+type XReadGroupArgs struct {
+	Group    string
+	Consumer string
+	Streams  []string // Keys, followed by as many IDs
+	Count    int64
+	Block    time.Duration
+	NoAck    bool
+}
+
+// XPending is the summary of the entries pending in a consumer group
+type XPending struct {
+	Count     int64
+	Lower     string
+	Higher    string
+	Consumers map[string]int64
+}
+
+// XPendingExtArgs select the pending entries XPendingExt returns
+type XPendingExtArgs struct {
+	Stream   string
+	Group    string
+	Idle     time.Duration
+	Start    string
+	End      string
+	Count    int64
+	Consumer string
+}
+
+// XPendingExt is an entry pending in a consumer group
+type XPendingExt struct {
+	ID         string
+	Consumer   string
+	Idle       time.Duration
+	RetryCount int64
+}
+
+// XClaimArgs are the arguments of XCLAIM
+type XClaimArgs struct {
+	Stream   string
+	Group    string
+	Consumer string
+	MinIdle  time.Duration
+	Messages []string
+}
+
+// XAutoClaimArgs are the arguments of XAUTOCLAIM
+type XAutoClaimArgs struct {
+	Stream   string
+	Group    string
+	Consumer string
+	MinIdle  time.Duration
+	Start    string
+	Count    int64
+}
+
+// XAutoClaimResult holds the entries claimed, the ID to continue from and
+// the IDs of the pending entries deleted from the stream
+type XAutoClaimResult struct {
+	Next     string
+	Messages []XMessage
+	Deleted  []string
+}
+
+func parseXMessage(reply resp.RESPData) (XMessage, error) {
+	elems, err := items(reply)
+	if err != nil {
+		return XMessage{}, err
+	}
+	if len(elems) != 2 {
+		return XMessage{}, errors.New("medis: unexpected reply, want an entry ID and its fields")
+	}
+	id, err := parseString(elems[0])
+	if err != nil {
+		return XMessage{}, err
+	}
+	if isNull(elems[1]) {
+		return XMessage{ID: id}, nil
+	}
+	values, err := parseStringMap(elems[1])
+	return XMessage{ID: id, Values: values}, err
+}
+
+func parseXMessages(reply resp.RESPData) ([]XMessage, error) {
+	elems, err := items(reply)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]XMessage, len(elems))
+	for i, elem := range elems {
+		if messages[i], err = parseXMessage(elem); err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
+// Parse the streams of XREAD, an array of [key, entries] or a map. Nil
+// when the command timed out.
+func parseXStreams(reply resp.RESPData) ([]XStream, error) {
+	elems, err := items(reply)
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := pairs(elems)
+	if err != nil {
+		return nil, err
+	}
+	streams := make([]XStream, len(pairs))
+	for i, pair := range pairs {
+		if streams[i].Stream, err = parseString(pair[0]); err != nil {
+			return nil, err
+		}
+		if streams[i].Messages, err = parseXMessages(pair[1]); err != nil {
+			return nil, err
+		}
+	}
+	return streams, nil
+}
+
+func parseXPending(reply resp.RESPData) (XPending, error) {
+	elems, err := items(reply)
+	if err != nil {
+		return XPending{}, err
+	}
+	if len(elems) != 4 {
+		return XPending{}, errors.New("medis: unexpected XPENDING reply")
+	}
+	var p XPending
+	if p.Count, err = parseInt(elems[0]); err != nil {
+		return p, err
+	}
+	if p.Count == 0 {
+		return p, nil
+	}
+	if p.Lower, err = parseString(elems[1]); err != nil {
+		return p, err
+	}
+	if p.Higher, err = parseString(elems[2]); err != nil {
+		return p, err
+	}
+	consumers, err := items(elems[3])
+	if err != nil {
+		return p, err
+	}
+	p.Consumers = make(map[string]int64, len(consumers))
+	for _, consumer := range consumers {
+		pair, err := items(consumer)
+		if err != nil {
+			return p, err
+		}
+		if len(pair) != 2 {
+			return p, errors.New("medis: unexpected XPENDING consumer")
+		}
+		name, err := parseString(pair[0])
+		if err != nil {
+			return p, err
+		}
+		if p.Consumers[name], err = parseInt(pair[1]); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+func parseXPendingExt(reply resp.RESPData) ([]XPendingExt, error) {
+	elems, err := items(reply)
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]XPendingExt, len(elems))
+	for i, elem := range elems {
+		fields, err := items(elem)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) != 4 {
+			return nil, errors.New("medis: unexpected XPENDING entry")
+		}
+		p := &pending[i]
+		if p.ID, err = parseString(fields[0]); err != nil {
+			return nil, err
+		}
+		if p.Consumer, err = parseString(fields[1]); err != nil {
+			return nil, err
+		}
+		if p.Idle, err = parseMilliseconds(fields[2]); err != nil {
+			return nil, err
+		}
+		if p.RetryCount, err = parseInt(fields[3]); err != nil {
+			return nil, err
+		}
+	}
+	return pending, nil
+}
+
+func parseXAutoClaim(reply resp.RESPData) (XAutoClaimResult, error) {
+	elems, err := items(reply)
+	if err != nil {
+		return XAutoClaimResult{}, err
+	}
+	if len(elems) != 3 {
+		return XAutoClaimResult{}, errors.New("medis: unexpected XAUTOCLAIM reply")
+	}
+	var r XAutoClaimResult
+	if r.Next, err = parseString(elems[0]); err != nil {
+		return r, err
+	}
+	if r.Messages, err = parseXMessages(elems[1]); err != nil {
+		return r, err
+	}
+	r.Deleted, err = parseOptionalStrings(elems[2])
+	return r, err
+}
+
+// XAdd appends an entry and returns its ID
+func (c cmdable) XAdd(ctx context.Context, a *XAddArgs) *Cmd[string] {
+	args := []any{"XADD", a.Stream}
+	if a.NoMkStream {
+		args = append(args, "NOMKSTREAM")
+	}
+	args = appendTrim(args, a.MaxLen, a.MinID, a.Approx, a.Limit)
+	id := a.ID
+	if id == "" {
+		id = "*"
+	}
+	cmd := newCmd(parseString, withArgs(append(args, id), a.Values...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// Append the trimming clause of XADD and XTRIM
+func appendTrim(args []any, maxLen int64, minID string, approx bool, limit int64) []any {
+	switch {
+	case maxLen > 0:
+		args = append(args, "MAXLEN")
+	case minID != "":
+		args = append(args, "MINID")
+	default:
+		return args
+	}
+	if approx {
+		args = append(args, "~")
+	}
+	if maxLen > 0 {
+		args = append(args, maxLen)
+	} else {
+		args = append(args, minID)
+	}
+	if approx && limit > 0 {
+		args = append(args, "LIMIT", limit)
+	}
+	return args
+}
+
+func (c cmdable) XLen(ctx context.Context, stream string) *Cmd[int64] {
+	cmd := newCmd(parseInt, "XLEN", stream)
+	c(ctx, cmd)
+	return cmd
+}
+
+// XRange returns the entries between start and end, "-" and "+" for the
+// whole stream, with options like "COUNT", 10
+func (c cmdable) XRange(ctx context.Context, stream, start, end string, opts ...any) *Cmd[[]XMessage] {
+	cmd := newCmd(parseXMessages, withArgs([]any{"XRANGE", stream, start, end}, opts...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// XRevRange is XRange from the end, taking end before start
+func (c cmdable) XRevRange(ctx context.Context, stream, end, start string, opts ...any) *Cmd[[]XMessage] {
+	cmd := newCmd(parseXMessages, withArgs([]any{"XREVRANGE", stream, end, start}, opts...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) XDel(ctx context.Context, stream string, ids ...string) *Cmd[int64] {
+	cmd := newCmd(parseInt, appendStrings([]any{"XDEL", stream}, ids)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// XTrimMaxLen trims the stream down to maxLen entries
+func (c cmdable) XTrimMaxLen(ctx context.Context, stream string, maxLen int64) *Cmd[int64] {
+	cmd := newCmd(parseInt, appendTrim([]any{"XTRIM", stream}, maxLen, "", false, 0)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// XTrimMaxLenApprox trims whole nodes only, evicting up to limit entries
+// unless it is zero
+func (c cmdable) XTrimMaxLenApprox(ctx context.Context, stream string, maxLen, limit int64) *Cmd[int64] {
+	cmd := newCmd(parseInt, appendTrim([]any{"XTRIM", stream}, maxLen, "", true, limit)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// XTrimMinID evicts the entries with an ID lower than minID
+func (c cmdable) XTrimMinID(ctx context.Context, stream, minID string) *Cmd[int64] {
+	cmd := newCmd(parseInt, appendTrim([]any{"XTRIM", stream}, 0, minID, false, 0)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) XTrimMinIDApprox(ctx context.Context, stream, minID string, limit int64) *Cmd[int64] {
+	cmd := newCmd(parseInt, appendTrim([]any{"XTRIM", stream}, 0, minID, true, limit)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// Append COUNT and BLOCK, returning the command blocking timeout
+func appendRead(args []any, count int64, block time.Duration) ([]any, time.Duration, bool) {
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	switch {
+	case block > 0:
+		return append(args, "BLOCK", block.Milliseconds()), block, true
+	case block < 0:
+		return append(args, "BLOCK", 0), 0, true
+	}
+	return args, 0, false
+}
+
+// XRead reads entries after the IDs given, Nil when the command blocked
+// until its timeout
+func (c cmdable) XRead(ctx context.Context, a *XReadArgs) *Cmd[[]XStream] {
+	args, block, blocking := appendRead([]any{"XREAD"}, a.Count, a.Block)
+	args = appendStrings(append(args, "STREAMS"), a.Streams)
+	cmd := newCmd(parseXStreams, args...)
+	cmd.block, cmd.blocking = block, blocking
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) XReadGroup(ctx context.Context, a *XReadGroupArgs) *Cmd[[]XStream] {
+	args, block, blocking := appendRead([]any{"XREADGROUP", "GROUP", a.Group, a.Consumer}, a.Count, a.Block)
+	if a.NoAck {
+		args = append(args, "NOACK")
+	}
+	args = appendStrings(append(args, "STREAMS"), a.Streams)
+	cmd := newCmd(parseXStreams, args...)
+	cmd.block, cmd.blocking = block, blocking
+	c(ctx, cmd)
+	return cmd
+}
+
+// XGroupCreate creates a consumer group delivering the entries after start,
+// "$" for the new ones only
+func (c cmdable) XGroupCreate(ctx context.Context, stream, group, start string) *Cmd[string] {
+	cmd := newCmd(parseString, "XGROUP", "CREATE", stream, group, start)
+	c(ctx, cmd)
+	return cmd
+}
+
+// XGroupCreateMkStream is XGroupCreate creating the stream if needed
+func (c cmdable) XGroupCreateMkStream(ctx context.Context, stream, group, start string) *Cmd[string] {
+	cmd := newCmd(parseString, "XGROUP", "CREATE", stream, group, start, "MKSTREAM")
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) XGroupCreateConsumer(ctx context.Context, stream, group, consumer string) *Cmd[int64] {
+	cmd := newCmd(parseInt, "XGROUP", "CREATECONSUMER", stream, group, consumer)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) XGroupDestroy(ctx context.Context, stream, group string) *Cmd[int64] {
+	cmd := newCmd(parseInt, "XGROUP", "DESTROY", stream, group)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) XGroupSetID(ctx context.Context, stream, group, start string) *Cmd[string] {
+	cmd := newCmd(parseString, "XGROUP", "SETID", stream, group, start)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) XAck(ctx context.Context, stream, group string, ids ...string) *Cmd[int64] {
+	cmd := newCmd(parseInt, appendStrings([]any{"XACK", stream, group}, ids)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// XPending summarizes the entries pending in group
+func (c cmdable) XPending(ctx context.Context, stream, group string) *Cmd[XPending] {
+	cmd := newCmd(parseXPending, "XPENDING", stream, group)
+	c(ctx, cmd)
+	return cmd
+}
+
+// XPendingExt lists the entries pending in a group
+func (c cmdable) XPendingExt(ctx context.Context, a *XPendingExtArgs) *Cmd[[]XPendingExt] {
+	args := []any{"XPENDING", a.Stream, a.Group}
+	if a.Idle > 0 {
+		args = append(args, "IDLE", a.Idle.Milliseconds())
+	}
+	args = append(args, a.Start, a.End, a.Count)
+	if a.Consumer != "" {
+		args = append(args, a.Consumer)
+	}
+	cmd := newCmd(parseXPendingExt, args...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// XClaim moves pending entries idle for at least MinIdle to Consumer
+func (c cmdable) XClaim(ctx context.Context, a *XClaimArgs) *Cmd[[]XMessage] {
+	args := appendStrings([]any{"XCLAIM", a.Stream, a.Group, a.Consumer, a.MinIdle.Milliseconds()}, a.Messages)
+	cmd := newCmd(parseXMessages, args...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// XClaimJustID is XClaim returning the IDs of the entries claimed
+func (c cmdable) XClaimJustID(ctx context.Context, a *XClaimArgs) *Cmd[[]string] {
+	args := appendStrings([]any{"XCLAIM", a.Stream, a.Group, a.Consumer, a.MinIdle.Milliseconds()}, a.Messages)
+	cmd := newCmd(parseStrings, append(args, "JUSTID")...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// XAutoClaim claims the entries idle for at least MinIdle, scanning from
+// Start
+func (c cmdable) XAutoClaim(ctx context.Context, a *XAutoClaimArgs) *Cmd[XAutoClaimResult] {
+	start := a.Start
+	if start == "" {
+		start = "0-0"
+	}
+	args := []any{"XAUTOCLAIM", a.Stream, a.Group, a.Consumer, a.MinIdle.Milliseconds(), start}
+	if a.Count > 0 {
+		args = append(args, "COUNT", a.Count)
+	}
+	cmd := newCmd(parseXAutoClaim, args...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// XInfoStream describes the stream with the fields of XINFO STREAM
+func (c cmdable) XInfoStream(ctx context.Context, stream string) *Cmd[map[string]any] {
+	cmd := newCmd(parseAnyMap, "XINFO", "STREAM", stream)
+	c(ctx, cmd)
+	return cmd
+}
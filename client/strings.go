@@ -0,0 +1,187 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// cmdable runs the commands of the typed helpers: right away on a client
+// or a connection, later on in a pipeline
+type cmdable func(ctx context.Context, cmd Cmder)
+
+// Append the options of a command to its arguments
+func withArgs(args []any, opts ...any) []any {
+	return append(args, opts...)
+}
+
+// Append keys, members or other strings to the arguments
+func appendStrings(args []any, values []string) []any {
+	for _, value := range values {
+		args = append(args, value)
+	}
+	return args
+}
+
+// Append an expiration, in seconds when it has no smaller unit
+func appendExpiration(args []any, expiration time.Duration) []any {
+	switch {
+	case expiration <= 0:
+		return args
+	case expiration%time.Second == 0:
+		return append(args, "EX", int64(expiration/time.Second))
+	default:
+		return append(args, "PX", expiration.Milliseconds())
+	}
+}
+
+// Set sets key to value, expiring after expiration unless it is zero
+func (c cmdable) Set(ctx context.Context, key string, value any, expiration time.Duration) *Cmd[string] {
+	cmd := newCmd(parseString, appendExpiration([]any{"SET", key, value}, expiration)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// SetArgs runs SET with the options given as they are, like "NX", "KEEPTTL"
+// or "GET". The reply is the status, or the old value with GET.
+func (c cmdable) SetArgs(ctx context.Context, key string, value any, opts ...any) *Cmd[string] {
+	cmd := newCmd(parseString, withArgs([]any{"SET", key, value}, opts...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// SetNX sets key unless it exists, reporting whether it was set
+func (c cmdable) SetNX(ctx context.Context, key string, value any) *Cmd[bool] {
+	cmd := newCmd(parseBool, "SETNX", key, value)
+	c(ctx, cmd)
+	return cmd
+}
+
+// SetEx sets key to expire after expiration, rounded down to seconds
+func (c cmdable) SetEx(ctx context.Context, key string, value any, expiration time.Duration) *Cmd[string] {
+	cmd := newCmd(parseString, "SETEX", key, int64(expiration/time.Second), value)
+	c(ctx, cmd)
+	return cmd
+}
+
+// PSetEx sets key to expire after expiration, rounded down to milliseconds
+func (c cmdable) PSetEx(ctx context.Context, key string, value any, expiration time.Duration) *Cmd[string] {
+	cmd := newCmd(parseString, "PSETEX", key, expiration.Milliseconds(), value)
+	c(ctx, cmd)
+	return cmd
+}
+
+// Get returns the value of key, Nil when it is missing
+func (c cmdable) Get(ctx context.Context, key string) *Cmd[string] {
+	cmd := newCmd(parseString, "GET", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) GetSet(ctx context.Context, key string, value any) *Cmd[string] {
+	cmd := newCmd(parseString, "GETSET", key, value)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) GetDel(ctx context.Context, key string) *Cmd[string] {
+	cmd := newCmd(parseString, "GETDEL", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+// GetEx returns the value of key and changes its expiration with options
+// like "EX", 10 or "PERSIST"
+func (c cmdable) GetEx(ctx context.Context, key string, opts ...any) *Cmd[string] {
+	cmd := newCmd(parseString, withArgs([]any{"GETEX", key}, opts...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// MGet returns the values of keys, nil for the missing ones
+func (c cmdable) MGet(ctx context.Context, keys ...string) *Cmd[[]any] {
+	cmd := newCmd(parseSlice, appendStrings([]any{"MGET"}, keys)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// MSet sets keys and values given in turns
+func (c cmdable) MSet(ctx context.Context, pairs ...any) *Cmd[string] {
+	cmd := newCmd(parseString, withArgs([]any{"MSET"}, pairs...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// MSetNX sets keys and values given in turns unless any key exists
+func (c cmdable) MSetNX(ctx context.Context, pairs ...any) *Cmd[bool] {
+	cmd := newCmd(parseBool, withArgs([]any{"MSETNX"}, pairs...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) StrLen(ctx context.Context, key string) *Cmd[int64] {
+	cmd := newCmd(parseInt, "STRLEN", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Append(ctx context.Context, key, value string) *Cmd[int64] {
+	cmd := newCmd(parseInt, "APPEND", key, value)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) GetRange(ctx context.Context, key string, start, end int64) *Cmd[string] {
+	cmd := newCmd(parseString, "GETRANGE", key, start, end)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) SubStr(ctx context.Context, key string, start, end int64) *Cmd[string] {
+	cmd := newCmd(parseString, "SUBSTR", key, start, end)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) SetRange(ctx context.Context, key string, offset int64, value string) *Cmd[int64] {
+	cmd := newCmd(parseInt, "SETRANGE", key, offset, value)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Incr(ctx context.Context, key string) *Cmd[int64] {
+	cmd := newCmd(parseInt, "INCR", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Decr(ctx context.Context, key string) *Cmd[int64] {
+	cmd := newCmd(parseInt, "DECR", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) IncrBy(ctx context.Context, key string, increment int64) *Cmd[int64] {
+	cmd := newCmd(parseInt, "INCRBY", key, increment)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) DecrBy(ctx context.Context, key string, decrement int64) *Cmd[int64] {
+	cmd := newCmd(parseInt, "DECRBY", key, decrement)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) IncrByFloat(ctx context.Context, key string, increment float64) *Cmd[float64] {
+	cmd := newCmd(parseFloat, "INCRBYFLOAT", key, increment)
+	c(ctx, cmd)
+	return cmd
+}
+
+// LCS returns the longest common subsequence of two keys. Options like
+// "LEN" or "IDX" change the reply, a string by default.
+func (c cmdable) LCS(ctx context.Context, key1, key2 string, opts ...any) *Cmd[any] {
+	cmd := newCmd(parseAny, withArgs([]any{"LCS", key1, key2}, opts...)...)
+	c(ctx, cmd)
+	return cmd
+}
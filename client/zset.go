@@ -0,0 +1,192 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// Z is a member of a sorted set and its score
+type Z struct {
+	Member string
+	Score  float64
+}
+
+// ZWithKey is a member popped from a sorted set by BZPOPMIN or BZPOPMAX
+type ZWithKey struct {
+	Z
+	Key string
+}
+
+// KeyMembers are the members popped from a sorted set by ZMPOP
+type KeyMembers struct {
+	Key     string
+	Members []Z
+}
+
+// Parse members and scores, in turns or in pairs. A null reply has no
+// members.
+func parseZs(reply resp.RESPData) ([]Z, error) {
+	elems, err := items(reply)
+	if errors.Is(err, Nil) {
+		return []Z{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := pairs(elems)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]Z, len(pairs))
+	for i, pair := range pairs {
+		if members[i].Member, err = parseString(pair[0]); err != nil {
+			return nil, err
+		}
+		if members[i].Score, err = parseFloat(pair[1]); err != nil {
+			return nil, err
+		}
+	}
+	return members, nil
+}
+
+// Parse [key, member, score]
+func parseZWithKey(reply resp.RESPData) (ZWithKey, error) {
+	elems, err := items(reply)
+	if err != nil {
+		return ZWithKey{}, err
+	}
+	if len(elems) != 3 {
+		return ZWithKey{}, errors.New("medis: unexpected reply, want a key, a member and a score")
+	}
+	var z ZWithKey
+	if z.Key, err = parseString(elems[0]); err != nil {
+		return z, err
+	}
+	if z.Member, err = parseString(elems[1]); err != nil {
+		return z, err
+	}
+	z.Score, err = parseFloat(elems[2])
+	return z, err
+}
+
+// Parse [key, [[member, score], ...]]
+func parseKeyMembers(reply resp.RESPData) (KeyMembers, error) {
+	elems, err := items(reply)
+	if err != nil {
+		return KeyMembers{}, err
+	}
+	if len(elems) != 2 {
+		return KeyMembers{}, errors.New("medis: unexpected reply, want a key and its members")
+	}
+	key, err := parseString(elems[0])
+	if err != nil {
+		return KeyMembers{}, err
+	}
+	members, err := parseZs(elems[1])
+	return KeyMembers{Key: key, Members: members}, err
+}
+
+// ZAdd adds or updates members, returning the number of new ones
+func (c cmdable) ZAdd(ctx context.Context, key string, members ...Z) *Cmd[int64] {
+	return c.ZAddArgs(ctx, key, nil, members...)
+}
+
+// ZAddArgs runs ZADD with options like "NX" or "GT" before the members
+func (c cmdable) ZAddArgs(ctx context.Context, key string, opts []any, members ...Z) *Cmd[int64] {
+	args := withArgs([]any{"ZADD", key}, opts...)
+	for _, m := range members {
+		args = append(args, m.Score, m.Member)
+	}
+	cmd := newCmd(parseInt, args...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ZCard(ctx context.Context, key string) *Cmd[int64] {
+	cmd := newCmd(parseInt, "ZCARD", key)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ZScore(ctx context.Context, key, member string) *Cmd[float64] {
+	cmd := newCmd(parseFloat, "ZSCORE", key, member)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ZRem(ctx context.Context, key string, members ...any) *Cmd[int64] {
+	cmd := newCmd(parseInt, withArgs([]any{"ZREM", key}, members...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// ZRange returns the members between two ranks, with options like "REV"
+func (c cmdable) ZRange(ctx context.Context, key string, start, stop int64, opts ...any) *Cmd[[]string] {
+	cmd := newCmd(parseStrings, withArgs([]any{"ZRANGE", key, start, stop}, opts...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// ZRangeWithScores is ZRange with the scores of the members
+func (c cmdable) ZRangeWithScores(ctx context.Context, key string, start, stop int64, opts ...any) *Cmd[[]Z] {
+	args := withArgs([]any{"ZRANGE", key, start, stop}, opts...)
+	cmd := newCmd(parseZs, append(args, "WITHSCORES")...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// ZPopMin pops the members with the lowest scores, one unless count is
+// given
+func (c cmdable) ZPopMin(ctx context.Context, key string, count ...int64) *Cmd[[]Z] {
+	cmd := newCmd(parseZs, withArgs([]any{"ZPOPMIN", key}, int64sToAny(count)...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ZPopMax(ctx context.Context, key string, count ...int64) *Cmd[[]Z] {
+	cmd := newCmd(parseZs, withArgs([]any{"ZPOPMAX", key}, int64sToAny(count)...)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// ZMPop pops up to count members from the first non empty sorted set of
+// keys, order is "MIN" or "MAX"
+func (c cmdable) ZMPop(ctx context.Context, order string, count int64, keys ...string) *Cmd[KeyMembers] {
+	args := appendStrings([]any{"ZMPOP", len(keys)}, keys)
+	cmd := newCmd(parseKeyMembers, append(args, order, "COUNT", count)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+// BZPopMin waits for up to timeout for a member to pop, forever when zero
+func (c cmdable) BZPopMin(ctx context.Context, timeout time.Duration, keys ...string) *Cmd[ZWithKey] {
+	args := appendStrings([]any{"BZPOPMIN"}, keys)
+	cmd := newBlockingCmd(timeout, parseZWithKey, append(args, blockSeconds(timeout))...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) BZPopMax(ctx context.Context, timeout time.Duration, keys ...string) *Cmd[ZWithKey] {
+	args := appendStrings([]any{"BZPOPMAX"}, keys)
+	cmd := newBlockingCmd(timeout, parseZWithKey, append(args, blockSeconds(timeout))...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) BZMPop(ctx context.Context, timeout time.Duration, order string, count int64, keys ...string) *Cmd[KeyMembers] {
+	args := appendStrings([]any{"BZMPOP", blockSeconds(timeout), len(keys)}, keys)
+	cmd := newBlockingCmd(timeout, parseKeyMembers, append(args, order, "COUNT", count)...)
+	c(ctx, cmd)
+	return cmd
+}
+
+func int64sToAny(values []int64) []any {
+	args := make([]any, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
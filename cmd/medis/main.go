@@ -2,35 +2,55 @@ package main
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/logging"
 	"github.com/mmnalaka/medis/internal/server"
 )
 
-const (
-	REDIS_PORT = 6379
-)
-
 func main() {
+	// Load the configuration from an optional config file and --option flags
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if err := logging.Setup(cfg.LogLevel, cfg.LogFormat, cfg.LogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up logging: %v\n", err)
+		os.Exit(1)
+	}
+	log := logging.For("server")
+
 	// Create a context that will be canceled on interrupt signals
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel() // ensures that cancel() is called before the function exits
 
-	// Handle interrupt signals
-	sigChan := make(chan os.Signal, 1)                      //  Creates a channel that will receive OS signals.
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM) // Registers the channel to receive interrupt (SIGINT) and termination (SIGTERM) signals.
+	// Handle interrupt signals, and SIGHUP sent by logrotate once it moved
+	// the log file
+	sigChan := make(chan os.Signal, 1)                                      //  Creates a channel that will receive OS signals.
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP) // Registers the channel to receive interrupt (SIGINT), termination (SIGTERM) and hangup (SIGHUP) signals.
 
 	go func() {
-		sig := <-sigChan
-		log.Printf("Received signal %v, initiating shutdown", sig)
-		cancel()
+		for sig := range sigChan {
+			if sig == syscall.SIGHUP {
+				if err := logging.Reopen(); err != nil {
+					log.Warn("Failed to reopen the log file", "err", err)
+				}
+				continue
+			}
+			log.Warn("Received signal, initiating shutdown", "signal", sig)
+			cancel()
+			return
+		}
 	}()
 
-	server := server.NewServer(REDIS_PORT)
+	server := server.NewServer(cfg)
 	if err := server.Start(ctx); err != nil {
-		log.Fatalf("Failed to start Medis server: %v", err)
+		log.Error("Failed to start Medis server", "err", err)
+		os.Exit(1)
 	}
 }
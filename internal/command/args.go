@@ -0,0 +1,125 @@
+package command
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+const (
+	notIntegerError = "ERR value is not an integer or out of range"
+	notFloatError   = "ERR value is not a valid float"
+	syntaxError     = "ERR syntax error"
+)
+
+// Parse an integer argument. Like Redis, only the canonical form is accepted:
+// no leading '+' or zeros, and no "-0".
+func parseInt(arg []byte) (int64, *resp.Error) {
+	digits := bytes.TrimPrefix(arg, []byte("-"))
+	if len(digits) > 0 && (digits[0] == '+' || digits[0] == '0' && (len(digits) > 1 || len(digits) < len(arg))) {
+		return 0, &resp.Error{Data: notIntegerError}
+	}
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, &resp.Error{Data: notIntegerError}
+	}
+	return n, nil
+}
+
+// Parse a float argument, accepting inf and -inf but not NaN
+func parseFloat(arg []byte) (float64, *resp.Error) {
+	f, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, &resp.Error{Data: notFloatError}
+	}
+	return f, nil
+}
+
+// Format a float the way Redis replies with scores, like %.17g with the
+// shortest digits reading back as f: 1234567 and 0.0001, but 1e+17 and 1e-05
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	exp, _ := strconv.Atoi(s[strings.IndexByte(s, 'e')+1:])
+	if exp < -4 || exp >= 17 {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Reply with the lines of a HELP subcommand
+func helpReply(help []string) resp.RESPData {
+	lines := make([]resp.RESPData, len(help))
+	for i, line := range help {
+		lines[i] = &resp.SimpleString{Data: line}
+	}
+	return &resp.Array{Data: lines}
+}
+
+// Parse the timeout of a blocking command, in seconds with decimals.
+// A timeout of 0 blocks forever.
+func parseTimeout(arg []byte) (time.Duration, *resp.Error) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, &resp.Error{Data: "ERR timeout is not a float or out of range"}
+	}
+	if seconds < 0 {
+		return 0, &resp.Error{Data: "ERR timeout is negative"}
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// Parse the "numkeys key [key ...]" part of a command starting at pos,
+// returning the keys and the remaining arguments
+func parseNumKeys(args [][]byte, pos int) ([]string, [][]byte, *resp.Error) {
+	n, err := strconv.Atoi(string(args[pos]))
+	if err != nil || n <= 0 {
+		return nil, nil, &resp.Error{Data: "ERR numkeys should be greater than 0"}
+	}
+	if pos+n >= len(args) {
+		return nil, nil, &resp.Error{Data: syntaxError}
+	}
+
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = string(args[pos+1+i])
+	}
+	return keys, args[pos+1+n:], nil
+}
+
+// Parse an optional "COUNT count" clause, the only option of the *MPOP
+// commands
+func parseCount(args [][]byte) (int, *resp.Error) {
+	if len(args) == 0 {
+		return 1, nil
+	}
+	if len(args) != 2 || strings.ToUpper(string(args[0])) != "COUNT" {
+		return 0, &resp.Error{Data: syntaxError}
+	}
+	count, err := strconv.Atoi(string(args[1]))
+	if err != nil || count <= 0 {
+		return 0, &resp.Error{Data: "ERR count should be greater than 0"}
+	}
+	return count, nil
+}
+
+func bulkStrings(values [][]byte) *resp.Array {
+	array := &resp.Array{Data: make([]resp.RESPData, len(values))}
+	for i, value := range values {
+		array.Data[i] = &resp.BulkString{Data: value}
+	}
+	return array
+}
+
+func nullArray() *resp.Array {
+	return &resp.Array{Data: nil}
+}
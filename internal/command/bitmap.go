@@ -0,0 +1,576 @@
+package command
+
+import (
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// Bitmaps are limited to the maximum size of strings
+const maxBitOffset = maxStringSize*8 - 1
+
+const bitOffsetError = "ERR bit offset is not an integer or out of range"
+
+// Parse a bit offset, which must address a bit within 512MB
+func parseBitOffset(arg []byte) (int64, *resp.Error) {
+	offset, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil || offset < 0 || offset > maxBitOffset {
+		return 0, &resp.Error{Data: bitOffsetError}
+	}
+	return offset, nil
+}
+
+// Bits are numbered from the most significant bit of the first byte. Bits
+// past the end of the string read as 0.
+func getBit(str []byte, offset int64) int {
+	i := offset >> 3
+	if i >= int64(len(str)) {
+		return 0
+	}
+	return int(str[i]>>(7-offset&7)) & 1
+}
+
+func setBit(str []byte, offset int64, bit int) {
+	mask := byte(1) << (7 - offset&7)
+	if bit == 1 {
+		str[offset>>3] |= mask
+	} else {
+		str[offset>>3] &^= mask
+	}
+}
+
+// Handler for SETBIT command
+func (h *Handler) handleSetBit(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	offset, errReply := parseBitOffset(cmd.Args[1])
+	if errReply != nil {
+		return errReply
+	}
+	bit := string(cmd.Args[2])
+	if bit != "0" && bit != "1" {
+		return &resp.Error{Data: "ERR bit is not an integer or out of range"}
+	}
+
+	key := string(cmd.Args[0])
+	str, _, errReply := getString(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+
+	old := getBit(str, offset)
+	str = copyString(str, int(offset>>3)+1)
+	setBit(str, offset, int(bit[0]-'0'))
+	tx.Set(key, str)
+	h.notifyKeyspaceEvent(config.NotifyString, "setbit", key, tx.DB())
+	return &resp.Integer{Data: int64(old)}
+}
+
+// Handler for GETBIT command
+func (h *Handler) handleGetBit(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	offset, errReply := parseBitOffset(cmd.Args[1])
+	if errReply != nil {
+		return errReply
+	}
+	str, _, errReply := getString(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return &resp.Integer{Data: int64(getBit(str, offset))}
+}
+
+// bitRange is the "[start [end [BYTE|BIT]]]" clause of BITCOUNT and BITPOS
+type bitRange struct {
+	start, end int64
+	endGiven   bool
+	bitUnit    bool // Indexes are bits rather than bytes
+}
+
+func parseBitRange(args [][]byte) (*bitRange, *resp.Error) {
+	r := &bitRange{end: -1}
+	if len(args) > 3 {
+		return nil, &resp.Error{Data: syntaxError}
+	}
+	if len(args) > 0 {
+		var errReply *resp.Error
+		if r.start, errReply = parseInt(args[0]); errReply != nil {
+			return nil, errReply
+		}
+	}
+	if len(args) > 1 {
+		var errReply *resp.Error
+		if r.end, errReply = parseInt(args[1]); errReply != nil {
+			return nil, errReply
+		}
+		r.endGiven = true
+	}
+	if len(args) > 2 {
+		switch strings.ToUpper(string(args[2])) {
+		case "BYTE":
+		case "BIT":
+			r.bitUnit = true
+		default:
+			return nil, &resp.Error{Data: syntaxError}
+		}
+	}
+	return r, nil
+}
+
+// Resolve the range against a string of n bytes, negative indexes counting
+// from the end, into an inclusive range of bit offsets
+func (r *bitRange) resolve(n int) (int64, int64, bool) {
+	total := int64(n)
+	if r.bitUnit {
+		total *= 8
+	}
+	start, end := r.start, r.end
+	if start < 0 {
+		start += total
+	}
+	if end < 0 {
+		end += total
+	}
+	start, end = max(start, 0), min(max(end, 0), total-1)
+	if start > end {
+		return 0, 0, false
+	}
+	if r.bitUnit {
+		return start, end, true
+	}
+	return start * 8, end*8 + 7, true
+}
+
+// Count the set bits between offsets from and to, inclusive
+func countBits(str []byte, from, to int64) int64 {
+	first, last := from>>3, to>>3
+	var count int
+	for i := first; i <= last; i++ {
+		b := str[i]
+		if i == first {
+			b &= 0xff >> (from & 7)
+		}
+		if i == last {
+			b &= 0xff << (7 - to&7)
+		}
+		count += bits.OnesCount8(b)
+	}
+	return int64(count)
+}
+
+// Find the first bit set to bit between offsets from and to, inclusive
+func findBit(str []byte, bit int, from, to int64) int64 {
+	skip := byte(0x00) // Bytes that cannot contain the bit
+	if bit == 0 {
+		skip = 0xff
+	}
+	for offset := from; offset <= to; {
+		if offset&7 == 0 && offset+7 <= to && str[offset>>3] == skip {
+			offset += 8
+			continue
+		}
+		if getBit(str, offset) == bit {
+			return offset
+		}
+		offset++
+	}
+	return -1
+}
+
+// Handler for BITCOUNT command
+// BITCOUNT key [start end [BYTE|BIT]]
+func (h *Handler) handleBitCount(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if len(cmd.Args) == 2 {
+		return &resp.Error{Data: syntaxError}
+	}
+	r, errReply := parseBitRange(cmd.Args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	str, _, errReply := getString(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+
+	from, to, ok := r.resolve(len(str))
+	if !ok {
+		return &resp.Integer{Data: 0}
+	}
+	return &resp.Integer{Data: countBits(str, from, to)}
+}
+
+// Handler for BITPOS command
+// BITPOS key bit [start [end [BYTE|BIT]]]
+func (h *Handler) handleBitPos(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	bitArg := string(cmd.Args[1])
+	if bitArg != "0" && bitArg != "1" {
+		return &resp.Error{Data: "ERR The bit argument must be 1 or 0."}
+	}
+	bit := int(bitArg[0] - '0')
+	r, errReply := parseBitRange(cmd.Args[2:])
+	if errReply != nil {
+		return errReply
+	}
+
+	str, exists, errReply := getString(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if !exists {
+		// A missing key is an empty string, so only clear bits can be found
+		if bit == 1 {
+			return &resp.Integer{Data: -1}
+		}
+		return &resp.Integer{Data: 0}
+	}
+
+	from, to, ok := r.resolve(len(str))
+	if !ok {
+		return &resp.Integer{Data: -1}
+	}
+	pos := findBit(str, bit, from, to)
+	if pos == -1 && bit == 0 && !r.endGiven {
+		// Without an explicit end the string is considered padded with zeros
+		pos = int64(len(str)) * 8
+	}
+	return &resp.Integer{Data: pos}
+}
+
+// Handler for BITOP command
+// BITOP AND|OR|XOR|NOT|DIFF destkey key [key ...]
+func (h *Handler) handleBitOp(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	op := strings.ToUpper(string(cmd.Args[0]))
+	dest, keys := string(cmd.Args[1]), cmd.Args[2:]
+	switch op {
+	case "AND", "OR", "XOR":
+	case "NOT":
+		if len(keys) != 1 {
+			return &resp.Error{Data: "ERR BITOP NOT must be called with a single source key."}
+		}
+	case "DIFF":
+		if len(keys) < 2 {
+			return &resp.Error{Data: "ERR BITOP DIFF must be called with at least two source keys."}
+		}
+	default:
+		return &resp.Error{Data: syntaxError}
+	}
+
+	sources := make([][]byte, len(keys))
+	size := 0
+	for i, key := range keys {
+		str, _, errReply := getString(tx, string(key))
+		if errReply != nil {
+			return errReply
+		}
+		sources[i] = str
+		size = max(size, len(str))
+	}
+
+	// Shorter strings are padded with zeros
+	byteAt := func(str []byte, i int) byte {
+		if i < len(str) {
+			return str[i]
+		}
+		return 0
+	}
+
+	result := make([]byte, size)
+	for i := range result {
+		b := byteAt(sources[0], i)
+		switch op {
+		case "NOT":
+			b = ^b
+		case "DIFF":
+			// Bits of the first key set in none of the others
+			var others byte
+			for _, src := range sources[1:] {
+				others |= byteAt(src, i)
+			}
+			b &^= others
+		default:
+			for _, src := range sources[1:] {
+				switch op {
+				case "AND":
+					b &= byteAt(src, i)
+				case "OR":
+					b |= byteAt(src, i)
+				case "XOR":
+					b ^= byteAt(src, i)
+				}
+			}
+		}
+		result[i] = b
+	}
+
+	if size == 0 {
+		if tx.Delete(dest) {
+			h.notifyKeyspaceEvent(config.NotifyGeneric, "del", dest, tx.DB())
+		}
+	} else {
+		replaceKey(tx, dest, result)
+		h.notifyKeyspaceEvent(config.NotifyString, "set", dest, tx.DB())
+	}
+	return &resp.Integer{Data: int64(size)}
+}
+
+// bitfieldOp is a single GET, SET or INCRBY operation of BITFIELD
+type bitfieldOp struct {
+	name     string
+	signed   bool
+	bits     uint
+	offset   int64
+	value    int64  // Value of SET, increment of INCRBY
+	overflow string // WRAP, SAT or FAIL
+}
+
+// Parse an integer type: i1 to i64 or u1 to u63
+func parseBitfieldType(arg []byte) (bool, uint, *resp.Error) {
+	invalid := &resp.Error{Data: "ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is."}
+	s := strings.ToLower(string(arg))
+	if len(s) < 2 || (s[0] != 'i' && s[0] != 'u') {
+		return false, 0, invalid
+	}
+	n, err := strconv.Atoi(s[1:])
+	signed := s[0] == 'i'
+	if err != nil || n < 1 || (signed && n > 64) || (!signed && n > 63) {
+		return false, 0, invalid
+	}
+	return signed, uint(n), nil
+}
+
+// Parse an offset in bits, or a multiple of the type width when prefixed with #
+func parseBitfieldOffset(arg []byte, width uint) (int64, *resp.Error) {
+	s, multiply := strings.CutPrefix(string(arg), "#")
+	offset, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, &resp.Error{Data: bitOffsetError}
+	}
+	if multiply {
+		if offset > maxBitOffset/int64(width) {
+			return 0, &resp.Error{Data: bitOffsetError}
+		}
+		offset *= int64(width)
+	}
+	if offset+int64(width)-1 > maxBitOffset {
+		return 0, &resp.Error{Data: bitOffsetError}
+	}
+	return offset, nil
+}
+
+// Parse the operations of BITFIELD, starting after the key
+func parseBitfieldOps(args [][]byte, readOnly bool) ([]*bitfieldOp, *resp.Error) {
+	var ops []*bitfieldOp
+	overflow := "WRAP"
+	for i := 0; i < len(args); i++ {
+		name := strings.ToUpper(string(args[i]))
+		remaining := len(args) - i - 1
+
+		if name == "OVERFLOW" && remaining >= 1 {
+			i++
+			overflow = strings.ToUpper(string(args[i]))
+			if overflow != "WRAP" && overflow != "SAT" && overflow != "FAIL" {
+				return nil, &resp.Error{Data: "ERR Invalid OVERFLOW type specified"}
+			}
+			continue
+		}
+
+		need := 2
+		if name == "SET" || name == "INCRBY" {
+			need = 3
+		}
+		if (name != "GET" && name != "SET" && name != "INCRBY") || remaining < need {
+			return nil, &resp.Error{Data: syntaxError}
+		}
+		if readOnly && name != "GET" {
+			return nil, &resp.Error{Data: "ERR BITFIELD_RO only supports the GET subcommand"}
+		}
+
+		op := &bitfieldOp{name: name, overflow: overflow}
+		var errReply *resp.Error
+		if op.signed, op.bits, errReply = parseBitfieldType(args[i+1]); errReply != nil {
+			return nil, errReply
+		}
+		if op.offset, errReply = parseBitfieldOffset(args[i+2], op.bits); errReply != nil {
+			return nil, errReply
+		}
+		if need == 3 {
+			if op.value, errReply = parseInt(args[i+3]); errReply != nil {
+				return nil, errReply
+			}
+		}
+		ops = append(ops, op)
+		i += need
+	}
+	return ops, nil
+}
+
+// Read an unsigned integer of width bits at offset
+func getBits(str []byte, offset int64, width uint) uint64 {
+	var value uint64
+	for i := int64(0); i < int64(width); i++ {
+		value = value<<1 | uint64(getBit(str, offset+i))
+	}
+	return value
+}
+
+// Write the low width bits of value at offset
+func setBits(str []byte, offset int64, width uint, value uint64) {
+	for i := int64(0); i < int64(width); i++ {
+		setBit(str, offset+i, int(value>>(int64(width)-1-i))&1)
+	}
+}
+
+func getSignedBits(str []byte, offset int64, width uint) int64 {
+	value := getBits(str, offset, width)
+	if width < 64 && value&(1<<(width-1)) != 0 {
+		// Sign extension
+		value |= math.MaxUint64 << width
+	}
+	return int64(value)
+}
+
+// Add incr to an unsigned field value, reporting whether it overflowed. The
+// result wraps around or saturates depending on the overflow mode.
+func unsignedOverflow(value uint64, incr int64, width uint, mode string) (uint64, bool) {
+	maxValue := uint64(1)<<width - 1
+	maxIncr := int64(maxValue - value)
+	minIncr := -int64(value)
+
+	switch {
+	case value > maxValue || (incr > 0 && incr > maxIncr):
+		if mode == "SAT" {
+			return maxValue, true
+		}
+	case incr < 0 && incr < minIncr:
+		if mode == "SAT" {
+			return 0, true
+		}
+	default:
+		return value + uint64(incr), false
+	}
+	return (value + uint64(incr)) & maxValue, true
+}
+
+// Add incr to a signed field value, reporting whether it overflowed. The
+// result wraps around or saturates depending on the overflow mode.
+func signedOverflow(value, incr int64, width uint, mode string) (int64, bool) {
+	maxValue := int64(math.MaxInt64)
+	if width < 64 {
+		maxValue = 1<<(width-1) - 1
+	}
+	minValue := -maxValue - 1
+	maxIncr := maxValue - value
+	minIncr := minValue - value
+
+	switch {
+	case value > maxValue || (width != 64 && incr > maxIncr) || (value >= 0 && incr > 0 && incr > maxIncr):
+		if mode == "SAT" {
+			return maxValue, true
+		}
+	case value < minValue || (width != 64 && incr < minIncr) || (value < 0 && incr < 0 && incr < minIncr):
+		if mode == "SAT" {
+			return minValue, true
+		}
+	default:
+		return value + incr, false
+	}
+
+	result := uint64(value) + uint64(incr)
+	if width < 64 {
+		mask := uint64(math.MaxUint64) << width
+		if result&(1<<(width-1)) != 0 {
+			result |= mask
+		} else {
+			result &^= mask
+		}
+	}
+	return int64(result), true
+}
+
+// Run a SET or INCRBY operation, replying null when it overflowed with the
+// FAIL mode and nothing was written
+func (op *bitfieldOp) write(str []byte) resp.RESPData {
+	if op.signed {
+		old := getSignedBits(str, op.offset, op.bits)
+		value, incr := op.value, int64(0)
+		if op.name == "INCRBY" {
+			value, incr = old, op.value
+		}
+		result, overflowed := signedOverflow(value, incr, op.bits, op.overflow)
+		if overflowed && op.overflow == "FAIL" {
+			return &resp.BulkString{Data: nil}
+		}
+		setBits(str, op.offset, op.bits, uint64(result))
+		if op.name == "SET" {
+			return &resp.Integer{Data: old}
+		}
+		return &resp.Integer{Data: result}
+	}
+
+	old := getBits(str, op.offset, op.bits)
+	value, incr := uint64(op.value), int64(0)
+	if op.name == "INCRBY" {
+		value, incr = old, op.value
+	}
+	result, overflowed := unsignedOverflow(value, incr, op.bits, op.overflow)
+	if overflowed && op.overflow == "FAIL" {
+		return &resp.BulkString{Data: nil}
+	}
+	setBits(str, op.offset, op.bits, result)
+	if op.name == "SET" {
+		return &resp.Integer{Data: int64(old)}
+	}
+	return &resp.Integer{Data: int64(result)}
+}
+
+// Handler for BITFIELD command
+// BITFIELD key [GET type offset] [SET type offset value] [INCRBY type offset increment] [OVERFLOW WRAP|SAT|FAIL] ...
+func (h *Handler) handleBitField(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.bitfield(tx, cmd, false)
+}
+
+// Handler for BITFIELD_RO command
+func (h *Handler) handleBitFieldRO(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.bitfield(tx, cmd, true)
+}
+
+func (h *Handler) bitfield(tx *keyspace.Tx, cmd *Command, readOnly bool) resp.RESPData {
+	ops, errReply := parseBitfieldOps(cmd.Args[1:], readOnly)
+	if errReply != nil {
+		return errReply
+	}
+
+	key := string(cmd.Args[0])
+	str, _, errReply := getString(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+
+	// Writes go to a copy large enough for every field written
+	size := -1
+	for _, op := range ops {
+		if op.name != "GET" {
+			size = max(size, int((op.offset+int64(op.bits)+7)>>3))
+		}
+	}
+	if size >= 0 {
+		str = copyString(str, size)
+		tx.Set(key, str)
+		h.notifyKeyspaceEvent(config.NotifyString, "setbit", key, tx.DB())
+	}
+
+	replies := make([]resp.RESPData, len(ops))
+	for i, op := range ops {
+		switch {
+		case op.name == "GET" && op.signed:
+			replies[i] = &resp.Integer{Data: getSignedBits(str, op.offset, op.bits)}
+		case op.name == "GET":
+			replies[i] = &resp.Integer{Data: int64(getBits(str, op.offset, op.bits))}
+		default:
+			replies[i] = op.write(str)
+		}
+	}
+	return &resp.Array{Data: replies}
+}
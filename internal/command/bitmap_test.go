@@ -0,0 +1,65 @@
+package command
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSignedOverflow(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      int64
+		incr       int64
+		width      uint
+		mode       string
+		want       int64
+		overflowed bool
+	}{
+		{"in range", 10, 5, 8, "WRAP", 15, false},
+		{"wrap up", 127, 1, 8, "WRAP", -128, true},
+		{"wrap down", -128, -1, 8, "WRAP", 127, true},
+		{"saturate up", 100, 100, 8, "SAT", 127, true},
+		{"saturate down", -100, -100, 8, "SAT", -128, true},
+		{"i64 wrap", math.MaxInt64, 1, 64, "WRAP", math.MinInt64, true},
+		{"i64 saturate", math.MinInt64, -1, 64, "SAT", math.MinInt64, true},
+		{"i1", 0, -1, 1, "WRAP", -1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, overflowed := signedOverflow(tt.value, tt.incr, tt.width, tt.mode)
+			if got != tt.want || overflowed != tt.overflowed {
+				t.Errorf("got %d (overflow %v), want %d (overflow %v)", got, overflowed, tt.want, tt.overflowed)
+			}
+		})
+	}
+}
+
+func TestUnsignedOverflow(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      uint64
+		incr       int64
+		width      uint
+		mode       string
+		want       uint64
+		overflowed bool
+	}{
+		{"in range", 10, 5, 8, "WRAP", 15, false},
+		{"wrap up", 255, 2, 8, "WRAP", 1, true},
+		{"wrap down", 0, -1, 8, "WRAP", 255, true},
+		{"saturate up", 200, 100, 8, "SAT", 255, true},
+		{"saturate down", 5, -10, 8, "SAT", 0, true},
+		{"set too large", 300, 0, 8, "SAT", 255, true},
+		{"u63", math.MaxInt64, 1, 63, "WRAP", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, overflowed := unsignedOverflow(tt.value, tt.incr, tt.width, tt.mode)
+			if got != tt.want || overflowed != tt.overflowed {
+				t.Errorf("got %d (overflow %v), want %d (overflow %v)", got, overflowed, tt.want, tt.overflowed)
+			}
+		})
+	}
+}
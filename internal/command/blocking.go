@@ -0,0 +1,249 @@
+package command
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// waiter is a client blocked until one of its keys can serve it
+type waiter struct {
+	client   *Client
+	db       int      // Database of the keys
+	keys     []string // Keys the client waits on
+	lockKeys []string // Keys to lock when serving the client
+	deadline time.Time
+
+	// ready reports whether key can serve the client, serve then runs the
+	// command against it. Both run with lockKeys locked. Readiness may
+	// differ between clients of the same key, a stream is only ready for
+	// the readers waiting for IDs older than its last entry. The client
+	// given to serve is the one serving, which collects the keys the
+	// command signals; the transaction is in the database of the waiter.
+	ready func(tx *keyspace.Tx, key string) bool
+	serve func(h *Handler, c *Client, tx *keyspace.Tx, key string) resp.RESPData
+
+	// Reply sent when the timeout expires
+	timeoutReply resp.RESPData
+
+	// Receives the reply of whoever claims the waiter: the client serving it,
+	// CLIENT UNBLOCK or the timeout
+	reply chan resp.RESPData
+}
+
+// dbKey identifies a key across databases
+type dbKey struct {
+	db  int
+	key string
+}
+
+// blockingRegistry tracks blocked clients by key, in the order they blocked
+type blockingRegistry struct {
+	mu       sync.Mutex
+	byKey    map[dbKey][]*waiter
+	byClient map[int64]*waiter
+}
+
+func newBlockingRegistry() *blockingRegistry {
+	return &blockingRegistry{
+		byKey:    make(map[dbKey][]*waiter),
+		byClient: make(map[int64]*waiter),
+	}
+}
+
+func (r *blockingRegistry) add(w *waiter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range w.keys {
+		k := dbKey{w.db, key}
+		r.byKey[k] = append(r.byKey[k], w)
+	}
+	r.byClient[w.client.ID] = w
+}
+
+// claim removes the waiter and reports whether the caller is the one that
+// must send its reply
+func (r *blockingRegistry) claim(w *waiter) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.removeLocked(w)
+}
+
+func (r *blockingRegistry) remove(w *waiter) {
+	r.claim(w)
+}
+
+func (r *blockingRegistry) removeLocked(w *waiter) bool {
+	if r.byClient[w.client.ID] != w {
+		return false
+	}
+	delete(r.byClient, w.client.ID)
+
+	for _, key := range w.keys {
+		k := dbKey{w.db, key}
+		waiters := r.byKey[k]
+		for i, other := range waiters {
+			if other == w {
+				waiters = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(waiters) == 0 {
+			delete(r.byKey, k)
+		} else {
+			r.byKey[k] = waiters
+		}
+	}
+	return true
+}
+
+// waiting returns the clients waiting on key, in the order they blocked
+func (r *blockingRegistry) waiting(key dbKey) []*waiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*waiter(nil), r.byKey[key]...)
+}
+
+func (r *blockingRegistry) hasWaiters(key dbKey) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.byKey[key]) > 0
+}
+
+func (r *blockingRegistry) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.byClient)
+}
+
+// unblock wakes a blocked client up as if it timed out, or with an error
+func (r *blockingRegistry) unblock(clientID int64, withError bool) bool {
+	r.mu.Lock()
+	w, ok := r.byClient[clientID]
+	if !ok || !r.removeLocked(w) {
+		r.mu.Unlock()
+		return false
+	}
+	r.mu.Unlock()
+
+	if withError {
+		w.reply <- &resp.Error{Data: "UNBLOCKED client unblocked via CLIENT UNBLOCK"}
+	} else {
+		w.reply <- w.timeoutReply
+	}
+	return true
+}
+
+// Wake every blocked client up as if it timed out
+func (h *Handler) unblockAll() {
+	h.blocked.mu.Lock()
+	ids := make([]int64, 0, len(h.blocked.byClient))
+	for id := range h.blocked.byClient {
+		ids = append(ids, id)
+	}
+	h.blocked.mu.Unlock()
+
+	for _, id := range ids {
+		h.blocked.unblock(id, false)
+	}
+}
+
+// block registers the client as waiting on keys. It must be called from the
+// command holding the locks of keys, right after finding them unable to
+// serve it, so no element pushed in between can be missed. Inside a
+// transaction the command does not block and times out right away.
+func (h *Handler) block(c *Client, w *waiter, timeout time.Duration) resp.RESPData {
+	if c.inExec {
+		return w.timeoutReply
+	}
+
+	w.client = c
+	w.db = c.db
+	w.reply = make(chan resp.RESPData, 1)
+	if timeout > 0 {
+		w.deadline = time.Now().Add(timeout)
+	}
+	if w.lockKeys == nil {
+		w.lockKeys = w.keys
+	}
+
+	h.blocked.add(w)
+	c.waiter = w
+	return nil
+}
+
+// IsBlocked reports whether the last command blocked the client. The reply
+// must then be obtained through WaitUnblocked.
+func (c *Client) IsBlocked() bool {
+	return c.waiter != nil
+}
+
+// WaitUnblocked waits until the blocked client is served, times out or gets
+// unblocked, and returns the reply of the blocking command. Closing
+// disconnected gives up waiting.
+func (h *Handler) WaitUnblocked(c *Client, disconnected <-chan struct{}) resp.RESPData {
+	w := c.waiter
+	defer func() { c.waiter = nil }()
+
+	var timeout <-chan time.Time
+	if !w.deadline.IsZero() {
+		timer := time.NewTimer(time.Until(w.deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case reply := <-w.reply:
+		return reply
+	case <-timeout:
+	case <-disconnected:
+	}
+
+	if h.blocked.claim(w) {
+		return w.timeoutReply
+	}
+	// Someone claimed the client concurrently, their reply is on its way
+	return <-w.reply
+}
+
+// signalKeyAsReady records that key received elements, so that clients
+// blocked on it get served once the current command completes
+func (h *Handler) signalKeyAsReady(c *Client, key string) {
+	h.signalKeyAsReadyIn(c, c.db, key)
+}
+
+// signalKeyAsReadyIn is signalKeyAsReady for a key of another database
+func (h *Handler) signalKeyAsReadyIn(c *Client, db int, key string) {
+	if k := (dbKey{db, key}); h.blocked.hasWaiters(k) {
+		c.readyKeys = append(c.readyKeys, k)
+	}
+}
+
+// serveBlockedClients serves the clients waiting on the keys that received
+// elements, in the order they blocked, skipping those the keys cannot serve
+func (h *Handler) serveBlockedClients(c *Client) {
+	for len(c.readyKeys) > 0 {
+		key := c.readyKeys[0]
+		c.readyKeys = c.readyKeys[1:]
+
+		for _, w := range h.blocked.waiting(key) {
+			h.store.Update(key.db, w.lockKeys, func(tx *keyspace.Tx) {
+				// The waiter may have timed out meanwhile, then try the next one
+				if w.ready(tx, key.key) && h.blocked.claim(w) {
+					w.reply <- w.serve(h, c, tx, key.key)
+				}
+			})
+		}
+	}
+	c.readyKeys = nil
+}
+
+// isBlocked reports whether the client is waiting in a blocking command
+func (r *blockingRegistry) isBlocked(clientID int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.byClient[clientID]
+	return ok
+}
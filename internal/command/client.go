@@ -0,0 +1,626 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// Conn is how other connections reach a client. Its functions may be called
+// from any goroutine, a nil one is skipped.
+type Conn struct {
+	// Push delivers the messages sent outside of command replies, like
+	// pub/sub messages
+	Push func(msg resp.RESPData)
+	// Close closes the connection, for CLIENT KILL
+	Close func()
+	// Buffers reports the bytes waiting in the query and output buffers
+	Buffers func() (query, output int)
+}
+
+// Client holds the state the handler keeps for a connection. It is only
+// accessed by the goroutine running the connection's commands, except for
+// the fields documented otherwise.
+type Client struct {
+	ID        int64
+	Addr      string
+	LocalAddr string
+	created   time.Time
+	db        int // Selected database
+
+	// Set before the client is registered and never changed, other
+	// connections reach the client through it
+	conn Conn
+	// Set by HELLO 3, read when pushing messages from other goroutines
+	resp3 atomic.Bool
+
+	// Killed by itself, the connection closes once the reply is written
+	closeAfterReply bool
+	noEvict         bool
+	noTouch         bool // Reading keys leaves their access time alone
+	monitor         bool // Receives every command run by the server
+	unixSocket      bool // Connected over the Unix socket
+
+	// What CLIENT LIST reports about the client, read by other connections
+	infoMu sync.Mutex
+	info   clientInfo
+
+	// Transaction state
+	multi      bool       // Inside MULTI, commands are queued
+	multiError bool       // A command could not be queued, EXEC will fail
+	queued     []*Command // Commands queued for EXEC
+	inExec     bool       // Running the queued commands
+
+	// Blocking state
+	waiter    *waiter // Set while blocked on keys
+	readyKeys []dbKey // Keys that received elements during the command
+
+	// Pub/sub state
+	channels map[string]struct{}
+	patterns map[string]struct{}
+
+	// Client side caching state
+	tracking *trackingState // Set while CLIENT TRACKING is on
+	caching  bool           // CLIENT CACHING was called for the next command
+}
+
+// clientInfo is a snapshot of the client state taken after every command,
+// along with the attributes set by CLIENT SETNAME and CLIENT SETINFO
+type clientInfo struct {
+	name            string
+	libName         string
+	libVer          string
+	db              int
+	flags           string
+	sub             int
+	psub            int
+	multi           int // Commands queued, -1 outside of MULTI
+	redirect        int64
+	resp            int
+	lastCmd         string
+	lastInteraction time.Time
+}
+
+// NewClient registers a new connection from addr to the local address laddr.
+// The client is visible to the other connections from then on, through conn.
+func (h *Handler) NewClient(addr, laddr string, conn Conn) *Client {
+	return h.newClient(addr, laddr, false, conn)
+}
+
+// NewUnixClient registers a new connection to the Unix socket at path. Like
+// in Redis, both of its addresses are path:0.
+func (h *Handler) NewUnixClient(path string, conn Conn) *Client {
+	return h.newClient(path+":0", path+":0", true, conn)
+}
+
+func (h *Handler) newClient(addr, laddr string, unixSocket bool, conn Conn) *Client {
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+
+	h.nextClientID++
+	now := time.Now()
+	c := &Client{ID: h.nextClientID, Addr: addr, LocalAddr: laddr, created: now, conn: conn, unixSocket: unixSocket}
+	c.info = clientInfo{multi: -1, redirect: -1, resp: 2, flags: "N", lastCmd: "NULL", lastInteraction: now}
+	if unixSocket {
+		c.info.flags = "U"
+	}
+	h.clients[c.ID] = c
+	return c
+}
+
+// CloseAfterReply reports whether the connection must be closed once the
+// reply to the last command is written
+func (c *Client) CloseAfterReply() bool {
+	return c.closeAfterReply
+}
+
+// Record the state other connections may inspect after running cmd
+func (c *Client) updateInfo(cmd *Command) {
+	var flags strings.Builder
+	if c.monitor {
+		flags.WriteByte('O')
+	}
+	if c.multi {
+		flags.WriteByte('x')
+	}
+	if c.subscriptionCount() > 0 {
+		flags.WriteByte('P')
+	}
+	redirect := int64(-1)
+	if s := c.tracking; s != nil {
+		flags.WriteByte('t')
+		if s.bcast {
+			flags.WriteByte('B')
+		}
+		redirect = s.redirect
+	}
+	if c.unixSocket {
+		flags.WriteByte('U')
+	}
+	if c.noTouch {
+		flags.WriteByte('T')
+	}
+	if c.noEvict {
+		flags.WriteByte('e')
+	}
+	if flags.Len() == 0 {
+		flags.WriteByte('N')
+	}
+	multi, proto := -1, 2
+	if c.multi {
+		multi = len(c.queued)
+	}
+	if c.resp3.Load() {
+		proto = 3
+	}
+
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	c.info.db = c.db
+	c.info.flags = flags.String()
+	c.info.sub, c.info.psub = len(c.channels), len(c.patterns)
+	c.info.multi = multi
+	c.info.redirect = redirect
+	c.info.resp = proto
+	c.info.lastCmd = strings.ToLower(cmd.Name)
+	c.info.lastInteraction = time.Now()
+}
+
+// RemoveClient forgets a closed connection
+func (h *Handler) RemoveClient(c *Client) {
+	if c.waiter != nil {
+		h.blocked.remove(c.waiter)
+		c.waiter = nil
+	}
+	h.unsubscribeAll(c)
+	h.tracking.disable(c)
+	if c.monitor {
+		h.monitors.remove(c)
+	}
+
+	h.clientsMu.Lock()
+	delete(h.clients, c.ID)
+	h.clientsMu.Unlock()
+}
+
+// Look up a connected client, nil when there is none with that ID
+func (h *Handler) clientByID(id int64) *Client {
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+	return h.clients[id]
+}
+
+func (h *Handler) clientCount() int {
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+	return len(h.clients)
+}
+
+var clientHelp = []string{
+	"CLIENT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"CACHING (YES|NO)",
+	"    Enable/disable tracking of the keys for next command in OPTIN/OPTOUT modes.",
+	"GETREDIR",
+	"    Return the client ID we are redirecting to when tracking is enabled.",
+	"GETNAME",
+	"    Return the name of the current connection.",
+	"ID",
+	"    Return the ID of the current connection.",
+	"INFO",
+	"    Return information about the current client connection.",
+	"KILL <ip:port>",
+	"    Kill connection made from <ip:port>.",
+	"KILL <option> <value> [<option> <value> [...]]",
+	"    Kill connections. Options are:",
+	"    * ADDR (<ip:port>|<unixsocket>:0)",
+	"      Kill connections made from the specified address",
+	"    * LADDR (<ip:port>|<unixsocket>:0)",
+	"      Kill connections made to specified local address",
+	"    * TYPE (NORMAL|MASTER|REPLICA|PUBSUB)",
+	"      Kill connections by type.",
+	"    * USER <username>",
+	"      Kill connections authenticated by <username>.",
+	"    * SKIPME (YES|NO)",
+	"      Skip killing current connection (default: yes).",
+	"    * ID <client-id>",
+	"      Kill connections by client id.",
+	"    * MAXAGE <maxage>",
+	"      Kill connections older than the specified age.",
+	"LIST [options ...]",
+	"    Return information about client connections. Options:",
+	"    * TYPE (NORMAL|MASTER|REPLICA|PUBSUB)",
+	"      Return clients of specified type.",
+	"    * ID <client-id> [<client-id> ...]",
+	"      Return clients with the specified IDs.",
+	"UNPAUSE",
+	"    Stop the current client pause, resuming traffic.",
+	"PAUSE <timeout> [WRITE|ALL]",
+	"    Suspend all, or just write, clients for <timeout> milliseconds.",
+	"SETNAME <name>",
+	"    Assign the name <name> to the current connection.",
+	"SETINFO <option> <value>",
+	"    Set client meta attr. Options are:",
+	"    * LIB-NAME: the client lib name.",
+	"    * LIB-VER: the client lib version.",
+	"UNBLOCK <clientid> [TIMEOUT|ERROR]",
+	"    Unblock the specified blocked client.",
+	"TRACKING (ON|OFF) [REDIRECT <id>] [BCAST] [PREFIX <prefix> [...]]",
+	"         [OPTIN] [OPTOUT] [NOLOOP]",
+	"    Control server assisted client side caching.",
+	"TRACKINGINFO",
+	"    Report tracking status for the current connection.",
+	"NO-EVICT (ON|OFF)",
+	"    Protect current client connection from eviction.",
+	"NO-TOUCH (ON|OFF)",
+	"    Will not touch LRU/LFU stats when this mode is on.",
+	"HELP",
+	"    Print this help.",
+}
+
+// Handler for CLIENT command
+func (h *Handler) handleClient(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	subcommand := strings.ToUpper(string(cmd.Args[0]))
+	args := cmd.Args[1:]
+	switch {
+	case subcommand == "ID" && len(args) == 0:
+		return &resp.Integer{Data: c.ID}
+	case subcommand == "UNBLOCK":
+		return h.handleClientUnblock(args)
+	case subcommand == "TRACKING":
+		return h.handleClientTracking(c, args)
+	case subcommand == "CACHING":
+		return h.handleClientCaching(c, args)
+	case subcommand == "GETREDIR" && len(args) == 0:
+		return h.handleClientGetRedir(c)
+	case subcommand == "TRACKINGINFO" && len(args) == 0:
+		return h.handleClientTrackingInfo(c)
+	case subcommand == "SETNAME" && len(args) == 1:
+		return h.handleClientSetName(c, args[0])
+	case subcommand == "GETNAME" && len(args) == 0:
+		c.infoMu.Lock()
+		defer c.infoMu.Unlock()
+		if c.info.name == "" {
+			return &resp.BulkString{Data: nil}
+		}
+		return &resp.BulkString{Data: []byte(c.info.name)}
+	case subcommand == "SETINFO" && len(args) == 2:
+		return h.handleClientSetInfo(c, args)
+	case subcommand == "LIST":
+		return h.handleClientList(c, args)
+	case subcommand == "INFO" && len(args) == 0:
+		c.updateInfo(&Command{Name: "CLIENT"})
+		return &resp.BulkString{Data: []byte(h.clientInfoLine(c) + "\n")}
+	case subcommand == "KILL":
+		return h.handleClientKill(c, args)
+	case subcommand == "PAUSE":
+		return h.handleClientPause(args)
+	case subcommand == "UNPAUSE" && len(args) == 0:
+		h.pause.unpause()
+		return &resp.SimpleString{Data: "OK"}
+	case (subcommand == "NO-EVICT" || subcommand == "NO-TOUCH") && len(args) == 1:
+		var on bool
+		switch strings.ToUpper(string(args[0])) {
+		case "ON":
+			on = true
+		case "OFF":
+		default:
+			return &resp.Error{Data: syntaxError}
+		}
+		if subcommand == "NO-EVICT" {
+			c.noEvict = on
+		} else {
+			c.noTouch = on
+		}
+		return &resp.SimpleString{Data: "OK"}
+	case subcommand == "HELP" && len(args) == 0:
+		return helpReply(clientHelp)
+	default:
+		return &resp.Error{Data: fmt.Sprintf("ERR unknown subcommand '%s'. Try CLIENT HELP.", cmd.Args[0])}
+	}
+}
+
+// CLIENT UNBLOCK client-id [TIMEOUT|ERROR]
+func (h *Handler) handleClientUnblock(args [][]byte) resp.RESPData {
+	if len(args) < 1 || len(args) > 2 {
+		return &resp.Error{Data: "ERR wrong number of arguments for 'client|unblock' command"}
+	}
+	id, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil {
+		return &resp.Error{Data: notIntegerError}
+	}
+
+	withError := false
+	if len(args) == 2 {
+		switch strings.ToUpper(string(args[1])) {
+		case "TIMEOUT":
+		case "ERROR":
+			withError = true
+		default:
+			return &resp.Error{Data: "ERR CLIENT UNBLOCK reason should be TIMEOUT or ERROR"}
+		}
+	}
+
+	if h.blocked.unblock(id, withError) {
+		return &resp.Integer{Data: 1}
+	}
+	return &resp.Integer{Data: 0}
+}
+
+// Reply with key value pairs, as a map to RESP3 clients and as a flat array
+// to RESP2 ones
+func mapReply(c *Client, pairs []resp.RESPData) resp.RESPData {
+	if c.resp3.Load() {
+		return &resp.Map{Data: pairs}
+	}
+	return &resp.Array{Data: pairs}
+}
+
+// Version reported to the clients checking for the features they rely on
+const redisVersion = "7.2.0"
+
+// Handler for HELLO command
+// HELLO [protover]
+func (h *Handler) handleHello(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if len(cmd.Args) > 0 {
+		version, err := strconv.ParseInt(string(cmd.Args[0]), 10, 64)
+		if err != nil {
+			return &resp.Error{Data: "ERR Protocol version is not an integer or out of range"}
+		}
+		if version < 2 || version > 3 {
+			return &resp.Error{Data: "NOPROTO unsupported protocol version"}
+		}
+		if len(cmd.Args) > 1 {
+			return &resp.Error{Data: fmt.Sprintf("ERR Syntax error in HELLO option '%s'", cmd.Args[1])}
+		}
+		c.resp3.Store(version == 3)
+	}
+
+	proto := int64(2)
+	if c.resp3.Load() {
+		proto = 3
+	}
+	return mapReply(c, []resp.RESPData{
+		&resp.BulkString{Data: []byte("server")}, &resp.BulkString{Data: []byte("redis")},
+		&resp.BulkString{Data: []byte("version")}, &resp.BulkString{Data: []byte(redisVersion)},
+		&resp.BulkString{Data: []byte("proto")}, &resp.Integer{Data: proto},
+		&resp.BulkString{Data: []byte("id")}, &resp.Integer{Data: c.ID},
+		&resp.BulkString{Data: []byte("mode")}, &resp.BulkString{Data: []byte("standalone")},
+		&resp.BulkString{Data: []byte("role")}, &resp.BulkString{Data: []byte("master")},
+		&resp.BulkString{Data: []byte("modules")}, &resp.Array{Data: []resp.RESPData{}},
+	})
+}
+
+// Names and library attributes show up space separated in CLIENT LIST
+func validClientAttribute(value []byte) bool {
+	for _, b := range value {
+		if b < '!' || b > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// CLIENT SETNAME connection-name
+func (h *Handler) handleClientSetName(c *Client, name []byte) resp.RESPData {
+	if !validClientAttribute(name) {
+		return &resp.Error{Data: "ERR Client names cannot contain spaces, newlines or special characters."}
+	}
+	c.infoMu.Lock()
+	c.info.name = string(name)
+	c.infoMu.Unlock()
+	return &resp.SimpleString{Data: "OK"}
+}
+
+// CLIENT SETINFO LIB-NAME|LIB-VER value
+func (h *Handler) handleClientSetInfo(c *Client, args [][]byte) resp.RESPData {
+	attr := strings.ToLower(string(args[0]))
+	if attr != "lib-name" && attr != "lib-ver" {
+		return &resp.Error{Data: fmt.Sprintf("ERR Unrecognized option '%s'", args[0])}
+	}
+	if !validClientAttribute(args[1]) {
+		return &resp.Error{Data: fmt.Sprintf("ERR %s cannot contain spaces, newlines or special characters.", attr)}
+	}
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	if attr == "lib-name" {
+		c.info.libName = string(args[1])
+	} else {
+		c.info.libVer = string(args[1])
+	}
+	return &resp.SimpleString{Data: "OK"}
+}
+
+// Every connected client, in ascending ID order
+func (h *Handler) clientList() []*Client {
+	h.clientsMu.Lock()
+	clients := make([]*Client, 0, len(h.clients))
+	for _, c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.clientsMu.Unlock()
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	return clients
+}
+
+// CLIENT LIST [TYPE normal|master|replica|pubsub] [ID client-id ...]
+func (h *Handler) handleClientList(c *Client, args [][]byte) resp.RESPData {
+	clientType := ""
+	var ids map[int64]bool
+	if len(args) > 0 {
+		switch strings.ToUpper(string(args[0])) {
+		case "TYPE":
+			if len(args) != 2 {
+				return &resp.Error{Data: syntaxError}
+			}
+			clientType = strings.ToLower(string(args[1]))
+			switch clientType {
+			case "normal", "pubsub", "master", "replica", "slave":
+			default:
+				return &resp.Error{Data: fmt.Sprintf("ERR Unknown client type '%s'", args[1])}
+			}
+		case "ID":
+			if len(args) < 2 {
+				return &resp.Error{Data: syntaxError}
+			}
+			ids = make(map[int64]bool)
+			for _, arg := range args[1:] {
+				id, err := strconv.ParseInt(string(arg), 10, 64)
+				if err != nil || id <= 0 {
+					return &resp.Error{Data: "ERR Invalid client ID"}
+				}
+				ids[id] = true
+			}
+		default:
+			return &resp.Error{Data: syntaxError}
+		}
+	}
+
+	// The calling client is in the middle of its command
+	c.updateInfo(&Command{Name: "CLIENT"})
+	var list strings.Builder
+	for _, client := range h.clientList() {
+		if ids != nil && !ids[client.ID] {
+			continue
+		}
+		if clientType != "" && client.clientType() != clientType {
+			continue
+		}
+		list.WriteString(h.clientInfoLine(client))
+		list.WriteByte('\n')
+	}
+	return &resp.BulkString{Data: []byte(list.String())}
+}
+
+// Class of a client for the TYPE filters of CLIENT LIST and CLIENT KILL
+func (c *Client) clientType() string {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	if c.info.sub+c.info.psub > 0 {
+		return "pubsub"
+	}
+	return "normal"
+}
+
+// Describe a client the way CLIENT LIST does
+func (h *Handler) clientInfoLine(c *Client) string {
+	var qbuf, omem int
+	if c.conn.Buffers != nil {
+		qbuf, omem = c.conn.Buffers()
+	}
+	blocked := h.blocked.isBlocked(c.ID)
+
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	now := time.Now()
+	flags := c.info.flags
+	if blocked {
+		flags = strings.TrimPrefix(flags+"b", "N")
+	}
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s age=%d idle=%d flags=%s db=%d sub=%d psub=%d multi=%d qbuf=%d omem=%d cmd=%s user=default redir=%d resp=%d lib-name=%s lib-ver=%s",
+		c.ID, c.Addr, c.LocalAddr, c.info.name,
+		int64(now.Sub(c.created)/time.Second), int64(now.Sub(c.info.lastInteraction)/time.Second),
+		flags, c.info.db, c.info.sub, c.info.psub, c.info.multi, qbuf, omem, c.info.lastCmd,
+		c.info.redirect, c.info.resp, c.info.libName, c.info.libVer)
+}
+
+// CLIENT KILL addr:port
+// CLIENT KILL [ID client-id] [TYPE type] [ADDR addr:port] [LADDR addr:port] [USER username] [SKIPME yes|no] [MAXAGE seconds] ...
+func (h *Handler) handleClientKill(c *Client, args [][]byte) resp.RESPData {
+	// The old form kills a single client by address
+	if len(args) == 1 {
+		for _, client := range h.clientList() {
+			if client.Addr == string(args[0]) {
+				h.killClient(c, client)
+				return &resp.SimpleString{Data: "OK"}
+			}
+		}
+		return &resp.Error{Data: "ERR No such client"}
+	}
+	if len(args) == 0 || len(args)%2 != 0 {
+		return &resp.Error{Data: syntaxError}
+	}
+
+	var filters []func(*Client) bool
+	skipMe := true
+	for i := 0; i < len(args); i += 2 {
+		value := string(args[i+1])
+		switch strings.ToUpper(string(args[i])) {
+		case "ID":
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				return &resp.Error{Data: "ERR client-id should be greater than 0"}
+			}
+			filters = append(filters, func(client *Client) bool { return client.ID == id })
+		case "TYPE":
+			clientType := strings.ToLower(value)
+			switch clientType {
+			case "normal", "pubsub", "master", "replica", "slave":
+			default:
+				return &resp.Error{Data: fmt.Sprintf("ERR Unknown client type '%s'", value)}
+			}
+			filters = append(filters, func(client *Client) bool { return client.clientType() == clientType })
+		case "ADDR":
+			filters = append(filters, func(client *Client) bool { return client.Addr == value })
+		case "LADDR":
+			filters = append(filters, func(client *Client) bool { return client.LocalAddr == value })
+		case "USER":
+			// Every connection is authenticated as the default user
+			if value != "default" {
+				return &resp.Error{Data: fmt.Sprintf("ERR No such user '%s'", value)}
+			}
+		case "SKIPME":
+			switch strings.ToLower(value) {
+			case "yes":
+				skipMe = true
+			case "no":
+				skipMe = false
+			default:
+				return &resp.Error{Data: syntaxError}
+			}
+		case "MAXAGE":
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return &resp.Error{Data: notIntegerError}
+			}
+			maxAge := time.Duration(seconds) * time.Second
+			filters = append(filters, func(client *Client) bool { return time.Since(client.created) >= maxAge })
+		default:
+			return &resp.Error{Data: syntaxError}
+		}
+	}
+
+	killed := 0
+clients:
+	for _, client := range h.clientList() {
+		if skipMe && client == c {
+			continue
+		}
+		for _, filter := range filters {
+			if !filter(client) {
+				continue clients
+			}
+		}
+		h.killClient(c, client)
+		killed++
+	}
+	return &resp.Integer{Data: int64(killed)}
+}
+
+// Close the connection of target. A client killing itself gets the reply to
+// CLIENT KILL first.
+func (h *Handler) killClient(c, target *Client) {
+	if target == c {
+		c.closeAfterReply = true
+		return
+	}
+	if target.conn.Close != nil {
+		target.conn.Close()
+	}
+}
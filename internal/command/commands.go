@@ -0,0 +1,246 @@
+package command
+
+import (
+	"strconv"
+
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// Command flags
+const (
+	// Transaction control commands run immediately instead of being queued
+	flagNoQueue = 1 << iota
+	// Commands reading keys only known while they run, like the patterns of
+	// SORT, lock the whole keyspace
+	flagLockAll
+	// Commands allowed while the client is subscribed to channels
+	flagPubSub
+	// Commands only reading keys, looking up a missing key is a key miss
+	flagReadOnly
+	// Administrative commands are not shown to MONITOR clients
+	flagAdmin
+	// Commands running in constant or logarithmic time, sampled apart from
+	// the others by the latency monitor
+	flagFast
+)
+
+type commandSpec struct {
+	name string
+	// Number of arguments including the command name, -N means at least N
+	arity   int
+	flags   int
+	keys    func(args [][]byte) []string // Keys the command accesses
+	handler func(h *Handler, c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData
+}
+
+func (s *commandSpec) checkArity(cmd *Command) bool {
+	n := len(cmd.Args) + 1
+	if s.arity < 0 {
+		return n >= -s.arity
+	}
+	return n == s.arity
+}
+
+func (s *commandSpec) keysOf(args [][]byte) []string {
+	if s.keys == nil {
+		return nil
+	}
+	return s.keys(args)
+}
+
+// keyRange selects the keys from argument first to last every step
+// arguments. A negative last counts from the end, -1 being the last argument.
+func keyRange(first, last, step int) func(args [][]byte) []string {
+	return func(args [][]byte) []string {
+		end := last
+		if end < 0 {
+			end += len(args)
+		}
+		var keys []string
+		for i := first; i <= end && i < len(args); i += step {
+			keys = append(keys, string(args[i]))
+		}
+		return keys
+	}
+}
+
+// numKeys selects the keys of commands taking a "numkeys key [key ...]"
+// argument list, where numkeys is the argument at index pos. Invalid counts
+// select nothing and are reported by the command itself.
+func numKeys(pos int) func(args [][]byte) []string {
+	return func(args [][]byte) []string {
+		if pos >= len(args) {
+			return nil
+		}
+		n, err := strconv.Atoi(string(args[pos]))
+		if err != nil || n <= 0 || pos+n >= len(args) {
+			return nil
+		}
+		keys := make([]string, n)
+		for i := range keys {
+			keys[i] = string(args[pos+1+i])
+		}
+		return keys
+	}
+}
+
+var commandTable map[string]*commandSpec
+
+func registerCommands(specs ...*commandSpec) {
+	for _, spec := range specs {
+		commandTable[spec.name] = spec
+	}
+}
+
+func init() {
+	commandTable = make(map[string]*commandSpec)
+
+	registerCommands(
+		// Connection
+		&commandSpec{name: "PING", arity: -1, flags: flagPubSub | flagFast, handler: (*Handler).handlePing},
+		&commandSpec{name: "CLIENT", arity: -2, handler: (*Handler).handleClient},
+		&commandSpec{name: "HELLO", arity: -1, flags: flagFast, handler: (*Handler).handleHello},
+		&commandSpec{name: "INFO", arity: -1, handler: (*Handler).handleInfo},
+		&commandSpec{name: "SELECT", arity: 2, flags: flagFast, handler: (*Handler).handleSelect},
+		&commandSpec{name: "CONFIG", arity: -2, flags: flagAdmin, handler: (*Handler).handleConfig},
+		&commandSpec{name: "SLOWLOG", arity: -2, flags: flagAdmin, handler: (*Handler).handleSlowlog},
+		&commandSpec{name: "MONITOR", arity: 1, flags: flagAdmin, handler: (*Handler).handleMonitor},
+		&commandSpec{name: "LATENCY", arity: -2, flags: flagAdmin, handler: (*Handler).handleLatency},
+		&commandSpec{name: "SHUTDOWN", arity: -1, flags: flagAdmin, handler: (*Handler).handleShutdown},
+
+		// Pub/Sub
+		&commandSpec{name: "SUBSCRIBE", arity: -2, flags: flagPubSub, handler: (*Handler).handleSubscribe},
+		&commandSpec{name: "UNSUBSCRIBE", arity: -1, flags: flagPubSub, handler: (*Handler).handleUnsubscribe},
+		&commandSpec{name: "PSUBSCRIBE", arity: -2, flags: flagPubSub, handler: (*Handler).handlePSubscribe},
+		&commandSpec{name: "PUNSUBSCRIBE", arity: -1, flags: flagPubSub, handler: (*Handler).handlePUnsubscribe},
+		&commandSpec{name: "PUBLISH", arity: 3, flags: flagFast, handler: (*Handler).handlePublish},
+		&commandSpec{name: "PUBSUB", arity: -2, handler: (*Handler).handlePubSub},
+
+		// Transactions
+		&commandSpec{name: "MULTI", arity: 1, flags: flagNoQueue | flagFast, handler: (*Handler).handleMulti},
+		&commandSpec{name: "EXEC", arity: 1, flags: flagNoQueue, handler: (*Handler).handleExec},
+		&commandSpec{name: "DISCARD", arity: 1, flags: flagNoQueue | flagFast, handler: (*Handler).handleDiscard},
+
+		// Strings
+		&commandSpec{name: "SET", arity: -3, keys: keyRange(0, 0, 1), handler: (*Handler).handleSet},
+		&commandSpec{name: "SETNX", arity: 3, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleSetNX},
+		&commandSpec{name: "SETEX", arity: 4, keys: keyRange(0, 0, 1), handler: (*Handler).handleSetEX},
+		&commandSpec{name: "PSETEX", arity: 4, keys: keyRange(0, 0, 1), handler: (*Handler).handlePSetEX},
+		&commandSpec{name: "GET", arity: 2, flags: flagReadOnly | flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleGet},
+		&commandSpec{name: "GETSET", arity: 3, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleGetSet},
+		&commandSpec{name: "GETDEL", arity: 2, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleGetDel},
+		&commandSpec{name: "GETEX", arity: -2, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleGetEX},
+		&commandSpec{name: "MGET", arity: -2, flags: flagReadOnly | flagFast, keys: keyRange(0, -1, 1), handler: (*Handler).handleMGet},
+		&commandSpec{name: "MSET", arity: -3, keys: keyRange(0, -1, 2), handler: (*Handler).handleMSet},
+		&commandSpec{name: "MSETNX", arity: -3, keys: keyRange(0, -1, 2), handler: (*Handler).handleMSetNX},
+		&commandSpec{name: "STRLEN", arity: 2, flags: flagReadOnly | flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleStrLen},
+		&commandSpec{name: "APPEND", arity: 3, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleAppend},
+		&commandSpec{name: "GETRANGE", arity: 4, flags: flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleGetRange},
+		&commandSpec{name: "SUBSTR", arity: 4, flags: flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleGetRange},
+		&commandSpec{name: "SETRANGE", arity: 4, keys: keyRange(0, 0, 1), handler: (*Handler).handleSetRange},
+		&commandSpec{name: "INCR", arity: 2, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleIncr},
+		&commandSpec{name: "DECR", arity: 2, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleDecr},
+		&commandSpec{name: "INCRBY", arity: 3, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleIncrBy},
+		&commandSpec{name: "DECRBY", arity: 3, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleDecrBy},
+		&commandSpec{name: "INCRBYFLOAT", arity: 3, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleIncrByFloat},
+		&commandSpec{name: "LCS", arity: -3, flags: flagReadOnly, keys: keyRange(0, 1, 1), handler: (*Handler).handleLCS},
+
+		// Keys
+		&commandSpec{name: "DEL", arity: -2, keys: keyRange(0, -1, 1), handler: (*Handler).handleDel},
+		&commandSpec{name: "UNLINK", arity: -2, keys: keyRange(0, -1, 1), handler: (*Handler).handleUnlink},
+		&commandSpec{name: "EXISTS", arity: -2, flags: flagReadOnly | flagFast, keys: keyRange(0, -1, 1), handler: (*Handler).handleExists},
+		&commandSpec{name: "TOUCH", arity: -2, flags: flagReadOnly | flagFast, keys: keyRange(0, -1, 1), handler: (*Handler).handleTouch},
+		&commandSpec{name: "TYPE", arity: 2, flags: flagReadOnly | flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleType},
+		&commandSpec{name: "RENAME", arity: 3, keys: keyRange(0, 1, 1), handler: (*Handler).handleRename},
+		&commandSpec{name: "RENAMENX", arity: 3, flags: flagFast, keys: keyRange(0, 1, 1), handler: (*Handler).handleRenameNX},
+		&commandSpec{name: "COPY", arity: -3, keys: keyRange(0, 1, 1), handler: (*Handler).handleCopy},
+		&commandSpec{name: "SORT", arity: -2, flags: flagLockAll, keys: sortKeys, handler: (*Handler).handleSort},
+		&commandSpec{name: "SORT_RO", arity: -2, flags: flagLockAll | flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleSortRO},
+		&commandSpec{name: "OBJECT", arity: -2, flags: flagReadOnly, keys: keyRange(1, 1, 1), handler: (*Handler).handleObject},
+		&commandSpec{name: "TTL", arity: 2, flags: flagReadOnly | flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleTTL},
+		&commandSpec{name: "PTTL", arity: 2, flags: flagReadOnly | flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handlePTTL},
+
+		// Bitmaps
+		&commandSpec{name: "SETBIT", arity: 4, keys: keyRange(0, 0, 1), handler: (*Handler).handleSetBit},
+		&commandSpec{name: "GETBIT", arity: 3, flags: flagReadOnly | flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleGetBit},
+		&commandSpec{name: "BITCOUNT", arity: -2, flags: flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleBitCount},
+		&commandSpec{name: "BITPOS", arity: -3, flags: flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleBitPos},
+		&commandSpec{name: "BITOP", arity: -4, keys: keyRange(1, -1, 1), handler: (*Handler).handleBitOp},
+		&commandSpec{name: "BITFIELD", arity: -2, keys: keyRange(0, 0, 1), handler: (*Handler).handleBitField},
+		&commandSpec{name: "BITFIELD_RO", arity: -2, flags: flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleBitFieldRO},
+
+		// HyperLogLog
+		&commandSpec{name: "PFADD", arity: -2, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handlePFAdd},
+		&commandSpec{name: "PFCOUNT", arity: -2, flags: flagReadOnly, keys: keyRange(0, -1, 1), handler: (*Handler).handlePFCount},
+		&commandSpec{name: "PFMERGE", arity: -2, keys: keyRange(0, -1, 1), handler: (*Handler).handlePFMerge},
+		&commandSpec{name: "PFDEBUG", arity: -3, keys: keyRange(1, 1, 1), handler: (*Handler).handlePFDebug},
+		&commandSpec{name: "PFSELFTEST", arity: 1, handler: (*Handler).handlePFSelfTest},
+
+		// Lists
+		&commandSpec{name: "LPUSH", arity: -3, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleLPush},
+		&commandSpec{name: "RPUSH", arity: -3, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleRPush},
+		&commandSpec{name: "LPOP", arity: -2, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleLPop},
+		&commandSpec{name: "RPOP", arity: -2, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleRPop},
+		&commandSpec{name: "LLEN", arity: 2, flags: flagReadOnly | flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleLLen},
+		&commandSpec{name: "LINDEX", arity: 3, flags: flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleLIndex},
+		&commandSpec{name: "LRANGE", arity: 4, flags: flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleLRange},
+		&commandSpec{name: "LMOVE", arity: 5, keys: keyRange(0, 1, 1), handler: (*Handler).handleLMove},
+		&commandSpec{name: "LMPOP", arity: -4, keys: numKeys(0), handler: (*Handler).handleLMPop},
+		&commandSpec{name: "BLPOP", arity: -3, keys: keyRange(0, -2, 1), handler: (*Handler).handleBLPop},
+		&commandSpec{name: "BRPOP", arity: -3, keys: keyRange(0, -2, 1), handler: (*Handler).handleBRPop},
+		&commandSpec{name: "BLMOVE", arity: 6, keys: keyRange(0, 1, 1), handler: (*Handler).handleBLMove},
+		&commandSpec{name: "BLMPOP", arity: -5, keys: numKeys(1), handler: (*Handler).handleBLMPop},
+
+		// Sets
+		&commandSpec{name: "SADD", arity: -3, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleSAdd},
+		&commandSpec{name: "SREM", arity: -3, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleSRem},
+		&commandSpec{name: "SCARD", arity: 2, flags: flagReadOnly | flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleSCard},
+		&commandSpec{name: "SISMEMBER", arity: 3, flags: flagReadOnly | flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleSIsMember},
+		&commandSpec{name: "SMEMBERS", arity: 2, flags: flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleSMembers},
+
+		// Hashes
+		&commandSpec{name: "HSET", arity: -4, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleHSet},
+		&commandSpec{name: "HGET", arity: 3, flags: flagReadOnly | flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleHGet},
+		&commandSpec{name: "HDEL", arity: -3, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleHDel},
+		&commandSpec{name: "HLEN", arity: 2, flags: flagReadOnly | flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleHLen},
+		&commandSpec{name: "HGETALL", arity: 2, flags: flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleHGetAll},
+
+		// Sorted sets
+		&commandSpec{name: "ZADD", arity: -4, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleZAdd},
+		&commandSpec{name: "ZCARD", arity: 2, flags: flagReadOnly | flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleZCard},
+		&commandSpec{name: "ZSCORE", arity: 3, flags: flagReadOnly | flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleZScore},
+		&commandSpec{name: "ZREM", arity: -3, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleZRem},
+		&commandSpec{name: "ZRANGE", arity: -4, flags: flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleZRange},
+		&commandSpec{name: "ZPOPMIN", arity: -2, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleZPopMin},
+		&commandSpec{name: "ZPOPMAX", arity: -2, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleZPopMax},
+		&commandSpec{name: "ZMPOP", arity: -4, keys: numKeys(0), handler: (*Handler).handleZMPop},
+		&commandSpec{name: "BZPOPMIN", arity: -3, keys: keyRange(0, -2, 1), handler: (*Handler).handleBZPopMin},
+		&commandSpec{name: "BZPOPMAX", arity: -3, keys: keyRange(0, -2, 1), handler: (*Handler).handleBZPopMax},
+		&commandSpec{name: "BZMPOP", arity: -5, keys: numKeys(1), handler: (*Handler).handleBZMPop},
+
+		// Geospatial indexes
+		&commandSpec{name: "GEOADD", arity: -5, keys: keyRange(0, 0, 1), handler: (*Handler).handleGeoAdd},
+		&commandSpec{name: "GEOPOS", arity: -2, flags: flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleGeoPos},
+		&commandSpec{name: "GEODIST", arity: -4, flags: flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleGeoDist},
+		&commandSpec{name: "GEOHASH", arity: -2, flags: flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleGeoHash},
+		&commandSpec{name: "GEOSEARCH", arity: -7, flags: flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleGeoSearch},
+		&commandSpec{name: "GEOSEARCHSTORE", arity: -8, keys: keyRange(0, 1, 1), handler: (*Handler).handleGeoSearchStore},
+
+		// Streams
+		&commandSpec{name: "XADD", arity: -5, keys: keyRange(0, 0, 1), handler: (*Handler).handleXAdd},
+		&commandSpec{name: "XLEN", arity: 2, flags: flagReadOnly | flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleXLen},
+		&commandSpec{name: "XRANGE", arity: -4, flags: flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleXRange},
+		&commandSpec{name: "XREVRANGE", arity: -4, flags: flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleXRevRange},
+		&commandSpec{name: "XDEL", arity: -3, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleXDel},
+		&commandSpec{name: "XTRIM", arity: -4, keys: keyRange(0, 0, 1), handler: (*Handler).handleXTrim},
+		&commandSpec{name: "XREAD", arity: -4, flags: flagReadOnly, keys: streamKeys, handler: (*Handler).handleXRead},
+		&commandSpec{name: "XREADGROUP", arity: -7, keys: streamKeys, handler: (*Handler).handleXReadGroup},
+		&commandSpec{name: "XGROUP", arity: -2, keys: keyRange(1, 1, 1), handler: (*Handler).handleXGroup},
+		&commandSpec{name: "XACK", arity: -4, flags: flagFast, keys: keyRange(0, 0, 1), handler: (*Handler).handleXAck},
+		&commandSpec{name: "XPENDING", arity: -3, flags: flagReadOnly, keys: keyRange(0, 0, 1), handler: (*Handler).handleXPending},
+		&commandSpec{name: "XCLAIM", arity: -6, keys: keyRange(0, 0, 1), handler: (*Handler).handleXClaim},
+		&commandSpec{name: "XAUTOCLAIM", arity: -6, keys: keyRange(0, 0, 1), handler: (*Handler).handleXAutoClaim},
+		&commandSpec{name: "XINFO", arity: -2, flags: flagReadOnly, keys: keyRange(1, 1, 1), handler: (*Handler).handleXInfo},
+	)
+}
@@ -0,0 +1,87 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/glob"
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/logging"
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+var configHelp = []string{
+	"CONFIG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"GET <pattern>",
+	"    Return parameters matching the glob-like <pattern> and their values.",
+	"SET <directive> <value>",
+	"    Set the configuration <directive> to <value>.",
+	"HELP",
+	"    Print this help.",
+}
+
+// Handler for CONFIG command
+func (h *Handler) handleConfig(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	subcommand := strings.ToUpper(string(cmd.Args[0]))
+	args := cmd.Args[1:]
+	switch {
+	case subcommand == "GET" && len(args) > 0:
+		return h.configGet(args)
+	case subcommand == "SET" && len(args) > 0 && len(args)%2 == 0:
+		return h.configSet(args)
+	case subcommand == "HELP" && len(args) == 0:
+		return helpReply(configHelp)
+	case subcommand == "GET" || subcommand == "SET" || subcommand == "HELP":
+		return &resp.Error{Data: fmt.Sprintf("ERR wrong number of arguments for 'config|%s' command", strings.ToLower(subcommand))}
+	default:
+		return &resp.Error{Data: fmt.Sprintf("ERR unknown subcommand '%s'. Try CONFIG HELP.", cmd.Args[0])}
+	}
+}
+
+// CONFIG GET parameter [parameter ...]
+// Parameters are glob patterns matched against the option names
+func (h *Handler) configGet(patterns [][]byte) resp.RESPData {
+	h.configMu.RLock()
+	defer h.configMu.RUnlock()
+
+	var reply [][]byte
+	for _, name := range config.Names() {
+		for _, pattern := range patterns {
+			if glob.Match(string(pattern), name, true) {
+				value, _ := h.config.Get(name)
+				reply = append(reply, []byte(name), []byte(value))
+				break
+			}
+		}
+	}
+	return bulkStrings(reply)
+}
+
+// CONFIG SET parameter value [parameter value ...]
+// Either every parameter is set, or none is
+func (h *Handler) configSet(args [][]byte) resp.RESPData {
+	h.configMu.Lock()
+	defer h.configMu.Unlock()
+
+	cfg := *h.config
+	for i := 0; i < len(args); i += 2 {
+		name := string(args[i])
+		err := cfg.Set(name, string(args[i+1]))
+		switch {
+		case errors.Is(err, config.ErrUnknownOption):
+			return &resp.Error{Data: fmt.Sprintf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", name)}
+		case err != nil:
+			return &resp.Error{Data: fmt.Sprintf("ERR CONFIG SET failed (possibly related to argument '%s') - %v", name, err)}
+		}
+	}
+
+	*h.config = cfg
+	h.notifyEvents.Store(int64(cfg.NotifyKeyspaceEvents))
+	h.slowlogThreshold.Store(int64(cfg.SlowlogLogSlowerThan))
+	h.slowlog.setMaxLen(cfg.SlowlogMaxLen)
+	h.latencyThreshold.Store(int64(cfg.LatencyMonitorThreshold))
+	logging.SetLevel(cfg.LogLevel)
+	return &resp.SimpleString{Data: "OK"}
+}
@@ -0,0 +1,467 @@
+package command
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+	"github.com/mmnalaka/medis/internal/types"
+)
+
+// Conversion of the supported units to meters
+var geoUnits = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"ft": 0.3048,
+	"mi": 1609.34,
+}
+
+func invalidCoordinatesError(lon, lat float64) *resp.Error {
+	return &resp.Error{Data: fmt.Sprintf("ERR invalid longitude,latitude pair %f,%f", lon, lat)}
+}
+
+// Parse a longitude and latitude pair
+func parseCoordinates(args [][]byte) (float64, float64, *resp.Error) {
+	lon, errReply := parseFloat(args[0])
+	if errReply != nil {
+		return 0, 0, errReply
+	}
+	lat, errReply := parseFloat(args[1])
+	if errReply != nil {
+		return 0, 0, errReply
+	}
+	if !types.ValidCoordinates(lon, lat) {
+		return 0, 0, invalidCoordinatesError(lon, lat)
+	}
+	return lon, lat, nil
+}
+
+// Parse a unit, returning its conversion to meters
+func parseUnit(arg []byte) (float64, *resp.Error) {
+	conversion, ok := geoUnits[strings.ToLower(string(arg))]
+	if !ok {
+		return 0, &resp.Error{Data: "ERR unsupported unit provided. please use M, KM, FT, MI"}
+	}
+	return conversion, nil
+}
+
+// Parse a positive distance followed by its unit, returning it in meters
+// and the conversion of the unit
+func parseDistance(arg, unit []byte, name string) (float64, float64, *resp.Error) {
+	distance, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(distance) {
+		return 0, 0, &resp.Error{Data: "ERR need numeric " + name}
+	}
+	if distance < 0 {
+		return 0, 0, &resp.Error{Data: "ERR " + name + " cannot be negative"}
+	}
+	conversion, errReply := parseUnit(unit)
+	if errReply != nil {
+		return 0, 0, errReply
+	}
+	return distance * conversion, conversion, nil
+}
+
+// Position of a member of a geo index, decoded from its score
+func memberPosition(zset *types.SortedSet, member string) (float64, float64, bool) {
+	score, ok := zset.Score(member)
+	if !ok {
+		return 0, 0, false
+	}
+	lon, lat := types.GeoDecode(uint64(score))
+	return lon, lat, true
+}
+
+// Coordinates are replied with up to 17 decimals, like Redis
+func coordinateReply(f float64) *resp.BulkString {
+	s := strconv.FormatFloat(f, 'f', 17, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	return &resp.BulkString{Data: []byte(s)}
+}
+
+func positionReply(lon, lat float64) *resp.Array {
+	return &resp.Array{Data: []resp.RESPData{coordinateReply(lon), coordinateReply(lat)}}
+}
+
+// Distances are replied with 4 decimals
+func distanceReply(distance float64) *resp.BulkString {
+	return &resp.BulkString{Data: []byte(strconv.FormatFloat(distance, 'f', 4, 64))}
+}
+
+// Handler for GEOADD command
+// GEOADD key [NX|XX] [CH] longitude latitude member [longitude latitude member ...]
+func (h *Handler) handleGeoAdd(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	var nx, xx bool
+	i := 1
+options:
+	for ; i < len(cmd.Args); i++ {
+		switch strings.ToUpper(string(cmd.Args[i])) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "CH":
+		default:
+			break options
+		}
+	}
+
+	triples := cmd.Args[i:]
+	if len(triples) == 0 || len(triples)%3 != 0 || (nx && xx) {
+		return &resp.Error{Data: syntaxError}
+	}
+
+	// Rewrite the command as a ZADD with the geohashes as scores
+	zadd := &Command{Name: "ZADD", Args: append([][]byte{}, cmd.Args[:i]...)}
+	for j := 0; j < len(triples); j += 3 {
+		lon, lat, errReply := parseCoordinates(triples[j : j+2])
+		if errReply != nil {
+			return errReply
+		}
+		score := strconv.FormatUint(types.GeoEncode(lon, lat), 10)
+		zadd.Args = append(zadd.Args, []byte(score), triples[j+2])
+	}
+	return h.handleZAdd(c, tx, zadd)
+}
+
+// Handler for GEOPOS command
+func (h *Handler) handleGeoPos(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	zset, errReply := getSortedSet(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+
+	reply := &resp.Array{Data: make([]resp.RESPData, len(cmd.Args)-1)}
+	for i, member := range cmd.Args[1:] {
+		reply.Data[i] = nullArray()
+		if zset == nil {
+			continue
+		}
+		if lon, lat, ok := memberPosition(zset, string(member)); ok {
+			reply.Data[i] = positionReply(lon, lat)
+		}
+	}
+	return reply
+}
+
+// Handler for GEODIST command
+// GEODIST key member1 member2 [M|KM|FT|MI]
+func (h *Handler) handleGeoDist(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if len(cmd.Args) > 4 {
+		return &resp.Error{Data: syntaxError}
+	}
+	conversion := 1.0
+	if len(cmd.Args) == 4 {
+		var errReply *resp.Error
+		if conversion, errReply = parseUnit(cmd.Args[3]); errReply != nil {
+			return errReply
+		}
+	}
+
+	zset, errReply := getSortedSet(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return &resp.BulkString{Data: nil}
+	}
+	lon1, lat1, ok1 := memberPosition(zset, string(cmd.Args[1]))
+	lon2, lat2, ok2 := memberPosition(zset, string(cmd.Args[2]))
+	if !ok1 || !ok2 {
+		return &resp.BulkString{Data: nil}
+	}
+	return distanceReply(types.GeoDistance(lon1, lat1, lon2, lat2) / conversion)
+}
+
+// Handler for GEOHASH command
+func (h *Handler) handleGeoHash(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	zset, errReply := getSortedSet(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+
+	reply := &resp.Array{Data: make([]resp.RESPData, len(cmd.Args)-1)}
+	for i, member := range cmd.Args[1:] {
+		reply.Data[i] = &resp.BulkString{Data: nil}
+		if zset == nil {
+			continue
+		}
+		if lon, lat, ok := memberPosition(zset, string(member)); ok {
+			reply.Data[i] = &resp.BulkString{Data: []byte(types.GeoHashString(lon, lat))}
+		}
+	}
+	return reply
+}
+
+// A search of GEOSEARCH or GEOSEARCHSTORE
+type geoSearch struct {
+	shape      types.GeoShape
+	conversion float64 // Meters per unit of the shape
+	byMember   bool    // The center is the position of member
+	member     string
+	desc       bool
+	sorted     bool
+	count      int
+	any        bool
+	withCoord  bool
+	withDist   bool
+	withHash   bool
+	storeDist  bool
+}
+
+// A member found by a search, with its distance in the unit of the shape
+type geoPoint struct {
+	member   string
+	score    float64
+	lon, lat float64
+	distance float64
+}
+
+// Parse the options of a search, starting after the source key
+func parseGeoSearch(args [][]byte, store bool) (*geoSearch, *resp.Error) {
+	name := "GEOSEARCH"
+	if store {
+		name = "GEOSEARCHSTORE"
+	}
+
+	s := &geoSearch{}
+	var fromLonLat, byRadius, byBox bool
+	for i := 0; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		switch arg := strings.ToUpper(string(args[i])); {
+		case arg == "WITHCOORD":
+			s.withCoord = true
+		case arg == "WITHDIST":
+			s.withDist = true
+		case arg == "WITHHASH":
+			s.withHash = true
+		case arg == "ANY":
+			s.any = true
+		case arg == "ASC":
+			s.sorted, s.desc = true, false
+		case arg == "DESC":
+			s.sorted, s.desc = true, true
+		case arg == "STOREDIST" && store:
+			s.storeDist = true
+		case arg == "COUNT" && remaining >= 1:
+			count, errReply := parseInt(args[i+1])
+			if errReply != nil {
+				return nil, errReply
+			}
+			if count <= 0 {
+				return nil, &resp.Error{Data: "ERR COUNT must be > 0"}
+			}
+			s.count = int(min(count, math.MaxInt32))
+			i++
+		case arg == "FROMMEMBER" && remaining >= 1:
+			if s.byMember {
+				return nil, &resp.Error{Data: syntaxError}
+			}
+			s.byMember, s.member = true, string(args[i+1])
+			i++
+		case arg == "FROMLONLAT" && remaining >= 2:
+			if fromLonLat {
+				return nil, &resp.Error{Data: syntaxError}
+			}
+			lon, lat, errReply := parseCoordinates(args[i+1 : i+3])
+			if errReply != nil {
+				return nil, errReply
+			}
+			s.shape.Lon, s.shape.Lat = lon, lat
+			fromLonLat = true
+			i += 2
+		case arg == "BYRADIUS" && remaining >= 2:
+			if byRadius {
+				return nil, &resp.Error{Data: syntaxError}
+			}
+			radius, conversion, errReply := parseDistance(args[i+1], args[i+2], "radius")
+			if errReply != nil {
+				return nil, errReply
+			}
+			s.shape.Radius, s.conversion = radius, conversion
+			byRadius = true
+			i += 2
+		case arg == "BYBOX" && remaining >= 3:
+			if byBox {
+				return nil, &resp.Error{Data: syntaxError}
+			}
+			width, _, errReply := parseDistance(args[i+1], args[i+3], "width")
+			if errReply != nil {
+				return nil, errReply
+			}
+			height, conversion, errReply := parseDistance(args[i+2], args[i+3], "height")
+			if errReply != nil {
+				return nil, errReply
+			}
+			s.shape.IsBox = true
+			s.shape.Width, s.shape.Height, s.conversion = width, height, conversion
+			byBox = true
+			i += 3
+		default:
+			return nil, &resp.Error{Data: syntaxError}
+		}
+	}
+
+	if store && (s.withDist || s.withHash || s.withCoord) {
+		return nil, &resp.Error{Data: "ERR " + name + " is not compatible with WITHDIST, WITHHASH and WITHCOORD options"}
+	}
+	if s.byMember == fromLonLat {
+		return nil, &resp.Error{Data: "ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + name}
+	}
+	if byRadius == byBox {
+		return nil, &resp.Error{Data: "ERR exactly one of BYRADIUS and BYBOX can be specified for " + name}
+	}
+	if s.any && s.count == 0 {
+		return nil, &resp.Error{Data: "ERR the ANY argument requires COUNT argument"}
+	}
+	// The closest members are returned first when a COUNT is given, unless
+	// any matching member will do
+	if s.count > 0 && !s.sorted && !s.any {
+		s.sorted = true
+	}
+	return s, nil
+}
+
+// Run the search on the geo index, scanning the members of the geohash
+// areas covering the shape
+func (s *geoSearch) run(zset *types.SortedSet) ([]geoPoint, *resp.Error) {
+	if s.byMember {
+		lon, lat, ok := memberPosition(zset, s.member)
+		if !ok {
+			return nil, &resp.Error{Data: "ERR could not decode requested zset member"}
+		}
+		s.shape.Lon, s.shape.Lat = lon, lat
+	}
+
+	var points []geoPoint
+scan:
+	for _, area := range s.shape.SearchAreas() {
+		min, max := area.ScoreRange()
+		for _, m := range zset.RangeByScore(float64(min), float64(max-1)) {
+			if s.any && len(points) >= s.count {
+				break scan
+			}
+			lon, lat := types.GeoDecode(uint64(m.Score))
+			distance, ok := s.shape.Contains(lon, lat)
+			if !ok {
+				continue
+			}
+			points = append(points, geoPoint{
+				member:   m.Name,
+				score:    m.Score,
+				lon:      lon,
+				lat:      lat,
+				distance: distance / s.conversion,
+			})
+		}
+	}
+
+	if s.sorted {
+		sort.SliceStable(points, func(i, j int) bool {
+			if s.desc {
+				return points[i].distance > points[j].distance
+			}
+			return points[i].distance < points[j].distance
+		})
+	}
+	if s.count > 0 && len(points) > s.count {
+		points = points[:s.count]
+	}
+	return points, nil
+}
+
+func (s *geoSearch) reply(points []geoPoint) *resp.Array {
+	reply := &resp.Array{Data: make([]resp.RESPData, len(points))}
+	for i, p := range points {
+		member := &resp.BulkString{Data: []byte(p.member)}
+		if !s.withDist && !s.withHash && !s.withCoord {
+			reply.Data[i] = member
+			continue
+		}
+
+		item := &resp.Array{Data: []resp.RESPData{member}}
+		if s.withDist {
+			item.Data = append(item.Data, distanceReply(p.distance))
+		}
+		if s.withHash {
+			item.Data = append(item.Data, &resp.Integer{Data: int64(p.score)})
+		}
+		if s.withCoord {
+			item.Data = append(item.Data, positionReply(p.lon, p.lat))
+		}
+		reply.Data[i] = item
+	}
+	return reply
+}
+
+// Handler for GEOSEARCH command
+// GEOSEARCH key FROMMEMBER member|FROMLONLAT longitude latitude
+// BYRADIUS radius unit|BYBOX width height unit [ASC|DESC] [COUNT count [ANY]]
+// [WITHCOORD] [WITHDIST] [WITHHASH]
+func (h *Handler) handleGeoSearch(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	search, errReply := parseGeoSearch(cmd.Args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+
+	zset, errReply := getSortedSet(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return &resp.Array{Data: []resp.RESPData{}}
+	}
+
+	points, errReply := search.run(zset)
+	if errReply != nil {
+		return errReply
+	}
+	return search.reply(points)
+}
+
+// Handler for GEOSEARCHSTORE command
+// GEOSEARCHSTORE destination source <GEOSEARCH options> [STOREDIST]
+func (h *Handler) handleGeoSearchStore(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	search, errReply := parseGeoSearch(cmd.Args[2:], true)
+	if errReply != nil {
+		return errReply
+	}
+
+	dest := string(cmd.Args[0])
+	zset, errReply := getSortedSet(tx, string(cmd.Args[1]))
+	if errReply != nil {
+		return errReply
+	}
+
+	var points []geoPoint
+	if zset != nil {
+		if points, errReply = search.run(zset); errReply != nil {
+			return errReply
+		}
+	}
+
+	// The destination is replaced, or deleted when nothing matched
+	if len(points) == 0 {
+		if tx.Delete(dest) {
+			h.notifyKeyspaceEvent(config.NotifyGeneric, "del", dest, tx.DB())
+		}
+		return &resp.Integer{Data: 0}
+	}
+	result := types.NewSortedSet()
+	for _, p := range points {
+		if search.storeDist {
+			result.Add(p.member, p.distance)
+		} else {
+			result.Add(p.member, p.score)
+		}
+	}
+	replaceKey(tx, dest, result)
+	h.notifyKeyspaceEvent(config.NotifyZSet, "geosearchstore", dest, tx.DB())
+	h.signalKeyAsReady(c, dest)
+	return &resp.Integer{Data: int64(len(points))}
+}
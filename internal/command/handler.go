@@ -2,72 +2,206 @@ package command
 
 import (
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/keyspace"
 	"github.com/mmnalaka/medis/internal/resp"
 )
 
+const wrongTypeError = "WRONGTYPE Operation against a key holding the wrong kind of value"
+
 type Handler struct {
-	store map[string][]byte
-	mu    sync.Mutex
+	// OnShutdown stops the server, for SHUTDOWN. When now is set the
+	// connections are closed without waiting for their commands to finish.
+	OnShutdown func(now bool)
+
+	store    *keyspace.Keyspace
+	blocked  *blockingRegistry
+	pubsub   *pubsubRegistry
+	tracking *trackingTable
+	pause    *pauseState
+	slowlog  *slowLog
+	monitors *monitorRegistry
+	latency  *latencyMonitor
+
+	// Settings changed at runtime by CONFIG SET
+	configMu sync.RWMutex
+	config   *config.Config
+	// notify-keyspace-events, slowlog-log-slower-than and
+	// latency-monitor-threshold, read by every command
+	notifyEvents     atomic.Int64
+	slowlogThreshold atomic.Int64
+	latencyThreshold atomic.Int64
+
+	clientsMu    sync.Mutex
+	clients      map[int64]*Client
+	nextClientID int64
+
+	// Command calls and error replies, keys removed by expiration
+	commandStats map[string]*commandStats
+	errorsMu     sync.Mutex
+	errors       map[string]int64
+	expiredKeys  atomic.Int64
+
+	// Values being freed in the background, and freed so far
+	lazyfreePending atomic.Int64
+	lazyfreed       atomic.Int64
 }
 
-func NewHandler() *Handler {
-	return &Handler{
-		store: make(map[string][]byte),
+// NewHandler creates a handler running with the given configuration, which
+// it owns from then on
+func NewHandler(cfg *config.Config) *Handler {
+	h := &Handler{
+		store:    keyspace.New(keyspace.DefaultShards, keyspace.DefaultDatabases),
+		blocked:  newBlockingRegistry(),
+		pubsub:   newPubSubRegistry(),
+		tracking: newTrackingTable(),
+		pause:    newPauseState(),
+		slowlog:  newSlowLog(cfg.SlowlogMaxLen),
+		monitors: newMonitorRegistry(),
+		latency:  newLatencyMonitor(),
+		config:   cfg,
+		clients:  make(map[int64]*Client),
+
+		commandStats: newCommandStats(),
+		errors:       make(map[string]int64),
 	}
+	h.notifyEvents.Store(int64(cfg.NotifyKeyspaceEvents))
+	h.slowlogThreshold.Store(int64(cfg.SlowlogLogSlowerThan))
+	h.latencyThreshold.Store(int64(cfg.LatencyMonitorThreshold))
+	h.store.SetHooks(keyspace.Hooks{
+		Added: func(db int, key string) {
+			h.notifyKeyspaceEvent(config.NotifyNew, "new", key, db)
+		},
+		Expired: func(db int, key string) {
+			h.expiredKeys.Add(1)
+			h.notifyKeyspaceEvent(config.NotifyExpired, "expired", key, db)
+			h.invalidateKeys(nil, []string{key})
+		},
+	})
+	return h
+}
+
+// Config returns a snapshot of the current configuration
+func (h *Handler) Config() config.Config {
+	h.configMu.RLock()
+	defer h.configMu.RUnlock()
+	return *h.config
 }
 
 // Handle commands
-func (h *Handler) Handle(cmd *Command) resp.RESPData {
-	switch cmd.Name {
-	case "PING":
-		return h.handlePing()
-	case "SET":
-		return h.handleSet(cmd)
-	case "GET":
-		return h.handleGet(cmd)
-	default:
-		return h.handleUnknown(cmd)
+func (h *Handler) Handle(c *Client, cmd *Command) resp.RESPData {
+	defer c.updateInfo(cmd)
+
+	spec, ok := commandTable[cmd.Name]
+	if !ok {
+		c.flagTransactionError()
+		return h.rejectCommand(cmd, h.handleUnknown(cmd))
+	}
+	if !spec.checkArity(cmd) {
+		c.flagTransactionError()
+		return h.rejectCommand(cmd, wrongArgsError(cmd))
 	}
-}
 
-// Handler for PING command
-func (h *Handler) handlePing() resp.RESPData {
-	return &resp.SimpleString{Data: "PONG"}
-}
+	// Subscribed RESP2 clients only receive messages
+	if c.subscriptionCount() > 0 && !c.resp3.Load() && spec.flags&flagPubSub == 0 {
+		return h.rejectCommand(cmd, &resp.Error{Data: fmt.Sprintf("ERR Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT are allowed in this context", strings.ToLower(cmd.Name))})
+	}
 
-// Handler for unknown commands
-func (h *Handler) handleUnknown(cmd *Command) resp.RESPData {
-	return &resp.Error{Data: fmt.Sprintf("ERR unknown command %s", cmd.Name)}
-}
+	// Inside MULTI commands are queued until EXEC
+	if c.multi && spec.flags&flagNoQueue == 0 {
+		c.queued = append(c.queued, cmd)
+		return &resp.SimpleString{Data: "QUEUED"}
+	}
 
-// Handler for SET command
-func (h *Handler) handleSet(cmd *Command) resp.RESPData {
-	if len(cmd.Args) != 2 {
-		return &resp.Error{Data: "ERR wrong number of arguments for SET"}
+	// CLIENT CACHING applies to the next command, or the next transaction
+	caching := c.caching
+	start := time.Now()
+	reply := h.call(c, spec, cmd)
+	duration := time.Since(start)
+	h.logSlowCommand(c, cmd, duration)
+	if spec.flags&flagFast != 0 {
+		h.sampleLatency(latencyFastCommand, duration)
+	} else {
+		h.sampleLatency(latencyCommand, duration)
+	}
+	if caching && !c.multi {
+		c.caching = false
 	}
 
-	h.mu.Lock()
-	h.store[string(cmd.Args[0])] = cmd.Args[1]
-	defer h.mu.Unlock()
-	return &resp.SimpleString{Data: "OK"}
+	// Hand the elements pushed by the command to the clients waiting for them
+	h.serveBlockedClients(c)
+	return reply
 }
 
-// Handler for GET command
-func (h *Handler) handleGet(cmd *Command) resp.RESPData {
-	if len(cmd.Args) != 1 {
-		return &resp.Error{Data: "ERR wrong number of arguments for GET"}
+// Cron runs the periodic background work, called every period by the server.
+// Like Redis, the active expiration gets a quarter of the period.
+func (h *Handler) Cron(period time.Duration) {
+	if h.paused() {
+		return
 	}
+	start := time.Now()
+	h.store.ActiveExpireCycle(period / 4)
+	h.sampleLatency(latencyExpireCycle, time.Since(start))
+}
 
-	h.mu.Lock()
-	value, exists := h.store[string(cmd.Args[0])]
-	h.mu.Unlock()
+// Run a command with the shards of its keys locked
+func (h *Handler) call(c *Client, spec *commandSpec, cmd *Command) resp.RESPData {
+	var reply resp.RESPData
+	fn := func(tx *keyspace.Tx) {
+		reply = h.invoke(c, spec, tx, cmd)
+	}
+	if spec.flags&flagLockAll != 0 {
+		h.store.UpdateAll(c.db, fn)
+	} else {
+		h.store.Update(c.db, spec.keysOf(cmd.Args), fn)
+	}
+	return reply
+}
 
-	if !exists {
-		// Null if the key does not exist
-		return &resp.BulkString{Data: nil}
+// Run the handler of a command whose keys are locked
+func (h *Handler) invoke(c *Client, spec *commandSpec, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if spec.flags&flagReadOnly != 0 {
+		h.notifyKeyMisses(tx, spec.keysOf(cmd.Args))
+	}
+	// TOUCH updates the access time of the keys even for NO-TOUCH clients
+	tx.SetNoTouch(c.noTouch && cmd.Name != "TOUCH")
+	start := time.Now()
+	reply := spec.handler(h, c, tx, cmd)
+	h.commandStats[cmd.Name].record(time.Since(start), h.countError(reply))
+	h.trackKeys(c, spec, cmd.Args)
+	// Queued commands are shown as EXEC runs them, before EXEC itself
+	if spec.flags&flagAdmin == 0 {
+		h.feedMonitors(c, cmd)
 	}
+	return reply
+}
+
+// Handler for PING command
+func (h *Handler) handlePing(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	// Subscribed RESP2 clients get a message shaped reply
+	if c.subscriptionCount() > 0 && !c.resp3.Load() {
+		message := []byte{}
+		if len(cmd.Args) == 1 {
+			message = cmd.Args[0]
+		}
+		return bulkStrings([][]byte{[]byte("pong"), message})
+	}
+	if len(cmd.Args) == 1 {
+		return &resp.BulkString{Data: cmd.Args[0]}
+	}
+	return &resp.SimpleString{Data: "PONG"}
+}
+
+// Handler for unknown commands
+func (h *Handler) handleUnknown(cmd *Command) resp.RESPData {
+	return &resp.Error{Data: fmt.Sprintf("ERR unknown command %s", cmd.Name)}
+}
 
-	return &resp.BulkString{Data: value}
+func wrongArgsError(cmd *Command) *resp.Error {
+	return &resp.Error{Data: fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Name))}
 }
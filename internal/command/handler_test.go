@@ -0,0 +1,1684 @@
+package command
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+func newCommand(args ...string) *Command {
+	cmd := &Command{Name: strings.ToUpper(args[0]), rawName: args[0]}
+	for _, arg := range args[1:] {
+		cmd.Args = append(cmd.Args, []byte(arg))
+	}
+	return cmd
+}
+
+// Run a command and return its encoded reply
+func run(h *Handler, c *Client, args ...string) string {
+	reply := h.Handle(c, newCommand(args...))
+	if reply == nil {
+		return "<blocked>"
+	}
+	return string(reply.Encode())
+}
+
+// Start a blocking command, the reply is delivered on the returned channel
+func runBlocking(t *testing.T, h *Handler, c *Client, args ...string) <-chan string {
+	t.Helper()
+	if reply := h.Handle(c, newCommand(args...)); reply != nil {
+		t.Fatalf("expected %v to block, got %q", args, reply.Encode())
+	}
+	if !c.IsBlocked() {
+		t.Fatalf("expected client to be blocked")
+	}
+
+	replies := make(chan string, 1)
+	go func() {
+		replies <- string(h.WaitUnblocked(c, nil).Encode())
+	}()
+	return replies
+}
+
+func receive(t *testing.T, replies <-chan string) string {
+	t.Helper()
+	select {
+	case reply := <-replies:
+		return reply
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the blocked client")
+		return ""
+	}
+}
+
+func expectReply(t *testing.T, got, want string) {
+	t.Helper()
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHandler_Strings(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	expectReply(t, run(h, c, "GET", "k"), "$-1\r\n")
+	expectReply(t, run(h, c, "SET", "k", "v"), "+OK\r\n")
+	expectReply(t, run(h, c, "GET", "k"), "$1\r\nv\r\n")
+	expectReply(t, run(h, c, "GET"), "-ERR wrong number of arguments for 'get' command\r\n")
+	expectReply(t, run(h, c, "LPUSH", "k", "a"), "-"+wrongTypeError+"\r\n")
+}
+
+func TestHandler_Lists(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	expectReply(t, run(h, c, "RPUSH", "l", "a", "b", "c"), ":3\r\n")
+	expectReply(t, run(h, c, "LPUSH", "l", "z"), ":4\r\n")
+	expectReply(t, run(h, c, "LRANGE", "l", "0", "-1"), "*4\r\n$1\r\nz\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n")
+	expectReply(t, run(h, c, "LPOP", "l"), "$1\r\nz\r\n")
+	expectReply(t, run(h, c, "RPOP", "l", "2"), "*2\r\n$1\r\nc\r\n$1\r\nb\r\n")
+	expectReply(t, run(h, c, "LMOVE", "l", "m", "LEFT", "RIGHT"), "$1\r\na\r\n")
+	expectReply(t, run(h, c, "LLEN", "l"), ":0\r\n")
+	expectReply(t, run(h, c, "LMPOP", "2", "l", "m", "LEFT"), "*2\r\n$1\r\nm\r\n*1\r\n$1\r\na\r\n")
+	expectReply(t, run(h, c, "LMPOP", "2", "l", "m", "LEFT"), "*-1\r\n")
+}
+
+func TestHandler_SortedSets(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	expectReply(t, run(h, c, "ZADD", "z", "2", "b", "1", "a", "3", "c"), ":3\r\n")
+	expectReply(t, run(h, c, "ZADD", "z", "XX", "CH", "5", "a", "1", "d"), ":1\r\n")
+	expectReply(t, run(h, c, "ZADD", "z", "INCR", "1.5", "b"), "$3\r\n3.5\r\n")
+	expectReply(t, run(h, c, "ZRANGE", "z", "0", "-1", "WITHSCORES"), "*6\r\n$1\r\nc\r\n$1\r\n3\r\n$1\r\nb\r\n$3\r\n3.5\r\n$1\r\na\r\n$1\r\n5\r\n")
+	expectReply(t, run(h, c, "ZPOPMIN", "z"), "*2\r\n$1\r\nc\r\n$1\r\n3\r\n")
+	expectReply(t, run(h, c, "ZMPOP", "1", "z", "MAX", "COUNT", "5"), "*2\r\n$1\r\nz\r\n*2\r\n*2\r\n$1\r\na\r\n$1\r\n5\r\n*2\r\n$1\r\nb\r\n$3\r\n3.5\r\n")
+	expectReply(t, run(h, c, "ZCARD", "z"), ":0\r\n")
+	expectReply(t, run(h, c, "ZADD", "z", "NX", "XX", "1", "a"), "-ERR XX and NX options at the same time are not compatible\r\n")
+}
+
+// Scores are formatted like %.17g: integral scores and large ones print
+// without an exponent
+func TestHandler_ScoreFormat(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	tests := []struct {
+		score, want string
+	}{
+		{"1234567", "1234567"},
+		{"-1234567", "-1234567"},
+		{"1234567.5", "1234567.5"},
+		{"9007199254740992", "9007199254740992"},
+		{"12345678901234567890", "1.2345678901234567e+19"},
+		{"1e17", "1e+17"},
+		{"0.1", "0.1"},
+		{"0.0001", "0.0001"},
+		{"0.00001", "1e-05"},
+		{"3.0", "3"},
+		{"+inf", "inf"},
+	}
+	for _, tt := range tests {
+		run(h, c, "ZADD", "z", tt.score, "m")
+		want := fmt.Sprintf("$%d\r\n%s\r\n", len(tt.want), tt.want)
+		expectReply(t, run(h, c, "ZSCORE", "z", "m"), want)
+		expectReply(t, run(h, c, "ZRANGE", "z", "0", "-1", "WITHSCORES"), "*2\r\n$1\r\nm\r\n"+want)
+	}
+
+	run(h, c, "ZADD", "z", "1000000", "m")
+	expectReply(t, run(h, c, "ZADD", "z", "INCR", "234567", "m"), "$7\r\n1234567\r\n")
+	expectReply(t, run(h, c, "ZPOPMIN", "z"), "*2\r\n$1\r\nm\r\n$7\r\n1234567\r\n")
+
+	// Geo members are stored with their 52-bit geohash as the score
+	run(h, c, "GEOADD", "Sicily", "13.361389", "38.115556", "Palermo")
+	expectReply(t, run(h, c, "ZSCORE", "Sicily", "Palermo"), "$16\r\n3479099956230698\r\n")
+}
+
+func TestHandler_BlockingPopServedInOrder(t *testing.T) {
+	h := NewHandler(config.Default())
+	first, second, pusher := h.NewClient("first", "", Conn{}), h.NewClient("second", "", Conn{}), h.NewClient("pusher", "", Conn{})
+
+	firstReply := runBlocking(t, h, first, "BLPOP", "a", "b", "0")
+	secondReply := runBlocking(t, h, second, "BRPOP", "b", "0")
+	expectReply(t, run(h, pusher, "INFO", "clients"), "$51\r\n# Clients\r\nconnected_clients:3\r\nblocked_clients:2\r\n\r\n")
+
+	// The client that blocked first gets the first element
+	expectReply(t, run(h, pusher, "RPUSH", "b", "x", "y"), ":2\r\n")
+	expectReply(t, receive(t, firstReply), "*2\r\n$1\r\nb\r\n$1\r\nx\r\n")
+	expectReply(t, receive(t, secondReply), "*2\r\n$1\r\nb\r\n$1\r\ny\r\n")
+	expectReply(t, run(h, pusher, "LLEN", "b"), ":0\r\n")
+}
+
+func TestHandler_BlockingTimeout(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	start := time.Now()
+	expectReply(t, receive(t, runBlocking(t, h, c, "BLPOP", "l", "0.05")), "*-1\r\n")
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("returned after %v, before the timeout", elapsed)
+	}
+
+	expectReply(t, run(h, c, "BLPOP", "l", "-1"), "-ERR timeout is negative\r\n")
+	expectReply(t, run(h, c, "BLPOP", "l", "abc"), "-ERR timeout is not a float or out of range\r\n")
+
+	// Nothing is left registered once the client timed out
+	expectReply(t, run(h, c, "RPUSH", "l", "a"), ":1\r\n")
+	expectReply(t, run(h, c, "LLEN", "l"), ":1\r\n")
+}
+
+func TestHandler_BlockingMoveChains(t *testing.T) {
+	h := NewHandler(config.Default())
+	mover, popper, pusher := h.NewClient("mover", "", Conn{}), h.NewClient("popper", "", Conn{}), h.NewClient("pusher", "", Conn{})
+
+	moved := runBlocking(t, h, mover, "BLMOVE", "src", "dst", "RIGHT", "LEFT", "0")
+	popped := runBlocking(t, h, popper, "BLPOP", "dst", "0")
+
+	// The element moved to dst must in turn serve the client blocked on dst
+	run(h, pusher, "RPUSH", "src", "v")
+	expectReply(t, receive(t, moved), "$1\r\nv\r\n")
+	expectReply(t, receive(t, popped), "*2\r\n$3\r\ndst\r\n$1\r\nv\r\n")
+}
+
+func TestHandler_BlockingMoveChainsInAnotherDatabase(t *testing.T) {
+	h := NewHandler(config.Default())
+	mover, popper, pusher := h.NewClient("mover", "", Conn{}), h.NewClient("popper", "", Conn{}), h.NewClient("pusher", "", Conn{})
+	run(h, mover, "SELECT", "1")
+	run(h, popper, "SELECT", "1")
+
+	moved := runBlocking(t, h, mover, "BLMOVE", "src", "dst", "RIGHT", "LEFT", "0")
+	popped := runBlocking(t, h, popper, "BLPOP", "dst", "0")
+
+	// The pusher is in database 0, dst must be signalled in database 1
+	run(h, pusher, "RPUSH", "list", "v")
+	expectReply(t, run(h, pusher, "COPY", "list", "src", "DB", "1"), ":1\r\n")
+	expectReply(t, receive(t, moved), "$1\r\nv\r\n")
+	expectReply(t, receive(t, popped), "*2\r\n$3\r\ndst\r\n$1\r\nv\r\n")
+}
+
+func TestHandler_BlockingSortedSet(t *testing.T) {
+	h := NewHandler(config.Default())
+	c, pusher := h.NewClient("test", "", Conn{}), h.NewClient("pusher", "", Conn{})
+
+	replies := runBlocking(t, h, c, "BZPOPMIN", "z", "0")
+	run(h, pusher, "ZADD", "z", "2", "b", "1", "a")
+	expectReply(t, receive(t, replies), "*3\r\n$1\r\nz\r\n$1\r\na\r\n$1\r\n1\r\n")
+
+	replies = runBlocking(t, h, c, "BZMPOP", "0", "1", "y", "MAX")
+	run(h, pusher, "ZADD", "y", "7", "m")
+	expectReply(t, receive(t, replies), "*2\r\n$1\r\ny\r\n*1\r\n*2\r\n$1\r\nm\r\n$1\r\n7\r\n")
+}
+
+func TestHandler_ClientUnblock(t *testing.T) {
+	h := NewHandler(config.Default())
+	c, other := h.NewClient("test", "", Conn{}), h.NewClient("other", "", Conn{})
+
+	replies := runBlocking(t, h, c, "BLPOP", "l", "0")
+	expectReply(t, run(h, other, "CLIENT", "UNBLOCK", "999"), ":0\r\n")
+	expectReply(t, run(h, other, "CLIENT", "UNBLOCK", "1"), ":1\r\n")
+	expectReply(t, receive(t, replies), "*-1\r\n")
+
+	replies = runBlocking(t, h, c, "BLPOP", "l", "0")
+	expectReply(t, run(h, other, "CLIENT", "UNBLOCK", "1", "ERROR"), ":1\r\n")
+	expectReply(t, receive(t, replies), "-UNBLOCKED client unblocked via CLIENT UNBLOCK\r\n")
+}
+
+func TestHandler_Multi(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	expectReply(t, run(h, c, "MULTI"), "+OK\r\n")
+	expectReply(t, run(h, c, "SET", "k", "v"), "+QUEUED\r\n")
+	expectReply(t, run(h, c, "BLPOP", "l", "0"), "+QUEUED\r\n")
+	expectReply(t, run(h, c, "GET", "k"), "+QUEUED\r\n")
+	// Blocking commands inside a transaction time out right away
+	expectReply(t, run(h, c, "EXEC"), "*3\r\n+OK\r\n*-1\r\n$1\r\nv\r\n")
+
+	expectReply(t, run(h, c, "MULTI"), "+OK\r\n")
+	expectReply(t, run(h, c, "NOSUCHCOMMAND"), "-ERR unknown command NOSUCHCOMMAND\r\n")
+	expectReply(t, run(h, c, "EXEC"), "-EXECABORT Transaction discarded because of previous errors.\r\n")
+
+	expectReply(t, run(h, c, "EXEC"), "-ERR EXEC without MULTI\r\n")
+	expectReply(t, run(h, c, "DISCARD"), "-ERR DISCARD without MULTI\r\n")
+}
+
+// Multi-key commands and transactions lock all of their keys at once, the
+// other clients never observe them half done
+func TestHandler_MultiKeyAtomicity(t *testing.T) {
+	inMulti := func(h *Handler, c *Client, commands ...[]string) string {
+		run(h, c, "MULTI")
+		for _, args := range commands {
+			run(h, c, args...)
+		}
+		return run(h, c, "EXEC")
+	}
+	// Both elements of a two bulk string array are equal
+	samePair := func(reply string) bool {
+		lines := strings.Split(reply, "\r\n")
+		return len(lines) == 6 && lines[0] == "*2" && lines[2] == lines[4]
+	}
+
+	tests := []struct {
+		name  string
+		setup []string
+		write func(h *Handler, c *Client, i int)
+		read  func(h *Handler, c *Client) string
+		valid func(reply string) bool
+	}{
+		{
+			name:  "MSET and MGET",
+			setup: []string{"MSET", "a", "0", "b", "0"},
+			write: func(h *Handler, c *Client, i int) {
+				run(h, c, "MSET", "a", strconv.Itoa(i), "b", strconv.Itoa(i))
+			},
+			read:  func(h *Handler, c *Client) string { return run(h, c, "MGET", "a", "b") },
+			valid: samePair,
+		},
+		{
+			name:  "RENAME and EXISTS",
+			setup: []string{"SET", "a", "1"},
+			write: func(h *Handler, c *Client, i int) {
+				if i%2 == 0 {
+					run(h, c, "RENAME", "a", "b")
+				} else {
+					run(h, c, "RENAME", "b", "a")
+				}
+			},
+			read:  func(h *Handler, c *Client) string { return run(h, c, "EXISTS", "a", "b") },
+			valid: func(reply string) bool { return reply == ":1\r\n" },
+		},
+		{
+			name:  "LMOVE and a transaction reading both lists",
+			setup: []string{"RPUSH", "a", "x"},
+			write: func(h *Handler, c *Client, i int) {
+				if i%2 == 0 {
+					run(h, c, "LMOVE", "a", "b", "LEFT", "LEFT")
+				} else {
+					run(h, c, "LMOVE", "b", "a", "LEFT", "LEFT")
+				}
+			},
+			read: func(h *Handler, c *Client) string {
+				return inMulti(h, c, []string{"LLEN", "a"}, []string{"LLEN", "b"})
+			},
+			valid: func(reply string) bool {
+				return reply == "*2\r\n:1\r\n:0\r\n" || reply == "*2\r\n:0\r\n:1\r\n"
+			},
+		},
+		{
+			name:  "a transaction and MGET",
+			setup: []string{"MSET", "a", "0", "b", "0"},
+			write: func(h *Handler, c *Client, i int) {
+				inMulti(h, c, []string{"INCR", "a"}, []string{"INCR", "b"})
+			},
+			read:  func(h *Handler, c *Client) string { return run(h, c, "MGET", "a", "b") },
+			valid: samePair,
+		},
+		{
+			// SORT locks every key, the keys it reads by pattern are unknown
+			name:  "a transaction locking every key and MGET",
+			setup: []string{"MSET", "a", "0", "b", "0"},
+			write: func(h *Handler, c *Client, i int) {
+				inMulti(h, c, []string{"SET", "a", strconv.Itoa(i)}, []string{"SORT", "l"}, []string{"SET", "b", strconv.Itoa(i)})
+			},
+			read:  func(h *Handler, c *Client) string { return run(h, c, "MGET", "a", "b") },
+			valid: samePair,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(config.Default())
+			writer, reader := h.NewClient("writer", "", Conn{}), h.NewClient("reader", "", Conn{})
+			if tt.setup != nil {
+				run(h, writer, tt.setup...)
+			}
+
+			// Long enough for the scheduler to preempt the writer in the
+			// middle of commands, even on a single CPU
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				deadline := time.Now().Add(200 * time.Millisecond)
+				for i := 0; time.Now().Before(deadline); i++ {
+					tt.write(h, writer, i)
+				}
+			}()
+			for running := true; running; {
+				select {
+				case <-done:
+					running = false
+				default:
+				}
+				if reply := tt.read(h, reader); !tt.valid(reply) {
+					t.Fatalf("observed %q", reply)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_Streams(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	expectReply(t, run(h, c, "XADD", "s", "1-1", "f", "a"), "$3\r\n1-1\r\n")
+	expectReply(t, run(h, c, "XADD", "s", "1-*", "f", "b"), "$3\r\n1-2\r\n")
+	expectReply(t, run(h, c, "XADD", "s", "2", "f", "c"), "$3\r\n2-0\r\n")
+	expectReply(t, run(h, c, "XADD", "s", "1-5", "f", "d"), "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n")
+	expectReply(t, run(h, c, "XADD", "s", "0-0", "f", "d"), "-ERR The ID specified in XADD must be greater than 0-0\r\n")
+	expectReply(t, run(h, c, "XADD", "s", "3-0", "f"), "-ERR wrong number of arguments for 'xadd' command\r\n")
+	expectReply(t, run(h, c, "XADD", "none", "NOMKSTREAM", "*", "f", "v"), "$-1\r\n")
+	expectReply(t, run(h, c, "XLEN", "s"), ":3\r\n")
+
+	expectReply(t, run(h, c, "XRANGE", "s", "-", "+", "COUNT", "1"), "*1\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$1\r\nf\r\n$1\r\na\r\n")
+	expectReply(t, run(h, c, "XRANGE", "s", "(1-1", "1"), "*1\r\n*2\r\n$3\r\n1-2\r\n*2\r\n$1\r\nf\r\n$1\r\nb\r\n")
+	expectReply(t, run(h, c, "XREVRANGE", "s", "+", "-", "COUNT", "1"), "*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nf\r\n$1\r\nc\r\n")
+	expectReply(t, run(h, c, "XRANGE", "s", "x", "+"), "-"+invalidStreamIDError+"\r\n")
+
+	expectReply(t, run(h, c, "XDEL", "s", "1-2", "9-9"), ":1\r\n")
+	expectReply(t, run(h, c, "XADD", "s", "MAXLEN", "=", "1", "3-0", "f", "e"), "$3\r\n3-0\r\n")
+	expectReply(t, run(h, c, "XLEN", "s"), ":1\r\n")
+	expectReply(t, run(h, c, "XTRIM", "s", "MINID", "4"), ":1\r\n")
+	expectReply(t, run(h, c, "XTRIM", "s", "MAXLEN", "1", "LIMIT", "1"), "-ERR syntax error, LIMIT cannot be used without the special ~ option\r\n")
+	expectReply(t, run(h, c, "XLEN", "s"), ":0\r\n")
+	expectReply(t, run(h, c, "LPUSH", "s", "a"), "-"+wrongTypeError+"\r\n")
+
+	expectReply(t, run(h, c, "XREAD", "STREAMS", "s", "0"), "*-1\r\n")
+	expectReply(t, run(h, c, "XREAD", "STREAMS", "s", "t", "0"), "-ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.\r\n")
+	run(h, c, "XADD", "s", "5-0", "f", "v")
+	expectReply(t, run(h, c, "XREAD", "COUNT", "5", "STREAMS", "s", "none", "0", "0"), "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n5-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n")
+}
+
+func TestHandler_BlockingXRead(t *testing.T) {
+	h := NewHandler(config.Default())
+	newer, older, writer := h.NewClient("newer", "", Conn{}), h.NewClient("older", "", Conn{}), h.NewClient("writer", "", Conn{})
+
+	run(h, writer, "XADD", "s", "1-0", "f", "a")
+	// Readers waiting for different IDs are served independently
+	newerReply := runBlocking(t, h, newer, "XREAD", "BLOCK", "0", "STREAMS", "s", "$")
+	olderReply := runBlocking(t, h, older, "XREAD", "BLOCK", "0", "STREAMS", "s", "2-0")
+
+	run(h, writer, "XADD", "s", "2-0", "f", "b")
+	expectReply(t, receive(t, newerReply), "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nf\r\n$1\r\nb\r\n")
+	if !older.IsBlocked() || h.blocked.count() != 1 {
+		t.Fatal("expected the reader waiting after 2-0 to stay blocked")
+	}
+
+	run(h, writer, "XADD", "s", "3-0", "f", "c")
+	expectReply(t, receive(t, olderReply), "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n3-0\r\n*2\r\n$1\r\nf\r\n$1\r\nc\r\n")
+
+	expectReply(t, receive(t, runBlocking(t, h, newer, "XREAD", "BLOCK", "50", "STREAMS", "s", "$")), "*-1\r\n")
+}
+
+func TestHandler_ConsumerGroups(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	expectReply(t, run(h, c, "XGROUP", "CREATE", "s", "g", "$"), "-ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.\r\n")
+	expectReply(t, run(h, c, "XGROUP", "CREATE", "s", "g", "$", "MKSTREAM"), "+OK\r\n")
+	expectReply(t, run(h, c, "XGROUP", "CREATE", "s", "g", "$"), "-BUSYGROUP Consumer Group name already exists\r\n")
+	run(h, c, "XADD", "s", "1-0", "f", "a")
+	run(h, c, "XADD", "s", "2-0", "f", "b")
+
+	expectReply(t, run(h, c, "XREADGROUP", "GROUP", "g", "alice", "COUNT", "1", "STREAMS", "s", ">"), "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\na\r\n")
+	expectReply(t, run(h, c, "XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">"), "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nf\r\n$1\r\nb\r\n")
+	expectReply(t, run(h, c, "XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">"), "*-1\r\n")
+	expectReply(t, run(h, c, "XREADGROUP", "GROUP", "nope", "bob", "STREAMS", "s", ">"), "-NOGROUP No such key 's' or consumer group 'nope' in XREADGROUP with GROUP option\r\n")
+
+	// History reads return the consumer's own pending entries
+	expectReply(t, run(h, c, "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0"), "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\na\r\n")
+	expectReply(t, run(h, c, "XPENDING", "s", "g"), "*4\r\n:2\r\n$3\r\n1-0\r\n$3\r\n2-0\r\n*2\r\n*2\r\n$5\r\nalice\r\n$1\r\n1\r\n*2\r\n$3\r\nbob\r\n$1\r\n1\r\n")
+
+	// Bob takes over alice's entry, then acknowledges both
+	expectReply(t, run(h, c, "XCLAIM", "s", "g", "bob", "0", "1-0", "JUSTID"), "*1\r\n$3\r\n1-0\r\n")
+	expectReply(t, run(h, c, "XPENDING", "s", "g", "-", "+", "10", "alice"), "*0\r\n")
+	expectReply(t, run(h, c, "XACK", "s", "g", "1-0", "2-0", "3-0"), ":2\r\n")
+	expectReply(t, run(h, c, "XPENDING", "s", "g"), "*4\r\n:0\r\n$-1\r\n$-1\r\n*-1\r\n")
+
+	expectReply(t, run(h, c, "XGROUP", "CREATECONSUMER", "s", "g", "carol"), ":1\r\n")
+	expectReply(t, run(h, c, "XGROUP", "DELCONSUMER", "s", "g", "carol"), ":0\r\n")
+	expectReply(t, run(h, c, "XGROUP", "SETID", "s", "g", "0"), "+OK\r\n")
+	expectReply(t, run(h, c, "XINFO", "GROUPS", "s"), "*1\r\n*12\r\n$4\r\nname\r\n$1\r\ng\r\n$9\r\nconsumers\r\n:2\r\n$7\r\npending\r\n:0\r\n$17\r\nlast-delivered-id\r\n$3\r\n0-0\r\n$12\r\nentries-read\r\n:0\r\n$3\r\nlag\r\n:2\r\n")
+	expectReply(t, run(h, c, "XGROUP", "DESTROY", "s", "g"), ":1\r\n")
+	expectReply(t, run(h, c, "XGROUP", "DESTROY", "s", "g"), ":0\r\n")
+
+	if reply := run(h, c, "XGROUP", "HELP"); !strings.HasPrefix(reply, "*17\r\n+XGROUP <subcommand>") {
+		t.Errorf("got %q", reply)
+	}
+	expectReply(t, run(h, c, "XGROUP", "NOPE"), "-ERR unknown subcommand 'NOPE'. Try XGROUP HELP.\r\n")
+	if reply := run(h, c, "XINFO", "HELP"); !strings.HasPrefix(reply, "*9\r\n+XINFO <subcommand>") {
+		t.Errorf("got %q", reply)
+	}
+	expectReply(t, run(h, c, "XINFO", "NOPE"), "-ERR unknown subcommand 'NOPE'. Try XINFO HELP.\r\n")
+}
+
+func TestHandler_XInfoStreamFull(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+	run(h, c, "XADD", "s", "1-0", "f", "a")
+	run(h, c, "XADD", "s", "2-0", "f", "b")
+	run(h, c, "XGROUP", "CREATE", "s", "g", "0")
+	run(h, c, "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">")
+
+	expectReply(t, run(h, c, "XINFO", "STREAM", "s", "NOPE"), "-ERR syntax error\r\n")
+	expectReply(t, run(h, c, "XINFO", "STREAM", "s", "FULL", "COUNT"), "-ERR syntax error\r\n")
+	expectReply(t, run(h, c, "XINFO", "STREAM", "s", "FULL", "COUNT", "x"), "-ERR value is not an integer or out of range\r\n")
+
+	// Delivery times vary, so only the surrounding fields are compared
+	reply := run(h, c, "XINFO", "STREAM", "s", "FULL")
+	for _, want := range []string{
+		"*14\r\n$6\r\nlength\r\n:2\r\n",
+		"$7\r\nentries\r\n*2\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\na\r\n*2\r\n$3\r\n2-0\r\n",
+		"$6\r\ngroups\r\n*1\r\n*14\r\n$4\r\nname\r\n$1\r\ng\r\n$17\r\nlast-delivered-id\r\n$3\r\n2-0\r\n" +
+			"$12\r\nentries-read\r\n:2\r\n$3\r\nlag\r\n:0\r\n$9\r\npel-count\r\n:2\r\n$7\r\npending\r\n*2\r\n*4\r\n$3\r\n1-0\r\n$5\r\nalice\r\n:",
+		"$9\r\nconsumers\r\n*1\r\n*10\r\n$4\r\nname\r\n$5\r\nalice\r\n$9\r\nseen-time\r\n:",
+		"$9\r\npel-count\r\n:2\r\n$7\r\npending\r\n*2\r\n*3\r\n$3\r\n1-0\r\n:",
+	} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("got %q, want it to contain %q", reply, want)
+		}
+	}
+
+	// COUNT limits the entries and both pending lists
+	reply = run(h, c, "XINFO", "STREAM", "s", "FULL", "COUNT", "1")
+	for _, want := range []string{
+		"$7\r\nentries\r\n*1\r\n*2\r\n$3\r\n1-0\r\n",
+		"$9\r\npel-count\r\n:2\r\n$7\r\npending\r\n*1\r\n*4\r\n",
+		"$9\r\npel-count\r\n:2\r\n$7\r\npending\r\n*1\r\n*3\r\n",
+	} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("got %q, want it to contain %q", reply, want)
+		}
+	}
+}
+
+func TestHandler_XInfoGroupsLag(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+	// The last delivered ID, entries read and lag of the only group
+	expectGroup := func(lastID, entriesRead, lag string) {
+		t.Helper()
+		expectReply(t, run(h, c, "XINFO", "GROUPS", "s"), "*1\r\n*12\r\n$4\r\nname\r\n$1\r\ng\r\n$9\r\nconsumers\r\n:1\r\n$7\r\npending\r\n:0\r\n"+
+			"$17\r\nlast-delivered-id\r\n$3\r\n"+lastID+"\r\n$12\r\nentries-read\r\n"+entriesRead+"\r\n$3\r\nlag\r\n"+lag+"\r\n")
+	}
+
+	for i := 1; i <= 5; i++ {
+		run(h, c, "XADD", "s", strconv.Itoa(i)+"-0", "f", "v")
+	}
+	run(h, c, "XGROUP", "CREATE", "s", "g", "0")
+	run(h, c, "XREADGROUP", "GROUP", "g", "alice", "COUNT", "2", "NOACK", "STREAMS", "s", ">")
+	expectGroup("2-0", ":2", ":3")
+
+	// Deleting an entry already read leaves the lag known
+	run(h, c, "XDEL", "s", "1-0")
+	expectGroup("2-0", ":2", ":3")
+
+	// Deleting an entry yet to be read makes it unknown
+	run(h, c, "XDEL", "s", "4-0")
+	expectGroup("2-0", ":2", "$-1")
+	run(h, c, "XREADGROUP", "GROUP", "g", "alice", "COUNT", "1", "NOACK", "STREAMS", "s", ">")
+	expectGroup("3-0", "$-1", "$-1")
+
+	// Until the group reads past the deleted entries
+	run(h, c, "XREADGROUP", "GROUP", "g", "alice", "NOACK", "STREAMS", "s", ">")
+	expectGroup("5-0", ":5", ":0")
+	run(h, c, "XADD", "s", "6-0", "f", "v")
+	expectGroup("5-0", ":5", ":1")
+}
+
+func TestHandler_XAutoClaim(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	run(h, c, "XGROUP", "CREATE", "s", "g", "0", "MKSTREAM")
+	for _, id := range []string{"1-0", "2-0", "3-0"} {
+		run(h, c, "XADD", "s", id, "f", "v")
+	}
+	run(h, c, "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">")
+	run(h, c, "XDEL", "s", "2-0")
+
+	// The deleted entry is dropped from the pending entries and reported
+	expectReply(t, run(h, c, "XAUTOCLAIM", "s", "g", "bob", "0", "-", "COUNT", "1", "JUSTID"), "*3\r\n$3\r\n2-0\r\n*1\r\n$3\r\n1-0\r\n*0\r\n")
+	expectReply(t, run(h, c, "XAUTOCLAIM", "s", "g", "bob", "0", "2-0", "JUSTID"), "*3\r\n$3\r\n0-0\r\n*1\r\n$3\r\n3-0\r\n*1\r\n$3\r\n2-0\r\n")
+	expectReply(t, run(h, c, "XAUTOCLAIM", "s", "g", "bob", "3600000", "-"), "*3\r\n$3\r\n0-0\r\n*0\r\n*0\r\n")
+	expectReply(t, run(h, c, "XPENDING", "s", "g", "-", "+", "10", "bob"), "*2\r\n*4\r\n$3\r\n1-0\r\n$3\r\nbob\r\n:0\r\n:1\r\n*4\r\n$3\r\n3-0\r\n$3\r\nbob\r\n:0\r\n:1\r\n")
+}
+
+func TestHandler_BlockingXReadGroup(t *testing.T) {
+	h := NewHandler(config.Default())
+	reader, writer := h.NewClient("reader", "", Conn{}), h.NewClient("writer", "", Conn{})
+
+	run(h, writer, "XGROUP", "CREATE", "s", "g", "$", "MKSTREAM")
+	replies := runBlocking(t, h, reader, "XREADGROUP", "GROUP", "g", "alice", "BLOCK", "0", "STREAMS", "s", ">")
+	run(h, writer, "XADD", "s", "1-0", "f", "v")
+	expectReply(t, receive(t, replies), "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n")
+	expectReply(t, run(h, writer, "XPENDING", "s", "g"), "*4\r\n:1\r\n$3\r\n1-0\r\n$3\r\n1-0\r\n*1\r\n*2\r\n$5\r\nalice\r\n$1\r\n1\r\n")
+
+	// Destroying the group wakes its readers up with an error
+	replies = runBlocking(t, h, reader, "XREADGROUP", "GROUP", "g", "alice", "BLOCK", "0", "STREAMS", "s", ">")
+	run(h, writer, "XGROUP", "DESTROY", "s", "g")
+	expectReply(t, receive(t, replies), "-NOGROUP No such key 's' or consumer group 'g' in XREADGROUP with GROUP option\r\n")
+}
+
+func TestHandler_Bitmaps(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	expectReply(t, run(h, c, "SETBIT", "b", "7", "1"), ":0\r\n")
+	expectReply(t, run(h, c, "SETBIT", "b", "7", "1"), ":1\r\n")
+	expectReply(t, run(h, c, "GET", "b"), "$1\r\n\x01\r\n")
+	expectReply(t, run(h, c, "GETBIT", "b", "100"), ":0\r\n")
+	expectReply(t, run(h, c, "SETBIT", "b", "-1", "1"), "-"+bitOffsetError+"\r\n")
+	expectReply(t, run(h, c, "SETBIT", "b", "1", "2"), "-ERR bit is not an integer or out of range\r\n")
+
+	run(h, c, "SET", "s", "foobar")
+	expectReply(t, run(h, c, "BITCOUNT", "s"), ":26\r\n")
+	expectReply(t, run(h, c, "BITCOUNT", "s", "1", "1"), ":6\r\n")
+	expectReply(t, run(h, c, "BITCOUNT", "s", "5", "30", "BIT"), ":17\r\n")
+	expectReply(t, run(h, c, "BITCOUNT", "s", "1"), "-ERR syntax error\r\n")
+
+	run(h, c, "SET", "p", "\xff\xf0\x00")
+	expectReply(t, run(h, c, "BITPOS", "p", "0"), ":12\r\n")
+	expectReply(t, run(h, c, "BITPOS", "p", "1", "2"), ":-1\r\n")
+	expectReply(t, run(h, c, "BITPOS", "p", "1", "7", "15", "BIT"), ":7\r\n")
+	expectReply(t, run(h, c, "SET", "ones", "\xff"), "+OK\r\n")
+	expectReply(t, run(h, c, "BITPOS", "ones", "0"), ":8\r\n")
+	expectReply(t, run(h, c, "BITPOS", "ones", "0", "0", "-1"), ":-1\r\n")
+	expectReply(t, run(h, c, "BITPOS", "missing", "0"), ":0\r\n")
+
+	run(h, c, "SET", "x", "\x0f\xff")
+	run(h, c, "SET", "y", "\x3c")
+	expectReply(t, run(h, c, "BITOP", "AND", "d", "x", "y"), ":2\r\n")
+	expectReply(t, run(h, c, "GET", "d"), "$2\r\n\x0c\x00\r\n")
+	expectReply(t, run(h, c, "BITOP", "OR", "d", "x", "y"), ":2\r\n")
+	expectReply(t, run(h, c, "GET", "d"), "$2\r\n\x3f\xff\r\n")
+	expectReply(t, run(h, c, "BITOP", "XOR", "d", "x", "y"), ":2\r\n")
+	expectReply(t, run(h, c, "GET", "d"), "$2\r\n\x33\xff\r\n")
+	expectReply(t, run(h, c, "BITOP", "NOT", "d", "y"), ":1\r\n")
+	expectReply(t, run(h, c, "GET", "d"), "$1\r\n\xc3\r\n")
+	expectReply(t, run(h, c, "BITOP", "DIFF", "d", "x", "y"), ":2\r\n")
+	expectReply(t, run(h, c, "GET", "d"), "$2\r\n\x03\xff\r\n")
+	expectReply(t, run(h, c, "BITOP", "NOT", "d", "x", "y"), "-ERR BITOP NOT must be called with a single source key.\r\n")
+	expectReply(t, run(h, c, "BITOP", "AND", "d", "none"), ":0\r\n")
+	expectReply(t, run(h, c, "GET", "d"), "$-1\r\n")
+}
+
+func TestHandler_BitField(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	expectReply(t, run(h, c, "BITFIELD", "f", "SET", "i8", "0", "100", "GET", "i8", "0"), "*2\r\n:0\r\n:100\r\n")
+	expectReply(t, run(h, c, "BITFIELD", "f", "INCRBY", "i8", "0", "100"), "*1\r\n:-56\r\n")
+	expectReply(t, run(h, c, "BITFIELD", "f", "OVERFLOW", "SAT", "INCRBY", "i8", "0", "-100"), "*1\r\n:-128\r\n")
+	expectReply(t, run(h, c, "BITFIELD", "f", "OVERFLOW", "FAIL", "INCRBY", "i8", "0", "-1", "GET", "u8", "0"), "*2\r\n$-1\r\n:128\r\n")
+
+	// #N offsets count in multiples of the type width
+	expectReply(t, run(h, c, "BITFIELD", "f", "SET", "u4", "#3", "15", "GET", "u16", "0"), "*2\r\n:0\r\n:32783\r\n")
+	expectReply(t, run(h, c, "BITFIELD", "f", "OVERFLOW", "SAT", "INCRBY", "u4", "#3", "1", "OVERFLOW", "WRAP", "INCRBY", "u4", "#3", "1"), "*2\r\n:15\r\n:0\r\n")
+	expectReply(t, run(h, c, "BITFIELD_RO", "f", "GET", "u2", "0"), "*1\r\n:2\r\n")
+	expectReply(t, run(h, c, "BITFIELD_RO", "f", "SET", "u2", "0", "1"), "-ERR BITFIELD_RO only supports the GET subcommand\r\n")
+	expectReply(t, run(h, c, "BITFIELD", "f", "GET", "u64", "0"), "-ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.\r\n")
+	expectReply(t, run(h, c, "BITFIELD", "f", "OVERFLOW", "NOPE"), "-ERR Invalid OVERFLOW type specified\r\n")
+}
+
+func TestHandler_HyperLogLog(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	expectReply(t, run(h, c, "PFADD", "h1", "a", "b", "c"), ":1\r\n")
+	expectReply(t, run(h, c, "PFADD", "h1", "a", "b"), ":0\r\n")
+	expectReply(t, run(h, c, "PFADD", "empty"), ":1\r\n")
+	expectReply(t, run(h, c, "PFCOUNT", "h1"), ":3\r\n")
+	expectReply(t, run(h, c, "PFCOUNT", "empty", "missing"), ":0\r\n")
+
+	run(h, c, "PFADD", "h2", "c", "d")
+	expectReply(t, run(h, c, "PFCOUNT", "h1", "h2"), ":4\r\n")
+	expectReply(t, run(h, c, "PFMERGE", "h3", "h1", "h2"), "+OK\r\n")
+	expectReply(t, run(h, c, "PFCOUNT", "h3"), ":4\r\n")
+
+	expectReply(t, run(h, c, "PFDEBUG", "ENCODING", "h3"), "+sparse\r\n")
+	expectReply(t, run(h, c, "PFDEBUG", "TODENSE", "h3"), ":1\r\n")
+	expectReply(t, run(h, c, "PFDEBUG", "ENCODING", "h3"), "+dense\r\n")
+	expectReply(t, run(h, c, "PFCOUNT", "h3"), ":4\r\n")
+	expectReply(t, run(h, c, "PFDEBUG", "DECODE", "h3"), "-ERR HLL encoding is not sparse\r\n")
+	expectReply(t, run(h, c, "PFDEBUG", "DECODE", "empty"), "$7\r\nZ:16384\r\n")
+	expectReply(t, run(h, c, "PFDEBUG", "ENCODING", "missing"), "-ERR The specified key does not exist\r\n")
+
+	// Merging a dense HyperLogLog makes the result dense
+	expectReply(t, run(h, c, "PFMERGE", "h4", "h1", "h3"), "+OK\r\n")
+	expectReply(t, run(h, c, "PFDEBUG", "ENCODING", "h4"), "+dense\r\n")
+
+	run(h, c, "SET", "s", "not a hll")
+	expectReply(t, run(h, c, "PFADD", "s", "a"), "-"+invalidHLLError+"\r\n")
+	expectReply(t, run(h, c, "PFCOUNT", "h1", "s"), "-"+invalidHLLError+"\r\n")
+	expectReply(t, run(h, c, "PFSELFTEST"), "+OK\r\n")
+}
+
+func TestHandler_Geo(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	expectReply(t, run(h, c, "GEOADD", "Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"), ":2\r\n")
+	expectReply(t, run(h, c, "GEODIST", "Sicily", "Palermo", "Catania"), "$11\r\n166274.1516\r\n")
+	expectReply(t, run(h, c, "GEODIST", "Sicily", "Palermo", "Catania", "km"), "$8\r\n166.2742\r\n")
+	expectReply(t, run(h, c, "GEODIST", "Sicily", "Palermo", "Nowhere"), "$-1\r\n")
+	expectReply(t, run(h, c, "GEOHASH", "Sicily", "Palermo", "Catania", "Nowhere"), "*3\r\n$11\r\nsqc8b49rny0\r\n$11\r\nsqdtr74hyu0\r\n$-1\r\n")
+	expectReply(t, run(h, c, "GEOPOS", "Sicily", "Palermo", "Nowhere"),
+		"*2\r\n*2\r\n$20\r\n13.36138933897018433\r\n$20\r\n38.11555639549629859\r\n*-1\r\n")
+
+	expectReply(t, run(h, c, "GEOADD", "Sicily", "12.758489", "38.788135", "edge1", "17.241510", "38.788135", "edge2"), ":2\r\n")
+	expectReply(t, run(h, c, "GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ASC"),
+		"*2\r\n$7\r\nCatania\r\n$7\r\nPalermo\r\n")
+	expectReply(t, run(h, c, "GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "DESC", "WITHDIST"),
+		"*4\r\n*2\r\n$5\r\nedge1\r\n$8\r\n279.7405\r\n*2\r\n$5\r\nedge2\r\n$8\r\n279.7403\r\n"+
+			"*2\r\n$7\r\nPalermo\r\n$8\r\n190.4424\r\n*2\r\n$7\r\nCatania\r\n$7\r\n56.4413\r\n")
+	expectReply(t, run(h, c, "GEOSEARCH", "Sicily", "FROMMEMBER", "Palermo", "BYRADIUS", "1", "m", "WITHHASH"),
+		"*1\r\n*2\r\n$7\r\nPalermo\r\n:3479099956230698\r\n")
+	expectReply(t, run(h, c, "GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "500", "km", "COUNT", "1"), "*1\r\n$7\r\nCatania\r\n")
+	expectReply(t, run(h, c, "GEOSEARCH", "Sicily", "FROMMEMBER", "Nowhere", "BYRADIUS", "1", "m"), "-ERR could not decode requested zset member\r\n")
+	expectReply(t, run(h, c, "GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "km", "BYBOX", "1", "1", "km"),
+		"-ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH\r\n")
+	expectReply(t, run(h, c, "GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "km", "ANY"), "-ERR the ANY argument requires COUNT argument\r\n")
+
+	expectReply(t, run(h, c, "GEOSEARCHSTORE", "near", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "STOREDIST"), ":2\r\n")
+	expectReply(t, run(h, c, "ZRANGE", "near", "0", "-1"), "*2\r\n$7\r\nCatania\r\n$7\r\nPalermo\r\n")
+	expectReply(t, run(h, c, "GEOSEARCHSTORE", "near", "Sicily", "FROMLONLAT", "0", "0", "BYRADIUS", "1", "km"), ":0\r\n")
+	expectReply(t, run(h, c, "ZCARD", "near"), ":0\r\n")
+	expectReply(t, run(h, c, "GEOSEARCHSTORE", "near", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "km", "WITHDIST"),
+		"-ERR GEOSEARCHSTORE is not compatible with WITHDIST, WITHHASH and WITHCOORD options\r\n")
+
+	expectReply(t, run(h, c, "GEOADD", "Sicily", "200", "100", "bad"), "-ERR invalid longitude,latitude pair 200.000000,100.000000\r\n")
+	expectReply(t, run(h, c, "GEOADD", "Sicily", "NX", "XX", "1", "1", "m"), "-ERR syntax error\r\n")
+}
+
+func TestHandler_SetOptions(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	expectReply(t, run(h, c, "SET", "k", "v1", "NX"), "+OK\r\n")
+	expectReply(t, run(h, c, "SET", "k", "v2", "NX"), "$-1\r\n")
+	expectReply(t, run(h, c, "SET", "k", "v2", "XX", "GET"), "$2\r\nv1\r\n")
+	expectReply(t, run(h, c, "SET", "missing", "v", "XX"), "$-1\r\n")
+	expectReply(t, run(h, c, "SET", "k", "v", "NX", "XX"), "-ERR syntax error\r\n")
+	expectReply(t, run(h, c, "SET", "k", "v", "EX", "10", "KEEPTTL"), "-ERR syntax error\r\n")
+	expectReply(t, run(h, c, "SET", "k", "v", "EX", "0"), "-ERR invalid expire time in 'set' command\r\n")
+	expectReply(t, run(h, c, "SET", "k", "v", "EX", "x"), "-"+notIntegerError+"\r\n")
+
+	expectReply(t, run(h, c, "TTL", "k"), ":-1\r\n")
+	expectReply(t, run(h, c, "TTL", "missing"), ":-2\r\n")
+	expectReply(t, run(h, c, "SET", "k", "v", "EX", "100"), "+OK\r\n")
+	expectReply(t, run(h, c, "TTL", "k"), ":100\r\n")
+	expectReply(t, run(h, c, "SET", "k", "v2", "KEEPTTL"), "+OK\r\n")
+	expectReply(t, run(h, c, "TTL", "k"), ":100\r\n")
+	expectReply(t, run(h, c, "SET", "k", "v3"), "+OK\r\n")
+	expectReply(t, run(h, c, "TTL", "k"), ":-1\r\n")
+
+	// Expired keys are gone
+	expectReply(t, run(h, c, "SET", "k", "v", "PX", "1"), "+OK\r\n")
+	time.Sleep(5 * time.Millisecond)
+	expectReply(t, run(h, c, "GET", "k"), "$-1\r\n")
+	expectReply(t, run(h, c, "SET", "k", "v", "PXAT", "1"), "+OK\r\n")
+	expectReply(t, run(h, c, "TTL", "k"), ":-2\r\n")
+
+	run(h, c, "LPUSH", "list", "a")
+	expectReply(t, run(h, c, "SET", "list", "v", "GET"), "-"+wrongTypeError+"\r\n")
+	expectReply(t, run(h, c, "SET", "list", "v"), "+OK\r\n")
+
+	expectReply(t, run(h, c, "SETNX", "k", "v"), ":1\r\n")
+	expectReply(t, run(h, c, "SETNX", "k", "v"), ":0\r\n")
+	expectReply(t, run(h, c, "SETEX", "k", "10", "v"), "+OK\r\n")
+	expectReply(t, run(h, c, "TTL", "k"), ":10\r\n")
+	expectReply(t, run(h, c, "PSETEX", "k", "-1", "v"), "-ERR invalid expire time in 'psetex' command\r\n")
+	expectReply(t, run(h, c, "GETSET", "k", "new"), "$1\r\nv\r\n")
+	expectReply(t, run(h, c, "TTL", "k"), ":-1\r\n")
+}
+
+func TestHandler_GetDelGetEx(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	run(h, c, "SET", "k", "v")
+	expectReply(t, run(h, c, "GETEX", "k", "EX", "50"), "$1\r\nv\r\n")
+	expectReply(t, run(h, c, "TTL", "k"), ":50\r\n")
+	expectReply(t, run(h, c, "GETEX", "k", "PERSIST"), "$1\r\nv\r\n")
+	expectReply(t, run(h, c, "TTL", "k"), ":-1\r\n")
+	expectReply(t, run(h, c, "GETEX", "k", "PERSIST", "EX", "1"), "-ERR syntax error\r\n")
+	expectReply(t, run(h, c, "GETEX", "k", "PX", "0"), "-ERR invalid expire time in 'getex' command\r\n")
+	// Beyond the range of a time.Duration
+	expectReply(t, run(h, c, "GETEX", "k", "EXAT", "9999999999999"), "$1\r\nv\r\n")
+	if reply := run(h, c, "TTL", "k"); !strings.HasPrefix(reply, ":9998") || len(reply) != len(":9998000000000\r\n") {
+		t.Errorf("got TTL %q", reply)
+	}
+	if reply := run(h, c, "PTTL", "k"); !strings.HasPrefix(reply, ":9998") || len(reply) != len(":9998000000000000\r\n") {
+		t.Errorf("got PTTL %q", reply)
+	}
+	expectReply(t, run(h, c, "GETEX", "k", "EXAT", "1"), "$1\r\nv\r\n")
+	expectReply(t, run(h, c, "GETEX", "k"), "$-1\r\n")
+
+	run(h, c, "SET", "k", "v")
+	expectReply(t, run(h, c, "GETDEL", "k"), "$1\r\nv\r\n")
+	expectReply(t, run(h, c, "GETDEL", "k"), "$-1\r\n")
+}
+
+func TestHandler_StringCommands(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	expectReply(t, run(h, c, "APPEND", "s", "Hello"), ":5\r\n")
+	expectReply(t, run(h, c, "APPEND", "s", " World"), ":11\r\n")
+	expectReply(t, run(h, c, "STRLEN", "s"), ":11\r\n")
+	expectReply(t, run(h, c, "STRLEN", "missing"), ":0\r\n")
+	expectReply(t, run(h, c, "GETRANGE", "s", "0", "4"), "$5\r\nHello\r\n")
+	expectReply(t, run(h, c, "GETRANGE", "s", "-3", "-1"), "$3\r\nrld\r\n")
+	expectReply(t, run(h, c, "GETRANGE", "s", "5", "3"), "$0\r\n\r\n")
+	expectReply(t, run(h, c, "GETRANGE", "s", "-1", "-5"), "$0\r\n\r\n")
+	expectReply(t, run(h, c, "GETRANGE", "s", "0", "100"), "$11\r\nHello World\r\n")
+	expectReply(t, run(h, c, "SETRANGE", "s", "6", "Redis"), ":11\r\n")
+	expectReply(t, run(h, c, "GET", "s"), "$11\r\nHello Redis\r\n")
+	expectReply(t, run(h, c, "SETRANGE", "padded", "3", "x"), ":4\r\n")
+	expectReply(t, run(h, c, "GET", "padded"), "$4\r\n\x00\x00\x00x\r\n")
+	expectReply(t, run(h, c, "SETRANGE", "none", "3", ""), ":0\r\n")
+	expectReply(t, run(h, c, "GET", "none"), "$-1\r\n")
+	expectReply(t, run(h, c, "SETRANGE", "s", "-1", "x"), "-ERR offset is out of range\r\n")
+	expectReply(t, run(h, c, "SETRANGE", "s", "536870911", "xx"), "-"+stringTooLongError+"\r\n")
+
+	expectReply(t, run(h, c, "MSET", "a", "1", "b", "2"), "+OK\r\n")
+	expectReply(t, run(h, c, "MSET", "a", "1", "b"), "-ERR wrong number of arguments for 'mset' command\r\n")
+	expectReply(t, run(h, c, "MGET", "a", "missing", "b"), "*3\r\n$1\r\n1\r\n$-1\r\n$1\r\n2\r\n")
+	expectReply(t, run(h, c, "MSETNX", "b", "3", "c", "3"), ":0\r\n")
+	expectReply(t, run(h, c, "MGET", "c"), "*1\r\n$-1\r\n")
+	expectReply(t, run(h, c, "MSETNX", "c", "3", "d", "4"), ":1\r\n")
+}
+
+func TestHandler_Counters(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	expectReply(t, run(h, c, "INCR", "n"), ":1\r\n")
+	expectReply(t, run(h, c, "INCRBY", "n", "10"), ":11\r\n")
+	expectReply(t, run(h, c, "DECR", "n"), ":10\r\n")
+	expectReply(t, run(h, c, "DECRBY", "n", "20"), ":-10\r\n")
+	expectReply(t, run(h, c, "GET", "n"), "$3\r\n-10\r\n")
+
+	run(h, c, "SET", "n", "9223372036854775807", "EX", "100")
+	expectReply(t, run(h, c, "INCR", "n"), "-ERR increment or decrement would overflow\r\n")
+	expectReply(t, run(h, c, "DECRBY", "n", "-9223372036854775808"), "-ERR decrement would overflow\r\n")
+	expectReply(t, run(h, c, "DECR", "n"), ":9223372036854775806\r\n")
+	expectReply(t, run(h, c, "TTL", "n"), ":100\r\n")
+
+	run(h, c, "SET", "s", "abc")
+	expectReply(t, run(h, c, "INCR", "s"), "-"+notIntegerError+"\r\n")
+	expectReply(t, run(h, c, "INCRBYFLOAT", "s", "1"), "-ERR value is not a valid float\r\n")
+
+	// Only canonical integers are accepted, as stored values and as arguments
+	for _, value := range []string{"010", "+1", "-0", " 1", ""} {
+		run(h, c, "SET", "s", value)
+		expectReply(t, run(h, c, "INCR", "s"), "-"+notIntegerError+"\r\n")
+		expectReply(t, run(h, c, "INCRBY", "n", value), "-"+notIntegerError+"\r\n")
+	}
+	run(h, c, "SET", "s", "0")
+	expectReply(t, run(h, c, "INCR", "s"), ":1\r\n")
+	expectReply(t, run(h, c, "SET", "s", "v", "EX", "+5"), "-"+notIntegerError+"\r\n")
+
+	run(h, c, "SET", "f", "10.50")
+	expectReply(t, run(h, c, "INCRBYFLOAT", "f", "0.1"), "$4\r\n10.6\r\n")
+	expectReply(t, run(h, c, "INCRBYFLOAT", "f", "-5"), "$3\r\n5.6\r\n")
+	run(h, c, "SET", "f", "5.0e3")
+	expectReply(t, run(h, c, "INCRBYFLOAT", "f", "2.0e2"), "$4\r\n5200\r\n")
+	expectReply(t, run(h, c, "INCRBYFLOAT", "f", "1e308"), "$309\r\n"+"1"+strings.Repeat("0", 308)+"\r\n")
+	expectReply(t, run(h, c, "INCRBYFLOAT", "f", "1.7e308"), "-ERR increment would produce NaN or Infinity\r\n")
+}
+
+func TestHandler_LCS(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	run(h, c, "MSET", "key1", "ohmytext", "key2", "mynewtext")
+	expectReply(t, run(h, c, "LCS", "key1", "key2"), "$6\r\nmytext\r\n")
+	expectReply(t, run(h, c, "LCS", "key1", "key2", "LEN"), ":6\r\n")
+	expectReply(t, run(h, c, "LCS", "key1", "key2", "IDX"),
+		"*4\r\n$7\r\nmatches\r\n*2\r\n"+
+			"*2\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n"+
+			"*2\r\n*2\r\n:2\r\n:3\r\n*2\r\n:0\r\n:1\r\n"+
+			"$3\r\nlen\r\n:6\r\n")
+	expectReply(t, run(h, c, "LCS", "key1", "key2", "IDX", "MINMATCHLEN", "4", "WITHMATCHLEN"),
+		"*4\r\n$7\r\nmatches\r\n*1\r\n*3\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n:4\r\n$3\r\nlen\r\n:6\r\n")
+	expectReply(t, run(h, c, "LCS", "key1", "missing"), "$0\r\n\r\n")
+	expectReply(t, run(h, c, "LCS", "key1", "key2", "LEN", "IDX"), "-ERR If you want both the length and indexes, please just use IDX.\r\n")
+
+	run(h, c, "LPUSH", "list", "a")
+	expectReply(t, run(h, c, "LCS", "key1", "list"), "-ERR The specified keys must contain string values\r\n")
+}
+
+func TestHandler_DelExistsType(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	run(h, c, "SET", "s", "v")
+	run(h, c, "RPUSH", "l", "a")
+	run(h, c, "ZADD", "z", "1", "a")
+	run(h, c, "XADD", "x", "1-1", "f", "v")
+	expectReply(t, run(h, c, "EXISTS", "s", "s", "missing", "l"), ":3\r\n")
+	expectReply(t, run(h, c, "TOUCH", "s", "missing"), ":1\r\n")
+
+	tests := []struct{ key, want string }{
+		{"s", "+string\r\n"},
+		{"l", "+list\r\n"},
+		{"z", "+zset\r\n"},
+		{"x", "+stream\r\n"},
+		{"missing", "+none\r\n"},
+	}
+	for _, tt := range tests {
+		expectReply(t, run(h, c, "TYPE", tt.key), tt.want)
+	}
+
+	expectReply(t, run(h, c, "DEL", "s", "l", "missing"), ":2\r\n")
+	expectReply(t, run(h, c, "UNLINK", "z", "x", "s"), ":2\r\n")
+	expectReply(t, run(h, c, "EXISTS", "s", "l", "z", "x"), ":0\r\n")
+}
+
+func TestHandler_UnlinkLazyFree(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	args := []string{"RPUSH", "big"}
+	for i := 0; i <= lazyfreeThreshold; i++ {
+		args = append(args, "e")
+	}
+	run(h, c, args...)
+	run(h, c, "RPUSH", "small", "e")
+	expectReply(t, run(h, c, "UNLINK", "big", "small"), ":2\r\n")
+
+	// Only the large value is handed to the background
+	deadline := time.Now().Add(2 * time.Second)
+	for h.lazyfreed.Load() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d lazyfreed objects, want 1", h.lazyfreed.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHandler_Rename(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	run(h, c, "SET", "a", "1", "EX", "100")
+	expectReply(t, run(h, c, "RENAME", "a", "b"), "+OK\r\n")
+	expectReply(t, run(h, c, "GET", "b"), "$1\r\n1\r\n")
+	expectReply(t, run(h, c, "TTL", "b"), ":100\r\n")
+	expectReply(t, run(h, c, "EXISTS", "a"), ":0\r\n")
+	expectReply(t, run(h, c, "RENAME", "a", "b"), "-ERR no such key\r\n")
+	expectReply(t, run(h, c, "RENAMENX", "a", "b"), "-ERR no such key\r\n")
+
+	// Renaming over a key drops its expiration time when the source has none
+	run(h, c, "SET", "c", "2")
+	expectReply(t, run(h, c, "RENAME", "c", "b"), "+OK\r\n")
+	expectReply(t, run(h, c, "TTL", "b"), ":-1\r\n")
+
+	run(h, c, "SET", "d", "3")
+	expectReply(t, run(h, c, "RENAMENX", "d", "b"), ":0\r\n")
+	expectReply(t, run(h, c, "RENAMENX", "d", "e"), ":1\r\n")
+	expectReply(t, run(h, c, "RENAMENX", "e", "e"), ":0\r\n")
+	expectReply(t, run(h, c, "RENAME", "e", "e"), "+OK\r\n")
+}
+
+func TestHandler_RenameServesBlockedClients(t *testing.T) {
+	h := NewHandler(config.Default())
+	c1 := h.NewClient("c1", "", Conn{})
+	c2 := h.NewClient("c2", "", Conn{})
+
+	replies := runBlocking(t, h, c1, "BLPOP", "dst", "0")
+	run(h, c2, "RPUSH", "src", "a")
+	run(h, c2, "RENAME", "src", "dst")
+	expectReply(t, receive(t, replies), "*2\r\n$3\r\ndst\r\n$1\r\na\r\n")
+}
+
+func TestHandler_Copy(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	run(h, c, "RPUSH", "src", "a", "b")
+	expectReply(t, run(h, c, "COPY", "src", "dst"), ":1\r\n")
+	run(h, c, "RPUSH", "dst", "c")
+	expectReply(t, run(h, c, "LRANGE", "src", "0", "-1"), "*2\r\n$1\r\na\r\n$1\r\nb\r\n")
+	expectReply(t, run(h, c, "LLEN", "dst"), ":3\r\n")
+
+	expectReply(t, run(h, c, "COPY", "src", "dst"), ":0\r\n")
+	expectReply(t, run(h, c, "COPY", "src", "dst", "REPLACE"), ":1\r\n")
+	expectReply(t, run(h, c, "LLEN", "dst"), ":2\r\n")
+	expectReply(t, run(h, c, "COPY", "missing", "dst", "REPLACE"), ":0\r\n")
+	expectReply(t, run(h, c, "COPY", "src", "src"), "-ERR source and destination objects are the same\r\n")
+	expectReply(t, run(h, c, "COPY", "src", "dst", "DB", "16"), "-ERR DB index is out of range\r\n")
+	expectReply(t, run(h, c, "COPY", "src", "dst", "FOO"), "-ERR syntax error\r\n")
+
+	// Copying to another database
+	run(h, c, "SET", "s", "v", "EX", "100")
+	expectReply(t, run(h, c, "COPY", "s", "s", "DB", "1"), ":1\r\n")
+	expectReply(t, run(h, c, "SELECT", "1"), "+OK\r\n")
+	expectReply(t, run(h, c, "GET", "s"), "$1\r\nv\r\n")
+	expectReply(t, run(h, c, "TTL", "s"), ":100\r\n")
+	expectReply(t, run(h, c, "EXISTS", "src"), ":0\r\n")
+	expectReply(t, run(h, c, "SELECT", "16"), "-ERR DB index is out of range\r\n")
+}
+
+func TestHandler_SelectInMulti(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	run(h, c, "MULTI")
+	run(h, c, "SET", "k", "0")
+	run(h, c, "SELECT", "2")
+	run(h, c, "SET", "k", "2")
+	expectReply(t, run(h, c, "EXEC"), "*3\r\n+OK\r\n+OK\r\n+OK\r\n")
+	expectReply(t, run(h, c, "GET", "k"), "$1\r\n2\r\n")
+	run(h, c, "SELECT", "0")
+	expectReply(t, run(h, c, "GET", "k"), "$1\r\n0\r\n")
+}
+
+func TestHandler_Object(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	run(h, c, "SET", "int", "12345")
+	run(h, c, "SET", "short", "hello")
+	run(h, c, "SET", "long", strings.Repeat("x", 45))
+	run(h, c, "RPUSH", "l", "a")
+
+	tests := []struct{ key, want string }{
+		{"int", "$3\r\nint\r\n"},
+		{"short", "$6\r\nembstr\r\n"},
+		{"long", "$3\r\nraw\r\n"},
+		{"l", "$9\r\nquicklist\r\n"},
+		{"missing", "$-1\r\n"},
+	}
+	for _, tt := range tests {
+		expectReply(t, run(h, c, "OBJECT", "ENCODING", tt.key), tt.want)
+	}
+
+	expectReply(t, run(h, c, "OBJECT", "REFCOUNT", "l"), ":1\r\n")
+	expectReply(t, run(h, c, "OBJECT", "IDLETIME", "l"), ":0\r\n")
+	expectReply(t, run(h, c, "OBJECT", "FREQ", "l"), "-"+lfuNotTrackedError+"\r\n")
+	expectReply(t, run(h, c, "OBJECT", "ENCODING"), "-ERR wrong number of arguments for 'object|encoding' command\r\n")
+	expectReply(t, run(h, c, "OBJECT", "FOO", "l"), "-ERR unknown subcommand 'FOO'. Try OBJECT HELP.\r\n")
+	if reply := run(h, c, "OBJECT", "HELP"); !strings.HasPrefix(reply, "*15\r\n") {
+		t.Errorf("got %q, want 15 help lines", reply)
+	}
+}
+
+func TestHandler_SetsAndHashes(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	expectReply(t, run(h, c, "SADD", "s", "a", "b", "a"), ":2\r\n")
+	expectReply(t, run(h, c, "SISMEMBER", "s", "a"), ":1\r\n")
+	expectReply(t, run(h, c, "SREM", "s", "a", "c"), ":1\r\n")
+	expectReply(t, run(h, c, "SMEMBERS", "s"), "*1\r\n$1\r\nb\r\n")
+	expectReply(t, run(h, c, "SREM", "s", "b"), ":1\r\n")
+	expectReply(t, run(h, c, "TYPE", "s"), "+none\r\n")
+
+	expectReply(t, run(h, c, "HSET", "h", "b", "1", "a", "2"), ":2\r\n")
+	expectReply(t, run(h, c, "HSET", "h", "b", "3"), ":0\r\n")
+	expectReply(t, run(h, c, "HSET", "h", "b"), "-ERR wrong number of arguments for 'hset' command\r\n")
+	expectReply(t, run(h, c, "HGET", "h", "b"), "$1\r\n3\r\n")
+	expectReply(t, run(h, c, "HGETALL", "h"), "*4\r\n$1\r\na\r\n$1\r\n2\r\n$1\r\nb\r\n$1\r\n3\r\n")
+	expectReply(t, run(h, c, "HDEL", "h", "a", "z"), ":1\r\n")
+	expectReply(t, run(h, c, "HLEN", "h"), ":1\r\n")
+	expectReply(t, run(h, c, "TYPE", "h"), "+hash\r\n")
+	expectReply(t, run(h, c, "SADD", "h", "x"), "-"+wrongTypeError+"\r\n")
+}
+
+func TestHandler_Sort(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	run(h, c, "RPUSH", "l", "3", "10", "1", "2")
+	run(h, c, "MSET", "w_1", "4", "w_2", "3", "w_3", "2", "w_10", "1")
+	run(h, c, "MSET", "name_1", "one", "name_2", "two", "name_3", "three")
+	run(h, c, "HSET", "obj_1", "rank", "b")
+	run(h, c, "HSET", "obj_2", "rank", "a")
+	run(h, c, "SADD", "s", "b", "c", "a")
+	run(h, c, "ZADD", "z", "1", "c", "2", "a", "3", "b")
+	run(h, c, "RPUSH", "words", "b", "a", "c")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"SORT", "l"}, "*4\r\n$1\r\n1\r\n$1\r\n2\r\n$1\r\n3\r\n$2\r\n10\r\n"},
+		{[]string{"SORT", "l", "DESC", "LIMIT", "1", "2"}, "*2\r\n$1\r\n3\r\n$1\r\n2\r\n"},
+		{[]string{"SORT", "l", "ALPHA"}, "*4\r\n$1\r\n1\r\n$2\r\n10\r\n$1\r\n2\r\n$1\r\n3\r\n"},
+		{[]string{"SORT", "l", "LIMIT", "10", "5"}, "*0\r\n"},
+		{[]string{"SORT", "l", "LIMIT", "-5", "1"}, "*1\r\n$1\r\n1\r\n"},
+		{[]string{"SORT", "l", "BY", "w_*"}, "*4\r\n$2\r\n10\r\n$1\r\n3\r\n$1\r\n2\r\n$1\r\n1\r\n"},
+		{[]string{"SORT", "l", "BY", "nosort"}, "*4\r\n$1\r\n3\r\n$2\r\n10\r\n$1\r\n1\r\n$1\r\n2\r\n"},
+		{[]string{"SORT", "l", "LIMIT", "0", "3", "GET", "#", "GET", "name_*"}, "*6\r\n$1\r\n1\r\n$3\r\none\r\n$1\r\n2\r\n$3\r\ntwo\r\n$1\r\n3\r\n$5\r\nthree\r\n"},
+		{[]string{"SORT", "l", "BY", "obj_*->rank", "ALPHA", "GET", "obj_*->rank"}, "*4\r\n$-1\r\n$-1\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{[]string{"SORT", "s", "ALPHA"}, "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"SORT", "z", "BY", "nosort", "DESC"}, "*3\r\n$1\r\nb\r\n$1\r\na\r\n$1\r\nc\r\n"},
+		{[]string{"SORT", "z", "ALPHA", "DESC"}, "*3\r\n$1\r\nc\r\n$1\r\nb\r\n$1\r\na\r\n"},
+		{[]string{"SORT", "missing"}, "*0\r\n"},
+		{[]string{"SORT", "words"}, "-ERR One or more scores can't be converted into double\r\n"},
+		{[]string{"SORT", "w_1"}, "-" + wrongTypeError + "\r\n"},
+		{[]string{"SORT", "l", "LIMIT", "1"}, "-ERR syntax error\r\n"},
+		{[]string{"SORT_RO", "l", "STORE", "dst"}, "-ERR syntax error\r\n"},
+		{[]string{"SORT_RO", "l", "DESC"}, "*4\r\n$2\r\n10\r\n$1\r\n3\r\n$1\r\n2\r\n$1\r\n1\r\n"},
+	}
+	for _, tt := range tests {
+		expectReply(t, run(h, c, tt.args...), tt.want)
+	}
+}
+
+func TestHandler_SortStore(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	run(h, c, "RPUSH", "l", "2", "1")
+	run(h, c, "SET", "name_1", "one")
+	expectReply(t, run(h, c, "SORT", "l", "GET", "name_*", "STORE", "dst"), ":2\r\n")
+	expectReply(t, run(h, c, "LRANGE", "dst", "0", "-1"), "*2\r\n$3\r\none\r\n$0\r\n\r\n")
+
+	// Sets are sorted before being stored even when BY asks not to
+	run(h, c, "SADD", "s", "c", "a", "b")
+	expectReply(t, run(h, c, "SORT", "s", "BY", "nosort", "STORE", "dst"), ":3\r\n")
+	expectReply(t, run(h, c, "LRANGE", "dst", "0", "-1"), "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n")
+
+	// Inside a transaction the pattern keys are locked as well
+	run(h, c, "MULTI")
+	run(h, c, "SORT", "l", "GET", "name_*")
+	expectReply(t, run(h, c, "EXEC"), "*1\r\n*2\r\n$3\r\none\r\n$-1\r\n")
+
+	// An empty result deletes the destination
+	expectReply(t, run(h, c, "SORT", "missing", "STORE", "dst"), ":0\r\n")
+	expectReply(t, run(h, c, "EXISTS", "dst"), ":0\r\n")
+
+	// Storing serves the clients blocked on the destination
+	c2 := h.NewClient("c2", "", Conn{})
+	replies := runBlocking(t, h, c2, "BLPOP", "dst", "0")
+	run(h, c, "SORT", "l", "STORE", "dst")
+	expectReply(t, receive(t, replies), "*2\r\n$3\r\ndst\r\n$1\r\n1\r\n")
+}
+
+// Create a client whose pushed messages are delivered on the returned channel
+func newPushClient(h *Handler) (*Client, <-chan string) {
+	messages := make(chan string, 64)
+	c := h.NewClient("subscriber", "", Conn{Push: func(msg resp.RESPData) {
+		messages <- string(msg.Encode())
+	}})
+	return c, messages
+}
+
+func TestHandler_PubSub(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+	sub, messages := newPushClient(h)
+
+	expectReply(t, run(h, sub, "SUBSCRIBE", "news", "sports"),
+		"*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n*3\r\n$9\r\nsubscribe\r\n$6\r\nsports\r\n:2\r\n")
+	expectReply(t, run(h, sub, "PSUBSCRIBE", "n*"), "*3\r\n$10\r\npsubscribe\r\n$2\r\nn*\r\n:3\r\n")
+
+	// Subscribed clients are limited to the pub/sub commands
+	expectReply(t, run(h, sub, "GET", "k"), "-ERR Can't execute 'get': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT are allowed in this context\r\n")
+	expectReply(t, run(h, sub, "PING"), "*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+
+	// Received through the channel and the pattern
+	expectReply(t, run(h, c, "PUBLISH", "news", "hello"), ":2\r\n")
+	expectReply(t, receive(t, messages), "*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+	expectReply(t, receive(t, messages), "*4\r\n$8\r\npmessage\r\n$2\r\nn*\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+
+	expectReply(t, run(h, c, "PUBSUB", "NUMSUB", "news", "other"), "*4\r\n$4\r\nnews\r\n:1\r\n$5\r\nother\r\n:0\r\n")
+	expectReply(t, run(h, c, "PUBSUB", "NUMPAT"), ":1\r\n")
+	if reply := run(h, c, "PUBSUB", "HELP"); !strings.HasPrefix(reply, "*10\r\n+PUBSUB <subcommand>") {
+		t.Errorf("got %q, want the help", reply)
+	}
+	expectReply(t, run(h, c, "PUBSUB", "NOPE"), "-ERR unknown subcommand or wrong number of arguments for 'NOPE'. Try PUBSUB HELP.\r\n")
+
+	run(h, sub, "UNSUBSCRIBE")
+	run(h, sub, "PUNSUBSCRIBE")
+	expectReply(t, run(h, c, "PUBLISH", "news", "hello"), ":0\r\n")
+	expectReply(t, run(h, sub, "GET", "k"), "$-1\r\n")
+}
+
+func TestHandler_KeyspaceNotifications(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+	sub, messages := newPushClient(h)
+
+	// Disabled by default
+	run(h, sub, "PSUBSCRIBE", "__key*@*__:*")
+	run(h, c, "SET", "k", "v")
+	expectReply(t, run(h, c, "CONFIG", "GET", "notify-keyspace-events"), "*2\r\n$22\r\nnotify-keyspace-events\r\n$0\r\n\r\n")
+
+	expectReply(t, run(h, c, "CONFIG", "SET", "notify-keyspace-events", "KEA"), "+OK\r\n")
+	expectReply(t, run(h, c, "CONFIG", "GET", "notify-*"), "*2\r\n$22\r\nnotify-keyspace-events\r\n$3\r\nAKE\r\n")
+
+	run(h, c, "SET", "k", "v2")
+	expectReply(t, receive(t, messages), "*4\r\n$8\r\npmessage\r\n$12\r\n__key*@*__:*\r\n$16\r\n__keyspace@0__:k\r\n$3\r\nset\r\n")
+	expectReply(t, receive(t, messages), "*4\r\n$8\r\npmessage\r\n$12\r\n__key*@*__:*\r\n$18\r\n__keyevent@0__:set\r\n$1\r\nk\r\n")
+	run(h, sub, "PUNSUBSCRIBE")
+
+	// Events of a single class in a single channel kind
+	run(h, c, "CONFIG", "SET", "notify-keyspace-events", "El")
+	run(h, sub, "PSUBSCRIBE", "__keyevent@*")
+	run(h, c, "SELECT", "1")
+	run(h, c, "SET", "k", "v")
+	run(h, c, "RPUSH", "l", "a", "b")
+	run(h, c, "LPOP", "l", "2")
+	expectReply(t, receive(t, messages), "*4\r\n$8\r\npmessage\r\n$12\r\n__keyevent@*\r\n$20\r\n__keyevent@1__:rpush\r\n$1\r\nl\r\n")
+	expectReply(t, receive(t, messages), "*4\r\n$8\r\npmessage\r\n$12\r\n__keyevent@*\r\n$19\r\n__keyevent@1__:lpop\r\n$1\r\nl\r\n")
+
+	// Generic events, with new keys and misses which A leaves out
+	run(h, c, "CONFIG", "SET", "notify-keyspace-events", "Egnm")
+	run(h, c, "RPUSH", "l", "a")
+	run(h, c, "RENAME", "l", "l2")
+	run(h, c, "GET", "missing")
+	for _, event := range []string{"new", "new", "rename_from", "rename_to", "keymiss"} {
+		got := receive(t, messages)
+		if !strings.Contains(got, "__keyevent@1__:"+event+"\r\n") {
+			t.Errorf("got %q, want a %s event", got, event)
+		}
+	}
+	run(h, c, "DEL", "l2")
+	expectReply(t, receive(t, messages), "*4\r\n$8\r\npmessage\r\n$12\r\n__keyevent@*\r\n$18\r\n__keyevent@1__:del\r\n$2\r\nl2\r\n")
+
+	// Expired keys
+	run(h, c, "CONFIG", "SET", "notify-keyspace-events", "Ex")
+	run(h, c, "SET", "k", "v", "PX", "1")
+	time.Sleep(5 * time.Millisecond)
+	run(h, c, "EXISTS", "k")
+	expectReply(t, receive(t, messages), "*4\r\n$8\r\npmessage\r\n$12\r\n__keyevent@*\r\n$22\r\n__keyevent@1__:expired\r\n$1\r\nk\r\n")
+
+	select {
+	case msg := <-messages:
+		t.Errorf("unexpected message %q", msg)
+	default:
+	}
+}
+
+func TestHandler_Config(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	expectReply(t, run(h, c, "CONFIG", "GET", "PORT"), "*2\r\n$4\r\nport\r\n$4\r\n6379\r\n")
+	expectReply(t, run(h, c, "CONFIG", "GET", "nothing*"), "*0\r\n")
+	expectReply(t, run(h, c, "CONFIG", "SET", "port", "7000"), "-ERR CONFIG SET failed (possibly related to argument 'port') - can't set immutable config\r\n")
+
+	// Nothing is applied when one of the options is invalid
+	expectReply(t, run(h, c, "CONFIG", "SET", "notify-keyspace-events", "KEA", "notify-keyspace-events", "Q"),
+		"-ERR CONFIG SET failed (possibly related to argument 'notify-keyspace-events') - invalid keyspace event flag 'Q'\r\n")
+	expectReply(t, run(h, c, "CONFIG", "GET", "notify-keyspace-events"), "*2\r\n$22\r\nnotify-keyspace-events\r\n$0\r\n\r\n")
+	if got := h.Config().NotifyKeyspaceEvents; got != 0 {
+		t.Errorf("got %v, want no events", got)
+	}
+
+	if reply := run(h, c, "CONFIG", "HELP"); !strings.HasPrefix(reply, "*7\r\n+CONFIG <subcommand>") {
+		t.Errorf("got %q, want the help", reply)
+	}
+	expectReply(t, run(h, c, "CONFIG", "NOPE"), "-ERR unknown subcommand 'NOPE'. Try CONFIG HELP.\r\n")
+}
+
+func TestHandler_Hello(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	expectReply(t, run(h, c, "HELLO", "4"), "-NOPROTO unsupported protocol version\r\n")
+	expectReply(t, run(h, c, "HELLO", "3", "AUTH", "user", "pass"), "-ERR Syntax error in HELLO option 'AUTH'\r\n")
+	reply := run(h, c, "HELLO", "3")
+	if !strings.HasPrefix(reply, "%7\r\n$6\r\nserver\r\n$5\r\nredis\r\n") || !strings.Contains(reply, "$5\r\nproto\r\n:3\r\n") {
+		t.Errorf("unexpected HELLO reply %q", reply)
+	}
+
+	// RESP3 clients get push messages and may run any command while subscribed
+	sub, messages := newPushClient(h)
+	run(h, sub, "HELLO", "3")
+	expectReply(t, run(h, sub, "SUBSCRIBE", "ch"), ">3\r\n$9\r\nsubscribe\r\n$2\r\nch\r\n:1\r\n")
+	expectReply(t, run(h, sub, "GET", "k"), "$-1\r\n")
+	expectReply(t, run(h, sub, "PING"), "+PONG\r\n")
+	run(h, c, "PUBLISH", "ch", "hi")
+	expectReply(t, receive(t, messages), ">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$2\r\nhi\r\n")
+
+	if reply := run(h, c, "HELLO", "2"); !strings.HasPrefix(reply, "*14\r\n") {
+		t.Errorf("unexpected HELLO reply %q", reply)
+	}
+}
+
+func TestHandler_ClientTracking(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+	reader, messages := newPushClient(h)
+	run(h, reader, "HELLO", "3")
+
+	expectReply(t, run(h, reader, "CLIENT", "GETREDIR"), ":-1\r\n")
+	expectReply(t, run(h, reader, "CLIENT", "TRACKING", "ON"), "+OK\r\n")
+	expectReply(t, run(h, reader, "CLIENT", "GETREDIR"), ":0\r\n")
+
+	// Keys read are invalidated once, on their next modification
+	run(h, c, "SET", "k", "v")
+	run(h, reader, "GET", "k")
+	run(h, c, "SET", "other", "v")
+	run(h, c, "APPEND", "k", "2")
+	run(h, c, "APPEND", "k", "3")
+	expectReply(t, receive(t, messages), ">2\r\n$10\r\ninvalidate\r\n*1\r\n$1\r\nk\r\n")
+
+	// Expiring keys are invalidated as well
+	run(h, c, "SET", "k", "v", "PX", "20")
+	run(h, reader, "MGET", "k", "other")
+	time.Sleep(30 * time.Millisecond)
+	run(h, c, "EXISTS", "k")
+	expectReply(t, receive(t, messages), ">2\r\n$10\r\ninvalidate\r\n*1\r\n$1\r\nk\r\n")
+
+	// NOLOOP skips the keys the client modifies itself
+	run(h, reader, "CLIENT", "TRACKING", "ON", "NOLOOP")
+	run(h, reader, "GET", "other")
+	run(h, reader, "SET", "other", "v2")
+	expectReply(t, run(h, reader, "CLIENT", "TRACKINGINFO"), "%3\r\n$5\r\nflags\r\n*2\r\n$2\r\non\r\n$6\r\nnoloop\r\n$8\r\nredirect\r\n:0\r\n$8\r\nprefixes\r\n*0\r\n")
+	run(h, reader, "CLIENT", "TRACKING", "OFF")
+
+	// OPTIN only tracks the command following CLIENT CACHING YES
+	expectReply(t, run(h, reader, "CLIENT", "CACHING", "YES"), "-ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled\r\n")
+	run(h, reader, "CLIENT", "TRACKING", "ON", "OPTIN")
+	expectReply(t, run(h, reader, "CLIENT", "CACHING", "NO"), "-ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode.\r\n")
+	run(h, reader, "GET", "a")
+	expectReply(t, run(h, reader, "CLIENT", "CACHING", "YES"), "+OK\r\n")
+	run(h, reader, "GET", "b")
+	run(h, reader, "GET", "c")
+	run(h, c, "MSET", "a", "1", "b", "1", "c", "1")
+	expectReply(t, receive(t, messages), ">2\r\n$10\r\ninvalidate\r\n*1\r\n$1\r\nb\r\n")
+	expectReply(t, run(h, reader, "CLIENT", "TRACKING", "ON", "OPTOUT"), "-ERR You can't switch OPTIN/OPTOUT mode before disabling tracking for this client, and then re-enabling it with a different mode.\r\n")
+	run(h, reader, "CLIENT", "TRACKING", "OFF")
+
+	// BCAST sends every key matching the prefixes, read or not
+	expectReply(t, run(h, reader, "CLIENT", "TRACKING", "ON", "PREFIX", "user:"), "-ERR PREFIX option requires BCAST mode to be enabled\r\n")
+	expectReply(t, run(h, reader, "CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "user:", "PREFIX", "user:1"),
+		"-ERR Prefix 'user:' overlaps with another provided prefix 'user:1'. Prefixes for a single client must not overlap.\r\n")
+	expectReply(t, run(h, reader, "CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "user:", "PREFIX", "session:"), "+OK\r\n")
+	run(h, c, "SET", "product:1", "v")
+	run(h, c, "HSET", "user:1", "name", "x")
+	expectReply(t, receive(t, messages), ">2\r\n$10\r\ninvalidate\r\n*1\r\n$6\r\nuser:1\r\n")
+	run(h, reader, "CLIENT", "TRACKING", "OFF")
+
+	select {
+	case msg := <-messages:
+		t.Errorf("unexpected message %q", msg)
+	default:
+	}
+}
+
+func TestHandler_ClientTrackingRedirect(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+	reader := h.NewClient("reader", "", Conn{})
+	sub, messages := newPushClient(h)
+
+	expectReply(t, run(h, reader, "CLIENT", "TRACKING", "ON", "REDIRECT", "1000"), "-ERR The client ID you want redirect to does not exist\r\n")
+	run(h, sub, "SUBSCRIBE", "__redis__:invalidate")
+	expectReply(t, run(h, reader, "CLIENT", "TRACKING", "ON", "REDIRECT", strconv.FormatInt(sub.ID, 10)), "+OK\r\n")
+	expectReply(t, run(h, reader, "CLIENT", "GETREDIR"), ":"+strconv.FormatInt(sub.ID, 10)+"\r\n")
+
+	// RESP2 clients receive the invalidations on the channel
+	run(h, reader, "GET", "k")
+	run(h, c, "DEL", "k")
+	run(h, c, "SET", "k", "v")
+	expectReply(t, receive(t, messages), "*3\r\n$7\r\nmessage\r\n$20\r\n__redis__:invalidate\r\n*1\r\n$1\r\nk\r\n")
+
+	// The redirection breaks when the receiving client goes away
+	h.RemoveClient(sub)
+	run(h, reader, "GET", "k")
+	run(h, c, "DEL", "k")
+	reply := run(h, reader, "CLIENT", "TRACKINGINFO")
+	if !strings.Contains(reply, "$15\r\nbroken_redirect\r\n") {
+		t.Errorf("got %q, want a broken redirection", reply)
+	}
+}
+
+func TestHandler_ClientNameAndList(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("127.0.0.1:5000", "127.0.0.1:6379", Conn{})
+	other := h.NewClient("127.0.0.1:5001", "127.0.0.1:6379", Conn{})
+
+	expectReply(t, run(h, c, "CLIENT", "ID"), ":1\r\n")
+	expectReply(t, run(h, c, "CLIENT", "GETNAME"), "$-1\r\n")
+	expectReply(t, run(h, c, "CLIENT", "SETNAME", "my conn"), "-ERR Client names cannot contain spaces, newlines or special characters.\r\n")
+	expectReply(t, run(h, c, "CLIENT", "SETNAME", "worker"), "+OK\r\n")
+	expectReply(t, run(h, c, "CLIENT", "GETNAME"), "$6\r\nworker\r\n")
+	expectReply(t, run(h, c, "CLIENT", "SETINFO", "LIB-NAME", "go-medis"), "+OK\r\n")
+	expectReply(t, run(h, c, "CLIENT", "SETINFO", "LIB-COLOR", "red"), "-ERR Unrecognized option 'LIB-COLOR'\r\n")
+
+	run(h, other, "SELECT", "2")
+	run(h, other, "MULTI")
+	run(h, other, "SET", "k", "v")
+
+	info := run(h, c, "CLIENT", "INFO")
+	for _, field := range []string{"id=1 ", "addr=127.0.0.1:5000 ", "laddr=127.0.0.1:6379 ", "name=worker ", "flags=N ", "db=0 ", "cmd=client ", "lib-name=go-medis "} {
+		if !strings.Contains(info, field) {
+			t.Errorf("got %q, want it to contain %q", info, field)
+		}
+	}
+
+	list := run(h, c, "CLIENT", "LIST", "ID", "2")
+	for _, field := range []string{"id=2 ", "flags=x ", "db=2 ", "multi=1 ", "cmd=set "} {
+		if !strings.Contains(list, field) {
+			t.Errorf("got %q, want it to contain %q", list, field)
+		}
+	}
+	if got := strings.Count(run(h, c, "CLIENT", "LIST"), "id="); got != 2 {
+		t.Errorf("got %d clients, want 2", got)
+	}
+	expectReply(t, run(h, c, "CLIENT", "LIST", "TYPE", "pubsub"), "$0\r\n\r\n")
+	expectReply(t, run(h, c, "CLIENT", "LIST", "TYPE", "robot"), "-ERR Unknown client type 'robot'\r\n")
+
+	if reply := run(h, c, "CLIENT", "HELP"); !strings.HasPrefix(reply, "*58\r\n+CLIENT <subcommand>") {
+		t.Errorf("got %q, want the help", reply)
+	}
+	expectReply(t, run(h, c, "CLIENT", "NOPE"), "-ERR unknown subcommand 'NOPE'. Try CLIENT HELP.\r\n")
+}
+
+func TestHandler_ClientKill(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("127.0.0.1:5000", "127.0.0.1:6379", Conn{})
+	closed := map[int64]bool{}
+	newClient := func(addr, laddr string) *Client {
+		var client *Client
+		client = h.NewClient(addr, laddr, Conn{Close: func() { closed[client.ID] = true }})
+		return client
+	}
+	a := newClient("127.0.0.1:5001", "127.0.0.1:6379")
+	b := newClient("127.0.0.1:5002", "127.0.0.1:6380")
+	sub := newClient("127.0.0.1:5003", "127.0.0.1:6379")
+	run(h, sub, "SUBSCRIBE", "ch")
+
+	expectReply(t, run(h, c, "CLIENT", "KILL", "127.0.0.1:5001"), "+OK\r\n")
+	expectReply(t, run(h, c, "CLIENT", "KILL", "127.0.0.1:9999"), "-ERR No such client\r\n")
+	if !closed[a.ID] || len(closed) != 1 {
+		t.Errorf("got %v closed, want client %d", closed, a.ID)
+	}
+
+	expectReply(t, run(h, c, "CLIENT", "KILL", "LADDR", "127.0.0.1:6380"), ":1\r\n")
+	expectReply(t, run(h, c, "CLIENT", "KILL", "TYPE", "pubsub", "USER", "default"), ":1\r\n")
+	expectReply(t, run(h, c, "CLIENT", "KILL", "USER", "admin"), "-ERR No such user 'admin'\r\n")
+	if !closed[b.ID] || !closed[sub.ID] {
+		t.Errorf("got %v closed, want clients %d and %d", closed, b.ID, sub.ID)
+	}
+
+	// The client itself is skipped unless asked for, then closed after the reply
+	expectReply(t, run(h, c, "CLIENT", "KILL", "ID", "1"), ":0\r\n")
+	if c.CloseAfterReply() {
+		t.Error("expected the client to be skipped")
+	}
+	expectReply(t, run(h, c, "CLIENT", "KILL", "ID", "1", "SKIPME", "no"), ":1\r\n")
+	if !c.CloseAfterReply() {
+		t.Error("expected the client to be closed after the reply")
+	}
+}
+
+func TestHandler_ClientPause(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+	writer := h.NewClient("writer", "", Conn{})
+
+	expectReply(t, run(h, c, "CLIENT", "PAUSE", "-1"), "-ERR timeout is negative\r\n")
+	expectReply(t, run(h, c, "CLIENT", "PAUSE", "10000", "READ"), "-ERR CLIENT PAUSE mode must be WRITE or ALL\r\n")
+	expectReply(t, run(h, c, "CLIENT", "PAUSE", "10000", "WRITE"), "+OK\r\n")
+
+	// Reads go through, writes wait for the pause to end
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cmd := newCommand("SET", "k", "v")
+		h.WaitUnpaused(writer, cmd)
+		h.Handle(writer, cmd)
+	}()
+	h.WaitUnpaused(c, newCommand("GET", "k"))
+	select {
+	case <-done:
+		t.Fatal("expected the write to be paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Queuing commands is not writing
+	run(h, c, "MULTI")
+	h.WaitUnpaused(c, newCommand("SET", "k", "v"))
+	run(h, c, "DISCARD")
+
+	expectReply(t, run(h, c, "CLIENT", "UNPAUSE"), "+OK\r\n")
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the paused write")
+	}
+	expectReply(t, run(h, c, "GET", "k"), "$1\r\nv\r\n")
+
+	// The pause ends by itself after the timeout
+	run(h, c, "CLIENT", "PAUSE", "20")
+	start := time.Now()
+	h.WaitUnpaused(c, newCommand("GET", "k"))
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("waited %v, want the read paused in ALL mode", elapsed)
+	}
+}
+
+func TestHandler_ClientNoTouch(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	run(h, c, "SET", "k", "v")
+	time.Sleep(1100 * time.Millisecond)
+	expectReply(t, run(h, c, "CLIENT", "NO-TOUCH", "ON"), "+OK\r\n")
+	run(h, c, "GET", "k")
+	expectReply(t, run(h, c, "OBJECT", "IDLETIME", "k"), ":1\r\n")
+	if info := run(h, c, "CLIENT", "INFO"); !strings.Contains(info, "flags=T ") {
+		t.Errorf("got %q, want the no-touch flag", info)
+	}
+
+	// TOUCH still updates the access time
+	run(h, c, "TOUCH", "k")
+	expectReply(t, run(h, c, "OBJECT", "IDLETIME", "k"), ":0\r\n")
+	expectReply(t, run(h, c, "CLIENT", "NO-EVICT", "maybe"), "-ERR syntax error\r\n")
+}
+
+func TestHandler_Slowlog(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("127.0.0.1:5000", "", Conn{})
+
+	run(h, c, "SET", "k", "v")
+	expectReply(t, run(h, c, "SLOWLOG", "LEN"), ":0\r\n")
+
+	// Every command is slower than 0 microseconds
+	run(h, c, "CONFIG", "SET", "slowlog-log-slower-than", "0", "slowlog-max-len", "3")
+	run(h, c, "CLIENT", "SETNAME", "worker")
+	run(h, c, "SET", "k", strings.Repeat("v", 130))
+	long := []string{"RPUSH", "l"}
+	for i := 0; i < 40; i++ {
+		long = append(long, "x")
+	}
+	run(h, c, long...)
+
+	// Newest first, with long arguments and commands truncated
+	entries := run(h, c, "SLOWLOG", "GET", "2")
+	if !strings.HasPrefix(entries, "*2\r\n*6\r\n:3\r\n") {
+		t.Errorf("got %q, want the two newest entries", entries)
+	}
+	if !strings.Contains(entries, "*32\r\n$5\r\nRPUSH\r\n$1\r\nl\r\n") || !strings.Contains(entries, "$23\r\n... (11 more arguments)\r\n") {
+		t.Errorf("got %q, want the RPUSH arguments truncated", entries)
+	}
+	if !strings.Contains(entries, "$146\r\n"+strings.Repeat("v", 128)+"... (2 more bytes)\r\n") {
+		t.Errorf("got %q, want the SET value truncated", entries)
+	}
+	if !strings.HasSuffix(entries, "$14\r\n127.0.0.1:5000\r\n$6\r\nworker\r\n") {
+		t.Errorf("got %q, want the client address and name", entries)
+	}
+	expectReply(t, run(h, c, "SLOWLOG", "LEN"), ":3\r\n")
+
+	// Shrinking the log keeps the newest entries
+	run(h, c, "CONFIG", "SET", "slowlog-max-len", "1")
+	if entries := run(h, c, "SLOWLOG", "GET", "-1"); !strings.HasPrefix(entries, "*1\r\n*6\r\n:6\r\n") || !strings.Contains(entries, "$15\r\nslowlog-max-len\r\n") {
+		t.Errorf("got %q, want the CONFIG SET entry", entries)
+	}
+
+	expectReply(t, run(h, c, "SLOWLOG", "GET", "-2"), "-ERR count should be greater than or equal to -1\r\n")
+	run(h, c, "CONFIG", "SET", "slowlog-log-slower-than", "-1")
+	expectReply(t, run(h, c, "SLOWLOG", "RESET"), "+OK\r\n")
+	expectReply(t, run(h, c, "SLOWLOG", "GET"), "*0\r\n")
+
+	if reply := run(h, c, "SLOWLOG", "HELP"); !strings.HasPrefix(reply, "*12\r\n+SLOWLOG <subcommand>") {
+		t.Errorf("got %q, want the help", reply)
+	}
+	expectReply(t, run(h, c, "SLOWLOG", "NOPE"), "-ERR unknown subcommand 'NOPE'. Try SLOWLOG HELP.\r\n")
+}
+
+func TestHandler_Monitor(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("127.0.0.1:5000", "", Conn{})
+	monitor, lines := newPushClient(h)
+
+	run(h, c, "SET", "before", "v")
+	expectReply(t, run(h, monitor, "MONITOR"), "+OK\r\n")
+	if info := run(h, monitor, "CLIENT", "INFO"); !strings.Contains(info, "flags=O ") {
+		t.Errorf("got %q, want the monitor flag", info)
+	}
+
+	expectMonitorLine := func(want string) {
+		t.Helper()
+		line := receive(t, lines)
+		// +<seconds>.<microseconds> [<db> <addr>] <args>
+		_, rest, ok := strings.Cut(line, " ")
+		if !ok || !regexp.MustCompile(`^\+\d+\.\d{6}$`).MatchString(line[:len(line)-len(rest)-1]) {
+			t.Fatalf("got %q, want a timestamp", line)
+		}
+		expectReply(t, rest, want)
+	}
+
+	expectMonitorLine(`[0 subscriber] "CLIENT" "INFO"` + "\r\n")
+
+	// The arguments are shown as sent, the name included
+	run(h, c, "set", "k", "a \"quoted\"\n\x01value")
+	expectMonitorLine(`[0 127.0.0.1:5000] "set" "k" "a \"quoted\"\n\x01value"` + "\r\n")
+
+	// Queued commands show up when EXEC runs them, in the selected database
+	run(h, c, "multi")
+	run(h, c, "Select", "1")
+	run(h, c, "incr", "n")
+	run(h, c, "EXEC")
+	expectMonitorLine(`[0 127.0.0.1:5000] "multi"` + "\r\n")
+	expectMonitorLine(`[1 127.0.0.1:5000] "Select" "1"` + "\r\n")
+	expectMonitorLine(`[1 127.0.0.1:5000] "incr" "n"` + "\r\n")
+	expectMonitorLine(`[1 127.0.0.1:5000] "EXEC"` + "\r\n")
+
+	// Administrative commands are not shown
+	run(h, c, "CONFIG", "GET", "port")
+	run(h, c, "ping")
+	expectMonitorLine(`[1 127.0.0.1:5000] "ping"` + "\r\n")
+
+	run(h, c, "MULTI")
+	run(h, c, "MONITOR")
+	expectReply(t, run(h, c, "EXEC"), "*1\r\n-ERR MONITOR isn't allowed for DENY BLOCKING client\r\n")
+	expectMonitorLine(`[1 127.0.0.1:5000] "MULTI"` + "\r\n")
+	expectMonitorLine(`[1 127.0.0.1:5000] "EXEC"` + "\r\n")
+
+	// Closed monitors stop receiving commands
+	h.RemoveClient(monitor)
+	run(h, c, "PING")
+	select {
+	case line := <-lines:
+		t.Errorf("got %q after the monitor was removed", line)
+	default:
+	}
+}
+
+func TestHandler_Latency(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	if report := run(h, c, "LATENCY", "DOCTOR"); !strings.Contains(report, "Latency monitoring is disabled") {
+		t.Errorf("got %q, want the monitor disabled", report)
+	}
+	run(h, c, "CONFIG", "SET", "latency-monitor-threshold", "100")
+	run(h, c, "GET", "k")
+	expectReply(t, run(h, c, "LATENCY", "LATEST"), "*0\r\n")
+
+	// Samples of the same second are merged, keeping the highest
+	now := time.Now()
+	h.latency.add("command", now.Add(-12*time.Minute), 100)
+	h.latency.add("command", now.Add(-11*time.Minute), 200)
+	h.latency.add("command", now.Add(-11*time.Minute), 500)
+	h.latency.add("command", now.Add(-10*time.Minute), 300)
+	h.latency.add("expire-cycle", now, 150)
+
+	t12, t11, t10 := now.Add(-12*time.Minute).Unix(), now.Add(-11*time.Minute).Unix(), now.Add(-10*time.Minute).Unix()
+	expectReply(t, run(h, c, "LATENCY", "LATEST"), fmt.Sprintf(
+		"*2\r\n*4\r\n$7\r\ncommand\r\n:%d\r\n:300\r\n:500\r\n*4\r\n$12\r\nexpire-cycle\r\n:%d\r\n:150\r\n:150\r\n", t10, now.Unix()))
+	expectReply(t, run(h, c, "LATENCY", "HISTORY", "command"), fmt.Sprintf(
+		"*3\r\n*2\r\n:%d\r\n:100\r\n*2\r\n:%d\r\n:500\r\n*2\r\n:%d\r\n:300\r\n", t12, t11, t10))
+	expectReply(t, run(h, c, "LATENCY", "HISTORY", "fork"), "*0\r\n")
+
+	graph := "command - high 500 ms, low 100 ms (all time high 500 ms)\n" +
+		strings.Repeat("-", 80) + "\n" +
+		" # \n" +
+		" |_\n" +
+		" ||\n" +
+		"_||\n" +
+		"   \n" +
+		"111\n" +
+		"210\n" +
+		"mmm\n"
+	expectReply(t, run(h, c, "LATENCY", "GRAPH", "command"), fmt.Sprintf("$%d\r\n%s\r\n", len(graph), graph))
+	expectReply(t, run(h, c, "LATENCY", "GRAPH", "fork"), "-ERR No samples available for event 'fork'\r\n")
+
+	report := run(h, c, "LATENCY", "DOCTOR")
+	for _, want := range []string{
+		"1. command: 3 latency spikes (average 300ms, mean deviation 133ms",
+		"2. expire-cycle: 1 latency spikes",
+		"Worst all time event 500ms.",
+		"- Check your Slow Log",
+		"- Deleting or expiring large objects",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("got %q, want it to contain %q", report, want)
+		}
+	}
+
+	expectReply(t, run(h, c, "LATENCY", "RESET", "command", "fork"), ":1\r\n")
+	expectReply(t, run(h, c, "LATENCY", "RESET"), ":1\r\n")
+	if report := run(h, c, "LATENCY", "DOCTOR"); !strings.Contains(report, "no latency spike was observed") {
+		t.Errorf("got %q, want no spike", report)
+	}
+
+	if reply := run(h, c, "LATENCY", "HELP"); !strings.HasPrefix(reply, "*14\r\n+LATENCY <subcommand>") {
+		t.Errorf("got %q, want the help", reply)
+	}
+	expectReply(t, run(h, c, "LATENCY", "NOPE"), "-ERR unknown subcommand 'NOPE'. Try LATENCY HELP.\r\n")
+}
+
+func TestHandler_Shutdown(t *testing.T) {
+	h := NewHandler(config.Default())
+	c := h.NewClient("test", "", Conn{})
+
+	expectReply(t, run(h, c, "SHUTDOWN"), "-ERR Errors trying to SHUTDOWN. Check logs.\r\n")
+	var requests []bool
+	h.OnShutdown = func(now bool) { requests = append(requests, now) }
+
+	expectReply(t, run(h, c, "SHUTDOWN", "SAVE", "NOSAVE"), "-ERR syntax error\r\n")
+	expectReply(t, run(h, c, "SHUTDOWN", "ABORT", "NOW"), "-ERR syntax error\r\n")
+	expectReply(t, run(h, c, "SHUTDOWN", "LATER"), "-ERR syntax error\r\n")
+	expectReply(t, run(h, c, "SHUTDOWN", "ABORT"), "-ERR No shutdown in progress.\r\n")
+	expectReply(t, run(h, c, "SHUTDOWN", "SAVE"), "-ERR Errors trying to SHUTDOWN. Check logs.\r\n")
+
+	run(h, c, "MULTI")
+	run(h, c, "SHUTDOWN")
+	expectReply(t, run(h, c, "EXEC"), "*1\r\n-ERR SHUTDOWN without NOW or ABORT isn't allowed for DENY BLOCKING client\r\n")
+	if len(requests) != 0 {
+		t.Fatalf("got %v, want no shutdown", requests)
+	}
+
+	expectReply(t, run(h, c, "SHUTDOWN", "save", "FORCE"), "+OK\r\n")
+	expectReply(t, run(h, c, "SHUTDOWN", "NOSAVE", "NOW"), "+OK\r\n")
+	if len(requests) != 2 || requests[0] || !requests[1] {
+		t.Errorf("got %v, want a shutdown and then one right now", requests)
+	}
+}
@@ -0,0 +1,119 @@
+package command
+
+import (
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+	"github.com/mmnalaka/medis/internal/types"
+)
+
+// Look up the hash stored at key. The hash is nil when the key does not
+// exist, and the error reply is set when it holds another type.
+func getHash(tx *keyspace.Tx, key string) (*types.Hash, *resp.Error) {
+	value, exists := tx.Get(key)
+	if !exists {
+		return nil, nil
+	}
+	hash, ok := value.(*types.Hash)
+	if !ok {
+		return nil, &resp.Error{Data: wrongTypeError}
+	}
+	return hash, nil
+}
+
+// Handler for HSET command
+// HSET key field value [field value ...]
+func (h *Handler) handleHSet(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if len(cmd.Args)%2 == 0 {
+		return wrongArgsError(cmd)
+	}
+	key := string(cmd.Args[0])
+	hash, errReply := getHash(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		hash = types.NewHash()
+		tx.Set(key, hash)
+	}
+
+	added := 0
+	for i := 1; i < len(cmd.Args); i += 2 {
+		if hash.Set(string(cmd.Args[i]), cmd.Args[i+1]) {
+			added++
+		}
+	}
+	h.notifyKeyspaceEvent(config.NotifyHash, "hset", key, tx.DB())
+	return &resp.Integer{Data: int64(added)}
+}
+
+// Handler for HGET command
+func (h *Handler) handleHGet(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	hash, errReply := getHash(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return &resp.BulkString{Data: nil}
+	}
+	value, _ := hash.Get(string(cmd.Args[1]))
+	return &resp.BulkString{Data: value}
+}
+
+// Handler for HDEL command
+func (h *Handler) handleHDel(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	key := string(cmd.Args[0])
+	hash, errReply := getHash(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return &resp.Integer{Data: 0}
+	}
+
+	deleted := 0
+	for _, field := range cmd.Args[1:] {
+		if hash.Delete(string(field)) {
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		h.notifyKeyspaceEvent(config.NotifyHash, "hdel", key, tx.DB())
+	}
+	// Hashes never exist empty
+	if hash.Len() == 0 {
+		tx.Delete(key)
+		h.notifyKeyspaceEvent(config.NotifyGeneric, "del", key, tx.DB())
+	}
+	return &resp.Integer{Data: int64(deleted)}
+}
+
+// Handler for HLEN command
+func (h *Handler) handleHLen(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	hash, errReply := getHash(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return &resp.Integer{Data: 0}
+	}
+	return &resp.Integer{Data: int64(hash.Len())}
+}
+
+// Handler for HGETALL command
+func (h *Handler) handleHGetAll(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	hash, errReply := getHash(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if hash == nil {
+		return &resp.Array{Data: []resp.RESPData{}}
+	}
+
+	reply := make([]resp.RESPData, 0, 2*hash.Len())
+	for _, field := range hash.Fields() {
+		value, _ := hash.Get(field)
+		reply = append(reply, &resp.BulkString{Data: []byte(field)}, &resp.BulkString{Data: value})
+	}
+	return &resp.Array{Data: reply}
+}
@@ -0,0 +1,220 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+	"github.com/mmnalaka/medis/internal/types"
+)
+
+const (
+	invalidHLLError   = "WRONGTYPE Key is not a valid HyperLogLog string value."
+	corruptedHLLError = "INVALIDOBJ Corrupted HLL object detected"
+)
+
+// Look up the HyperLogLog stored at key, a string with the HyperLogLog
+// encoding. The error reply is set when the key holds anything else.
+func getHyperLogLog(tx *keyspace.Tx, key string) (types.HyperLogLog, bool, *resp.Error) {
+	str, exists, errReply := getString(tx, key)
+	if errReply != nil || !exists {
+		return nil, false, errReply
+	}
+	if !types.HyperLogLog(str).Valid() {
+		return nil, false, &resp.Error{Data: invalidHLLError}
+	}
+	return types.HyperLogLog(str), true, nil
+}
+
+// Handler for PFADD command
+func (h *Handler) handlePFAdd(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	key := string(cmd.Args[0])
+	hll, exists, errReply := getHyperLogLog(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+
+	updated := !exists
+	if exists {
+		hll = types.HyperLogLog(copyString(hll, 0))
+	} else {
+		hll = types.NewHyperLogLog()
+	}
+
+	for _, element := range cmd.Args[1:] {
+		changed, err := hll.Add(element)
+		if err != nil {
+			return &resp.Error{Data: corruptedHLLError}
+		}
+		updated = updated || changed
+	}
+
+	if !updated {
+		return &resp.Integer{Data: 0}
+	}
+	hll.InvalidateCache()
+	tx.Set(key, []byte(hll))
+	h.notifyKeyspaceEvent(config.NotifyString, "pfadd", key, tx.DB())
+	return &resp.Integer{Data: 1}
+}
+
+// Handler for PFCOUNT command
+func (h *Handler) handlePFCount(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if len(cmd.Args) > 1 {
+		// Estimate the cardinality of the union of the HyperLogLogs
+		registers := make([]uint8, types.HLLRegisters)
+		for _, arg := range cmd.Args {
+			hll, exists, errReply := getHyperLogLog(tx, string(arg))
+			if errReply != nil {
+				return errReply
+			}
+			if !exists {
+				continue
+			}
+			if err := hll.MergeInto(registers); err != nil {
+				return &resp.Error{Data: corruptedHLLError}
+			}
+		}
+		return &resp.Integer{Data: int64(types.CountRegisters(registers))}
+	}
+
+	key := string(cmd.Args[0])
+	hll, exists, errReply := getHyperLogLog(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if !exists {
+		return &resp.Integer{Data: 0}
+	}
+
+	if count, ok := hll.CachedCount(); ok {
+		return &resp.Integer{Data: int64(count)}
+	}
+	count, err := hll.Count()
+	if err != nil {
+		return &resp.Error{Data: corruptedHLLError}
+	}
+	// Cache the cardinality until the next update
+	hll = types.HyperLogLog(copyString(hll, 0))
+	hll.SetCachedCount(count)
+	tx.Set(key, []byte(hll))
+	return &resp.Integer{Data: int64(count)}
+}
+
+// Handler for PFMERGE command
+// PFMERGE destkey [sourcekey [sourcekey ...]]
+func (h *Handler) handlePFMerge(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	// The destination is part of the union
+	registers := make([]uint8, types.HLLRegisters)
+	useDense := false
+	for _, arg := range cmd.Args {
+		hll, exists, errReply := getHyperLogLog(tx, string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if !exists {
+			continue
+		}
+		useDense = useDense || !hll.IsSparse()
+		if err := hll.MergeInto(registers); err != nil {
+			return &resp.Error{Data: corruptedHLLError}
+		}
+	}
+
+	key := string(cmd.Args[0])
+	hll, exists, _ := getHyperLogLog(tx, key)
+	if exists {
+		hll = types.HyperLogLog(copyString(hll, 0))
+	} else {
+		hll = types.NewHyperLogLog()
+	}
+
+	// The result is dense as soon as one of the inputs is
+	if useDense {
+		if err := hll.ToDense(); err != nil {
+			return &resp.Error{Data: corruptedHLLError}
+		}
+	}
+	if err := hll.SetRegisters(registers); err != nil {
+		return &resp.Error{Data: corruptedHLLError}
+	}
+	hll.InvalidateCache()
+	tx.Set(key, []byte(hll))
+	h.notifyKeyspaceEvent(config.NotifyString, "pfadd", key, tx.DB())
+	return &resp.SimpleString{Data: "OK"}
+}
+
+// Handler for PFDEBUG command
+// PFDEBUG GETREG|DECODE|ENCODING|TODENSE key
+func (h *Handler) handlePFDebug(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if len(cmd.Args) != 2 {
+		return wrongArgsError(cmd)
+	}
+	subcommand := strings.ToUpper(string(cmd.Args[0]))
+	key := string(cmd.Args[1])
+
+	hll, exists, errReply := getHyperLogLog(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if !exists {
+		return &resp.Error{Data: "ERR The specified key does not exist"}
+	}
+
+	switch subcommand {
+	case "GETREG":
+		// Like Redis, reading the registers converts to the dense encoding
+		if hll.IsSparse() {
+			hll = types.HyperLogLog(copyString(hll, 0))
+			if err := hll.ToDense(); err != nil {
+				return &resp.Error{Data: corruptedHLLError}
+			}
+			tx.Set(key, []byte(hll))
+		}
+		registers, err := hll.Registers()
+		if err != nil {
+			return &resp.Error{Data: corruptedHLLError}
+		}
+		array := &resp.Array{Data: make([]resp.RESPData, len(registers))}
+		for i, value := range registers {
+			array.Data[i] = &resp.Integer{Data: int64(value)}
+		}
+		return array
+
+	case "DECODE":
+		if !hll.IsSparse() {
+			return &resp.Error{Data: "ERR HLL encoding is not sparse"}
+		}
+		return &resp.BulkString{Data: []byte(hll.DecodeSparse())}
+
+	case "ENCODING":
+		if hll.IsSparse() {
+			return &resp.SimpleString{Data: "sparse"}
+		}
+		return &resp.SimpleString{Data: "dense"}
+
+	case "TODENSE":
+		if !hll.IsSparse() {
+			return &resp.Integer{Data: 0}
+		}
+		hll = types.HyperLogLog(copyString(hll, 0))
+		if err := hll.ToDense(); err != nil {
+			return &resp.Error{Data: corruptedHLLError}
+		}
+		tx.Set(key, []byte(hll))
+		return &resp.Integer{Data: 1}
+
+	default:
+		return &resp.Error{Data: fmt.Sprintf("ERR Unknown PFDEBUG subcommand '%s'", cmd.Args[0])}
+	}
+}
+
+// Handler for PFSELFTEST command
+func (h *Handler) handlePFSelfTest(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if err := types.HyperLogLogSelfTest(); err != nil {
+		return &resp.Error{Data: "TESTFAILED " + err.Error()}
+	}
+	return &resp.SimpleString{Data: "OK"}
+}
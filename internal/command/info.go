@@ -0,0 +1,32 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// Handler for INFO command
+func (h *Handler) handleInfo(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	sections := map[string]bool{}
+	for _, arg := range cmd.Args {
+		sections[strings.ToLower(string(arg))] = true
+	}
+	all := len(sections) == 0 || sections["all"] || sections["default"] || sections["everything"]
+
+	var info strings.Builder
+	if all || sections["clients"] {
+		info.WriteString("# Clients\r\n")
+		fmt.Fprintf(&info, "connected_clients:%d\r\n", h.clientCount())
+		fmt.Fprintf(&info, "blocked_clients:%d\r\n", h.blocked.count())
+	}
+	if all || sections["memory"] {
+		info.WriteString("# Memory\r\n")
+		fmt.Fprintf(&info, "lazyfree_pending_objects:%d\r\n", h.lazyfreePending.Load())
+		fmt.Fprintf(&info, "lazyfreed_objects:%d\r\n", h.lazyfreed.Load())
+	}
+
+	return &resp.BulkString{Data: []byte(info.String())}
+}
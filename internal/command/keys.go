@@ -0,0 +1,394 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+	"github.com/mmnalaka/medis/internal/types"
+)
+
+// Values with more elements than this are freed in the background by UNLINK
+const lazyfreeThreshold = 64
+
+const (
+	noSuchKeyError     = "ERR no such key"
+	dbOutOfRangeError  = "ERR DB index is out of range"
+	lfuNotTrackedError = "ERR An LFU maxmemory policy is not selected, access frequency not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust."
+)
+
+// Store a new value under key, dropping the expiration time of the value it
+// replaces. Commands modifying a value in place use tx.Set, which keeps it.
+func replaceKey(tx *keyspace.Tx, key string, value any) {
+	tx.Set(key, value)
+	tx.Persist(key)
+}
+
+// Handler for TTL command
+func (h *Handler) handleTTL(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return ttlReply(tx, string(cmd.Args[0]), time.Second)
+}
+
+// Handler for PTTL command
+func (h *Handler) handlePTTL(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return ttlReply(tx, string(cmd.Args[0]), time.Millisecond)
+}
+
+// Reply with the remaining time to live of key in the given unit, -2 when
+// the key does not exist and -1 when it has no expiration time
+func ttlReply(tx *keyspace.Tx, key string, unit time.Duration) resp.RESPData {
+	if _, exists := tx.Get(key); !exists {
+		return &resp.Integer{Data: -2}
+	}
+	at, ok := tx.Expiration(key)
+	if !ok {
+		return &resp.Integer{Data: -1}
+	}
+	// From Unix milliseconds, as a time.Duration caps out near 292 years
+	ttl := max(0, at.UnixMilli()-time.Now().UnixMilli())
+	if unit == time.Second {
+		// Rounded to the closest second
+		return &resp.Integer{Data: (ttl + 500) / 1000}
+	}
+	return &resp.Integer{Data: ttl}
+}
+
+// Handler for DEL command
+func (h *Handler) handleDel(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	deleted := 0
+	for _, arg := range cmd.Args {
+		key := string(arg)
+		if tx.Delete(key) {
+			h.notifyKeyspaceEvent(config.NotifyGeneric, "del", key, tx.DB())
+			deleted++
+		}
+	}
+	return &resp.Integer{Data: int64(deleted)}
+}
+
+// Handler for UNLINK command
+func (h *Handler) handleUnlink(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	deleted := 0
+	for _, arg := range cmd.Args {
+		key := string(arg)
+		value, exists := tx.Peek(key)
+		if !exists {
+			continue
+		}
+		tx.Delete(key)
+		h.freeObjectAsync(value)
+		h.notifyKeyspaceEvent(config.NotifyGeneric, "del", key, tx.DB())
+		deleted++
+	}
+	return &resp.Integer{Data: int64(deleted)}
+}
+
+// Release a deleted value in a background goroutine when it is large enough
+// for the work to be worth it, like the Redis lazyfree thread
+func (h *Handler) freeObjectAsync(value any) {
+	if freeEffort(value) <= lazyfreeThreshold {
+		return
+	}
+	h.lazyfreePending.Add(1)
+	go func() {
+		switch v := value.(type) {
+		case *types.List:
+			v.Clear()
+		case *types.SortedSet:
+			v.Clear()
+		case *types.Stream:
+			v.Clear()
+		case *types.Set:
+			v.Clear()
+		case *types.Hash:
+			v.Clear()
+		}
+		h.lazyfreePending.Add(-1)
+		h.lazyfreed.Add(1)
+	}()
+}
+
+// Number of allocations released when freeing value
+func freeEffort(value any) int {
+	switch v := value.(type) {
+	case *types.List:
+		return v.Len()
+	case *types.SortedSet:
+		return v.Len()
+	case *types.Stream:
+		return v.Len()
+	case *types.Set:
+		return v.Len()
+	case *types.Hash:
+		return v.Len()
+	default:
+		return 1
+	}
+}
+
+// Handler for EXISTS command
+func (h *Handler) handleExists(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	// Keys given several times are counted every time
+	count := 0
+	for _, arg := range cmd.Args {
+		if _, exists := tx.Peek(string(arg)); exists {
+			count++
+		}
+	}
+	return &resp.Integer{Data: int64(count)}
+}
+
+// Handler for TOUCH command
+func (h *Handler) handleTouch(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	count := 0
+	for _, arg := range cmd.Args {
+		if _, exists := tx.Get(string(arg)); exists {
+			count++
+		}
+	}
+	return &resp.Integer{Data: int64(count)}
+}
+
+// Handler for TYPE command
+func (h *Handler) handleType(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	value, exists := tx.Peek(string(cmd.Args[0]))
+	if !exists {
+		return &resp.SimpleString{Data: "none"}
+	}
+	return &resp.SimpleString{Data: typeName(value)}
+}
+
+func typeName(value any) string {
+	switch value.(type) {
+	case []byte:
+		return "string"
+	case *types.List:
+		return "list"
+	case *types.SortedSet:
+		return "zset"
+	case *types.Stream:
+		return "stream"
+	case *types.Set:
+		return "set"
+	case *types.Hash:
+		return "hash"
+	default:
+		return "unknown"
+	}
+}
+
+// Handler for RENAME command
+func (h *Handler) handleRename(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if _, errReply := renameKey(h, c, tx, cmd, false); errReply != nil {
+		return errReply
+	}
+	return &resp.SimpleString{Data: "OK"}
+}
+
+// Handler for RENAMENX command
+func (h *Handler) handleRenameNX(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	renamed, errReply := renameKey(h, c, tx, cmd, true)
+	if errReply != nil {
+		return errReply
+	}
+	if !renamed {
+		return &resp.Integer{Data: 0}
+	}
+	return &resp.Integer{Data: 1}
+}
+
+// Move the value and expiration time of key to newkey. With nx an existing
+// newkey is left alone and nothing is renamed.
+func renameKey(h *Handler, c *Client, tx *keyspace.Tx, cmd *Command, nx bool) (bool, *resp.Error) {
+	key, newKey := string(cmd.Args[0]), string(cmd.Args[1])
+	value, exists := tx.Get(key)
+	if !exists {
+		return false, &resp.Error{Data: noSuchKeyError}
+	}
+	if key == newKey {
+		return !nx, nil
+	}
+	if _, exists := tx.Peek(newKey); exists && nx {
+		return false, nil
+	}
+
+	at, hasExpiration := tx.Expiration(key)
+	tx.Delete(key)
+	replaceKey(tx, newKey, value)
+	if hasExpiration {
+		tx.SetExpiration(newKey, at)
+	}
+	h.notifyKeyspaceEvent(config.NotifyGeneric, "rename_from", key, tx.DB())
+	h.notifyKeyspaceEvent(config.NotifyGeneric, "rename_to", newKey, tx.DB())
+	h.signalKeyAsReady(c, newKey)
+	return true, nil
+}
+
+// Handler for COPY command
+func (h *Handler) handleCopy(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	source, destination := string(cmd.Args[0]), string(cmd.Args[1])
+	db, replace := tx.DB(), false
+	for i := 2; i < len(cmd.Args); i++ {
+		switch strings.ToUpper(string(cmd.Args[i])) {
+		case "REPLACE":
+			replace = true
+		case "DB":
+			if i+1 >= len(cmd.Args) {
+				return &resp.Error{Data: syntaxError}
+			}
+			i++
+			n, errReply := parseInt(cmd.Args[i])
+			if errReply != nil {
+				return errReply
+			}
+			if n < 0 || n >= int64(h.store.Databases()) {
+				return &resp.Error{Data: dbOutOfRangeError}
+			}
+			db = int(n)
+		default:
+			return &resp.Error{Data: syntaxError}
+		}
+	}
+	if source == destination && db == tx.DB() {
+		return &resp.Error{Data: "ERR source and destination objects are the same"}
+	}
+
+	value, exists := tx.Get(source)
+	if !exists {
+		return &resp.Integer{Data: 0}
+	}
+	at, hasExpiration := tx.Expiration(source)
+
+	// The shard of destination is locked in every database
+	srcDB := tx.DB()
+	tx.Select(db)
+	defer tx.Select(srcDB)
+	if _, exists := tx.Peek(destination); exists && !replace {
+		return &resp.Integer{Data: 0}
+	}
+	replaceKey(tx, destination, cloneValue(value))
+	if hasExpiration {
+		tx.SetExpiration(destination, at)
+	}
+	h.notifyKeyspaceEvent(config.NotifyGeneric, "copy_to", destination, db)
+	h.signalKeyAsReadyIn(c, db, destination)
+	return &resp.Integer{Data: 1}
+}
+
+// Copy a value so that modifying one leaves the other alone. Strings are
+// never modified in place and can be shared.
+func cloneValue(value any) any {
+	switch v := value.(type) {
+	case *types.List:
+		return v.Clone()
+	case *types.SortedSet:
+		return v.Clone()
+	case *types.Stream:
+		return v.Clone()
+	case *types.Set:
+		return v.Clone()
+	case *types.Hash:
+		return v.Clone()
+	default:
+		return value
+	}
+}
+
+// Handler for SELECT command
+func (h *Handler) handleSelect(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	n, err := strconv.Atoi(string(cmd.Args[0]))
+	if err != nil {
+		return &resp.Error{Data: notIntegerError}
+	}
+	if n < 0 || n >= h.store.Databases() {
+		return &resp.Error{Data: dbOutOfRangeError}
+	}
+	c.db = n
+	return &resp.SimpleString{Data: "OK"}
+}
+
+var objectHelp = []string{
+	"OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"ENCODING <key>",
+	"    Return the kind of internal representation used in order to store the value",
+	"    associated with a <key>.",
+	"FREQ <key>",
+	"    Return the access frequency index of the <key>. The returned integer is",
+	"    proportional to the logarithm of the recent access frequency of the key.",
+	"IDLETIME <key>",
+	"    Return the idle time of the <key>, that is the approximated number of",
+	"    seconds elapsed since the last access to the key.",
+	"REFCOUNT <key>",
+	"    Return the number of references of the value associated with the specified",
+	"    <key>.",
+	"HELP",
+	"    Print this help.",
+}
+
+// Handler for OBJECT command. Inspecting a key does not count as accessing
+// it, so its idle time is left alone.
+func (h *Handler) handleObject(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	subcommand := strings.ToUpper(string(cmd.Args[0]))
+	if subcommand == "HELP" && len(cmd.Args) == 1 {
+		return helpReply(objectHelp)
+	}
+
+	switch subcommand {
+	case "ENCODING", "REFCOUNT", "IDLETIME", "FREQ":
+	default:
+		return &resp.Error{Data: fmt.Sprintf("ERR unknown subcommand '%s'. Try OBJECT HELP.", cmd.Args[0])}
+	}
+	if len(cmd.Args) != 2 {
+		return &resp.Error{Data: fmt.Sprintf("ERR wrong number of arguments for 'object|%s' command", strings.ToLower(subcommand))}
+	}
+
+	key := string(cmd.Args[1])
+	value, exists := tx.Peek(key)
+	if !exists {
+		return &resp.BulkString{Data: nil}
+	}
+	switch subcommand {
+	case "ENCODING":
+		return &resp.BulkString{Data: []byte(objectEncoding(value))}
+	case "REFCOUNT":
+		// Values are never shared between keys
+		return &resp.Integer{Data: 1}
+	case "IDLETIME":
+		idle, _ := tx.IdleTime(key)
+		return &resp.Integer{Data: int64(idle / time.Second)}
+	default:
+		return &resp.Error{Data: lfuNotTrackedError}
+	}
+}
+
+// Name of the Redis encoding closest to the representation of value
+func objectEncoding(value any) string {
+	switch v := value.(type) {
+	case []byte:
+		// Redis stores strings that are integers as such, and embeds the
+		// short ones in their object header
+		if len(v) <= 20 {
+			if _, err := parseInt(v); err == nil {
+				return "int"
+			}
+		}
+		if len(v) <= 44 {
+			return "embstr"
+		}
+		return "raw"
+	case *types.List:
+		return "quicklist"
+	case *types.SortedSet:
+		return "skiplist"
+	case *types.Stream:
+		return "stream"
+	case *types.Set, *types.Hash:
+		return "hashtable"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,415 @@
+package command
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+const (
+	// Samples kept per event, like Redis
+	latencySamples = 160
+	// Width and height of LATENCY GRAPH
+	latencyGraphColumns = 80
+	latencyGraphRows    = 4
+)
+
+// Latency events
+const (
+	latencyCommand     = "command"      // Commands that are not fast
+	latencyFastCommand = "fast-command" // Commands flagged fast
+	latencyExpireCycle = "expire-cycle" // Active expiration of keys
+)
+
+type latencySample struct {
+	time    int64 // Unix time in seconds, zero for an unused slot
+	latency int64 // Milliseconds
+}
+
+// latencyEvent is the history of an event, one sample per second at most
+type latencyEvent struct {
+	samples [latencySamples]latencySample
+	next    int   // Slot of the next sample, the oldest once every slot is used
+	max     int64 // Highest latency ever sampled
+}
+
+// Samples in chronological order
+func (e *latencyEvent) history() []latencySample {
+	var history []latencySample
+	for i := range e.samples {
+		sample := e.samples[(e.next+i)%latencySamples]
+		if sample.time != 0 {
+			history = append(history, sample)
+		}
+	}
+	return history
+}
+
+// latencyMonitor records the events that took at least
+// latency-monitor-threshold milliseconds
+type latencyMonitor struct {
+	mu     sync.Mutex
+	events map[string]*latencyEvent
+}
+
+func newLatencyMonitor() *latencyMonitor {
+	return &latencyMonitor{events: make(map[string]*latencyEvent)}
+}
+
+// add records a sample, keeping the highest one when the event already
+// has a sample for the current second
+func (m *latencyMonitor) add(event string, now time.Time, latency int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.events[event]
+	if e == nil {
+		e = &latencyEvent{}
+		m.events[event] = e
+	}
+	e.max = max(e.max, latency)
+
+	sec := now.Unix()
+	prev := &e.samples[(e.next+latencySamples-1)%latencySamples]
+	if prev.time == sec {
+		prev.latency = max(prev.latency, latency)
+		return
+	}
+	e.samples[e.next] = latencySample{time: sec, latency: latency}
+	e.next = (e.next + 1) % latencySamples
+}
+
+// snapshot copies the events, sorted by name
+func (m *latencyMonitor) snapshot() ([]string, []latencyEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.events))
+	for name := range m.events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	events := make([]latencyEvent, len(names))
+	for i, name := range names {
+		events[i] = *m.events[name]
+	}
+	return names, events
+}
+
+func (m *latencyMonitor) event(name string) (latencyEvent, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.events[name]
+	if !ok {
+		return latencyEvent{}, false
+	}
+	return *e, true
+}
+
+// reset forgets the given events, or every event when none is given, and
+// returns how many were forgotten
+func (m *latencyMonitor) reset(names []string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(names) == 0 {
+		count := len(m.events)
+		clear(m.events)
+		return count
+	}
+	count := 0
+	for _, name := range names {
+		if _, ok := m.events[name]; ok {
+			delete(m.events, name)
+			count++
+		}
+	}
+	return count
+}
+
+// Record event if it took at least latency-monitor-threshold milliseconds,
+// zero disabling the monitor
+func (h *Handler) sampleLatency(event string, duration time.Duration) {
+	threshold := h.latencyThreshold.Load()
+	latency := duration.Milliseconds()
+	if threshold == 0 || latency < threshold {
+		return
+	}
+	h.latency.add(event, time.Now(), latency)
+}
+
+var latencyHelp = []string{
+	"LATENCY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"DOCTOR",
+	"    Return a human readable latency analysis report.",
+	"GRAPH <event>",
+	"    Return an ASCII latency graph for the <event> class.",
+	"HISTORY <event>",
+	"    Return time-latency samples for the <event> class.",
+	"LATEST",
+	"    Return the latest latency samples for all events.",
+	"RESET [<event> ...]",
+	"    Reset latency data of one or more <event> classes.",
+	"    (default: reset all data for all event classes)",
+	"HELP",
+	"    Print this help.",
+}
+
+// Handler for LATENCY command
+func (h *Handler) handleLatency(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	subcommand := strings.ToUpper(string(cmd.Args[0]))
+	args := cmd.Args[1:]
+	switch {
+	case subcommand == "LATEST" && len(args) == 0:
+		return h.handleLatencyLatest()
+	case subcommand == "HISTORY" && len(args) == 1:
+		return h.handleLatencyHistory(string(args[0]))
+	case subcommand == "RESET":
+		names := make([]string, len(args))
+		for i, arg := range args {
+			names[i] = string(arg)
+		}
+		return &resp.Integer{Data: int64(h.latency.reset(names))}
+	case subcommand == "GRAPH" && len(args) == 1:
+		return h.handleLatencyGraph(string(args[0]))
+	case subcommand == "DOCTOR" && len(args) == 0:
+		return &resp.BulkString{Data: []byte(h.latencyReport())}
+	case subcommand == "HELP" && len(args) == 0:
+		return helpReply(latencyHelp)
+	case subcommand == "LATEST" || subcommand == "HISTORY" || subcommand == "GRAPH" || subcommand == "DOCTOR" || subcommand == "HELP":
+		return &resp.Error{Data: fmt.Sprintf("ERR wrong number of arguments for 'latency|%s' command", strings.ToLower(subcommand))}
+	default:
+		return &resp.Error{Data: fmt.Sprintf("ERR unknown subcommand '%s'. Try LATENCY HELP.", cmd.Args[0])}
+	}
+}
+
+// LATENCY LATEST
+// Every event with the time and latency of its latest sample, and its
+// highest latency
+func (h *Handler) handleLatencyLatest() resp.RESPData {
+	names, events := h.latency.snapshot()
+	reply := &resp.Array{Data: make([]resp.RESPData, len(names))}
+	for i, name := range names {
+		latest := events[i].samples[(events[i].next+latencySamples-1)%latencySamples]
+		reply.Data[i] = &resp.Array{Data: []resp.RESPData{
+			&resp.BulkString{Data: []byte(name)},
+			&resp.Integer{Data: latest.time},
+			&resp.Integer{Data: latest.latency},
+			&resp.Integer{Data: events[i].max},
+		}}
+	}
+	return reply
+}
+
+// LATENCY HISTORY event
+func (h *Handler) handleLatencyHistory(name string) resp.RESPData {
+	e, _ := h.latency.event(name)
+	history := e.history()
+	reply := &resp.Array{Data: make([]resp.RESPData, len(history))}
+	for i, sample := range history {
+		reply.Data[i] = &resp.Array{Data: []resp.RESPData{
+			&resp.Integer{Data: sample.time},
+			&resp.Integer{Data: sample.latency},
+		}}
+	}
+	return reply
+}
+
+// LATENCY GRAPH event
+// example:
+//
+//	command - high 500 ms, low 101 ms (all time high 500 ms)
+//	--------------------------------------------------------------------------------
+//	   #_
+//	  _||
+//	 _|||
+//	_||||
+//
+//	5222
+//	sss
+func (h *Handler) handleLatencyGraph(name string) resp.RESPData {
+	e, ok := h.latency.event(name)
+	if !ok {
+		return &resp.Error{Data: fmt.Sprintf("ERR No samples available for event '%s'", name)}
+	}
+	history := e.history()
+
+	// Samples are labeled with how long ago they happened
+	now := time.Now().Unix()
+	labels := make([]string, len(history))
+	low, high := history[0].latency, history[0].latency
+	for i, sample := range history {
+		low, high = min(low, sample.latency), max(high, sample.latency)
+		elapsed := now - sample.time
+		switch {
+		case elapsed < 60:
+			labels[i] = fmt.Sprintf("%ds", elapsed)
+		case elapsed < 3600:
+			labels[i] = fmt.Sprintf("%dm", elapsed/60)
+		case elapsed < 24*3600:
+			labels[i] = fmt.Sprintf("%dh", elapsed/3600)
+		default:
+			labels[i] = fmt.Sprintf("%dd", elapsed/(24*3600))
+		}
+	}
+
+	var graph strings.Builder
+	fmt.Fprintf(&graph, "%s - high %d ms, low %d ms (all time high %d ms)\n", name, high, low, e.max)
+	graph.WriteString(strings.Repeat("-", latencyGraphColumns) + "\n")
+	for start := 0; start < len(history); start += latencyGraphColumns {
+		if start != 0 {
+			graph.WriteByte('\n')
+		}
+		end := min(start+latencyGraphColumns, len(history))
+		renderSparkline(&graph, history[start:end], labels[start:end], low, high)
+	}
+	return &resp.BulkString{Data: []byte(graph.String())}
+}
+
+// Draw the samples as columns filled up to their latency, relative to the
+// range of every sample, with the labels written vertically below. This is
+// the filled sparkline of Redis.
+func renderSparkline(b *strings.Builder, samples []latencySample, labels []string, low, high int64) {
+	const charset = "_o#" // Partially filled cells
+	steps := len(charset) * latencyGraphRows
+	span := float64(high - low)
+	if span == 0 {
+		span = 1
+	}
+
+	line := make([]byte, len(samples))
+	for row := 0; row < latencyGraphRows; row++ {
+		for i, sample := range samples {
+			step := int(float64(int(float64(sample.latency-low)*float64(steps))) / span)
+			step = min(max(step, 0), steps-1)
+			cell := step - (latencyGraphRows-row-1)*len(charset)
+			switch {
+			case cell < 0:
+				line[i] = ' '
+			case cell < len(charset):
+				line[i] = charset[cell]
+			default:
+				line[i] = '|'
+			}
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+
+	// A blank line, then the labels one character per row
+	b.WriteString(strings.Repeat(" ", len(samples)) + "\n")
+	for row := 0; ; row++ {
+		more := false
+		for i, label := range labels {
+			line[i] = ' '
+			if row < len(label) {
+				line[i] = label[row]
+				more = true
+			}
+		}
+		if !more {
+			return
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+}
+
+// The analysis of an event for LATENCY DOCTOR
+type latencyStats struct {
+	samples int
+	avg     int64   // Average latency
+	mad     int64   // Mean absolute deviation of the latency
+	period  float64 // Average seconds between samples
+}
+
+func analyzeLatency(history []latencySample, now int64) latencyStats {
+	stats := latencyStats{samples: len(history)}
+	var sum int64
+	oldest := now
+	for _, sample := range history {
+		sum += sample.latency
+		oldest = min(oldest, sample.time)
+	}
+	stats.avg = sum / int64(len(history))
+	var deviation int64
+	for _, sample := range history {
+		deviation += int64(math.Abs(float64(sample.latency - stats.avg)))
+	}
+	stats.mad = deviation / int64(len(history))
+	stats.period = float64(max(now-oldest, 1)) / float64(len(history))
+	return stats
+}
+
+// Build the LATENCY DOCTOR report: what was observed for every event, and
+// advice on how to lower the latency
+func (h *Handler) latencyReport() string {
+	names, events := h.latency.snapshot()
+	threshold := h.latencyThreshold.Load()
+	if len(names) == 0 {
+		if threshold == 0 {
+			return "I'm sorry, Dave, I can't do that. Latency monitoring is disabled in this instance. " +
+				"You may use \"CONFIG SET latency-monitor-threshold <milliseconds>.\" in order to enable it.\n"
+		}
+		return "Dave, no latency spike was observed during the lifetime of this instance, not in the slightest bit. " +
+			"I honestly think you ought to sleep better.\n"
+	}
+
+	var report strings.Builder
+	report.WriteString("Dave, I have observed latency spikes in this instance. You don't mind talking about it, do you Dave?\n\n")
+	var slowCommands, fastCommands, expires bool
+	now := time.Now().Unix()
+	for i, name := range names {
+		stats := analyzeLatency(events[i].history(), now)
+		fmt.Fprintf(&report, "%d. %s: %d latency spikes (average %dms, mean deviation %dms, period %.2f sec). Worst all time event %dms.\n",
+			i+1, name, stats.samples, stats.avg, stats.mad, stats.period, events[i].max)
+		switch name {
+		case latencyCommand:
+			slowCommands = true
+		case latencyFastCommand:
+			fastCommands = true
+		case latencyExpireCycle:
+			expires = true
+		}
+	}
+
+	var advice []string
+	slowlogThreshold := h.slowlogThreshold.Load()
+	if slowCommands {
+		switch {
+		case slowlogThreshold < 0:
+			advice = append(advice, fmt.Sprintf("There are latency issues with potentially slow commands you are using. "+
+				"Try to enable the Slow Log using the command 'CONFIG SET slowlog-log-slower-than %d'. "+
+				"If the Slow Log is disabled, slow commands are not logged for you.", threshold*1000))
+		case slowlogThreshold > threshold*1000:
+			advice = append(advice, fmt.Sprintf("Your current Slow Log configuration only logs events that are slower than "+
+				"your configured latency monitor threshold. Please use 'CONFIG SET slowlog-log-slower-than %d'.", threshold*1000))
+		}
+		advice = append(advice, "Check your Slow Log to understand what are the commands you are running which are too slow to execute. "+
+			"Commands operating on many elements, like SORT, LRANGE, SMEMBERS or HGETALL on large keys, are the usual suspects.")
+	}
+	if fastCommands {
+		advice = append(advice, "The system is slow to execute code paths not containing system calls. "+
+			"This usually means the system does not provide the server CPU time to run for long periods. You should try to:\n"+
+			"  1) Lower the system load.\n"+
+			"  2) Use a computer / VM just for the server if you are running other software in the same system.\n"+
+			"  3) Check if you have a \"noisy neighbour\" problem.")
+	}
+	if expires {
+		advice = append(advice, "Deleting or expiring large objects is a blocking operation. "+
+			"If you have very large objects that are often deleted or expired, try to fragment those objects into multiple smaller objects.")
+	}
+
+	if len(advice) == 0 {
+		report.WriteString("\nWhile there are latency events logged, I'm not able to suggest any easy fix.\n")
+		return report.String()
+	}
+	report.WriteString("\nI have a few advices for you:\n\n")
+	for _, a := range advice {
+		report.WriteString("- " + a + "\n")
+	}
+	return report.String()
+}
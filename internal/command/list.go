@@ -0,0 +1,449 @@
+package command
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+	"github.com/mmnalaka/medis/internal/types"
+)
+
+// Look up the list stored at key. The list is nil when the key does not
+// exist, and the error reply is set when it holds another type.
+func getList(tx *keyspace.Tx, key string) (*types.List, *resp.Error) {
+	value, exists := tx.Get(key)
+	if !exists {
+		return nil, nil
+	}
+	list, ok := value.(*types.List)
+	if !ok {
+		return nil, &resp.Error{Data: wrongTypeError}
+	}
+	return list, nil
+}
+
+// Lists never exist empty, the key goes away with the last element
+func popList(tx *keyspace.Tx, key string, list *types.List, left bool) []byte {
+	var value []byte
+	if left {
+		value, _ = list.PopLeft()
+	} else {
+		value, _ = list.PopRight()
+	}
+	if list.Len() == 0 {
+		tx.Delete(key)
+	}
+	return value
+}
+
+// Publish the events of popping elements from the list stored at key, once
+// per command whatever the number of elements popped
+func (h *Handler) notifyListPop(tx *keyspace.Tx, key string, list *types.List, left bool) {
+	event := "rpop"
+	if left {
+		event = "lpop"
+	}
+	h.notifyKeyspaceEvent(config.NotifyList, event, key, tx.DB())
+	if list.Len() == 0 {
+		h.notifyKeyspaceEvent(config.NotifyGeneric, "del", key, tx.DB())
+	}
+}
+
+func (h *Handler) notifyListPush(tx *keyspace.Tx, key string, left bool) {
+	event := "rpush"
+	if left {
+		event = "lpush"
+	}
+	h.notifyKeyspaceEvent(config.NotifyList, event, key, tx.DB())
+}
+
+func pushList(tx *keyspace.Tx, key string, list *types.List, left bool, value []byte) {
+	if list == nil {
+		list = types.NewList()
+		tx.Set(key, list)
+	}
+	if left {
+		list.PushLeft(value)
+	} else {
+		list.PushRight(value)
+	}
+}
+
+// Parse LEFT or RIGHT, reporting whether it is LEFT
+func parseDirection(arg []byte) (bool, *resp.Error) {
+	switch strings.ToUpper(string(arg)) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	default:
+		return false, &resp.Error{Data: syntaxError}
+	}
+}
+
+// Handler for LPUSH command
+func (h *Handler) handleLPush(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.push(c, tx, cmd, true)
+}
+
+// Handler for RPUSH command
+func (h *Handler) handleRPush(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.push(c, tx, cmd, false)
+}
+
+func (h *Handler) push(c *Client, tx *keyspace.Tx, cmd *Command, left bool) resp.RESPData {
+	key := string(cmd.Args[0])
+	list, errReply := getList(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		list = types.NewList()
+		tx.Set(key, list)
+	}
+
+	for _, value := range cmd.Args[1:] {
+		if left {
+			list.PushLeft(value)
+		} else {
+			list.PushRight(value)
+		}
+	}
+
+	h.notifyListPush(tx, key, left)
+	h.signalKeyAsReady(c, key)
+	return &resp.Integer{Data: int64(list.Len())}
+}
+
+// Handler for LPOP command
+func (h *Handler) handleLPop(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.pop(tx, cmd, true)
+}
+
+// Handler for RPOP command
+func (h *Handler) handleRPop(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.pop(tx, cmd, false)
+}
+
+// LPOP/RPOP key [count]
+func (h *Handler) pop(tx *keyspace.Tx, cmd *Command, left bool) resp.RESPData {
+	if len(cmd.Args) > 2 {
+		return wrongArgsError(cmd)
+	}
+
+	count := -1 // No count given, reply with a single element
+	if len(cmd.Args) == 2 {
+		n, err := strconv.Atoi(string(cmd.Args[1]))
+		if err != nil || n < 0 {
+			return &resp.Error{Data: "ERR value is out of range, must be positive"}
+		}
+		count = n
+	}
+
+	key := string(cmd.Args[0])
+	list, errReply := getList(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		if count == -1 {
+			return &resp.BulkString{Data: nil}
+		}
+		return nullArray()
+	}
+
+	if count == -1 {
+		value := popList(tx, key, list, left)
+		h.notifyListPop(tx, key, list, left)
+		return &resp.BulkString{Data: value}
+	}
+
+	values := [][]byte{}
+	for i := 0; i < count && list.Len() > 0; i++ {
+		values = append(values, popList(tx, key, list, left))
+	}
+	if len(values) > 0 {
+		h.notifyListPop(tx, key, list, left)
+	}
+	return bulkStrings(values)
+}
+
+// Handler for LLEN command
+func (h *Handler) handleLLen(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	list, errReply := getList(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return &resp.Integer{Data: 0}
+	}
+	return &resp.Integer{Data: int64(list.Len())}
+}
+
+// Handler for LINDEX command
+func (h *Handler) handleLIndex(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	index, errReply := parseInt(cmd.Args[1])
+	if errReply != nil {
+		return errReply
+	}
+	list, errReply := getList(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return &resp.BulkString{Data: nil}
+	}
+
+	value, _ := list.Index(int(index))
+	return &resp.BulkString{Data: value}
+}
+
+// Handler for LRANGE command
+func (h *Handler) handleLRange(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	start, errReply := parseInt(cmd.Args[1])
+	if errReply != nil {
+		return errReply
+	}
+	stop, errReply := parseInt(cmd.Args[2])
+	if errReply != nil {
+		return errReply
+	}
+	list, errReply := getList(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return &resp.Array{Data: []resp.RESPData{}}
+	}
+	return bulkStrings(list.Range(int(start), int(stop)))
+}
+
+// Handler for LMOVE command
+func (h *Handler) handleLMove(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	fromLeft, errReply := parseDirection(cmd.Args[2])
+	if errReply != nil {
+		return errReply
+	}
+	toLeft, errReply := parseDirection(cmd.Args[3])
+	if errReply != nil {
+		return errReply
+	}
+
+	reply := h.lmove(c, tx, string(cmd.Args[0]), string(cmd.Args[1]), fromLeft, toLeft)
+	if reply == nil {
+		return &resp.BulkString{Data: nil}
+	}
+	return reply
+}
+
+// Move an element between lists, the reply is nil when the source is empty
+func (h *Handler) lmove(c *Client, tx *keyspace.Tx, src, dst string, fromLeft, toLeft bool) resp.RESPData {
+	srcList, errReply := getList(tx, src)
+	if errReply != nil {
+		return errReply
+	}
+	if srcList == nil {
+		return nil
+	}
+	dstList, errReply := getList(tx, dst)
+	if errReply != nil {
+		return errReply
+	}
+
+	value := popList(tx, src, srcList, fromLeft)
+	h.notifyListPop(tx, src, srcList, fromLeft)
+	if src == dst {
+		// Rotating a list, which may just have been deleted
+		dstList, _ = getList(tx, dst)
+	}
+	pushList(tx, dst, dstList, toLeft, value)
+	h.notifyListPush(tx, dst, toLeft)
+
+	// Serving a blocked client runs in its database, not in the one of c
+	h.signalKeyAsReadyIn(c, tx.DB(), dst)
+	return &resp.BulkString{Data: value}
+}
+
+// Handler for LMPOP command
+func (h *Handler) handleLMPop(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	keys, left, count, errReply := parseMPop(cmd.Args, 0, parseDirection)
+	if errReply != nil {
+		return errReply
+	}
+
+	reply := h.lmpop(tx, keys, left, count)
+	if reply == nil {
+		return nullArray()
+	}
+	return reply
+}
+
+// Parse "numkeys key [key ...] <where> [COUNT count]" starting at pos
+func parseMPop(args [][]byte, pos int, parseWhere func([]byte) (bool, *resp.Error)) ([]string, bool, int, *resp.Error) {
+	keys, rest, errReply := parseNumKeys(args, pos)
+	if errReply != nil {
+		return nil, false, 0, errReply
+	}
+	if len(rest) == 0 {
+		return nil, false, 0, &resp.Error{Data: syntaxError}
+	}
+	where, errReply := parseWhere(rest[0])
+	if errReply != nil {
+		return nil, false, 0, errReply
+	}
+	count, errReply := parseCount(rest[1:])
+	if errReply != nil {
+		return nil, false, 0, errReply
+	}
+	return keys, where, count, nil
+}
+
+// Pop up to count elements from the first non-empty list, the reply is nil
+// when every list is empty
+func (h *Handler) lmpop(tx *keyspace.Tx, keys []string, left bool, count int) resp.RESPData {
+	for _, key := range keys {
+		list, errReply := getList(tx, key)
+		if errReply != nil {
+			return errReply
+		}
+		if list != nil {
+			return h.lmpopFrom(tx, key, list, left, count)
+		}
+	}
+	return nil
+}
+
+func (h *Handler) lmpopFrom(tx *keyspace.Tx, key string, list *types.List, left bool, count int) resp.RESPData {
+	var values [][]byte
+	for i := 0; i < count && list.Len() > 0; i++ {
+		values = append(values, popList(tx, key, list, left))
+	}
+	h.notifyListPop(tx, key, list, left)
+	return &resp.Array{Data: []resp.RESPData{
+		&resp.BulkString{Data: []byte(key)},
+		bulkStrings(values),
+	}}
+}
+
+// A list key can serve a blocked client as soon as it exists, since empty
+// lists are deleted
+func listReady(tx *keyspace.Tx, key string) bool {
+	value, _ := tx.Get(key)
+	_, ok := value.(*types.List)
+	return ok
+}
+
+// Handler for BLPOP command
+func (h *Handler) handleBLPop(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.blockingPop(c, tx, cmd, true)
+}
+
+// Handler for BRPOP command
+func (h *Handler) handleBRPop(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.blockingPop(c, tx, cmd, false)
+}
+
+// BLPOP/BRPOP key [key ...] timeout
+func (h *Handler) blockingPop(c *Client, tx *keyspace.Tx, cmd *Command, left bool) resp.RESPData {
+	timeout, errReply := parseTimeout(cmd.Args[len(cmd.Args)-1])
+	if errReply != nil {
+		return errReply
+	}
+
+	keys := make([]string, len(cmd.Args)-1)
+	for i := range keys {
+		keys[i] = string(cmd.Args[i])
+	}
+
+	popFrom := func(tx *keyspace.Tx, key string, list *types.List) resp.RESPData {
+		value := popList(tx, key, list, left)
+		h.notifyListPop(tx, key, list, left)
+		return bulkStrings([][]byte{[]byte(key), value})
+	}
+
+	for _, key := range keys {
+		list, errReply := getList(tx, key)
+		if errReply != nil {
+			return errReply
+		}
+		if list != nil {
+			return popFrom(tx, key, list)
+		}
+	}
+
+	return h.block(c, &waiter{
+		keys:  keys,
+		ready: listReady,
+		serve: func(h *Handler, _ *Client, tx *keyspace.Tx, key string) resp.RESPData {
+			list, errReply := getList(tx, key)
+			if errReply != nil {
+				return errReply
+			}
+			return popFrom(tx, key, list)
+		},
+		timeoutReply: nullArray(),
+	}, timeout)
+}
+
+// Handler for BLMOVE command
+func (h *Handler) handleBLMove(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	fromLeft, errReply := parseDirection(cmd.Args[2])
+	if errReply != nil {
+		return errReply
+	}
+	toLeft, errReply := parseDirection(cmd.Args[3])
+	if errReply != nil {
+		return errReply
+	}
+	timeout, errReply := parseTimeout(cmd.Args[4])
+	if errReply != nil {
+		return errReply
+	}
+
+	src, dst := string(cmd.Args[0]), string(cmd.Args[1])
+	if reply := h.lmove(c, tx, src, dst, fromLeft, toLeft); reply != nil {
+		return reply
+	}
+
+	return h.block(c, &waiter{
+		keys:     []string{src},
+		lockKeys: []string{src, dst},
+		ready:    listReady,
+		serve: func(h *Handler, serving *Client, tx *keyspace.Tx, key string) resp.RESPData {
+			// The destination may have blocked clients of its own
+			return h.lmove(serving, tx, src, dst, fromLeft, toLeft)
+		},
+		timeoutReply: &resp.BulkString{Data: nil},
+	}, timeout)
+}
+
+// Handler for BLMPOP command
+func (h *Handler) handleBLMPop(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	timeout, errReply := parseTimeout(cmd.Args[0])
+	if errReply != nil {
+		return errReply
+	}
+	keys, left, count, errReply := parseMPop(cmd.Args, 1, parseDirection)
+	if errReply != nil {
+		return errReply
+	}
+
+	if reply := h.lmpop(tx, keys, left, count); reply != nil {
+		return reply
+	}
+
+	return h.block(c, &waiter{
+		keys:  keys,
+		ready: listReady,
+		serve: func(h *Handler, _ *Client, tx *keyspace.Tx, key string) resp.RESPData {
+			list, errReply := getList(tx, key)
+			if errReply != nil {
+				return errReply
+			}
+			return h.lmpopFrom(tx, key, list, left, count)
+		},
+		timeoutReply: nullArray(),
+	}, timeout)
+}
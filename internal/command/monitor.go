@@ -0,0 +1,116 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// monitorRegistry holds the clients that ran MONITOR
+type monitorRegistry struct {
+	mu      sync.RWMutex
+	clients map[int64]*Client
+	// Number of monitors, so that commands skip formatting when there is none
+	count atomic.Int64
+}
+
+func newMonitorRegistry() *monitorRegistry {
+	return &monitorRegistry{clients: make(map[int64]*Client)}
+}
+
+func (r *monitorRegistry) add(c *Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clients[c.ID] = c
+	r.count.Store(int64(len(r.clients)))
+}
+
+func (r *monitorRegistry) remove(c *Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.clients, c.ID)
+	r.count.Store(int64(len(r.clients)))
+}
+
+// IsMonitor reports whether the client ran MONITOR. Like Redis, monitors are
+// subject to the replica output buffer limits.
+func (c *Client) IsMonitor() bool {
+	return c.monitor
+}
+
+// Handler for MONITOR command
+func (h *Handler) handleMonitor(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	// Transactions expect a reply per command, not a stream
+	if c.inExec {
+		return &resp.Error{Data: "ERR MONITOR isn't allowed for DENY BLOCKING client"}
+	}
+	if !c.monitor {
+		c.monitor = true
+		h.monitors.add(c)
+	}
+	return &resp.SimpleString{Data: "OK"}
+}
+
+// Send the command c ran to every monitor, in the format of Redis
+// example: +1700000000.123456 [0 127.0.0.1:50000] "set" "k" "v"
+func (h *Handler) feedMonitors(c *Client, cmd *Command) {
+	if h.monitors.count.Load() == 0 {
+		return
+	}
+
+	now := time.Now()
+	var line strings.Builder
+	fmt.Fprintf(&line, "%d.%06d [%d %s]", now.Unix(), now.Nanosecond()/1000, c.db, c.Addr)
+	// The arguments as the client sent them, the name included
+	name := cmd.rawName
+	if name == "" {
+		name = cmd.Name
+	}
+	line.WriteByte(' ')
+	writeQuoted(&line, []byte(name))
+	for _, arg := range cmd.Args {
+		line.WriteByte(' ')
+		writeQuoted(&line, arg)
+	}
+	msg := &resp.SimpleString{Data: line.String()}
+
+	h.monitors.mu.RLock()
+	defer h.monitors.mu.RUnlock()
+	for _, monitor := range h.monitors.clients {
+		monitor.push(msg)
+	}
+}
+
+// Write s in double quotes, escaped like the sdscatrepr function of Redis
+func writeQuoted(b *strings.Builder, s []byte) {
+	b.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			if c >= ' ' && c <= '~' {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(b, `\x%02x`, c)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
@@ -0,0 +1,76 @@
+package command
+
+import (
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// A command failing to queue makes the whole transaction fail on EXEC
+func (c *Client) flagTransactionError() {
+	if c.multi {
+		c.multiError = true
+	}
+}
+
+func (c *Client) resetTransaction() {
+	c.multi = false
+	c.multiError = false
+	c.queued = nil
+}
+
+// Handler for MULTI command
+func (h *Handler) handleMulti(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if c.multi {
+		return &resp.Error{Data: "ERR MULTI calls can not be nested"}
+	}
+	c.multi = true
+	return &resp.SimpleString{Data: "OK"}
+}
+
+// Handler for DISCARD command
+func (h *Handler) handleDiscard(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if !c.multi {
+		return &resp.Error{Data: "ERR DISCARD without MULTI"}
+	}
+	c.resetTransaction()
+	return &resp.SimpleString{Data: "OK"}
+}
+
+// Handler for EXEC command. The queued commands run with the shards of all
+// their keys locked, so other clients observe the transaction as a whole.
+func (h *Handler) handleExec(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if !c.multi {
+		return &resp.Error{Data: "ERR EXEC without MULTI"}
+	}
+	queued, failed := c.queued, c.multiError
+	c.resetTransaction()
+	if failed {
+		return &resp.Error{Data: "EXECABORT Transaction discarded because of previous errors."}
+	}
+
+	var keys []string
+	lockAll := false
+	for _, queuedCmd := range queued {
+		spec := commandTable[queuedCmd.Name]
+		keys = append(keys, spec.keysOf(queuedCmd.Args)...)
+		lockAll = lockAll || spec.flags&flagLockAll != 0
+	}
+
+	replies := &resp.Array{Data: make([]resp.RESPData, len(queued))}
+	fn := func(tx *keyspace.Tx) {
+		for i, queuedCmd := range queued {
+			// SELECT may switch databases in the middle of the transaction
+			tx.Select(c.db)
+			replies.Data[i] = h.invoke(c, commandTable[queuedCmd.Name], tx, queuedCmd)
+		}
+	}
+	c.inExec = true
+	if lockAll {
+		h.store.UpdateAll(c.db, fn)
+	} else {
+		h.store.Update(c.db, keys, fn)
+	}
+	c.inExec = false
+
+	return replies
+}
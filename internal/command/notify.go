@@ -0,0 +1,40 @@
+package command
+
+import (
+	"strconv"
+
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/keyspace"
+)
+
+// notifyKeyspaceEvent publishes that event happened to key in database db,
+// if notify-keyspace-events selects its class. The keyspace channel of the
+// key receives the event name, and the keyevent channel of the event
+// receives the key name.
+// example: SET foo bar in database 0 publishes "set" to __keyspace@0__:foo
+// and "foo" to __keyevent@0__:set
+func (h *Handler) notifyKeyspaceEvent(class config.KeyspaceEvents, event, key string, db int) {
+	events := config.KeyspaceEvents(h.notifyEvents.Load())
+	if events&class == 0 {
+		return
+	}
+	if events&config.NotifyKeyspace != 0 {
+		h.pubsub.publish("__keyspace@"+strconv.Itoa(db)+"__:"+key, []byte(event))
+	}
+	if events&config.NotifyKeyevent != 0 {
+		h.pubsub.publish("__keyevent@"+strconv.Itoa(db)+"__:"+event, []byte(key))
+	}
+}
+
+// Publish a keymiss event for every key a read-only command is about to
+// look up in vain
+func (h *Handler) notifyKeyMisses(tx *keyspace.Tx, keys []string) {
+	if config.KeyspaceEvents(h.notifyEvents.Load())&config.NotifyKeyMiss == 0 {
+		return
+	}
+	for _, key := range keys {
+		if _, exists := tx.Peek(key); !exists {
+			h.notifyKeyspaceEvent(config.NotifyKeyMiss, "keymiss", key, tx.DB())
+		}
+	}
+}
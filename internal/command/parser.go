@@ -8,8 +8,12 @@ import (
 )
 
 type Command struct {
-	Name string
+	Name string // Upper cased
 	Args [][]byte
+
+	// The name as the client sent it, for MONITOR. Commands the handler
+	// makes up have none.
+	rawName string
 }
 
 // ParseCommand converts a RESP array into a Command structure
@@ -30,8 +34,9 @@ func ParseCommand(data resp.RESPData) (*Command, error) {
 	}
 
 	cmd := &Command{
-		Name: strings.ToUpper(string(cmdNameBulk.Data)), // Commands are case-insensitive
-		Args: make([][]byte, len(array.Data)-1),
+		Name:    strings.ToUpper(string(cmdNameBulk.Data)), // Commands are case-insensitive
+		Args:    make([][]byte, len(array.Data)-1),
+		rawName: string(cmdNameBulk.Data),
 	}
 
 	// Extract arguments
@@ -0,0 +1,124 @@
+package command
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// pauseState tracks CLIENT PAUSE. Paused commands wait on the connection
+// goroutine before being executed, so they never hold up the event loop.
+type pauseState struct {
+	mu       sync.Mutex
+	until    time.Time     // End of the pause, zero when not paused
+	all      bool          // Every command is paused, not only writes
+	unpaused chan struct{} // Closed when the pause ends early
+}
+
+func newPauseState() *pauseState {
+	return &pauseState{unpaused: make(chan struct{})}
+}
+
+// pause extends the current pause, keeping the most restrictive mode
+func (p *pauseState) pause(until time.Time, all bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Now().After(p.until) {
+		p.until, p.all = until, all
+		return
+	}
+	if until.After(p.until) {
+		p.until = until
+	}
+	p.all = p.all || all
+}
+
+func (p *pauseState) unpause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.until, p.all = time.Time{}, false
+	close(p.unpaused)
+	p.unpaused = make(chan struct{})
+}
+
+// active reports whether commands of the given kind are paused, with the
+// channel closed when the pause ends early and the time it ends otherwise
+func (p *pauseState) active(write bool) (bool, <-chan struct{}, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !time.Now().Before(p.until) || !(p.all || write) {
+		return false, nil, time.Time{}
+	}
+	return true, p.unpaused, p.until
+}
+
+// Writes are the commands with keys that are not read-only, which is also
+// what client side caching invalidates, and PUBLISH
+func (s *commandSpec) isWrite() bool {
+	return (s.keys != nil && s.flags&flagReadOnly == 0) || s.name == "PUBLISH"
+}
+
+// WaitUnpaused holds cmd back while CLIENT PAUSE applies to it. It must be
+// called by the connection goroutine before the command is executed.
+// Commands queued by MULTI are held back when EXEC runs them.
+func (h *Handler) WaitUnpaused(c *Client, cmd *Command) {
+	spec, ok := commandTable[cmd.Name]
+	if !ok || (c.multi && spec.flags&flagNoQueue == 0) {
+		return
+	}
+	write := spec.isWrite()
+	if cmd.Name == "EXEC" {
+		for _, queued := range c.queued {
+			write = write || commandTable[queued.Name].isWrite()
+		}
+	}
+
+	for {
+		paused, unpaused, until := h.pause.active(write)
+		if !paused {
+			return
+		}
+		timer := time.NewTimer(time.Until(until))
+		select {
+		case <-unpaused:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// Report whether writes are paused, the active expiration deletes no key
+// meanwhile
+func (h *Handler) paused() bool {
+	paused, _, _ := h.pause.active(true)
+	return paused
+}
+
+// CLIENT PAUSE timeout [WRITE|ALL]
+func (h *Handler) handleClientPause(args [][]byte) resp.RESPData {
+	if len(args) < 1 || len(args) > 2 {
+		return &resp.Error{Data: "ERR wrong number of arguments for 'client|pause' command"}
+	}
+	ms, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil {
+		return &resp.Error{Data: "ERR timeout is not an integer or out of range"}
+	}
+	if ms < 0 {
+		return &resp.Error{Data: "ERR timeout is negative"}
+	}
+	all := true
+	if len(args) == 2 {
+		switch strings.ToUpper(string(args[1])) {
+		case "WRITE":
+			all = false
+		case "ALL":
+		default:
+			return &resp.Error{Data: "ERR CLIENT PAUSE mode must be WRITE or ALL"}
+		}
+	}
+	h.pause.pause(time.Now().Add(time.Duration(ms)*time.Millisecond), all)
+	return &resp.SimpleString{Data: "OK"}
+}
@@ -0,0 +1,309 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mmnalaka/medis/internal/glob"
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// multiReply is a sequence of replies answering a single command, like the
+// confirmation SUBSCRIBE sends for every channel
+type multiReply []resp.RESPData
+
+func (m multiReply) Encode() []byte {
+	var result []byte
+	for _, reply := range m {
+		result = append(result, reply.Encode()...)
+	}
+	return result
+}
+
+func (m multiReply) Decode(data []byte) error {
+	return errors.New("a sequence of replies cannot be decoded")
+}
+
+// pubsubRegistry tracks the clients subscribed to channels and patterns
+type pubsubRegistry struct {
+	mu       sync.RWMutex
+	channels map[string]map[*Client]struct{}
+	patterns map[string]map[*Client]struct{}
+}
+
+func newPubSubRegistry() *pubsubRegistry {
+	return &pubsubRegistry{
+		channels: make(map[string]map[*Client]struct{}),
+		patterns: make(map[string]map[*Client]struct{}),
+	}
+}
+
+func (r *pubsubRegistry) add(subscriptions map[string]map[*Client]struct{}, name string, c *Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clients, ok := subscriptions[name]
+	if !ok {
+		clients = make(map[*Client]struct{})
+		subscriptions[name] = clients
+	}
+	clients[c] = struct{}{}
+}
+
+func (r *pubsubRegistry) remove(subscriptions map[string]map[*Client]struct{}, name string, c *Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(subscriptions[name], c)
+	if len(subscriptions[name]) == 0 {
+		delete(subscriptions, name)
+	}
+}
+
+// publish sends message to the subscribers of channel and of the patterns
+// matching it, and returns the number of clients that received it
+func (r *pubsubRegistry) publish(channel string, message []byte) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	receivers := 0
+	if clients := r.channels[channel]; len(clients) > 0 {
+		msg := bulkStrings([][]byte{[]byte("message"), []byte(channel), message}).Data
+		for c := range clients {
+			c.push(pushReply(c, msg))
+		}
+		receivers += len(clients)
+	}
+	for pattern, clients := range r.patterns {
+		if !glob.Match(pattern, channel, false) {
+			continue
+		}
+		msg := bulkStrings([][]byte{[]byte("pmessage"), []byte(pattern), []byte(channel), message}).Data
+		for c := range clients {
+			c.push(pushReply(c, msg))
+		}
+		receivers += len(clients)
+	}
+	return receivers
+}
+
+// Names of the channels with subscribers matching pattern, in ascending order
+func (r *pubsubRegistry) activeChannels(pattern string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var names []string
+	for name := range r.channels {
+		if pattern == "" || glob.Match(pattern, name, false) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *pubsubRegistry) numSub(channel string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.channels[channel])
+}
+
+func (r *pubsubRegistry) isSubscribed(channel string, c *Client) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.channels[channel][c]
+	return ok
+}
+
+func (r *pubsubRegistry) numPat() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.patterns)
+}
+
+// Shape a message sent outside of command replies for the protocol of the
+// client, RESP2 clients get an array
+func pushReply(c *Client, items []resp.RESPData) resp.RESPData {
+	if c.resp3.Load() {
+		return &resp.Push{Data: items}
+	}
+	return &resp.Array{Data: items}
+}
+
+// Deliver a message outside of command replies
+func (c *Client) push(msg resp.RESPData) {
+	if c.conn.Push != nil {
+		c.conn.Push(msg)
+	}
+}
+
+func (c *Client) subscriptionCount() int {
+	return len(c.channels) + len(c.patterns)
+}
+
+// IsSubscribed reports whether the client is subscribed to channels or
+// patterns. RESP2 clients only receive messages while subscribed.
+func (c *Client) IsSubscribed() bool {
+	return c.subscriptionCount() > 0
+}
+
+func subscriptionReply(c *Client, kind string, name []byte, count int) resp.RESPData {
+	return pushReply(c, []resp.RESPData{
+		&resp.BulkString{Data: []byte(kind)},
+		&resp.BulkString{Data: name},
+		&resp.Integer{Data: int64(count)},
+	})
+}
+
+// The confirmations of a subscription command cannot be told apart from the
+// replies of a transaction
+func subscribeInExecError(cmd *Command) resp.RESPData {
+	return &resp.Error{Data: fmt.Sprintf("ERR %s is not allowed inside a transaction", strings.ToLower(cmd.Name))}
+}
+
+// Handler for SUBSCRIBE command
+func (h *Handler) handleSubscribe(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if c.inExec {
+		return subscribeInExecError(cmd)
+	}
+	replies := make(multiReply, 0, len(cmd.Args))
+	for _, arg := range cmd.Args {
+		channel := string(arg)
+		if _, ok := c.channels[channel]; !ok {
+			if c.channels == nil {
+				c.channels = make(map[string]struct{})
+			}
+			c.channels[channel] = struct{}{}
+			h.pubsub.add(h.pubsub.channels, channel, c)
+		}
+		replies = append(replies, subscriptionReply(c, "subscribe", arg, c.subscriptionCount()))
+	}
+	return replies
+}
+
+// Handler for UNSUBSCRIBE command, without channels it unsubscribes from all
+func (h *Handler) handleUnsubscribe(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if c.inExec {
+		return subscribeInExecError(cmd)
+	}
+	return h.unsubscribe(c, cmd.Args, false)
+}
+
+// Handler for PSUBSCRIBE command
+func (h *Handler) handlePSubscribe(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if c.inExec {
+		return subscribeInExecError(cmd)
+	}
+	replies := make(multiReply, 0, len(cmd.Args))
+	for _, arg := range cmd.Args {
+		pattern := string(arg)
+		if _, ok := c.patterns[pattern]; !ok {
+			if c.patterns == nil {
+				c.patterns = make(map[string]struct{})
+			}
+			c.patterns[pattern] = struct{}{}
+			h.pubsub.add(h.pubsub.patterns, pattern, c)
+		}
+		replies = append(replies, subscriptionReply(c, "psubscribe", arg, c.subscriptionCount()))
+	}
+	return replies
+}
+
+// Handler for PUNSUBSCRIBE command, without patterns it unsubscribes from all
+func (h *Handler) handlePUnsubscribe(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if c.inExec {
+		return subscribeInExecError(cmd)
+	}
+	return h.unsubscribe(c, cmd.Args, true)
+}
+
+func (h *Handler) unsubscribe(c *Client, args [][]byte, patterns bool) multiReply {
+	kind, subscribed, registered := "unsubscribe", c.channels, h.pubsub.channels
+	if patterns {
+		kind, subscribed, registered = "punsubscribe", c.patterns, h.pubsub.patterns
+	}
+
+	if len(args) == 0 {
+		for name := range subscribed {
+			args = append(args, []byte(name))
+		}
+		sort.Slice(args, func(i, j int) bool { return string(args[i]) < string(args[j]) })
+		if len(args) == 0 {
+			return multiReply{subscriptionReply(c, kind, nil, c.subscriptionCount())}
+		}
+	}
+
+	replies := make(multiReply, 0, len(args))
+	for _, arg := range args {
+		name := string(arg)
+		if _, ok := subscribed[name]; ok {
+			delete(subscribed, name)
+			h.pubsub.remove(registered, name, c)
+		}
+		replies = append(replies, subscriptionReply(c, kind, arg, c.subscriptionCount()))
+	}
+	return replies
+}
+
+// Drop every subscription of a closed connection
+func (h *Handler) unsubscribeAll(c *Client) {
+	for channel := range c.channels {
+		h.pubsub.remove(h.pubsub.channels, channel, c)
+	}
+	for pattern := range c.patterns {
+		h.pubsub.remove(h.pubsub.patterns, pattern, c)
+	}
+	c.channels, c.patterns = nil, nil
+}
+
+// Handler for PUBLISH command
+func (h *Handler) handlePublish(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	receivers := h.pubsub.publish(string(cmd.Args[0]), cmd.Args[1])
+	return &resp.Integer{Data: int64(receivers)}
+}
+
+var pubsubHelp = []string{
+	"PUBSUB <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"CHANNELS [<pattern>]",
+	"    Return the currently active channels matching a <pattern> (default: '*').",
+	"NUMPAT",
+	"    Return number of subscriptions to patterns.",
+	"NUMSUB [<channel> ...]",
+	"    Return the number of subscribers for the specified channels, excluding",
+	"    pattern subscriptions(default: no channels).",
+	"HELP",
+	"    Print this help.",
+}
+
+// Handler for PUBSUB command
+func (h *Handler) handlePubSub(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	subcommand := strings.ToUpper(string(cmd.Args[0]))
+	args := cmd.Args[1:]
+	switch {
+	case subcommand == "CHANNELS" && len(args) <= 1:
+		pattern := ""
+		if len(args) == 1 {
+			pattern = string(args[0])
+		}
+		var names [][]byte
+		for _, name := range h.pubsub.activeChannels(pattern) {
+			names = append(names, []byte(name))
+		}
+		return bulkStrings(names)
+	case subcommand == "NUMSUB":
+		reply := make([]resp.RESPData, 0, 2*len(args))
+		for _, channel := range args {
+			reply = append(reply,
+				&resp.BulkString{Data: channel},
+				&resp.Integer{Data: int64(h.pubsub.numSub(string(channel)))})
+		}
+		return &resp.Array{Data: reply}
+	case subcommand == "NUMPAT" && len(args) == 0:
+		return &resp.Integer{Data: int64(h.pubsub.numPat())}
+	case subcommand == "HELP" && len(args) == 0:
+		return helpReply(pubsubHelp)
+	default:
+		return &resp.Error{Data: fmt.Sprintf("ERR unknown subcommand or wrong number of arguments for '%s'. Try PUBSUB HELP.", cmd.Args[0])}
+	}
+}
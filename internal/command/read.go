@@ -2,201 +2,197 @@ package command
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"strconv"
 
 	"github.com/mmnalaka/medis/internal/resp"
 )
 
-func ReadCommand(reader *bufio.Reader) (resp.RESPData, error) {
-	// Skip any leading whitespace or newlines
+// ProtocolError is a request that does not follow the protocol. The client
+// gets the error, then is disconnected like in Redis.
+type ProtocolError struct {
+	msg string
+}
+
+func (e *ProtocolError) Error() string {
+	return "Protocol error: " + e.msg
+}
+
+// Bulk strings longer than this are read as they arrive, rather than into a
+// buffer of the length announced
+const bulkChunk = 64 * 1024
+
+// ReadCommand reads the next request. Arrays, the requests sent by clients,
+// are read as they arrive, refusing bulk strings longer than maxBulkLen
+// before anything is allocated for them. Other requests are held to the
+// same limit. Empty and null arrays are skipped, like in Redis.
+func ReadCommand(reader *bufio.Reader, maxBulkLen int64) (resp.RESPData, error) {
 	for {
-		b, err := reader.ReadByte()
+		// Skip any leading whitespace or newlines
+		for {
+			b, err := reader.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+
+			// If not whitespace, unread and break
+			if b != '\r' && b != '\n' && b != ' ' {
+				if err := reader.UnreadByte(); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+
+		// Peek the first byte to determine the type
+		prefix, err := reader.Peek(1)
 		if err != nil {
 			return nil, err
 		}
 
-		// If not whitespace, unread and break
-		if b != '\r' && b != '\n' && b != ' ' {
-			if err := reader.UnreadByte(); err != nil {
+		switch firstByte := prefix[0]; firstByte {
+		case resp.ArrayPrefix:
+			array, err := readArray(reader, maxBulkLen)
+			if err != nil {
+				return nil, err
+			}
+			if array != nil {
+				return array, nil
+			}
+		case resp.BulkStringPrefix:
+			length, err := readLength(reader, resp.BulkStringPrefix)
+			if err != nil {
+				return nil, err
+			}
+			if length == -1 {
+				return &resp.BulkString{}, nil
+			}
+			data, err := readBulk(reader, length, maxBulkLen)
+			if err != nil {
+				return nil, err
+			}
+			return &resp.BulkString{Data: data}, nil
+		case resp.SimpleStringPrefix, resp.ErrorPrefix, resp.IntegerPrefix:
+			line, err := readLine(reader, maxBulkLen)
+			if err != nil {
 				return nil, err
 			}
-			break
+			var result resp.RESPData
+			switch firstByte {
+			case resp.SimpleStringPrefix:
+				result = &resp.SimpleString{}
+			case resp.ErrorPrefix:
+				result = &resp.Error{}
+			default:
+				result = &resp.Integer{}
+			}
+			if err := result.Decode(line); err != nil {
+				return nil, err
+			}
+			return result, nil
+		default:
+			return nil, fmt.Errorf("unknown command type: %c (%d)", firstByte, firstByte)
 		}
 	}
+}
 
-	// Read the first byte to determine the type
-	firstByte, err := reader.ReadByte()
+// Read an array of bulk strings. Empty and null arrays give nil.
+func readArray(reader *bufio.Reader, maxBulkLen int64) (*resp.Array, error) {
+	count, err := readLength(reader, resp.ArrayPrefix)
 	if err != nil {
 		return nil, err
 	}
-
-	// Put back the byte for full reading
-	if err := reader.UnreadByte(); err != nil {
-		return nil, err
+	if count > math.MaxInt32 {
+		return nil, &ProtocolError{"invalid multibulk length"}
+	}
+	if count <= 0 {
+		return nil, nil
 	}
 
-	// Read and store the data
-	var data []byte
-	for {
-		b, err := reader.ReadByte()
+	// The count comes from the client, only a few elements are allocated
+	// up front
+	elements := make([]resp.RESPData, 0, min(count, 1024))
+	for range count {
+		length, err := readLength(reader, resp.BulkStringPrefix)
 		if err != nil {
 			return nil, err
 		}
-		data = append(data, b)
-		if isCompleteMessage(data) {
-			break
+		data, err := readBulk(reader, length, maxBulkLen)
+		if err != nil {
+			return nil, err
 		}
+		elements = append(elements, &resp.BulkString{Data: data})
 	}
-
-	// Based on the first byte, create the appropriate response object
-	var result resp.RESPData
-	switch firstByte {
-	case resp.SimpleStringPrefix:
-		result = &resp.SimpleString{}
-	case resp.IntegerPrefix:
-		result = &resp.Integer{}
-	case resp.ErrorPrefix:
-		result = &resp.Error{}
-	case resp.BulkStringPrefix:
-		result = &resp.BulkString{}
-	case resp.ArrayPrefix:
-		result = &resp.Array{}
-	default:
-		return nil, fmt.Errorf("unknown command type: %c (%d)", firstByte, firstByte)
-	}
-
-	// Decode the response
-	if err := result.Decode(data); err != nil {
-		return nil, err
-	}
-
-	return result, nil
-}
-
-func isCompleteMessage(data []byte) bool {
-	if len(data) < 2 {
-		return false
-	}
-
-	switch data[0] {
-	case resp.SimpleStringPrefix, resp.ErrorPrefix, resp.IntegerPrefix:
-		return data[len(data)-2] == '\r' && data[len(data)-1] == '\n'
-
-	case resp.BulkStringPrefix:
-		return isCompleteBulkString(data)
-
-	case resp.ArrayPrefix:
-		return isCompleteArray(data)
-
-	default:
-		return false
-	}
+	return &resp.Array{Data: elements}, nil
 }
 
-func isCompleteBulkString(data []byte) bool {
-	// Find the first CRLF
-	firstCRLF := findCRLF(data[1:])
-	if firstCRLF == -1 {
-		return false
+// Read the data of a bulk string and its CRLF, once its length is known
+func readBulk(reader *bufio.Reader, length, maxBulkLen int64) ([]byte, error) {
+	if length < 0 || length > maxBulkLen {
+		return nil, &ProtocolError{"invalid bulk length"}
 	}
 
-	// Parse length
-	lengthStr := string(data[1 : 1+firstCRLF])
-	length, err := strconv.Atoi(lengthStr)
-	if err != nil {
-		return false
+	var data []byte
+	if length <= bulkChunk {
+		data = make([]byte, length+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+	} else {
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, reader, length+2); err != nil {
+			return nil, err
+		}
+		data = buf.Bytes()
 	}
-
-	// Null bulk string
-	if length == -1 {
-		return len(data) >= firstCRLF+3 && // +3 for \r\n after length
-			data[len(data)-2] == '\r' && data[len(data)-1] == '\n'
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		return nil, &ProtocolError{"invalid bulk length"}
 	}
-
-	// Check if we have the complete string
-	expectedLen := 1 + firstCRLF + 2 + length + 2 // $length\r\ndata\r\n
-	return len(data) >= expectedLen
+	return data[:length], nil
 }
 
-func isCompleteArray(data []byte) bool {
-	// Find the first CRLF
-	firstCRLF := findCRLF(data[1:])
-	if firstCRLF == -1 {
-		return false
-	}
-
-	// Parse array length
-	lengthStr := string(data[1 : 1+firstCRLF])
-	length, err := strconv.Atoi(lengthStr)
-	if err != nil {
-		return false
-	}
-
-	// Null array
-	if length == -1 {
-		return len(data) >= firstCRLF+3 && // +3 for \r\n after length
-			data[len(data)-2] == '\r' && data[len(data)-1] == '\n'
-	}
-
-	// Parse each element
-	pos := 1 + firstCRLF + 2 // Skip *length\r\n
-	elementsFound := 0
-
-	for pos < len(data) {
-		if elementsFound == length {
-			return true
-		}
-
-		if pos >= len(data) {
-			return false
+// Read a line with up to maxLen bytes between its prefix and CRLF
+func readLine(reader *bufio.Reader, maxLen int64) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if int64(len(line)) > maxLen+3 {
+			return nil, &ProtocolError{"too big inline request"}
 		}
-
-		switch data[pos] {
-		case resp.BulkStringPrefix:
-			end := findBulkStringEnd(data[pos:])
-			if end == -1 {
-				return false
-			}
-			pos += end
-			elementsFound++
-		default:
-			return false // Only bulk strings expected in redis-cli commands
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
 		}
-	}
-
-	return elementsFound == length
-}
-
-func findCRLF(data []byte) int {
-	for i := 0; i < len(data)-1; i++ {
-		if data[i] == '\r' && data[i+1] == '\n' {
-			return i
+		if err != nil {
+			return nil, err
 		}
+		return line, nil
 	}
-	return -1
 }
 
-func findBulkStringEnd(data []byte) int {
-	firstCRLF := findCRLF(data[1:])
-	if firstCRLF == -1 {
-		return -1
+// Read a header line, a prefix followed by a length
+func readLength(reader *bufio.Reader, prefix byte) (int64, error) {
+	// Headers are short, a line filling the buffer is not one
+	line, err := reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return 0, &ProtocolError{"too big header"}
 	}
-
-	lengthStr := string(data[1 : 1+firstCRLF])
-	length, err := strconv.Atoi(lengthStr)
 	if err != nil {
-		return -1
+		return 0, err
 	}
-
-	if length == -1 {
-		return firstCRLF + 3 // $-1\r\n
+	if line[0] != prefix {
+		return 0, &ProtocolError{fmt.Sprintf("expected '%c', got '%c'", prefix, line[0])}
 	}
-
-	totalLen := 1 + firstCRLF + 2 + length + 2 // $length\r\ndata\r\n
-	if totalLen > len(data) {
-		return -1
+	length, err := strconv.ParseInt(string(bytes.TrimSuffix(line[1:], []byte("\r\n"))), 10, 64)
+	if err != nil || !bytes.HasSuffix(line, []byte("\r\n")) {
+		if prefix == resp.ArrayPrefix {
+			return 0, &ProtocolError{"invalid multibulk length"}
+		}
+		return 0, &ProtocolError{"invalid bulk length"}
 	}
-
-	return totalLen
+	return length, nil
 }
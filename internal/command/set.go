@@ -0,0 +1,116 @@
+package command
+
+import (
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+	"github.com/mmnalaka/medis/internal/types"
+)
+
+// Look up the set stored at key. The set is nil when the key does not
+// exist, and the error reply is set when it holds another type.
+func getSet(tx *keyspace.Tx, key string) (*types.Set, *resp.Error) {
+	value, exists := tx.Get(key)
+	if !exists {
+		return nil, nil
+	}
+	set, ok := value.(*types.Set)
+	if !ok {
+		return nil, &resp.Error{Data: wrongTypeError}
+	}
+	return set, nil
+}
+
+// Handler for SADD command
+func (h *Handler) handleSAdd(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	key := string(cmd.Args[0])
+	set, errReply := getSet(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		set = types.NewSet()
+		tx.Set(key, set)
+	}
+
+	added := 0
+	for _, member := range cmd.Args[1:] {
+		if set.Add(string(member)) {
+			added++
+		}
+	}
+	if added > 0 {
+		h.notifyKeyspaceEvent(config.NotifySet, "sadd", key, tx.DB())
+	}
+	return &resp.Integer{Data: int64(added)}
+}
+
+// Handler for SREM command
+func (h *Handler) handleSRem(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	key := string(cmd.Args[0])
+	set, errReply := getSet(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return &resp.Integer{Data: 0}
+	}
+
+	removed := 0
+	for _, member := range cmd.Args[1:] {
+		if set.Remove(string(member)) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		h.notifyKeyspaceEvent(config.NotifySet, "srem", key, tx.DB())
+	}
+	// Sets never exist empty
+	if set.Len() == 0 {
+		tx.Delete(key)
+		h.notifyKeyspaceEvent(config.NotifyGeneric, "del", key, tx.DB())
+	}
+	return &resp.Integer{Data: int64(removed)}
+}
+
+// Handler for SCARD command
+func (h *Handler) handleSCard(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	set, errReply := getSet(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return &resp.Integer{Data: 0}
+	}
+	return &resp.Integer{Data: int64(set.Len())}
+}
+
+// Handler for SISMEMBER command
+func (h *Handler) handleSIsMember(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	set, errReply := getSet(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil || !set.Contains(string(cmd.Args[1])) {
+		return &resp.Integer{Data: 0}
+	}
+	return &resp.Integer{Data: 1}
+}
+
+// Handler for SMEMBERS command
+func (h *Handler) handleSMembers(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	set, errReply := getSet(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return &resp.Array{Data: []resp.RESPData{}}
+	}
+
+	members := set.Members()
+	reply := make([]resp.RESPData, len(members))
+	for i, member := range members {
+		reply[i] = &resp.BulkString{Data: []byte(member)}
+	}
+	return &resp.Array{Data: reply}
+}
@@ -0,0 +1,62 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/logging"
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// Shutdown releases the clients waiting in blocking commands or on CLIENT
+// PAUSE, for the server to shut down
+func (h *Handler) Shutdown() {
+	h.unblockAll()
+	h.pause.unpause()
+}
+
+// SHUTDOWN [NOSAVE|SAVE] [NOW] [FORCE] [ABORT]
+// On success the connection is closed without a reply. There is neither
+// persistence nor replicas here: SAVE fails unless FORCE ignores the
+// failure, and ABORT never finds a shutdown waiting for replicas.
+func (h *Handler) handleShutdown(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	var save, noSave, now, force, abort bool
+	for _, arg := range cmd.Args {
+		switch strings.ToUpper(string(arg)) {
+		case "SAVE":
+			save = true
+		case "NOSAVE":
+			noSave = true
+		case "NOW":
+			now = true
+		case "FORCE":
+			force = true
+		case "ABORT":
+			abort = true
+		default:
+			return &resp.Error{Data: "ERR syntax error"}
+		}
+	}
+	if (abort && len(cmd.Args) > 1) || (save && noSave) {
+		return &resp.Error{Data: "ERR syntax error"}
+	}
+	if abort {
+		return &resp.Error{Data: "ERR No shutdown in progress."}
+	}
+	// Transactions expect a reply per command, they can only shut down now
+	if c.inExec && !now {
+		return &resp.Error{Data: "ERR SHUTDOWN without NOW or ABORT isn't allowed for DENY BLOCKING client"}
+	}
+
+	log := logging.For("server")
+	if save && !force {
+		log.Warn("Error trying to save before shutting down, there is no persistence")
+		return &resp.Error{Data: "ERR Errors trying to SHUTDOWN. Check logs."}
+	}
+	if h.OnShutdown == nil {
+		return &resp.Error{Data: "ERR Errors trying to SHUTDOWN. Check logs."}
+	}
+	log.Warn("User requested shutdown", "client", c.ID, "now", now)
+	h.OnShutdown(now)
+	return &resp.SimpleString{Data: "OK"}
+}
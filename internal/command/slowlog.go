@@ -0,0 +1,202 @@
+package command
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+const (
+	// Like Redis, long commands are logged with their first arguments only,
+	// and long arguments with their first bytes only
+	slowlogMaxArgs     = 32
+	slowlogMaxArgBytes = 128
+)
+
+type slowlogEntry struct {
+	id         int64
+	time       time.Time
+	duration   time.Duration
+	args       [][]byte
+	addr, name string
+}
+
+// slowLog keeps the latest commands that ran longer than
+// slowlog-log-slower-than, up to slowlog-max-len of them
+type slowLog struct {
+	mu      sync.Mutex
+	entries []slowlogEntry // Ring of entries, next is the oldest once full
+	next    int
+	nextID  int64
+	maxLen  int
+}
+
+func newSlowLog(maxLen int) *slowLog {
+	return &slowLog{maxLen: maxLen}
+}
+
+func (l *slowLog) add(entry slowlogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry.id = l.nextID
+	l.nextID++
+	if l.maxLen == 0 {
+		return
+	}
+	if len(l.entries) < l.maxLen {
+		l.entries = append(l.entries, slowlogEntry{})
+	}
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % len(l.entries)
+}
+
+// latest returns up to count entries, newest first. A negative count
+// returns them all.
+func (l *slowLog) latest(count int) []slowlogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if count < 0 || count > len(l.entries) {
+		count = len(l.entries)
+	}
+	entries := make([]slowlogEntry, 0, count)
+	for i := 1; i <= count; i++ {
+		entries = append(entries, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return entries
+}
+
+func (l *slowLog) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+func (l *slowLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries, l.next = nil, 0
+}
+
+// setMaxLen changes the capacity, keeping the newest entries that fit
+func (l *slowLog) setMaxLen(maxLen int) {
+	kept := l.latest(maxLen)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxLen = maxLen
+	l.entries = make([]slowlogEntry, 0, len(kept))
+	for i := len(kept) - 1; i >= 0; i-- {
+		l.entries = append(l.entries, kept[i])
+	}
+	l.next = 0
+	if maxLen > 0 {
+		l.next = len(kept) % maxLen
+	}
+}
+
+// Log cmd if it ran for longer than slowlog-log-slower-than
+func (h *Handler) logSlowCommand(c *Client, cmd *Command, duration time.Duration) {
+	threshold := h.slowlogThreshold.Load()
+	if threshold < 0 || duration.Microseconds() < threshold {
+		return
+	}
+
+	argc := min(1+len(cmd.Args), slowlogMaxArgs)
+	args := make([][]byte, 0, argc)
+	args = append(args, []byte(cmd.Name))
+	for i, arg := range cmd.Args {
+		if len(args) == argc-1 && i < len(cmd.Args)-1 {
+			args = append(args, []byte(fmt.Sprintf("... (%d more arguments)", len(cmd.Args)-i)))
+			break
+		}
+		if len(arg) > slowlogMaxArgBytes {
+			arg = fmt.Appendf(arg[:slowlogMaxArgBytes:slowlogMaxArgBytes], "... (%d more bytes)", len(arg)-slowlogMaxArgBytes)
+		} else {
+			arg = append([]byte(nil), arg...)
+		}
+		args = append(args, arg)
+	}
+
+	c.infoMu.Lock()
+	name := c.info.name
+	c.infoMu.Unlock()
+	h.slowlog.add(slowlogEntry{
+		time:     time.Now(),
+		duration: duration,
+		args:     args,
+		addr:     c.Addr,
+		name:     name,
+	})
+}
+
+var slowlogHelp = []string{
+	"SLOWLOG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"GET [<count>]",
+	"    Return top <count> entries from the slowlog (default: 10, -1 mean all).",
+	"    Entries are made of:",
+	"    id, timestamp, time in microseconds, arguments array, client IP and port,",
+	"    client name",
+	"LEN",
+	"    Return the length of the slowlog.",
+	"RESET",
+	"    Reset the slowlog.",
+	"HELP",
+	"    Print this help.",
+}
+
+// Handler for SLOWLOG command
+func (h *Handler) handleSlowlog(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	subcommand := strings.ToUpper(string(cmd.Args[0]))
+	args := cmd.Args[1:]
+	switch {
+	case subcommand == "GET" && len(args) <= 1:
+		return h.handleSlowlogGet(args)
+	case subcommand == "LEN" && len(args) == 0:
+		return &resp.Integer{Data: int64(h.slowlog.len())}
+	case subcommand == "RESET" && len(args) == 0:
+		h.slowlog.reset()
+		return &resp.SimpleString{Data: "OK"}
+	case subcommand == "HELP" && len(args) == 0:
+		return helpReply(slowlogHelp)
+	case subcommand == "GET" || subcommand == "LEN" || subcommand == "RESET" || subcommand == "HELP":
+		return &resp.Error{Data: fmt.Sprintf("ERR wrong number of arguments for 'slowlog|%s' command", strings.ToLower(subcommand))}
+	default:
+		return &resp.Error{Data: fmt.Sprintf("ERR unknown subcommand '%s'. Try SLOWLOG HELP.", cmd.Args[0])}
+	}
+}
+
+// SLOWLOG GET [count]
+// Each entry is its ID, Unix time, duration in microseconds, arguments,
+// client address and client name
+func (h *Handler) handleSlowlogGet(args [][]byte) resp.RESPData {
+	count := int64(10)
+	if len(args) == 1 {
+		n, err := strconv.ParseInt(string(args[0]), 10, 64)
+		if err != nil || n < -1 {
+			return &resp.Error{Data: "ERR count should be greater than or equal to -1"}
+		}
+		count = n
+	}
+	if count > math.MaxInt32 {
+		count = -1
+	}
+
+	entries := h.slowlog.latest(int(count))
+	reply := &resp.Array{Data: make([]resp.RESPData, len(entries))}
+	for i, entry := range entries {
+		reply.Data[i] = &resp.Array{Data: []resp.RESPData{
+			&resp.Integer{Data: entry.id},
+			&resp.Integer{Data: entry.time.Unix()},
+			&resp.Integer{Data: entry.duration.Microseconds()},
+			bulkStrings(entry.args),
+			&resp.BulkString{Data: []byte(entry.addr)},
+			&resp.BulkString{Data: []byte(entry.name)},
+		}}
+	}
+	return reply
+}
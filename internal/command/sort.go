@@ -0,0 +1,283 @@
+package command
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+	"github.com/mmnalaka/medis/internal/types"
+)
+
+// sortItem is an element being sorted with the weight it is compared by
+type sortItem struct {
+	value  []byte
+	score  float64 // Weight when sorting numerically
+	weight []byte  // Weight from a BY pattern when sorting alphabetically
+	found  bool    // The BY pattern referenced an existing value
+}
+
+// Selects the sorted key and the STORE destination
+func sortKeys(args [][]byte) []string {
+	keys := keyRange(0, 0, 1)(args)
+	for i := 1; i+1 < len(args); i++ {
+		if strings.EqualFold(string(args[i]), "STORE") {
+			keys = append(keys, string(args[i+1]))
+		}
+	}
+	return keys
+}
+
+// Handler for SORT command
+// SORT key [BY pattern] [LIMIT offset count] [GET pattern ...] [ASC|DESC]
+// [ALPHA] [STORE destination]
+func (h *Handler) handleSort(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.sort(c, tx, cmd, false)
+}
+
+// Handler for SORT_RO command
+func (h *Handler) handleSortRO(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.sort(c, tx, cmd, true)
+}
+
+func (h *Handler) sort(c *Client, tx *keyspace.Tx, cmd *Command, readOnly bool) resp.RESPData {
+	var (
+		desc, alpha, dontSort bool
+		sortBy                []byte
+		getPatterns           [][]byte
+		storeKey              string
+		store                 bool
+		limitStart            int64
+		limitCount            int64 = -1
+	)
+	for i := 1; i < len(cmd.Args); i++ {
+		left := len(cmd.Args) - i - 1
+		switch option := strings.ToUpper(string(cmd.Args[i])); {
+		case option == "ASC":
+			desc = false
+		case option == "DESC":
+			desc = true
+		case option == "ALPHA":
+			alpha = true
+		case option == "LIMIT" && left >= 2:
+			var errReply *resp.Error
+			if limitStart, errReply = parseInt(cmd.Args[i+1]); errReply != nil {
+				return errReply
+			}
+			if limitCount, errReply = parseInt(cmd.Args[i+2]); errReply != nil {
+				return errReply
+			}
+			i += 2
+		case option == "STORE" && left >= 1 && !readOnly:
+			storeKey, store = string(cmd.Args[i+1]), true
+			i++
+		case option == "BY" && left >= 1:
+			sortBy = cmd.Args[i+1]
+			// A pattern without * gives every element the same weight
+			dontSort = bytes.IndexByte(sortBy, '*') < 0
+			i++
+		case option == "GET" && left >= 1:
+			getPatterns = append(getPatterns, cmd.Args[i+1])
+			i++
+		default:
+			return &resp.Error{Data: syntaxError}
+		}
+	}
+
+	// Collect the elements, a missing key sorts like an empty list
+	var values [][]byte
+	if value, exists := tx.Get(string(cmd.Args[0])); exists {
+		switch v := value.(type) {
+		case *types.List:
+			values = v.Range(0, -1)
+		case *types.Set:
+			for _, member := range v.Members() {
+				values = append(values, []byte(member))
+			}
+			// Sets have no order of their own, so stored results would
+			// depend on the iteration order
+			if dontSort && store {
+				dontSort, alpha, sortBy = false, true, nil
+			}
+		case *types.SortedSet:
+			// Without sorting, members come in the order of the sorted set
+			for _, m := range v.Range(0, -1, dontSort && desc) {
+				values = append(values, []byte(m.Name))
+			}
+		default:
+			return &resp.Error{Data: wrongTypeError}
+		}
+	}
+
+	items := make([]sortItem, len(values))
+	for i, value := range values {
+		items[i].value = value
+	}
+	if !dontSort {
+		if errReply := loadSortWeights(tx, items, sortBy, alpha); errReply != nil {
+			return errReply
+		}
+		sort.SliceStable(items, func(i, j int) bool {
+			cmp := compareSortItems(&items[i], &items[j], sortBy != nil, alpha)
+			if desc {
+				cmp = -cmp
+			}
+			return cmp < 0
+		})
+	}
+
+	// Apply LIMIT the way Redis clamps it
+	n := len(items)
+	start, end := 0, n-1
+	if limitStart > 0 {
+		start = int(min(limitStart, int64(n)))
+	}
+	if limitCount >= 0 {
+		end = start + int(min(limitCount, int64(n))) - 1
+	}
+	if start >= n {
+		start, end = n-1, n-2
+	}
+	end = min(end, n-1)
+	selected := items[:0]
+	if end >= start {
+		selected = items[start : end+1]
+	}
+
+	if store {
+		list := types.NewList()
+		for _, item := range selected {
+			if len(getPatterns) == 0 {
+				list.PushRight(item.value)
+			}
+			for _, pattern := range getPatterns {
+				value, _ := lookupKeyByPattern(tx, pattern, item.value)
+				if value == nil {
+					value = []byte{}
+				}
+				list.PushRight(value)
+			}
+		}
+		if list.Len() == 0 {
+			if tx.Delete(storeKey) {
+				h.notifyKeyspaceEvent(config.NotifyGeneric, "del", storeKey, tx.DB())
+			}
+		} else {
+			replaceKey(tx, storeKey, list)
+			h.notifyKeyspaceEvent(config.NotifyList, "sortstore", storeKey, tx.DB())
+			h.signalKeyAsReady(c, storeKey)
+		}
+		return &resp.Integer{Data: int64(list.Len())}
+	}
+
+	reply := make([]resp.RESPData, 0, len(selected)*max(1, len(getPatterns)))
+	for _, item := range selected {
+		if len(getPatterns) == 0 {
+			reply = append(reply, &resp.BulkString{Data: item.value})
+		}
+		for _, pattern := range getPatterns {
+			value, _ := lookupKeyByPattern(tx, pattern, item.value)
+			reply = append(reply, &resp.BulkString{Data: value})
+		}
+	}
+	return &resp.Array{Data: reply}
+}
+
+// Compute the weight of every item, either the item itself or the value its
+// BY pattern references. Numeric weights must parse as doubles, missing
+// referenced values weigh 0.
+func loadSortWeights(tx *keyspace.Tx, items []sortItem, sortBy []byte, alpha bool) *resp.Error {
+	convError := false
+	for i := range items {
+		item := &items[i]
+		weight := item.value
+		if sortBy != nil {
+			var ok bool
+			if weight, ok = lookupKeyByPattern(tx, sortBy, item.value); !ok {
+				continue
+			}
+			item.weight, item.found = weight, true
+		}
+		if !alpha {
+			score, err := strconv.ParseFloat(string(weight), 64)
+			if err != nil || math.IsNaN(score) {
+				convError = true
+			}
+			item.score = score
+		}
+	}
+	if convError {
+		return &resp.Error{Data: "ERR One or more scores can't be converted into double"}
+	}
+	return nil
+}
+
+// Compare two items by weight. Numeric ties are broken by comparing the
+// elements, so the order does not depend on the sort algorithm.
+func compareSortItems(a, b *sortItem, byPattern, alpha bool) int {
+	switch {
+	case !alpha:
+		if a.score != b.score {
+			if a.score < b.score {
+				return -1
+			}
+			return 1
+		}
+		return bytes.Compare(a.value, b.value)
+	case byPattern:
+		// Items whose pattern references nothing come first
+		if !a.found || !b.found {
+			switch {
+			case a.found == b.found:
+				return 0
+			case !a.found:
+				return -1
+			default:
+				return 1
+			}
+		}
+		return bytes.Compare(a.weight, b.weight)
+	default:
+		return bytes.Compare(a.value, b.value)
+	}
+}
+
+// Look up the value a SORT pattern references for element. The first * of
+// the pattern is replaced by element to build a key name, and a "->field"
+// suffix reads a field of the hash stored there instead of a string. The
+// pattern "#" references the element itself.
+func lookupKeyByPattern(tx *keyspace.Tx, pattern, element []byte) ([]byte, bool) {
+	if string(pattern) == "#" {
+		return element, true
+	}
+	star := bytes.IndexByte(pattern, '*')
+	if star < 0 {
+		return nil, false
+	}
+
+	keyEnd := len(pattern)
+	var field []byte
+	if arrow := bytes.Index(pattern[star+1:], []byte("->")); arrow >= 0 && star+arrow+3 < len(pattern) {
+		keyEnd = star + 1 + arrow
+		field = pattern[keyEnd+2:]
+	}
+	key := string(pattern[:star]) + string(element) + string(pattern[star+1:keyEnd])
+
+	value, exists := tx.Get(key)
+	if !exists {
+		return nil, false
+	}
+	if field != nil {
+		hash, ok := value.(*types.Hash)
+		if !ok {
+			return nil, false
+		}
+		return hash.Get(string(field))
+	}
+	str, ok := value.([]byte)
+	return str, ok
+}
@@ -0,0 +1,142 @@
+package command
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// DurationBuckets are the upper bounds of the command duration histograms
+var DurationBuckets = [...]time.Duration{
+	10 * time.Microsecond, 25 * time.Microsecond, 50 * time.Microsecond, 100 * time.Microsecond,
+	250 * time.Microsecond, 500 * time.Microsecond, time.Millisecond, 2500 * time.Microsecond,
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond, time.Second,
+}
+
+// Like Redis, errors are counted for this many prefixes at most, so that
+// errors made of user input cannot grow the table without bounds
+const maxErrorPrefixes = 128
+
+// commandStats counts the calls of a command, updated from any goroutine
+type commandStats struct {
+	failed   atomic.Int64
+	rejected atomic.Int64
+	duration atomic.Int64 // Nanoseconds
+	// Calls by duration, the last bucket holds the calls slower than every
+	// bound
+	buckets [len(DurationBuckets) + 1]atomic.Int64
+}
+
+func newCommandStats() map[string]*commandStats {
+	stats := make(map[string]*commandStats, len(commandTable))
+	for name := range commandTable {
+		stats[name] = &commandStats{}
+	}
+	return stats
+}
+
+func (s *commandStats) record(duration time.Duration, failed bool) {
+	if failed {
+		s.failed.Add(1)
+	}
+	s.duration.Add(int64(duration))
+	i := sort.Search(len(DurationBuckets), func(i int) bool { return duration <= DurationBuckets[i] })
+	s.buckets[i].Add(1)
+}
+
+// Count an error reply by its prefix, reporting whether reply is an error
+// example: "WRONGTYPE Operation against a key..." counts as WRONGTYPE
+func (h *Handler) countError(reply resp.RESPData) bool {
+	e, ok := reply.(*resp.Error)
+	if !ok {
+		return false
+	}
+	prefix, _, _ := strings.Cut(e.Data, " ")
+
+	h.errorsMu.Lock()
+	defer h.errorsMu.Unlock()
+	if _, ok := h.errors[prefix]; ok || len(h.errors) < maxErrorPrefixes {
+		h.errors[prefix]++
+	}
+	return true
+}
+
+// Count a command refused before running, like with a wrong number of
+// arguments
+func (h *Handler) rejectCommand(cmd *Command, reply resp.RESPData) resp.RESPData {
+	if stats, ok := h.commandStats[cmd.Name]; ok {
+		stats.rejected.Add(1)
+	}
+	h.countError(reply)
+	return reply
+}
+
+// CommandStats counts the calls of a command
+type CommandStats struct {
+	Name     string
+	Calls    int64 // Calls that ran
+	Failed   int64 // Calls that ran and replied with an error
+	Rejected int64 // Calls refused before running
+	// Buckets[i] counts the calls that took at most DurationBuckets[i], the
+	// counts are cumulative
+	Buckets  []int64
+	Duration time.Duration // Time spent in every call
+}
+
+// Stats is a snapshot of the handler counters
+type Stats struct {
+	Commands         []CommandStats   // Commands called at least once, by name
+	Errors           map[string]int64 // Error replies by prefix
+	ConnectedClients int
+	BlockedClients   int
+	ExpiredKeys      int64
+	Keys             []int // Keys in every database
+}
+
+// Stats returns the current counters. It may be called from any goroutine.
+func (h *Handler) Stats() Stats {
+	stats := Stats{
+		ConnectedClients: h.clientCount(),
+		BlockedClients:   h.blocked.count(),
+		ExpiredKeys:      h.expiredKeys.Load(),
+		Keys:             make([]int, h.store.Databases()),
+	}
+	for db := range stats.Keys {
+		stats.Keys[db] = h.store.Len(db)
+	}
+
+	for name, s := range h.commandStats {
+		// The calls are the sum of the buckets, so that they match even
+		// while commands run
+		command := CommandStats{
+			Name:     name,
+			Failed:   s.failed.Load(),
+			Rejected: s.rejected.Load(),
+			Buckets:  make([]int64, len(DurationBuckets)),
+			Duration: time.Duration(s.duration.Load()),
+		}
+		for i := range s.buckets {
+			command.Calls += s.buckets[i].Load()
+			if i < len(command.Buckets) {
+				command.Buckets[i] = command.Calls
+			}
+		}
+		if command.Calls == 0 && command.Rejected == 0 {
+			continue
+		}
+		stats.Commands = append(stats.Commands, command)
+	}
+	sort.Slice(stats.Commands, func(i, j int) bool { return stats.Commands[i].Name < stats.Commands[j].Name })
+
+	h.errorsMu.Lock()
+	defer h.errorsMu.Unlock()
+	stats.Errors = make(map[string]int64, len(h.errors))
+	for prefix, count := range h.errors {
+		stats.Errors[prefix] = count
+	}
+	return stats
+}
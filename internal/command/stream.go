@@ -0,0 +1,1415 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+	"github.com/mmnalaka/medis/internal/types"
+)
+
+const invalidStreamIDError = "ERR Invalid stream ID specified as stream command argument"
+
+// Look up the stream stored at key. The stream is nil when the key does not
+// exist, and the error reply is set when it holds another type.
+func getStream(tx *keyspace.Tx, key string) (*types.Stream, *resp.Error) {
+	value, exists := tx.Get(key)
+	if !exists {
+		return nil, nil
+	}
+	stream, ok := value.(*types.Stream)
+	if !ok {
+		return nil, &resp.Error{Data: wrongTypeError}
+	}
+	return stream, nil
+}
+
+// Look up a consumer group, replying NOGROUP when the stream or the group
+// does not exist
+func getGroup(tx *keyspace.Tx, key, name string) (*types.Stream, *types.ConsumerGroup, *resp.Error) {
+	stream, errReply := getStream(tx, key)
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	if stream != nil {
+		if g, ok := stream.Groups[name]; ok {
+			return stream, g, nil
+		}
+	}
+	return nil, nil, &resp.Error{Data: fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s'", key, name)}
+}
+
+// Parse an "ms-seq" ID, or "ms" standing for "ms-missingSeq"
+func parseStreamID(arg []byte, missingSeq uint64) (types.StreamID, *resp.Error) {
+	id, err := types.ParseStreamID(string(arg), missingSeq)
+	if err != nil {
+		return id, &resp.Error{Data: invalidStreamIDError}
+	}
+	return id, nil
+}
+
+// Parse the start of an ID interval: "-", an ID, or an ID prefixed with "("
+// to exclude it
+func parseRangeStart(arg []byte) (types.StreamID, *resp.Error) {
+	if string(arg) == "-" {
+		return types.StreamID{}, nil
+	}
+	if len(arg) > 1 && arg[0] == '(' {
+		id, errReply := parseStreamID(arg[1:], 0)
+		if errReply != nil {
+			return id, errReply
+		}
+		next, ok := id.Next()
+		if !ok {
+			return id, &resp.Error{Data: "ERR invalid start ID for the interval"}
+		}
+		return next, nil
+	}
+	return parseStreamID(arg, 0)
+}
+
+// Parse the end of an ID interval: "+", an ID, or an ID prefixed with "("
+// to exclude it
+func parseRangeEnd(arg []byte) (types.StreamID, *resp.Error) {
+	if string(arg) == "+" {
+		return types.MaxStreamID, nil
+	}
+	if len(arg) > 1 && arg[0] == '(' {
+		id, errReply := parseStreamID(arg[1:], 0)
+		if errReply != nil {
+			return id, errReply
+		}
+		prev, ok := id.Prev()
+		if !ok {
+			return id, &resp.Error{Data: "ERR invalid end ID for the interval"}
+		}
+		return prev, nil
+	}
+	return parseStreamID(arg, types.MaxStreamID.Seq)
+}
+
+func streamIDReply(id types.StreamID) *resp.BulkString {
+	return &resp.BulkString{Data: []byte(id.String())}
+}
+
+func entryReply(e types.StreamEntry) *resp.Array {
+	return &resp.Array{Data: []resp.RESPData{streamIDReply(e.ID), bulkStrings(e.Fields)}}
+}
+
+func entriesReply(entries []types.StreamEntry) *resp.Array {
+	array := &resp.Array{Data: make([]resp.RESPData, len(entries))}
+	for i, e := range entries {
+		array.Data[i] = entryReply(e)
+	}
+	return array
+}
+
+// Reply of XREAD and XREADGROUP for a single stream
+func streamReadReply(key string, entries resp.RESPData) *resp.Array {
+	return &resp.Array{Data: []resp.RESPData{&resp.BulkString{Data: []byte(key)}, entries}}
+}
+
+// trimSpec is the "MAXLEN|MINID [=|~] threshold [LIMIT count]" clause of
+// XADD and XTRIM
+type trimSpec struct {
+	strategy string // MAXLEN, MINID, or empty when not trimming
+	approx   bool   // Given "~", which allows LIMIT
+	maxLen   int
+	minID    types.StreamID
+	limit    int // Maximum evictions, 0 for no limit
+}
+
+// Parse a trimming clause at args[i], returning the index following it
+func parseTrim(args [][]byte, i int, spec *trimSpec) (int, *resp.Error) {
+	option := strings.ToUpper(string(args[i]))
+	switch option {
+	case "MAXLEN", "MINID":
+		if spec.strategy != "" {
+			return 0, &resp.Error{Data: "ERR syntax error, MAXLEN and MINID options at the same time are not compatible"}
+		}
+		spec.strategy = option
+		i++
+		if i < len(args) && (string(args[i]) == "=" || string(args[i]) == "~") {
+			// Trimming is always exact, which satisfies approximate trimming too
+			spec.approx = string(args[i]) == "~"
+			i++
+		}
+		if i >= len(args) {
+			return 0, &resp.Error{Data: syntaxError}
+		}
+		if option == "MAXLEN" {
+			n, errReply := parseInt(args[i])
+			if errReply != nil {
+				return 0, errReply
+			}
+			if n < 0 {
+				return 0, &resp.Error{Data: "ERR The MAXLEN argument must be >= 0."}
+			}
+			spec.maxLen = int(n)
+		} else {
+			id, errReply := parseStreamID(args[i], 0)
+			if errReply != nil {
+				return 0, errReply
+			}
+			spec.minID = id
+		}
+	case "LIMIT":
+		if i+1 >= len(args) {
+			return 0, &resp.Error{Data: syntaxError}
+		}
+		i++
+		n, errReply := parseInt(args[i])
+		if errReply != nil {
+			return 0, errReply
+		}
+		if n < 0 {
+			return 0, &resp.Error{Data: "ERR The LIMIT argument must be >= 0."}
+		}
+		spec.limit = int(n)
+	}
+	return i + 1, nil
+}
+
+func (spec *trimSpec) validate() *resp.Error {
+	if spec.limit > 0 && !spec.approx {
+		return &resp.Error{Data: "ERR syntax error, LIMIT cannot be used without the special ~ option"}
+	}
+	return nil
+}
+
+func (spec *trimSpec) trim(stream *types.Stream) int {
+	switch spec.strategy {
+	case "MAXLEN":
+		return stream.TrimMaxLen(spec.maxLen, spec.limit)
+	case "MINID":
+		return stream.TrimMinID(spec.minID, spec.limit)
+	}
+	return 0
+}
+
+// Compute the ID of a new entry from "*", "ms-*" or an explicit ID
+func nextStreamID(stream *types.Stream, arg []byte) (types.StreamID, *resp.Error) {
+	last := stream.LastID
+	exhausted := &resp.Error{Data: "ERR The stream has exhausted the last possible ID, unable to add more items"}
+	tooSmall := &resp.Error{Data: "ERR The ID specified in XADD is equal or smaller than the target stream top item"}
+
+	if string(arg) == "*" {
+		now := uint64(time.Now().UnixMilli())
+		if now > last.Ms {
+			return types.StreamID{Ms: now}, nil
+		}
+		next, ok := last.Next()
+		if !ok {
+			return next, exhausted
+		}
+		return next, nil
+	}
+
+	if ms, ok := strings.CutSuffix(string(arg), "-*"); ok {
+		n, err := strconv.ParseUint(ms, 10, 64)
+		if err != nil {
+			return types.StreamID{}, &resp.Error{Data: invalidStreamIDError}
+		}
+		switch {
+		case n > last.Ms:
+			return types.StreamID{Ms: n}, nil
+		case n < last.Ms:
+			return types.StreamID{}, tooSmall
+		}
+		if last.Seq == types.MaxStreamID.Seq {
+			return types.StreamID{}, tooSmall
+		}
+		return types.StreamID{Ms: n, Seq: last.Seq + 1}, nil
+	}
+
+	id, errReply := parseStreamID(arg, 0)
+	if errReply != nil {
+		return id, errReply
+	}
+	if id.IsZero() {
+		return id, &resp.Error{Data: "ERR The ID specified in XADD must be greater than 0-0"}
+	}
+	if !last.Less(id) {
+		return id, tooSmall
+	}
+	return id, nil
+}
+
+// Handler for XADD command
+// XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+func (h *Handler) handleXAdd(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	var noMkStream bool
+	var spec trimSpec
+	i := 1
+options:
+	for i < len(cmd.Args) {
+		switch strings.ToUpper(string(cmd.Args[i])) {
+		case "NOMKSTREAM":
+			noMkStream = true
+			i++
+		case "MAXLEN", "MINID", "LIMIT":
+			next, errReply := parseTrim(cmd.Args, i, &spec)
+			if errReply != nil {
+				return errReply
+			}
+			i = next
+		default:
+			break options
+		}
+	}
+
+	fields := cmd.Args[min(i+1, len(cmd.Args)):]
+	if i >= len(cmd.Args) || len(fields) == 0 || len(fields)%2 != 0 {
+		return wrongArgsError(cmd)
+	}
+	if errReply := spec.validate(); errReply != nil {
+		return errReply
+	}
+
+	key := string(cmd.Args[0])
+	stream, errReply := getStream(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if stream == nil {
+		if noMkStream {
+			return &resp.BulkString{Data: nil}
+		}
+		stream = types.NewStream()
+	}
+
+	id, errReply := nextStreamID(stream, cmd.Args[i])
+	if errReply != nil {
+		return errReply
+	}
+	if _, exists := tx.Get(key); !exists {
+		tx.Set(key, stream)
+	}
+
+	values := make([][]byte, len(fields))
+	copy(values, fields)
+	stream.Append(id, values)
+	h.notifyKeyspaceEvent(config.NotifyStream, "xadd", key, tx.DB())
+	if spec.trim(stream) > 0 {
+		h.notifyKeyspaceEvent(config.NotifyStream, "xtrim", key, tx.DB())
+	}
+
+	h.signalKeyAsReady(c, key)
+	return streamIDReply(id)
+}
+
+// Handler for XLEN command
+func (h *Handler) handleXLen(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	stream, errReply := getStream(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if stream == nil {
+		return &resp.Integer{Data: 0}
+	}
+	return &resp.Integer{Data: int64(stream.Len())}
+}
+
+// Handler for XRANGE command
+func (h *Handler) handleXRange(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return xrange(tx, cmd, false)
+}
+
+// Handler for XREVRANGE command
+func (h *Handler) handleXRevRange(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return xrange(tx, cmd, true)
+}
+
+// XRANGE key start end [COUNT count], XREVRANGE takes end before start
+func xrange(tx *keyspace.Tx, cmd *Command, reverse bool) resp.RESPData {
+	startArg, endArg := cmd.Args[1], cmd.Args[2]
+	if reverse {
+		startArg, endArg = endArg, startArg
+	}
+	start, errReply := parseRangeStart(startArg)
+	if errReply != nil {
+		return errReply
+	}
+	end, errReply := parseRangeEnd(endArg)
+	if errReply != nil {
+		return errReply
+	}
+
+	count := int64(-1)
+	switch len(cmd.Args) {
+	case 3:
+	case 5:
+		if strings.ToUpper(string(cmd.Args[3])) != "COUNT" {
+			return &resp.Error{Data: syntaxError}
+		}
+		if count, errReply = parseInt(cmd.Args[4]); errReply != nil {
+			return errReply
+		}
+	default:
+		return &resp.Error{Data: syntaxError}
+	}
+
+	stream, errReply := getStream(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if stream == nil || count == 0 || end.Less(start) {
+		return &resp.Array{Data: []resp.RESPData{}}
+	}
+	return entriesReply(stream.Range(start, end, int(max(count, 0)), reverse))
+}
+
+// Handler for XDEL command
+func (h *Handler) handleXDel(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	ids := make([]types.StreamID, len(cmd.Args)-1)
+	for i, arg := range cmd.Args[1:] {
+		id, errReply := parseStreamID(arg, 0)
+		if errReply != nil {
+			return errReply
+		}
+		ids[i] = id
+	}
+
+	key := string(cmd.Args[0])
+	stream, errReply := getStream(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if stream == nil {
+		return &resp.Integer{Data: 0}
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		if stream.Delete(id) {
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		h.notifyKeyspaceEvent(config.NotifyStream, "xdel", key, tx.DB())
+	}
+	return &resp.Integer{Data: int64(deleted)}
+}
+
+// Handler for XTRIM command
+// XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func (h *Handler) handleXTrim(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	var spec trimSpec
+	for i := 1; i < len(cmd.Args); {
+		switch strings.ToUpper(string(cmd.Args[i])) {
+		case "MAXLEN", "MINID", "LIMIT":
+			next, errReply := parseTrim(cmd.Args, i, &spec)
+			if errReply != nil {
+				return errReply
+			}
+			i = next
+		default:
+			return &resp.Error{Data: syntaxError}
+		}
+	}
+	if spec.strategy == "" {
+		return &resp.Error{Data: syntaxError}
+	}
+	if errReply := spec.validate(); errReply != nil {
+		return errReply
+	}
+
+	key := string(cmd.Args[0])
+	stream, errReply := getStream(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if stream == nil {
+		return &resp.Integer{Data: 0}
+	}
+	trimmed := spec.trim(stream)
+	if trimmed > 0 {
+		h.notifyKeyspaceEvent(config.NotifyStream, "xtrim", key, tx.DB())
+	}
+	return &resp.Integer{Data: int64(trimmed)}
+}
+
+// streamKeys selects the keys of XREAD and XREADGROUP, listed after the
+// STREAMS option and followed by as many IDs. An unbalanced list selects
+// nothing and is reported by the command itself.
+func streamKeys(args [][]byte) []string {
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "GROUP":
+			i += 2
+		case "COUNT", "BLOCK":
+			i++
+		case "STREAMS":
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return nil
+			}
+			keys := make([]string, len(rest)/2)
+			for j := range keys {
+				keys[j] = string(rest[j])
+			}
+			return keys
+		}
+	}
+	return nil
+}
+
+// streamRead holds the options of XREAD and XREADGROUP
+type streamRead struct {
+	group    string
+	consumer string
+	count    int // 0 for no limit
+	block    bool
+	timeout  time.Duration
+	noAck    bool
+	keys     []string
+	ids      [][]byte
+}
+
+// Parse "[GROUP group consumer] [COUNT count] [BLOCK milliseconds] [NOACK]
+// STREAMS key [key ...] id [id ...]"
+func parseStreamRead(cmd *Command, group bool) (*streamRead, *resp.Error) {
+	r := &streamRead{}
+	name, placeholder := strings.ToLower(cmd.Name), "$"
+	if group {
+		placeholder = ">"
+	}
+	for i := 0; i < len(cmd.Args); i++ {
+		option := strings.ToUpper(string(cmd.Args[i]))
+		remaining := len(cmd.Args) - i - 1
+		switch {
+		case option == "GROUP" && group && remaining >= 2:
+			r.group, r.consumer = string(cmd.Args[i+1]), string(cmd.Args[i+2])
+			i += 2
+		case option == "COUNT" && remaining >= 1:
+			i++
+			n, errReply := parseInt(cmd.Args[i])
+			if errReply != nil {
+				return nil, errReply
+			}
+			r.count = int(max(n, 0))
+		case option == "BLOCK" && remaining >= 1:
+			i++
+			ms, errReply := parseInt(cmd.Args[i])
+			if errReply != nil {
+				return nil, &resp.Error{Data: "ERR timeout is not an integer or out of range"}
+			}
+			if ms < 0 {
+				return nil, &resp.Error{Data: "ERR timeout is negative"}
+			}
+			r.block = true
+			r.timeout = time.Duration(ms) * time.Millisecond
+		case option == "NOACK" && group:
+			r.noAck = true
+		case option == "STREAMS" && remaining >= 1:
+			rest := cmd.Args[i+1:]
+			if len(rest)%2 != 0 {
+				return nil, &resp.Error{Data: fmt.Sprintf("ERR Unbalanced '%s' list of streams: for each stream key an ID or '%s' must be specified.", name, placeholder)}
+			}
+			r.keys = make([]string, len(rest)/2)
+			for j := range r.keys {
+				r.keys[j] = string(rest[j])
+			}
+			r.ids = rest[len(rest)/2:]
+			i = len(cmd.Args)
+		default:
+			return nil, &resp.Error{Data: syntaxError}
+		}
+	}
+
+	if r.keys == nil {
+		return nil, &resp.Error{Data: syntaxError}
+	}
+	if group && r.group == "" {
+		return nil, &resp.Error{Data: "ERR Missing GROUP option for XREADGROUP"}
+	}
+	return r, nil
+}
+
+// Handler for XREAD command
+// XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func (h *Handler) handleXRead(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	r, errReply := parseStreamRead(cmd, false)
+	if errReply != nil {
+		return errReply
+	}
+
+	// Entries are read after these IDs, "$" standing for the last one
+	after := make(map[string]types.StreamID, len(r.keys))
+	streams := make([]*types.Stream, len(r.keys))
+	for i, key := range r.keys {
+		stream, errReply := getStream(tx, key)
+		if errReply != nil {
+			return errReply
+		}
+		streams[i] = stream
+		if string(r.ids[i]) == "$" {
+			if stream != nil {
+				after[key] = stream.LastID
+			}
+			continue
+		}
+		id, errReply := parseStreamID(r.ids[i], 0)
+		if errReply != nil {
+			return errReply
+		}
+		after[key] = id
+	}
+
+	readFrom := func(stream *types.Stream, key string) []types.StreamEntry {
+		start, ok := after[key].Next()
+		if stream == nil || !ok {
+			return nil
+		}
+		return stream.Range(start, types.MaxStreamID, r.count, false)
+	}
+
+	var results []resp.RESPData
+	for i, key := range r.keys {
+		if entries := readFrom(streams[i], key); len(entries) > 0 {
+			results = append(results, streamReadReply(key, entriesReply(entries)))
+		}
+	}
+	if len(results) > 0 {
+		return &resp.Array{Data: results}
+	}
+	if !r.block {
+		return nullArray()
+	}
+
+	return h.block(c, &waiter{
+		keys: r.keys,
+		ready: func(tx *keyspace.Tx, key string) bool {
+			stream, _ := getStream(tx, key)
+			return len(readFrom(stream, key)) > 0
+		},
+		serve: func(h *Handler, _ *Client, tx *keyspace.Tx, key string) resp.RESPData {
+			stream, _ := getStream(tx, key)
+			reply := streamReadReply(key, entriesReply(readFrom(stream, key)))
+			return &resp.Array{Data: []resp.RESPData{reply}}
+		},
+		timeoutReply: nullArray(),
+	}, r.timeout)
+}
+
+// Deliver up to count new entries of the group to consumer
+func readNewEntries(stream *types.Stream, g *types.ConsumerGroup, consumer *types.Consumer, count int, noAck bool) []types.StreamEntry {
+	start, ok := g.LastID.Next()
+	if !ok {
+		return nil
+	}
+	entries := stream.Range(start, types.MaxStreamID, count, false)
+	if len(entries) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for _, e := range entries {
+		g.Read(stream, e.ID)
+		if !noAck {
+			p := g.Deliver(e.ID, consumer, now)
+			p.DeliveryCount = 1
+		}
+	}
+	consumer.ActiveTime = now
+	return entries
+}
+
+// Reply with the entries pending for consumer after the given ID. Entries
+// deleted from the stream meanwhile are reported with no fields.
+func readPendingEntries(stream *types.Stream, consumer *types.Consumer, after types.StreamID, count int) *resp.Array {
+	array := &resp.Array{Data: []resp.RESPData{}}
+	for _, p := range types.SortedPending(consumer.Pending) {
+		if count > 0 && len(array.Data) == count {
+			break
+		}
+		if !after.Less(p.ID) {
+			continue
+		}
+		if e, ok := stream.Get(p.ID); ok {
+			array.Data = append(array.Data, entryReply(e))
+		} else {
+			array.Data = append(array.Data, &resp.Array{Data: []resp.RESPData{streamIDReply(p.ID), nullArray()}})
+		}
+	}
+	return array
+}
+
+// Handler for XREADGROUP command
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func (h *Handler) handleXReadGroup(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	r, errReply := parseStreamRead(cmd, true)
+	if errReply != nil {
+		return errReply
+	}
+
+	// Every stream must have the group and every ID must be valid before
+	// anything gets delivered
+	history := make([]*types.StreamID, len(r.keys)) // nil for ">"
+	for i, key := range r.keys {
+		if _, _, errReply := h.lookupReadGroup(tx, key, r.group); errReply != nil {
+			return errReply
+		}
+		if string(r.ids[i]) == ">" {
+			continue
+		}
+		id, errReply := parseStreamID(r.ids[i], 0)
+		if errReply != nil {
+			return errReply
+		}
+		history[i] = &id
+	}
+
+	var results []resp.RESPData
+	for i, key := range r.keys {
+		stream, g, _ := h.lookupReadGroup(tx, key, r.group)
+		consumer, _ := g.Consumer(r.consumer, true)
+		consumer.SeenTime = time.Now()
+
+		if history[i] != nil {
+			results = append(results, streamReadReply(key, readPendingEntries(stream, consumer, *history[i], r.count)))
+		} else if entries := readNewEntries(stream, g, consumer, r.count, r.noAck); len(entries) > 0 {
+			results = append(results, streamReadReply(key, entriesReply(entries)))
+		}
+	}
+	if len(results) > 0 {
+		return &resp.Array{Data: results}
+	}
+	if !r.block {
+		return nullArray()
+	}
+
+	return h.block(c, &waiter{
+		keys: r.keys,
+		ready: func(tx *keyspace.Tx, key string) bool {
+			stream, g, errReply := h.lookupReadGroup(tx, key, r.group)
+			if errReply != nil {
+				// Served with the error, the group is gone
+				return true
+			}
+			start, ok := g.LastID.Next()
+			return ok && len(stream.Range(start, types.MaxStreamID, 1, false)) > 0
+		},
+		serve: func(h *Handler, _ *Client, tx *keyspace.Tx, key string) resp.RESPData {
+			stream, g, errReply := h.lookupReadGroup(tx, key, r.group)
+			if errReply != nil {
+				return errReply
+			}
+			consumer, _ := g.Consumer(r.consumer, true)
+			consumer.SeenTime = time.Now()
+			entries := readNewEntries(stream, g, consumer, r.count, r.noAck)
+			return &resp.Array{Data: []resp.RESPData{streamReadReply(key, entriesReply(entries))}}
+		},
+		timeoutReply: nullArray(),
+	}, r.timeout)
+}
+
+func (h *Handler) lookupReadGroup(tx *keyspace.Tx, key, group string) (*types.Stream, *types.ConsumerGroup, *resp.Error) {
+	stream, g, errReply := getGroup(tx, key, group)
+	if errReply != nil && errReply.Data != wrongTypeError {
+		errReply = &resp.Error{Data: fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, group)}
+	}
+	return stream, g, errReply
+}
+
+var xgroupHelp = []string{
+	"XGROUP <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"CREATE <key> <groupname> <id|$> [option]",
+	"    Create a new consumer group. Options are:",
+	"    * MKSTREAM",
+	"      Create the empty stream if it does not exist.",
+	"    * ENTRIESREAD entries_read",
+	"      Set the group's entries_read counter (internal use).",
+	"CREATECONSUMER <key> <groupname> <consumer>",
+	"    Create a new consumer in the specified group.",
+	"DELCONSUMER <key> <groupname> <consumer>",
+	"    Remove the specified consumer.",
+	"DESTROY <key> <groupname>",
+	"    Remove the specified group.",
+	"SETID <key> <groupname> <id|$> [ENTRIESREAD entries_read]",
+	"    Set the current group ID and entries_read counter.",
+	"HELP",
+	"    Print this help.",
+}
+
+// Handler for XGROUP command
+func (h *Handler) handleXGroup(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	subcommand := strings.ToUpper(string(cmd.Args[0]))
+	args := cmd.Args[1:]
+	if subcommand == "HELP" && len(args) == 0 {
+		return helpReply(xgroupHelp)
+	}
+
+	var minArgs, maxArgs int
+	switch subcommand {
+	case "CREATE":
+		minArgs, maxArgs = 3, 6
+	case "SETID":
+		minArgs, maxArgs = 3, 5
+	case "DESTROY":
+		minArgs, maxArgs = 2, 2
+	case "CREATECONSUMER", "DELCONSUMER":
+		minArgs, maxArgs = 3, 3
+	default:
+		return &resp.Error{Data: fmt.Sprintf("ERR unknown subcommand '%s'. Try XGROUP HELP.", cmd.Args[0])}
+	}
+	if len(args) < minArgs || len(args) > maxArgs {
+		return &resp.Error{Data: fmt.Sprintf("ERR unknown subcommand or wrong number of arguments for '%s'. Try XGROUP HELP.", cmd.Args[0])}
+	}
+
+	key, name := string(args[0]), string(args[1])
+	var mkStream bool
+	entriesRead := int64(-2) // Not given
+	if subcommand == "CREATE" || subcommand == "SETID" {
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(string(args[i])) {
+			case "MKSTREAM":
+				if subcommand != "CREATE" {
+					return &resp.Error{Data: syntaxError}
+				}
+				mkStream = true
+			case "ENTRIESREAD":
+				if i+1 >= len(args) {
+					return &resp.Error{Data: syntaxError}
+				}
+				i++
+				n, errReply := parseInt(args[i])
+				if errReply != nil {
+					return errReply
+				}
+				if n < -1 {
+					return &resp.Error{Data: "ERR value for ENTRIESREAD must be positive or -1"}
+				}
+				entriesRead = n
+			default:
+				return &resp.Error{Data: syntaxError}
+			}
+		}
+	}
+
+	stream, errReply := getStream(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if stream == nil {
+		if !mkStream {
+			return &resp.Error{Data: "ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."}
+		}
+		stream = types.NewStream()
+	}
+
+	// Resolve the ID the group starts after
+	var lastID types.StreamID
+	if subcommand == "CREATE" || subcommand == "SETID" {
+		if string(args[2]) == "$" {
+			lastID = stream.LastID
+			if entriesRead == -2 {
+				entriesRead = stream.EntriesAdded
+			}
+		} else {
+			id, errReply := parseStreamID(args[2], 0)
+			if errReply != nil {
+				return errReply
+			}
+			lastID = id
+		}
+		if entriesRead == -2 {
+			entriesRead = -1
+			if lastID.IsZero() {
+				entriesRead = 0
+			}
+		}
+	}
+
+	if subcommand == "CREATE" {
+		if _, exists := stream.Groups[name]; exists {
+			return &resp.Error{Data: "BUSYGROUP Consumer Group name already exists"}
+		}
+		if _, exists := tx.Get(key); !exists {
+			tx.Set(key, stream)
+		}
+		stream.NewGroup(name, lastID, entriesRead)
+		h.notifyKeyspaceEvent(config.NotifyStream, "xgroup-create", key, tx.DB())
+		return &resp.SimpleString{Data: "OK"}
+	}
+
+	g, ok := stream.Groups[name]
+	if !ok {
+		if subcommand == "DESTROY" {
+			return &resp.Integer{Data: 0}
+		}
+		return &resp.Error{Data: fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", name, key)}
+	}
+
+	switch subcommand {
+	case "SETID":
+		g.LastID = lastID
+		g.EntriesRead = entriesRead
+		h.notifyKeyspaceEvent(config.NotifyStream, "xgroup-setid", key, tx.DB())
+		return &resp.SimpleString{Data: "OK"}
+	case "DESTROY":
+		delete(stream.Groups, name)
+		h.notifyKeyspaceEvent(config.NotifyStream, "xgroup-destroy", key, tx.DB())
+		// Clients blocked reading from the group get an error
+		h.signalKeyAsReady(c, key)
+		return &resp.Integer{Data: 1}
+	case "CREATECONSUMER":
+		_, created := g.Consumer(string(args[2]), true)
+		if created {
+			h.notifyKeyspaceEvent(config.NotifyStream, "xgroup-createconsumer", key, tx.DB())
+			return &resp.Integer{Data: 1}
+		}
+		return &resp.Integer{Data: 0}
+	default: // DELCONSUMER
+		pending, deleted := g.DeleteConsumer(string(args[2]))
+		if deleted {
+			h.notifyKeyspaceEvent(config.NotifyStream, "xgroup-delconsumer", key, tx.DB())
+		}
+		return &resp.Integer{Data: int64(pending)}
+	}
+}
+
+// Handler for XACK command
+func (h *Handler) handleXAck(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	ids := make([]types.StreamID, len(cmd.Args)-2)
+	for i, arg := range cmd.Args[2:] {
+		id, errReply := parseStreamID(arg, 0)
+		if errReply != nil {
+			return errReply
+		}
+		ids[i] = id
+	}
+
+	_, g, errReply := getGroup(tx, string(cmd.Args[0]), string(cmd.Args[1]))
+	if errReply != nil {
+		if errReply.Data == wrongTypeError {
+			return errReply
+		}
+		return &resp.Integer{Data: 0}
+	}
+
+	acked := 0
+	for _, id := range ids {
+		if g.Ack(id) {
+			acked++
+		}
+	}
+	return &resp.Integer{Data: int64(acked)}
+}
+
+// Handler for XPENDING command
+// XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func (h *Handler) handleXPending(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	args := cmd.Args[2:]
+	extended := len(args) > 0
+
+	var minIdle time.Duration
+	var start, end types.StreamID
+	var count int64
+	var consumerName string
+	if extended {
+		if strings.ToUpper(string(args[0])) == "IDLE" && len(args) > 1 {
+			ms, errReply := parseInt(args[1])
+			if errReply != nil {
+				return errReply
+			}
+			minIdle = time.Duration(ms) * time.Millisecond
+			args = args[2:]
+		}
+		if len(args) < 3 || len(args) > 4 {
+			return &resp.Error{Data: syntaxError}
+		}
+		var errReply *resp.Error
+		if start, errReply = parseRangeStart(args[0]); errReply != nil {
+			return errReply
+		}
+		if end, errReply = parseRangeEnd(args[1]); errReply != nil {
+			return errReply
+		}
+		if count, errReply = parseInt(args[2]); errReply != nil {
+			return errReply
+		}
+		if len(args) == 4 {
+			consumerName = string(args[3])
+		}
+	}
+
+	_, g, errReply := getGroup(tx, string(cmd.Args[0]), string(cmd.Args[1]))
+	if errReply != nil {
+		return errReply
+	}
+
+	if !extended {
+		if len(g.Pending) == 0 {
+			return &resp.Array{Data: []resp.RESPData{
+				&resp.Integer{Data: 0}, &resp.BulkString{Data: nil}, &resp.BulkString{Data: nil}, nullArray(),
+			}}
+		}
+		pending := types.SortedPending(g.Pending)
+		consumers := &resp.Array{Data: []resp.RESPData{}}
+		for _, consumer := range g.SortedConsumers() {
+			if len(consumer.Pending) > 0 {
+				consumers.Data = append(consumers.Data, bulkStrings([][]byte{
+					[]byte(consumer.Name), []byte(strconv.Itoa(len(consumer.Pending))),
+				}))
+			}
+		}
+		return &resp.Array{Data: []resp.RESPData{
+			&resp.Integer{Data: int64(len(pending))},
+			streamIDReply(pending[0].ID),
+			streamIDReply(pending[len(pending)-1].ID),
+			consumers,
+		}}
+	}
+
+	pendingSet := g.Pending
+	if consumerName != "" {
+		consumer, ok := g.Consumers[consumerName]
+		if !ok {
+			return &resp.Array{Data: []resp.RESPData{}}
+		}
+		pendingSet = consumer.Pending
+	}
+
+	now := time.Now()
+	array := &resp.Array{Data: []resp.RESPData{}}
+	for _, p := range types.SortedPending(pendingSet) {
+		if int64(len(array.Data)) >= count {
+			break
+		}
+		if p.ID.Less(start) || end.Less(p.ID) {
+			continue
+		}
+		idle := now.Sub(p.DeliveryTime)
+		if idle < minIdle {
+			continue
+		}
+		array.Data = append(array.Data, &resp.Array{Data: []resp.RESPData{
+			streamIDReply(p.ID),
+			&resp.BulkString{Data: []byte(p.Consumer.Name)},
+			&resp.Integer{Data: idle.Milliseconds()},
+			&resp.Integer{Data: p.DeliveryCount},
+		}})
+	}
+	return array
+}
+
+// Parse a minimum idle time in milliseconds, negative values meaning 0
+func parseMinIdle(arg []byte) (time.Duration, *resp.Error) {
+	ms, errReply := parseInt(arg)
+	if errReply != nil {
+		return 0, &resp.Error{Data: "ERR Invalid min-idle-time argument for XCLAIM"}
+	}
+	return time.Duration(max(ms, 0)) * time.Millisecond, nil
+}
+
+// Handler for XCLAIM command
+// XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds] [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+func (h *Handler) handleXClaim(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	minIdle, errReply := parseMinIdle(cmd.Args[3])
+	if errReply != nil {
+		return errReply
+	}
+
+	// IDs come first, the options start at the first argument that is not one
+	i := 4
+	var ids []types.StreamID
+	for ; i < len(cmd.Args); i++ {
+		id, err := types.ParseStreamID(string(cmd.Args[i]), 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return &resp.Error{Data: invalidStreamIDError}
+	}
+
+	now := time.Now()
+	deliveryTime := now
+	retryCount := int64(-1)
+	var force, justID bool
+	var lastID *types.StreamID
+	for ; i < len(cmd.Args); i++ {
+		option := strings.ToUpper(string(cmd.Args[i]))
+		hasValue := i+1 < len(cmd.Args)
+		switch {
+		case option == "FORCE":
+			force = true
+		case option == "JUSTID":
+			justID = true
+		case option == "IDLE" && hasValue:
+			i++
+			ms, errReply := parseInt(cmd.Args[i])
+			if errReply != nil {
+				return &resp.Error{Data: "ERR Invalid IDLE option argument for XCLAIM"}
+			}
+			deliveryTime = now.Add(-time.Duration(ms) * time.Millisecond)
+		case option == "TIME" && hasValue:
+			i++
+			ms, errReply := parseInt(cmd.Args[i])
+			if errReply != nil {
+				return &resp.Error{Data: "ERR Invalid TIME option argument for XCLAIM"}
+			}
+			deliveryTime = time.UnixMilli(ms)
+		case option == "RETRYCOUNT" && hasValue:
+			i++
+			n, errReply := parseInt(cmd.Args[i])
+			if errReply != nil {
+				return &resp.Error{Data: "ERR Invalid RETRYCOUNT option argument for XCLAIM"}
+			}
+			retryCount = n
+		case option == "LASTID" && hasValue:
+			i++
+			id, errReply := parseStreamID(cmd.Args[i], 0)
+			if errReply != nil {
+				return errReply
+			}
+			lastID = &id
+		default:
+			return &resp.Error{Data: fmt.Sprintf("ERR Unrecognized XCLAIM option '%s'", cmd.Args[i])}
+		}
+	}
+	if deliveryTime.After(now) {
+		deliveryTime = now
+	}
+
+	stream, g, errReply := getGroup(tx, string(cmd.Args[0]), string(cmd.Args[1]))
+	if errReply != nil {
+		return errReply
+	}
+	if lastID != nil && g.LastID.Less(*lastID) {
+		g.LastID = *lastID
+	}
+	consumer, _ := g.Consumer(string(cmd.Args[2]), true)
+	consumer.SeenTime = now
+
+	array := &resp.Array{Data: []resp.RESPData{}}
+	for _, id := range ids {
+		entry, exists := stream.Get(id)
+		p, pending := g.Pending[id]
+		switch {
+		case !exists:
+			// Entries deleted from the stream can no longer be claimed
+			if pending {
+				g.Ack(id)
+			}
+			continue
+		case !pending && !force:
+			continue
+		case pending && minIdle > 0 && now.Sub(p.DeliveryTime) < minIdle:
+			continue
+		}
+
+		p = g.Deliver(id, consumer, deliveryTime)
+		if retryCount >= 0 {
+			p.DeliveryCount = retryCount
+		} else if !justID {
+			p.DeliveryCount++
+		}
+		consumer.ActiveTime = now
+
+		if justID {
+			array.Data = append(array.Data, streamIDReply(id))
+		} else {
+			array.Data = append(array.Data, entryReply(entry))
+		}
+	}
+	return array
+}
+
+// Handler for XAUTOCLAIM command
+// XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+func (h *Handler) handleXAutoClaim(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	minIdle, errReply := parseMinIdle(cmd.Args[3])
+	if errReply != nil {
+		return errReply
+	}
+	start, errReply := parseRangeStart(cmd.Args[4])
+	if errReply != nil {
+		return errReply
+	}
+
+	count := 100
+	var justID bool
+	for i := 5; i < len(cmd.Args); i++ {
+		switch strings.ToUpper(string(cmd.Args[i])) {
+		case "JUSTID":
+			justID = true
+		case "COUNT":
+			if i+1 >= len(cmd.Args) {
+				return &resp.Error{Data: syntaxError}
+			}
+			i++
+			n, errReply := parseInt(cmd.Args[i])
+			if errReply != nil {
+				return errReply
+			}
+			if n < 1 || n > 1<<20 {
+				return &resp.Error{Data: "ERR COUNT must be > 0"}
+			}
+			count = int(n)
+		default:
+			return &resp.Error{Data: syntaxError}
+		}
+	}
+
+	stream, g, errReply := getGroup(tx, string(cmd.Args[0]), string(cmd.Args[1]))
+	if errReply != nil {
+		return errReply
+	}
+	now := time.Now()
+	consumer, _ := g.Consumer(string(cmd.Args[2]), true)
+	consumer.SeenTime = now
+
+	// Scan at most count*10 pending entries to bound the work of a call
+	attempts := count * 10
+	claimed := &resp.Array{Data: []resp.RESPData{}}
+	deleted := &resp.Array{Data: []resp.RESPData{}}
+	cursor := types.StreamID{}
+	pending := types.SortedPending(g.Pending)
+	for _, p := range pending {
+		if p.ID.Less(start) {
+			continue
+		}
+		if count == 0 || attempts == 0 {
+			cursor = p.ID
+			break
+		}
+		attempts--
+
+		entry, exists := stream.Get(p.ID)
+		if !exists {
+			g.Ack(p.ID)
+			deleted.Data = append(deleted.Data, streamIDReply(p.ID))
+			continue
+		}
+		if minIdle > 0 && now.Sub(p.DeliveryTime) < minIdle {
+			continue
+		}
+
+		g.Deliver(p.ID, consumer, now)
+		if !justID {
+			p.DeliveryCount++
+			claimed.Data = append(claimed.Data, entryReply(entry))
+		} else {
+			claimed.Data = append(claimed.Data, streamIDReply(p.ID))
+		}
+		consumer.ActiveTime = now
+		count--
+	}
+
+	return &resp.Array{Data: []resp.RESPData{streamIDReply(cursor), claimed, deleted}}
+}
+
+var xinfoHelp = []string{
+	"XINFO <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"CONSUMERS <key> <groupname>",
+	"    Show consumers of <groupname>.",
+	"GROUPS <key>",
+	"    Show the stream consumer groups.",
+	"STREAM <key> [FULL [COUNT <count>]",
+	"    Show information about the stream.",
+	"HELP",
+	"    Print this help.",
+}
+
+// Handler for XINFO command
+func (h *Handler) handleXInfo(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	subcommand := strings.ToUpper(string(cmd.Args[0]))
+	if subcommand == "HELP" && len(cmd.Args) == 1 {
+		return helpReply(xinfoHelp)
+	}
+	// STREAM takes options after its key
+	wantArgs := map[string]int{"STREAM": 1, "GROUPS": 1, "CONSUMERS": 2}
+	n, ok := wantArgs[subcommand]
+	if !ok {
+		return &resp.Error{Data: fmt.Sprintf("ERR unknown subcommand '%s'. Try XINFO HELP.", cmd.Args[0])}
+	}
+	if len(cmd.Args)-1 != n && (subcommand != "STREAM" || len(cmd.Args)-1 < n) {
+		return &resp.Error{Data: fmt.Sprintf("ERR unknown subcommand or wrong number of arguments for '%s'. Try XINFO HELP.", cmd.Args[0])}
+	}
+
+	key := string(cmd.Args[1])
+	stream, errReply := getStream(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if stream == nil {
+		return &resp.Error{Data: "ERR no such key"}
+	}
+
+	now := time.Now()
+	switch subcommand {
+	case "STREAM":
+		if len(cmd.Args) > 2 {
+			return xinfoStreamFull(stream, cmd.Args[2:])
+		}
+		firstEntry, lastEntry := resp.RESPData(&resp.BulkString{Data: nil}), resp.RESPData(&resp.BulkString{Data: nil})
+		firstID := types.StreamID{}
+		if e, ok := stream.First(); ok {
+			firstEntry, firstID = entryReply(e), e.ID
+		}
+		if e, ok := stream.Last(); ok {
+			lastEntry = entryReply(e)
+		}
+		return infoReply(
+			"length", &resp.Integer{Data: int64(stream.Len())},
+			"last-generated-id", streamIDReply(stream.LastID),
+			"max-deleted-entry-id", streamIDReply(stream.MaxDeletedID),
+			"entries-added", &resp.Integer{Data: stream.EntriesAdded},
+			"recorded-first-entry-id", streamIDReply(firstID),
+			"groups", &resp.Integer{Data: int64(len(stream.Groups))},
+			"first-entry", firstEntry,
+			"last-entry", lastEntry,
+		)
+
+	case "GROUPS":
+		array := &resp.Array{Data: []resp.RESPData{}}
+		for _, g := range stream.SortedGroups() {
+			entriesRead, lag := groupCounters(stream, g)
+			array.Data = append(array.Data, infoReply(
+				"name", &resp.BulkString{Data: []byte(g.Name)},
+				"consumers", &resp.Integer{Data: int64(len(g.Consumers))},
+				"pending", &resp.Integer{Data: int64(len(g.Pending))},
+				"last-delivered-id", streamIDReply(g.LastID),
+				"entries-read", entriesRead,
+				"lag", lag,
+			))
+		}
+		return array
+
+	default: // CONSUMERS
+		g, ok := stream.Groups[string(cmd.Args[2])]
+		if !ok {
+			return &resp.Error{Data: fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", cmd.Args[2], key)}
+		}
+		array := &resp.Array{Data: []resp.RESPData{}}
+		for _, consumer := range g.SortedConsumers() {
+			inactive := int64(-1)
+			if !consumer.ActiveTime.IsZero() {
+				inactive = now.Sub(consumer.ActiveTime).Milliseconds()
+			}
+			array.Data = append(array.Data, infoReply(
+				"name", &resp.BulkString{Data: []byte(consumer.Name)},
+				"pending", &resp.Integer{Data: int64(len(consumer.Pending))},
+				"idle", &resp.Integer{Data: now.Sub(consumer.SeenTime).Milliseconds()},
+				"inactive", &resp.Integer{Data: inactive},
+			))
+		}
+		return array
+	}
+}
+
+// The entries-read and lag of a group, null when unknown
+func groupCounters(stream *types.Stream, g *types.ConsumerGroup) (entriesRead, lag resp.RESPData) {
+	entriesRead, lag = &resp.BulkString{Data: nil}, &resp.BulkString{Data: nil}
+	if g.EntriesRead >= 0 {
+		entriesRead = &resp.Integer{Data: g.EntriesRead}
+	}
+	// Entries deleted after the last delivered one make it unknown
+	if n, ok := stream.Lag(g); ok {
+		lag = &resp.Integer{Data: n}
+	}
+	return entriesRead, lag
+}
+
+// XINFO STREAM key FULL [COUNT count]
+// The entries, and the groups with their pending entries and consumers.
+// Up to count entries are listed for each, 10 by default and all for 0.
+func xinfoStreamFull(stream *types.Stream, args [][]byte) resp.RESPData {
+	if strings.ToUpper(string(args[0])) != "FULL" {
+		return &resp.Error{Data: syntaxError}
+	}
+	count := int64(10)
+	if len(args) > 1 {
+		if len(args) != 3 || strings.ToUpper(string(args[1])) != "COUNT" {
+			return &resp.Error{Data: syntaxError}
+		}
+		var errReply *resp.Error
+		if count, errReply = parseInt(args[2]); errReply != nil {
+			return errReply
+		}
+		count = max(count, 0)
+	}
+	limit := func(pending []*types.PendingEntry) []*types.PendingEntry {
+		if count > 0 && int64(len(pending)) > count {
+			return pending[:count]
+		}
+		return pending
+	}
+
+	groups := &resp.Array{Data: []resp.RESPData{}}
+	for _, g := range stream.SortedGroups() {
+		pending := &resp.Array{Data: []resp.RESPData{}}
+		for _, p := range limit(types.SortedPending(g.Pending)) {
+			pending.Data = append(pending.Data, &resp.Array{Data: []resp.RESPData{
+				streamIDReply(p.ID),
+				&resp.BulkString{Data: []byte(p.Consumer.Name)},
+				&resp.Integer{Data: p.DeliveryTime.UnixMilli()},
+				&resp.Integer{Data: p.DeliveryCount},
+			}})
+		}
+
+		consumers := &resp.Array{Data: []resp.RESPData{}}
+		for _, consumer := range g.SortedConsumers() {
+			consumerPending := &resp.Array{Data: []resp.RESPData{}}
+			for _, p := range limit(types.SortedPending(consumer.Pending)) {
+				consumerPending.Data = append(consumerPending.Data, &resp.Array{Data: []resp.RESPData{
+					streamIDReply(p.ID),
+					&resp.Integer{Data: p.DeliveryTime.UnixMilli()},
+					&resp.Integer{Data: p.DeliveryCount},
+				}})
+			}
+			activeTime := int64(-1)
+			if !consumer.ActiveTime.IsZero() {
+				activeTime = consumer.ActiveTime.UnixMilli()
+			}
+			consumers.Data = append(consumers.Data, infoReply(
+				"name", &resp.BulkString{Data: []byte(consumer.Name)},
+				"seen-time", &resp.Integer{Data: consumer.SeenTime.UnixMilli()},
+				"active-time", &resp.Integer{Data: activeTime},
+				"pel-count", &resp.Integer{Data: int64(len(consumer.Pending))},
+				"pending", consumerPending,
+			))
+		}
+
+		entriesRead, lag := groupCounters(stream, g)
+		groups.Data = append(groups.Data, infoReply(
+			"name", &resp.BulkString{Data: []byte(g.Name)},
+			"last-delivered-id", streamIDReply(g.LastID),
+			"entries-read", entriesRead,
+			"lag", lag,
+			"pel-count", &resp.Integer{Data: int64(len(g.Pending))},
+			"pending", pending,
+			"consumers", consumers,
+		))
+	}
+
+	firstID := types.StreamID{}
+	if e, ok := stream.First(); ok {
+		firstID = e.ID
+	}
+	return infoReply(
+		"length", &resp.Integer{Data: int64(stream.Len())},
+		"last-generated-id", streamIDReply(stream.LastID),
+		"max-deleted-entry-id", streamIDReply(stream.MaxDeletedID),
+		"entries-added", &resp.Integer{Data: stream.EntriesAdded},
+		"recorded-first-entry-id", streamIDReply(firstID),
+		"entries", entriesReply(stream.Range(types.StreamID{}, types.MaxStreamID, int(count), false)),
+		"groups", groups,
+	)
+}
+
+// Build a flat field/value reply from alternating names and values
+func infoReply(pairs ...any) *resp.Array {
+	array := &resp.Array{Data: make([]resp.RESPData, 0, len(pairs))}
+	for i := 0; i < len(pairs); i += 2 {
+		array.Data = append(array.Data, &resp.BulkString{Data: []byte(pairs[i].(string))}, pairs[i+1].(resp.RESPData))
+	}
+	return array
+}
@@ -0,0 +1,609 @@
+package command
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// Strings are limited to 512MB like in Redis
+const maxStringSize = 512 * 1024 * 1024
+
+const stringTooLongError = "ERR string exceeds maximum allowed size (proto-max-bulk-len)"
+
+// Look up the string stored at key. The error reply is set when the key holds
+// another type.
+func getString(tx *keyspace.Tx, key string) ([]byte, bool, *resp.Error) {
+	value, exists := tx.Get(key)
+	if !exists {
+		return nil, false, nil
+	}
+	str, ok := value.([]byte)
+	if !ok {
+		return nil, false, &resp.Error{Data: wrongTypeError}
+	}
+	return str, true, nil
+}
+
+// Stored strings may still be referenced by replies being written once the
+// command released its locks, so they are never modified in place. Commands
+// changing a string store a modified copy, of at least size bytes.
+func copyString(str []byte, size int) []byte {
+	dup := make([]byte, max(len(str), size))
+	copy(dup, str)
+	return dup
+}
+
+// Parse the argument of an EX, PX, EXAT or PXAT option into an absolute
+// expiration time. Like Redis, the time is computed in milliseconds and
+// rejected when it does not fit.
+func parseExpireTime(cmd *Command, option string, arg []byte) (time.Time, *resp.Error) {
+	n, errReply := parseInt(arg)
+	if errReply != nil {
+		return time.Time{}, errReply
+	}
+	invalid := &resp.Error{Data: fmt.Sprintf("ERR invalid expire time in '%s' command", strings.ToLower(cmd.Name))}
+	if n <= 0 {
+		return time.Time{}, invalid
+	}
+
+	if option == "EX" || option == "EXAT" {
+		if n > math.MaxInt64/1000 {
+			return time.Time{}, invalid
+		}
+		n *= 1000
+	}
+	if option == "EX" || option == "PX" {
+		now := time.Now().UnixMilli()
+		if n > math.MaxInt64-now {
+			return time.Time{}, invalid
+		}
+		n += now
+	}
+	return time.UnixMilli(n), nil
+}
+
+func isExpireOption(option string) bool {
+	return option == "EX" || option == "PX" || option == "EXAT" || option == "PXAT"
+}
+
+// Handler for SET command
+// SET key value [NX|XX] [GET] [EX seconds|PX milliseconds|EXAT unix-time-seconds|PXAT unix-time-milliseconds|KEEPTTL]
+func (h *Handler) handleSet(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	var nx, xx, get, keepTTL, expire bool
+	var expireAt time.Time
+	options := cmd.Args[2:]
+	for i := 0; i < len(options); i++ {
+		option := strings.ToUpper(string(options[i]))
+		switch {
+		case option == "NX" && !xx:
+			nx = true
+		case option == "XX" && !nx:
+			xx = true
+		case option == "GET":
+			get = true
+		case option == "KEEPTTL" && !expire:
+			keepTTL = true
+		case isExpireOption(option) && !expire && !keepTTL && i+1 < len(options):
+			at, errReply := parseExpireTime(cmd, option, options[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			expire, expireAt = true, at
+			i++
+		default:
+			return &resp.Error{Data: syntaxError}
+		}
+	}
+
+	key := string(cmd.Args[0])
+	value, exists := tx.Get(key)
+
+	// With GET the old value is replied, and must be a string
+	var reply resp.RESPData = &resp.SimpleString{Data: "OK"}
+	if get {
+		old, ok := value.([]byte)
+		if exists && !ok {
+			return &resp.Error{Data: wrongTypeError}
+		}
+		reply = &resp.BulkString{Data: old}
+	}
+
+	if (nx && exists) || (xx && !exists) {
+		if get {
+			return reply
+		}
+		return &resp.BulkString{Data: nil}
+	}
+
+	if keepTTL {
+		tx.Set(key, cmd.Args[1])
+	} else {
+		replaceKey(tx, key, cmd.Args[1])
+	}
+	if expire {
+		tx.SetExpiration(key, expireAt)
+	}
+	h.notifyKeyspaceEvent(config.NotifyString, "set", key, tx.DB())
+	if expire {
+		h.notifyKeyspaceEvent(config.NotifyGeneric, "expire", key, tx.DB())
+	}
+	return reply
+}
+
+// Handler for SETNX command
+func (h *Handler) handleSetNX(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	key := string(cmd.Args[0])
+	if _, exists := tx.Get(key); exists {
+		return &resp.Integer{Data: 0}
+	}
+	tx.Set(key, cmd.Args[1])
+	h.notifyKeyspaceEvent(config.NotifyString, "set", key, tx.DB())
+	return &resp.Integer{Data: 1}
+}
+
+// Handler for SETEX command
+func (h *Handler) handleSetEX(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.setWithExpiration(tx, cmd, "EX")
+}
+
+// Handler for PSETEX command
+func (h *Handler) handlePSetEX(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.setWithExpiration(tx, cmd, "PX")
+}
+
+// SETEX/PSETEX key ttl value
+func (h *Handler) setWithExpiration(tx *keyspace.Tx, cmd *Command, option string) resp.RESPData {
+	at, errReply := parseExpireTime(cmd, option, cmd.Args[1])
+	if errReply != nil {
+		return errReply
+	}
+	key := string(cmd.Args[0])
+	tx.Set(key, cmd.Args[2])
+	tx.SetExpiration(key, at)
+	h.notifyKeyspaceEvent(config.NotifyString, "set", key, tx.DB())
+	h.notifyKeyspaceEvent(config.NotifyGeneric, "expire", key, tx.DB())
+	return &resp.SimpleString{Data: "OK"}
+}
+
+// Handler for GET command
+func (h *Handler) handleGet(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	str, exists, errReply := getString(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if !exists {
+		// Null if the key does not exist
+		return &resp.BulkString{Data: nil}
+	}
+	return &resp.BulkString{Data: str}
+}
+
+// Handler for GETSET command
+func (h *Handler) handleGetSet(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	key := string(cmd.Args[0])
+	old, _, errReply := getString(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	replaceKey(tx, key, cmd.Args[1])
+	h.notifyKeyspaceEvent(config.NotifyString, "set", key, tx.DB())
+	return &resp.BulkString{Data: old}
+}
+
+// Handler for GETDEL command
+func (h *Handler) handleGetDel(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	key := string(cmd.Args[0])
+	str, exists, errReply := getString(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if exists {
+		tx.Delete(key)
+		h.notifyKeyspaceEvent(config.NotifyGeneric, "del", key, tx.DB())
+	}
+	return &resp.BulkString{Data: str}
+}
+
+// Handler for GETEX command
+// GETEX key [EX seconds|PX milliseconds|EXAT unix-time-seconds|PXAT unix-time-milliseconds|PERSIST]
+func (h *Handler) handleGetEX(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	var expire, persist bool
+	var expireAt time.Time
+	options := cmd.Args[1:]
+	for i := 0; i < len(options); i++ {
+		option := strings.ToUpper(string(options[i]))
+		switch {
+		case option == "PERSIST" && !expire:
+			persist = true
+		case isExpireOption(option) && !expire && !persist && i+1 < len(options):
+			at, errReply := parseExpireTime(cmd, option, options[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			expire, expireAt = true, at
+			i++
+		default:
+			return &resp.Error{Data: syntaxError}
+		}
+	}
+
+	key := string(cmd.Args[0])
+	str, exists, errReply := getString(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if !exists {
+		return &resp.BulkString{Data: nil}
+	}
+
+	switch {
+	case expire && !expireAt.After(time.Now()):
+		tx.Delete(key)
+		h.notifyKeyspaceEvent(config.NotifyGeneric, "del", key, tx.DB())
+	case expire:
+		tx.SetExpiration(key, expireAt)
+		h.notifyKeyspaceEvent(config.NotifyGeneric, "expire", key, tx.DB())
+	case persist:
+		if tx.Persist(key) {
+			h.notifyKeyspaceEvent(config.NotifyGeneric, "persist", key, tx.DB())
+		}
+	}
+	return &resp.BulkString{Data: str}
+}
+
+// Handler for MGET command
+func (h *Handler) handleMGet(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	reply := &resp.Array{Data: make([]resp.RESPData, len(cmd.Args))}
+	for i, key := range cmd.Args {
+		// Keys holding another type are reported as missing
+		value, _ := tx.Get(string(key))
+		str, _ := value.([]byte)
+		reply.Data[i] = &resp.BulkString{Data: str}
+	}
+	return reply
+}
+
+// Handler for MSET command
+func (h *Handler) handleMSet(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if len(cmd.Args)%2 != 0 {
+		return wrongArgsError(cmd)
+	}
+	for i := 0; i < len(cmd.Args); i += 2 {
+		key := string(cmd.Args[i])
+		replaceKey(tx, key, cmd.Args[i+1])
+		h.notifyKeyspaceEvent(config.NotifyString, "set", key, tx.DB())
+	}
+	return &resp.SimpleString{Data: "OK"}
+}
+
+// Handler for MSETNX command
+func (h *Handler) handleMSetNX(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	if len(cmd.Args)%2 != 0 {
+		return wrongArgsError(cmd)
+	}
+	// Nothing is set if any of the keys exists
+	for i := 0; i < len(cmd.Args); i += 2 {
+		if _, exists := tx.Get(string(cmd.Args[i])); exists {
+			return &resp.Integer{Data: 0}
+		}
+	}
+	for i := 0; i < len(cmd.Args); i += 2 {
+		key := string(cmd.Args[i])
+		tx.Set(key, cmd.Args[i+1])
+		h.notifyKeyspaceEvent(config.NotifyString, "set", key, tx.DB())
+	}
+	return &resp.Integer{Data: 1}
+}
+
+// Handler for STRLEN command
+func (h *Handler) handleStrLen(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	str, _, errReply := getString(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return &resp.Integer{Data: int64(len(str))}
+}
+
+// Handler for APPEND command
+func (h *Handler) handleAppend(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	key := string(cmd.Args[0])
+	str, exists, errReply := getString(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if len(str)+len(cmd.Args[1]) > maxStringSize {
+		return &resp.Error{Data: stringTooLongError}
+	}
+	if exists {
+		str = append(copyString(str, 0), cmd.Args[1]...)
+	} else {
+		str = cmd.Args[1]
+	}
+	tx.Set(key, str)
+	h.notifyKeyspaceEvent(config.NotifyString, "append", key, tx.DB())
+	return &resp.Integer{Data: int64(len(str))}
+}
+
+// Handler for GETRANGE command
+// GETRANGE key start end
+func (h *Handler) handleGetRange(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	start, errReply := parseInt(cmd.Args[1])
+	if errReply != nil {
+		return errReply
+	}
+	end, errReply := parseInt(cmd.Args[2])
+	if errReply != nil {
+		return errReply
+	}
+
+	str, _, errReply := getString(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+
+	// Negative offsets count from the end, like Redis the range is empty
+	// when both are negative and inverted
+	size := int64(len(str))
+	if start < 0 && end < 0 && start > end {
+		return &resp.BulkString{Data: []byte{}}
+	}
+	if start < 0 {
+		start = max(0, size+start)
+	}
+	if end < 0 {
+		end = max(0, size+end)
+	}
+	end = min(end, size-1)
+	if start > end || size == 0 {
+		return &resp.BulkString{Data: []byte{}}
+	}
+	return &resp.BulkString{Data: str[start : end+1]}
+}
+
+// Handler for SETRANGE command
+// SETRANGE key offset value
+func (h *Handler) handleSetRange(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	offset, errReply := parseInt(cmd.Args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if offset < 0 {
+		return &resp.Error{Data: "ERR offset is out of range"}
+	}
+
+	key := string(cmd.Args[0])
+	str, _, errReply := getString(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+
+	// An empty value changes nothing, and does not create the key
+	value := cmd.Args[2]
+	if len(value) == 0 {
+		return &resp.Integer{Data: int64(len(str))}
+	}
+	if offset+int64(len(value)) > maxStringSize {
+		return &resp.Error{Data: stringTooLongError}
+	}
+
+	// Bytes between the end of the string and the offset are zeros
+	str = copyString(str, int(offset)+len(value))
+	copy(str[offset:], value)
+	tx.Set(key, str)
+	h.notifyKeyspaceEvent(config.NotifyString, "setrange", key, tx.DB())
+	return &resp.Integer{Data: int64(len(str))}
+}
+
+// Handler for INCR command
+func (h *Handler) handleIncr(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.incrBy(tx, string(cmd.Args[0]), 1)
+}
+
+// Handler for DECR command
+func (h *Handler) handleDecr(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.incrBy(tx, string(cmd.Args[0]), -1)
+}
+
+// Handler for INCRBY command
+func (h *Handler) handleIncrBy(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	delta, errReply := parseInt(cmd.Args[1])
+	if errReply != nil {
+		return errReply
+	}
+	return h.incrBy(tx, string(cmd.Args[0]), delta)
+}
+
+// Handler for DECRBY command
+func (h *Handler) handleDecrBy(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	delta, errReply := parseInt(cmd.Args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if delta == math.MinInt64 {
+		return &resp.Error{Data: "ERR decrement would overflow"}
+	}
+	return h.incrBy(tx, string(cmd.Args[0]), -delta)
+}
+
+// Add delta to the integer stored at key, a missing key counting as 0
+func (h *Handler) incrBy(tx *keyspace.Tx, key string, delta int64) resp.RESPData {
+	str, exists, errReply := getString(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	var n int64
+	if exists {
+		if n, errReply = parseInt(str); errReply != nil {
+			return errReply
+		}
+	}
+
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return &resp.Error{Data: "ERR increment or decrement would overflow"}
+	}
+	n += delta
+	tx.Set(key, []byte(strconv.FormatInt(n, 10)))
+	h.notifyKeyspaceEvent(config.NotifyString, "incrby", key, tx.DB())
+	return &resp.Integer{Data: n}
+}
+
+// Handler for INCRBYFLOAT command
+func (h *Handler) handleIncrByFloat(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	delta, errReply := parseFloat(cmd.Args[1])
+	if errReply != nil {
+		return errReply
+	}
+
+	key := string(cmd.Args[0])
+	str, exists, errReply := getString(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	var f float64
+	if exists {
+		if f, errReply = parseFloat(str); errReply != nil {
+			return errReply
+		}
+	}
+
+	f += delta
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return &resp.Error{Data: "ERR increment would produce NaN or Infinity"}
+	}
+	// Stored without exponent, like Redis
+	value := []byte(strconv.FormatFloat(f, 'f', -1, 64))
+	tx.Set(key, value)
+	h.notifyKeyspaceEvent(config.NotifyString, "incrbyfloat", key, tx.DB())
+	return &resp.BulkString{Data: value}
+}
+
+// Handler for LCS command
+// LCS key1 key2 [LEN] [IDX] [MINMATCHLEN min-match-len] [WITHMATCHLEN]
+func (h *Handler) handleLCS(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	var getLen, getIdx, withMatchLen bool
+	var minMatchLen int64
+	for i := 2; i < len(cmd.Args); i++ {
+		switch option := strings.ToUpper(string(cmd.Args[i])); {
+		case option == "LEN":
+			getLen = true
+		case option == "IDX":
+			getIdx = true
+		case option == "WITHMATCHLEN":
+			withMatchLen = true
+		case option == "MINMATCHLEN" && i+1 < len(cmd.Args):
+			n, errReply := parseInt(cmd.Args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			minMatchLen = max(0, n)
+			i++
+		default:
+			return &resp.Error{Data: syntaxError}
+		}
+	}
+	if getLen && getIdx {
+		return &resp.Error{Data: "ERR If you want both the length and indexes, please just use IDX."}
+	}
+
+	// Missing keys are empty strings
+	var strs [2][]byte
+	for i := range strs {
+		value, exists := tx.Get(string(cmd.Args[i]))
+		str, ok := value.([]byte)
+		if exists && !ok {
+			return &resp.Error{Data: "ERR The specified keys must contain string values"}
+		}
+		strs[i] = str
+	}
+	a, b := strs[0], strs[1]
+	if uint64(len(a)+1)*uint64(len(b)+1)*4 > maxStringSize {
+		return &resp.Error{Data: "ERR Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len"}
+	}
+
+	// lcs(i, j) is the length of the LCS of the first i bytes of a and the
+	// first j bytes of b
+	width := len(b) + 1
+	table := make([]uint32, (len(a)+1)*width)
+	lcs := func(i, j int) uint32 { return table[i*width+j] }
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				table[i*width+j] = lcs(i-1, j-1) + 1
+			} else {
+				table[i*width+j] = max(lcs(i-1, j), lcs(i, j-1))
+			}
+		}
+	}
+	length := lcs(len(a), len(b))
+	if getLen {
+		return &resp.Integer{Data: int64(length)}
+	}
+
+	// Walk the table back from the end, collecting the LCS and the ranges
+	// of contiguous matches, last match first
+	result := make([]byte, length)
+	matches := &resp.Array{Data: []resp.RESPData{}}
+	idx := int(length)
+	aStart, aEnd, bStart, bEnd := -1, 0, 0, 0
+	for i, j := len(a), len(b); i > 0 && j > 0; {
+		emit := false
+		if a[i-1] == b[j-1] {
+			result[idx-1] = a[i-1]
+			if aStart == -1 {
+				aStart, aEnd, bStart, bEnd = i-1, i-1, j-1, j-1
+			} else if aStart == i && bStart == j {
+				// Extend the range backward, it is contiguous
+				aStart--
+				bStart--
+			} else {
+				emit = true
+			}
+			// No match can come before the first byte of either string
+			if aStart == 0 || bStart == 0 {
+				emit = true
+			}
+			idx--
+			i--
+			j--
+		} else {
+			if lcs(i-1, j) > lcs(i, j-1) {
+				i--
+			} else {
+				j--
+			}
+			emit = aStart != -1
+		}
+
+		matchLen := aEnd - aStart + 1
+		if emit {
+			if getIdx && int64(matchLen) >= minMatchLen {
+				match := &resp.Array{Data: []resp.RESPData{
+					&resp.Array{Data: []resp.RESPData{&resp.Integer{Data: int64(aStart)}, &resp.Integer{Data: int64(aEnd)}}},
+					&resp.Array{Data: []resp.RESPData{&resp.Integer{Data: int64(bStart)}, &resp.Integer{Data: int64(bEnd)}}},
+				}}
+				if withMatchLen {
+					match.Data = append(match.Data, &resp.Integer{Data: int64(matchLen)})
+				}
+				matches.Data = append(matches.Data, match)
+			}
+			aStart = -1
+		}
+	}
+
+	if getIdx {
+		return &resp.Array{Data: []resp.RESPData{
+			&resp.BulkString{Data: []byte("matches")},
+			matches,
+			&resp.BulkString{Data: []byte("len")},
+			&resp.Integer{Data: int64(length)},
+		}}
+	}
+	return &resp.BulkString{Data: result}
+}
@@ -0,0 +1,403 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// RESP2 clients receive the invalidation messages of the clients redirecting
+// to them on this channel
+const trackingChannel = "__redis__:invalidate"
+
+// trackingState holds the CLIENT TRACKING options of a client. It is replaced
+// rather than modified, so the goroutines sending invalidations can read it.
+type trackingState struct {
+	bcast    bool
+	optin    bool
+	optout   bool
+	noloop   bool
+	redirect int64    // Client receiving the invalidation messages, 0 for itself
+	prefixes []string // Prefixes of the keys followed in BCAST mode
+}
+
+type trackedClient struct {
+	c     *Client
+	state *trackingState
+}
+
+// trackingTable remembers the keys clients may have cached, like the Redis
+// tracking table. Keys are tracked by name whatever their database.
+type trackingTable struct {
+	mu       sync.Mutex
+	clients  map[int64]*trackedClient      // Clients with tracking on
+	keys     map[string]map[int64]struct{} // Keys read by clients in the default mode
+	prefixes map[string]map[int64]struct{} // Prefixes followed by BCAST clients
+	active   atomic.Int64                  // Number of clients with tracking on
+}
+
+func newTrackingTable() *trackingTable {
+	return &trackingTable{
+		clients:  make(map[int64]*trackedClient),
+		keys:     make(map[string]map[int64]struct{}),
+		prefixes: make(map[string]map[int64]struct{}),
+	}
+}
+
+// enable turns tracking on for c or replaces its options
+func (t *trackingTable) enable(c *Client, state *trackingState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if old, ok := t.clients[c.ID]; ok {
+		t.unregisterPrefixes(c.ID, old.state)
+	} else {
+		t.active.Add(1)
+	}
+	t.clients[c.ID] = &trackedClient{c: c, state: state}
+	if state.bcast {
+		for _, prefix := range state.prefixes {
+			ids, ok := t.prefixes[prefix]
+			if !ok {
+				ids = make(map[int64]struct{})
+				t.prefixes[prefix] = ids
+			}
+			ids[c.ID] = struct{}{}
+		}
+	}
+}
+
+// disable turns tracking off for c. The keys it read are forgotten lazily,
+// when they are invalidated.
+func (t *trackingTable) disable(c *Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	old, ok := t.clients[c.ID]
+	if !ok {
+		return
+	}
+	t.unregisterPrefixes(c.ID, old.state)
+	delete(t.clients, c.ID)
+	t.active.Add(-1)
+}
+
+func (t *trackingTable) unregisterPrefixes(id int64, state *trackingState) {
+	for _, prefix := range state.prefixes {
+		delete(t.prefixes[prefix], id)
+		if len(t.prefixes[prefix]) == 0 {
+			delete(t.prefixes, prefix)
+		}
+	}
+}
+
+// remember records that c read keys and may cache them
+func (t *trackingTable) remember(c *Client, keys []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range keys {
+		ids, ok := t.keys[key]
+		if !ok {
+			ids = make(map[int64]struct{})
+			t.keys[key] = ids
+		}
+		ids[c.ID] = struct{}{}
+	}
+}
+
+// invalidate returns the clients to notify that key was modified by the
+// client by, which is nil for expired keys. Clients in the default mode are
+// notified once, until they read the key again.
+func (t *trackingTable) invalidate(key string, by *Client) []*trackedClient {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var targets []*trackedClient
+	notify := func(id int64) {
+		tc, ok := t.clients[id]
+		if !ok || (tc.state.noloop && tc.c == by) {
+			return
+		}
+		targets = append(targets, tc)
+	}
+	for id := range t.keys[key] {
+		if tc, ok := t.clients[id]; ok && !tc.state.bcast {
+			notify(id)
+		}
+	}
+	delete(t.keys, key)
+	for prefix, ids := range t.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			for id := range ids {
+				notify(id)
+			}
+		}
+	}
+	return targets
+}
+
+// Remember the keys read by a tracking client, and invalidate the keys of
+// the other commands, which are taken as writing all of them
+func (h *Handler) trackKeys(c *Client, spec *commandSpec, args [][]byte) {
+	if h.tracking.active.Load() == 0 {
+		return
+	}
+	keys := spec.keysOf(args)
+	if len(keys) == 0 {
+		return
+	}
+	if spec.flags&flagReadOnly == 0 {
+		h.invalidateKeys(c, keys)
+		return
+	}
+
+	// OPTIN clients only track the commands following CLIENT CACHING YES,
+	// and OPTOUT clients skip those following CLIENT CACHING NO
+	s := c.tracking
+	if s != nil && !s.bcast && (!s.optin || c.caching) && (!s.optout || !c.caching) {
+		h.tracking.remember(c, keys)
+	}
+}
+
+// Send invalidation messages for keys modified by client c, which is nil for
+// expired keys
+func (h *Handler) invalidateKeys(c *Client, keys []string) {
+	if h.tracking.active.Load() == 0 {
+		return
+	}
+	for _, key := range keys {
+		for _, tc := range h.tracking.invalidate(key, c) {
+			h.sendInvalidation(tc, bulkStrings([][]byte{[]byte(key)}))
+		}
+	}
+}
+
+// Deliver an invalidation message to a tracking client or the client it
+// redirects to. RESP3 clients get a push message, RESP2 ones have to be
+// subscribed to the invalidation channel.
+func (h *Handler) sendInvalidation(tc *trackedClient, keys resp.RESPData) {
+	target := tc.c
+	if tc.state.redirect != 0 {
+		if target = h.clientByID(tc.state.redirect); target == nil {
+			if tc.c.resp3.Load() {
+				tc.c.push(&resp.Push{Data: []resp.RESPData{
+					&resp.BulkString{Data: []byte("tracking-redir-broken")},
+					&resp.Integer{Data: tc.state.redirect},
+				}})
+			}
+			return
+		}
+	}
+
+	switch {
+	case target.resp3.Load():
+		target.push(&resp.Push{Data: []resp.RESPData{
+			&resp.BulkString{Data: []byte("invalidate")},
+			keys,
+		}})
+	case h.pubsub.isSubscribed(trackingChannel, target):
+		target.push(&resp.Array{Data: []resp.RESPData{
+			&resp.BulkString{Data: []byte("message")},
+			&resp.BulkString{Data: []byte(trackingChannel)},
+			keys,
+		}})
+	}
+}
+
+// CLIENT TRACKING ON|OFF [REDIRECT client-id] [PREFIX prefix ...] [BCAST] [OPTIN] [OPTOUT] [NOLOOP]
+func (h *Handler) handleClientTracking(c *Client, args [][]byte) resp.RESPData {
+	if len(args) < 1 {
+		return &resp.Error{Data: "ERR wrong number of arguments for 'client|tracking' command"}
+	}
+	var on bool
+	switch strings.ToUpper(string(args[0])) {
+	case "ON":
+		on = true
+	case "OFF":
+	default:
+		return &resp.Error{Data: syntaxError}
+	}
+
+	state := &trackingState{}
+	var prefixes []string
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "REDIRECT":
+			if i+1 >= len(args) {
+				return &resp.Error{Data: syntaxError}
+			}
+			i++
+			id, errReply := parseInt(args[i])
+			if errReply != nil {
+				return errReply
+			}
+			state.redirect = id
+		case "PREFIX":
+			if i+1 >= len(args) {
+				return &resp.Error{Data: syntaxError}
+			}
+			i++
+			prefixes = append(prefixes, string(args[i]))
+		case "BCAST":
+			state.bcast = true
+		case "OPTIN":
+			state.optin = true
+		case "OPTOUT":
+			state.optout = true
+		case "NOLOOP":
+			state.noloop = true
+		default:
+			return &resp.Error{Data: syntaxError}
+		}
+	}
+
+	if !on {
+		h.tracking.disable(c)
+		c.tracking, c.caching = nil, false
+		return &resp.SimpleString{Data: "OK"}
+	}
+
+	old := c.tracking
+	switch {
+	case len(prefixes) > 0 && !state.bcast:
+		return &resp.Error{Data: "ERR PREFIX option requires BCAST mode to be enabled"}
+	case old != nil && old.bcast != state.bcast:
+		return &resp.Error{Data: "ERR You can't switch BCAST mode on/off before disabling tracking for this client, and then re-enabling it with a different mode."}
+	case state.optin && state.optout:
+		return &resp.Error{Data: "ERR You can't use OPTIN and OPTOUT at the same time"}
+	case state.bcast && (state.optin || state.optout):
+		return &resp.Error{Data: "ERR OPTIN and OPTOUT are not compatible with BCAST"}
+	case old != nil && (old.optin != state.optin || old.optout != state.optout):
+		return &resp.Error{Data: "ERR You can't switch OPTIN/OPTOUT mode before disabling tracking for this client, and then re-enabling it with a different mode."}
+	case state.redirect != 0 && h.clientByID(state.redirect) == nil:
+		return &resp.Error{Data: "ERR The client ID you want redirect to does not exist"}
+	}
+
+	if state.bcast {
+		var existing []string
+		if old != nil {
+			existing = old.prefixes
+		}
+		merged, errReply := mergePrefixes(existing, prefixes)
+		if errReply != nil {
+			return errReply
+		}
+		state.prefixes = merged
+	}
+
+	h.tracking.enable(c, state)
+	c.tracking = state
+	return &resp.SimpleString{Data: "OK"}
+}
+
+// Add the prefixes given to CLIENT TRACKING to those a client follows. A key
+// must match a single prefix of the client, so prefixes may not overlap.
+// Without any prefix the client follows every key.
+func mergePrefixes(existing, added []string) ([]string, *resp.Error) {
+	overlaps := func(a, b string) bool {
+		return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+	}
+	merged := append([]string{}, existing...)
+	for i, prefix := range added {
+		if contains(existing, prefix) {
+			continue
+		}
+		for _, other := range existing {
+			if overlaps(prefix, other) {
+				return nil, &resp.Error{Data: fmt.Sprintf("ERR Prefix '%s' overlaps with an existing prefix '%s'. Prefixes for a single client must not overlap.", prefix, other)}
+			}
+		}
+		for _, other := range added[i+1:] {
+			if overlaps(prefix, other) {
+				return nil, &resp.Error{Data: fmt.Sprintf("ERR Prefix '%s' overlaps with another provided prefix '%s'. Prefixes for a single client must not overlap.", prefix, other)}
+			}
+		}
+		merged = append(merged, prefix)
+	}
+	if len(merged) == 0 {
+		merged = []string{""}
+	}
+	return merged, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// CLIENT CACHING YES|NO
+func (h *Handler) handleClientCaching(c *Client, args [][]byte) resp.RESPData {
+	if len(args) != 1 {
+		return &resp.Error{Data: "ERR wrong number of arguments for 'client|caching' command"}
+	}
+	s := c.tracking
+	if s == nil || (!s.optin && !s.optout) {
+		return &resp.Error{Data: "ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled"}
+	}
+	switch strings.ToUpper(string(args[0])) {
+	case "YES":
+		if !s.optin {
+			return &resp.Error{Data: "ERR CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode."}
+		}
+	case "NO":
+		if !s.optout {
+			return &resp.Error{Data: "ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode."}
+		}
+	default:
+		return &resp.Error{Data: syntaxError}
+	}
+	c.caching = true
+	return &resp.SimpleString{Data: "OK"}
+}
+
+// CLIENT GETREDIR
+func (h *Handler) handleClientGetRedir(c *Client) resp.RESPData {
+	if c.tracking == nil {
+		return &resp.Integer{Data: -1}
+	}
+	return &resp.Integer{Data: c.tracking.redirect}
+}
+
+// CLIENT TRACKINGINFO
+func (h *Handler) handleClientTrackingInfo(c *Client) resp.RESPData {
+	s := c.tracking
+	if s == nil {
+		return mapReply(c, []resp.RESPData{
+			&resp.BulkString{Data: []byte("flags")}, bulkStrings([][]byte{[]byte("off")}),
+			&resp.BulkString{Data: []byte("redirect")}, &resp.Integer{Data: -1},
+			&resp.BulkString{Data: []byte("prefixes")}, &resp.Array{Data: []resp.RESPData{}},
+		})
+	}
+
+	flags := [][]byte{[]byte("on")}
+	for _, flag := range []struct {
+		set  bool
+		name string
+	}{
+		{s.bcast, "bcast"},
+		{s.optin, "optin"},
+		{s.optout, "optout"},
+		{s.optin && c.caching, "caching-yes"},
+		{s.optout && c.caching, "caching-no"},
+		{s.noloop, "noloop"},
+		{s.redirect != 0 && h.clientByID(s.redirect) == nil, "broken_redirect"},
+	} {
+		if flag.set {
+			flags = append(flags, []byte(flag.name))
+		}
+	}
+	prefixes := make([][]byte, len(s.prefixes))
+	for i, prefix := range s.prefixes {
+		prefixes[i] = []byte(prefix)
+	}
+	return mapReply(c, []resp.RESPData{
+		&resp.BulkString{Data: []byte("flags")}, bulkStrings(flags),
+		&resp.BulkString{Data: []byte("redirect")}, &resp.Integer{Data: s.redirect},
+		&resp.BulkString{Data: []byte("prefixes")}, bulkStrings(prefixes),
+	})
+}
@@ -0,0 +1,462 @@
+package command
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/keyspace"
+	"github.com/mmnalaka/medis/internal/resp"
+	"github.com/mmnalaka/medis/internal/types"
+)
+
+// Look up the sorted set stored at key. The set is nil when the key does not
+// exist, and the error reply is set when it holds another type.
+func getSortedSet(tx *keyspace.Tx, key string) (*types.SortedSet, *resp.Error) {
+	value, exists := tx.Get(key)
+	if !exists {
+		return nil, nil
+	}
+	zset, ok := value.(*types.SortedSet)
+	if !ok {
+		return nil, &resp.Error{Data: wrongTypeError}
+	}
+	return zset, nil
+}
+
+// Sorted sets never exist empty, the key goes away with the last member
+func popSortedSet(tx *keyspace.Tx, key string, zset *types.SortedSet, max bool) types.Member {
+	var m types.Member
+	if max {
+		m, _ = zset.PopMax()
+	} else {
+		m, _ = zset.PopMin()
+	}
+	if zset.Len() == 0 {
+		tx.Delete(key)
+	}
+	return m
+}
+
+// Publish the events of popping members from the sorted set stored at key,
+// once per command whatever the number of members popped
+func (h *Handler) notifyZSetPop(tx *keyspace.Tx, key string, zset *types.SortedSet, max bool) {
+	event := "zpopmin"
+	if max {
+		event = "zpopmax"
+	}
+	h.notifyKeyspaceEvent(config.NotifyZSet, event, key, tx.DB())
+	if zset.Len() == 0 {
+		h.notifyKeyspaceEvent(config.NotifyGeneric, "del", key, tx.DB())
+	}
+}
+
+func scoreReply(score float64) *resp.BulkString {
+	return &resp.BulkString{Data: []byte(formatFloat(score))}
+}
+
+// Parse MIN or MAX, reporting whether it is MAX
+func parseMinMax(arg []byte) (bool, *resp.Error) {
+	switch strings.ToUpper(string(arg)) {
+	case "MIN":
+		return false, nil
+	case "MAX":
+		return true, nil
+	default:
+		return false, &resp.Error{Data: syntaxError}
+	}
+}
+
+// Handler for ZADD command
+// ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func (h *Handler) handleZAdd(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	var nx, xx, gt, lt, ch, incr bool
+	i := 1
+options:
+	for ; i < len(cmd.Args); i++ {
+		switch strings.ToUpper(string(cmd.Args[i])) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break options
+		}
+	}
+
+	pairs := cmd.Args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return &resp.Error{Data: syntaxError}
+	}
+	if nx && xx {
+		return &resp.Error{Data: "ERR XX and NX options at the same time are not compatible"}
+	}
+	if (gt && lt) || (gt && nx) || (lt && nx) {
+		return &resp.Error{Data: "ERR GT, LT, and/or NX options at the same time are not compatible"}
+	}
+	if incr && len(pairs) > 2 {
+		return &resp.Error{Data: "ERR INCR option supports a single increment-element pair"}
+	}
+
+	// Validate every score before changing anything
+	scores := make([]float64, len(pairs)/2)
+	for j := range scores {
+		score, errReply := parseFloat(pairs[2*j])
+		if errReply != nil {
+			return errReply
+		}
+		scores[j] = score
+	}
+
+	key := string(cmd.Args[0])
+	zset, errReply := getSortedSet(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		if xx {
+			// Nothing can be updated, don't create an empty key
+			if incr {
+				return &resp.BulkString{Data: nil}
+			}
+			return &resp.Integer{Data: 0}
+		}
+		zset = types.NewSortedSet()
+		tx.Set(key, zset)
+	}
+
+	added, changed := 0, 0
+	var incrScore *float64
+	for j, score := range scores {
+		member := string(pairs[2*j+1])
+		old, exists := zset.Score(member)
+
+		if (nx && exists) || (xx && !exists) {
+			continue
+		}
+		if incr && exists {
+			score += old
+			if math.IsNaN(score) {
+				return &resp.Error{Data: "ERR resulting score is not a number (NaN)"}
+			}
+		}
+		if exists && ((gt && score <= old) || (lt && score >= old)) {
+			continue
+		}
+
+		zset.Add(member, score)
+		if !exists {
+			added++
+		} else if score != old {
+			changed++
+		}
+		incrScore = &score
+	}
+
+	if added+changed > 0 {
+		event := "zadd"
+		if incr {
+			event = "zincr"
+		}
+		h.notifyKeyspaceEvent(config.NotifyZSet, event, key, tx.DB())
+	}
+	if zset.Len() == 0 {
+		tx.Delete(key)
+	} else if added > 0 {
+		h.signalKeyAsReady(c, key)
+	}
+
+	if incr {
+		if incrScore == nil {
+			return &resp.BulkString{Data: nil}
+		}
+		return scoreReply(*incrScore)
+	}
+	if ch {
+		return &resp.Integer{Data: int64(added + changed)}
+	}
+	return &resp.Integer{Data: int64(added)}
+}
+
+// Handler for ZCARD command
+func (h *Handler) handleZCard(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	zset, errReply := getSortedSet(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return &resp.Integer{Data: 0}
+	}
+	return &resp.Integer{Data: int64(zset.Len())}
+}
+
+// Handler for ZSCORE command
+func (h *Handler) handleZScore(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	zset, errReply := getSortedSet(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return &resp.BulkString{Data: nil}
+	}
+	score, ok := zset.Score(string(cmd.Args[1]))
+	if !ok {
+		return &resp.BulkString{Data: nil}
+	}
+	return scoreReply(score)
+}
+
+// Handler for ZREM command
+func (h *Handler) handleZRem(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	key := string(cmd.Args[0])
+	zset, errReply := getSortedSet(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return &resp.Integer{Data: 0}
+	}
+
+	removed := 0
+	for _, member := range cmd.Args[1:] {
+		if zset.Remove(string(member)) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		h.notifyKeyspaceEvent(config.NotifyZSet, "zrem", key, tx.DB())
+	}
+	if zset.Len() == 0 {
+		tx.Delete(key)
+		h.notifyKeyspaceEvent(config.NotifyGeneric, "del", key, tx.DB())
+	}
+	return &resp.Integer{Data: int64(removed)}
+}
+
+// Handler for ZRANGE command
+// ZRANGE key start stop [REV] [WITHSCORES]
+func (h *Handler) handleZRange(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	start, errReply := parseInt(cmd.Args[1])
+	if errReply != nil {
+		return errReply
+	}
+	stop, errReply := parseInt(cmd.Args[2])
+	if errReply != nil {
+		return errReply
+	}
+
+	var rev, withScores bool
+	for _, arg := range cmd.Args[3:] {
+		switch strings.ToUpper(string(arg)) {
+		case "REV":
+			rev = true
+		case "WITHSCORES":
+			withScores = true
+		default:
+			return &resp.Error{Data: syntaxError}
+		}
+	}
+
+	zset, errReply := getSortedSet(tx, string(cmd.Args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if zset == nil {
+		return &resp.Array{Data: []resp.RESPData{}}
+	}
+
+	return membersReply(zset.Range(int(start), int(stop), rev), withScores)
+}
+
+// Reply with members, followed by their score when withScores is set
+func membersReply(members []types.Member, withScores bool) *resp.Array {
+	reply := &resp.Array{Data: []resp.RESPData{}}
+	for _, m := range members {
+		reply.Data = append(reply.Data, &resp.BulkString{Data: []byte(m.Name)})
+		if withScores {
+			reply.Data = append(reply.Data, scoreReply(m.Score))
+		}
+	}
+	return reply
+}
+
+// Handler for ZPOPMIN command
+func (h *Handler) handleZPopMin(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.zpop(tx, cmd, false)
+}
+
+// Handler for ZPOPMAX command
+func (h *Handler) handleZPopMax(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.zpop(tx, cmd, true)
+}
+
+// ZPOPMIN/ZPOPMAX key [count]
+func (h *Handler) zpop(tx *keyspace.Tx, cmd *Command, max bool) resp.RESPData {
+	if len(cmd.Args) > 2 {
+		return wrongArgsError(cmd)
+	}
+	count := 1
+	if len(cmd.Args) == 2 {
+		n, err := strconv.Atoi(string(cmd.Args[1]))
+		if err != nil || n < 0 {
+			return &resp.Error{Data: "ERR value is out of range, must be positive"}
+		}
+		count = n
+	}
+
+	key := string(cmd.Args[0])
+	zset, errReply := getSortedSet(tx, key)
+	if errReply != nil {
+		return errReply
+	}
+
+	var members []types.Member
+	for i := 0; zset != nil && i < count && zset.Len() > 0; i++ {
+		members = append(members, popSortedSet(tx, key, zset, max))
+	}
+	if len(members) > 0 {
+		h.notifyZSetPop(tx, key, zset, max)
+	}
+	return membersReply(members, true)
+}
+
+// Handler for ZMPOP command
+func (h *Handler) handleZMPop(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	keys, max, count, errReply := parseMPop(cmd.Args, 0, parseMinMax)
+	if errReply != nil {
+		return errReply
+	}
+
+	reply := h.zmpop(tx, keys, max, count)
+	if reply == nil {
+		return nullArray()
+	}
+	return reply
+}
+
+// Pop up to count members from the first non-empty sorted set, the reply is
+// nil when every set is empty
+func (h *Handler) zmpop(tx *keyspace.Tx, keys []string, max bool, count int) resp.RESPData {
+	for _, key := range keys {
+		zset, errReply := getSortedSet(tx, key)
+		if errReply != nil {
+			return errReply
+		}
+		if zset != nil {
+			return h.zmpopFrom(tx, key, zset, max, count)
+		}
+	}
+	return nil
+}
+
+func (h *Handler) zmpopFrom(tx *keyspace.Tx, key string, zset *types.SortedSet, max bool, count int) resp.RESPData {
+	members := &resp.Array{Data: []resp.RESPData{}}
+	for i := 0; i < count && zset.Len() > 0; i++ {
+		m := popSortedSet(tx, key, zset, max)
+		members.Data = append(members.Data, &resp.Array{Data: []resp.RESPData{
+			&resp.BulkString{Data: []byte(m.Name)},
+			scoreReply(m.Score),
+		}})
+	}
+	h.notifyZSetPop(tx, key, zset, max)
+	return &resp.Array{Data: []resp.RESPData{
+		&resp.BulkString{Data: []byte(key)},
+		members,
+	}}
+}
+
+// A sorted set key can serve a blocked client as soon as it exists, since
+// empty sets are deleted
+func sortedSetReady(tx *keyspace.Tx, key string) bool {
+	value, _ := tx.Get(key)
+	_, ok := value.(*types.SortedSet)
+	return ok
+}
+
+// Handler for BZPOPMIN command
+func (h *Handler) handleBZPopMin(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.blockingZPop(c, tx, cmd, false)
+}
+
+// Handler for BZPOPMAX command
+func (h *Handler) handleBZPopMax(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	return h.blockingZPop(c, tx, cmd, true)
+}
+
+// BZPOPMIN/BZPOPMAX key [key ...] timeout
+func (h *Handler) blockingZPop(c *Client, tx *keyspace.Tx, cmd *Command, max bool) resp.RESPData {
+	timeout, errReply := parseTimeout(cmd.Args[len(cmd.Args)-1])
+	if errReply != nil {
+		return errReply
+	}
+
+	keys := make([]string, len(cmd.Args)-1)
+	for i := range keys {
+		keys[i] = string(cmd.Args[i])
+	}
+
+	popFrom := func(tx *keyspace.Tx, key string, zset *types.SortedSet) resp.RESPData {
+		m := popSortedSet(tx, key, zset, max)
+		h.notifyZSetPop(tx, key, zset, max)
+		return &resp.Array{Data: []resp.RESPData{
+			&resp.BulkString{Data: []byte(key)},
+			&resp.BulkString{Data: []byte(m.Name)},
+			scoreReply(m.Score),
+		}}
+	}
+
+	for _, key := range keys {
+		zset, errReply := getSortedSet(tx, key)
+		if errReply != nil {
+			return errReply
+		}
+		if zset != nil {
+			return popFrom(tx, key, zset)
+		}
+	}
+
+	return h.block(c, &waiter{
+		keys:  keys,
+		ready: sortedSetReady,
+		serve: func(h *Handler, _ *Client, tx *keyspace.Tx, key string) resp.RESPData {
+			zset, _ := getSortedSet(tx, key)
+			return popFrom(tx, key, zset)
+		},
+		timeoutReply: nullArray(),
+	}, timeout)
+}
+
+// Handler for BZMPOP command
+func (h *Handler) handleBZMPop(c *Client, tx *keyspace.Tx, cmd *Command) resp.RESPData {
+	timeout, errReply := parseTimeout(cmd.Args[0])
+	if errReply != nil {
+		return errReply
+	}
+	keys, max, count, errReply := parseMPop(cmd.Args, 1, parseMinMax)
+	if errReply != nil {
+		return errReply
+	}
+
+	if reply := h.zmpop(tx, keys, max, count); reply != nil {
+		return reply
+	}
+
+	return h.block(c, &waiter{
+		keys:  keys,
+		ready: sortedSetReady,
+		serve: func(h *Handler, _ *Client, tx *keyspace.Tx, key string) resp.RESPData {
+			zset, _ := getSortedSet(tx, key)
+			return h.zmpopFrom(tx, key, zset, max, count)
+		},
+		timeoutReply: nullArray(),
+	}, timeout)
+}
@@ -0,0 +1,629 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPort = 6379
+	// The metrics endpoint is disabled unless a port is given
+	DefaultMetricsPort = 0
+
+	// Every connection runs its commands directly against the sharded keyspace
+	ExecutionModeThreaded = "threaded"
+	// Connections only do I/O, a single goroutine executes every command
+	ExecutionModeEventLoop = "eventloop"
+)
+
+// Log levels, from the most to the least verbose
+var LogLevels = []string{"debug", "verbose", "notice", "warning"}
+
+// ClientClass groups clients that share output buffer limits
+type ClientClass int
+
+const (
+	ClientClassNormal ClientClass = iota
+	ClientClassReplica
+	ClientClassPubSub
+)
+
+var clientClassNames = []string{"normal", "replica", "pubsub"}
+
+func (c ClientClass) String() string {
+	return clientClassNames[c]
+}
+
+// OutputBufferLimit bounds the replies that may pile up for a client that
+// does not read them fast enough. The client is disconnected as soon as the
+// hard limit is reached, or once it stayed above the soft limit for
+// SoftSeconds. A zero limit disables the check.
+type OutputBufferLimit struct {
+	Hard        int64
+	Soft        int64
+	SoftSeconds time.Duration
+}
+
+// Config holds the server settings
+type Config struct {
+	Port           int         // 0 to not listen on TCP
+	MetricsPort    int         // Port of the Prometheus endpoint, 0 to disable it
+	UnixSocket     string      // Path of the Unix socket, empty for none
+	UnixSocketPerm os.FileMode // Permissions of the socket, 0 to leave the umask ones
+	// Addresses to listen on, "*" for every IPv4 address and "::*" for
+	// every IPv6 one. Addresses prefixed with "-" are skipped when they are
+	// not available.
+	Bind []string
+	// Refuse clients from other hosts, there is no authentication
+	ProtectedMode           bool
+	ExecutionMode           string
+	ClientOutputBufferLimit [3]OutputBufferLimit // Indexed by ClientClass
+	NotifyKeyspaceEvents    KeyspaceEvents
+	// Commands taking longer than this many microseconds are logged in the
+	// slow log, a negative value disables it
+	SlowlogLogSlowerThan int
+	SlowlogMaxLen        int
+	// Events taking at least this many milliseconds are recorded by the
+	// latency monitor, zero disables it
+	LatencyMonitorThreshold int
+	LogLevel                string
+	LogFile                 string // Empty for the standard output
+	LogFormat               string // "text" or "json"
+	// Time given to the connections to finish their commands on shutdown,
+	// before they are closed
+	ShutdownTimeout time.Duration
+
+	MaxClients int
+	// Clients idle for longer are disconnected, zero disables the timeout
+	Timeout time.Duration
+	// Period of the TCP keepalive probes, zero disables them
+	TCPKeepAlive time.Duration
+	TCPBacklog   int
+	// Longest bulk string accepted in a request
+	ProtoMaxBulkLen int64
+}
+
+var (
+	ErrUnknownOption   = errors.New("unknown option")
+	ErrImmutableOption = errors.New("can't set immutable config")
+)
+
+// Default returns the configuration used when no option is given
+func Default() *Config {
+	return &Config{
+		Port:          DefaultPort,
+		Bind:          []string{"*", "-::*"},
+		ProtectedMode: true,
+		MetricsPort:   DefaultMetricsPort,
+		ExecutionMode: ExecutionModeThreaded,
+		ClientOutputBufferLimit: [3]OutputBufferLimit{
+			ClientClassNormal:  {},
+			ClientClassReplica: {Hard: 256 << 20, Soft: 64 << 20, SoftSeconds: 60 * time.Second},
+			ClientClassPubSub:  {Hard: 32 << 20, Soft: 8 << 20, SoftSeconds: 60 * time.Second},
+		},
+		SlowlogLogSlowerThan: 10000,
+		SlowlogMaxLen:        128,
+		LogLevel:             "notice",
+		LogFormat:            "text",
+		ShutdownTimeout:      10 * time.Second,
+		MaxClients:           10000,
+		TCPKeepAlive:         300 * time.Second,
+		TCPBacklog:           511,
+		ProtoMaxBulkLen:      512 << 20,
+	}
+}
+
+// option is a config directive
+type option struct {
+	// Applies the arguments of the directive
+	set func(cfg *Config, args []string) error
+	// Formats the current value the way it is written in a config file
+	get func(cfg *Config) string
+	// Immutable options can only be set at startup
+	immutable bool
+}
+
+var options = map[string]option{
+	"port": {
+		set: func(cfg *Config, args []string) error {
+			return parseInt(args, 0, 65535, &cfg.Port)
+		},
+		get:       func(cfg *Config) string { return strconv.Itoa(cfg.Port) },
+		immutable: true,
+	},
+	"bind": {
+		set: func(cfg *Config, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("wrong number of arguments")
+			}
+			for _, addr := range args {
+				host := strings.TrimPrefix(addr, "-")
+				if host != "*" && host != "::*" && net.ParseIP(host) == nil {
+					return fmt.Errorf("invalid bind address %q", addr)
+				}
+			}
+			cfg.Bind = args
+			return nil
+		},
+		get:       func(cfg *Config) string { return strings.Join(cfg.Bind, " ") },
+		immutable: true,
+	},
+	"protected-mode": {
+		set: func(cfg *Config, args []string) error {
+			return parseYesNo(args, &cfg.ProtectedMode)
+		},
+		get: func(cfg *Config) string { return formatYesNo(cfg.ProtectedMode) },
+	},
+	"unixsocket": {
+		set: func(cfg *Config, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("wrong number of arguments")
+			}
+			cfg.UnixSocket = args[0]
+			return nil
+		},
+		get:       func(cfg *Config) string { return cfg.UnixSocket },
+		immutable: true,
+	},
+	"unixsocketperm": {
+		set: func(cfg *Config, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("wrong number of arguments")
+			}
+			perm, err := strconv.ParseUint(args[0], 8, 32)
+			if err != nil || perm > 0o777 {
+				return fmt.Errorf("invalid permissions %q", args[0])
+			}
+			cfg.UnixSocketPerm = os.FileMode(perm)
+			return nil
+		},
+		get:       func(cfg *Config) string { return strconv.FormatUint(uint64(cfg.UnixSocketPerm), 8) },
+		immutable: true,
+	},
+	"metrics-port": {
+		set: func(cfg *Config, args []string) error {
+			return parseInt(args, 0, 65535, &cfg.MetricsPort)
+		},
+		get:       func(cfg *Config) string { return strconv.Itoa(cfg.MetricsPort) },
+		immutable: true,
+	},
+	"execution-mode": {
+		set: func(cfg *Config, args []string) error {
+			return parseEnum(args, []string{ExecutionModeThreaded, ExecutionModeEventLoop}, &cfg.ExecutionMode)
+		},
+		get:       func(cfg *Config) string { return cfg.ExecutionMode },
+		immutable: true,
+	},
+	"client-output-buffer-limit": {
+		set: parseClientOutputBufferLimit,
+		get: formatClientOutputBufferLimit,
+	},
+	"notify-keyspace-events": {
+		set: func(cfg *Config, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("wrong number of arguments")
+			}
+			events, err := ParseKeyspaceEvents(args[0])
+			if err != nil {
+				return err
+			}
+			cfg.NotifyKeyspaceEvents = events
+			return nil
+		},
+		get: func(cfg *Config) string { return cfg.NotifyKeyspaceEvents.String() },
+	},
+	"slowlog-log-slower-than": {
+		set: func(cfg *Config, args []string) error {
+			return parseInt(args, -1, math.MaxInt, &cfg.SlowlogLogSlowerThan)
+		},
+		get: func(cfg *Config) string { return strconv.Itoa(cfg.SlowlogLogSlowerThan) },
+	},
+	"slowlog-max-len": {
+		set: func(cfg *Config, args []string) error {
+			return parseInt(args, 0, math.MaxInt, &cfg.SlowlogMaxLen)
+		},
+		get: func(cfg *Config) string { return strconv.Itoa(cfg.SlowlogMaxLen) },
+	},
+	"loglevel": {
+		set: func(cfg *Config, args []string) error {
+			return parseEnum(args, LogLevels, &cfg.LogLevel)
+		},
+		get: func(cfg *Config) string { return cfg.LogLevel },
+	},
+	"logfile": {
+		set: func(cfg *Config, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("wrong number of arguments")
+			}
+			cfg.LogFile = args[0]
+			return nil
+		},
+		get:       func(cfg *Config) string { return cfg.LogFile },
+		immutable: true,
+	},
+	"log-format": {
+		set: func(cfg *Config, args []string) error {
+			return parseEnum(args, []string{"text", "json"}, &cfg.LogFormat)
+		},
+		get:       func(cfg *Config) string { return cfg.LogFormat },
+		immutable: true,
+	},
+	"shutdown-timeout": {
+		set: func(cfg *Config, args []string) error {
+			return parseSeconds(args, &cfg.ShutdownTimeout)
+		},
+		get: func(cfg *Config) string { return formatSeconds(cfg.ShutdownTimeout) },
+	},
+	"maxclients": {
+		set: func(cfg *Config, args []string) error {
+			return parseInt(args, 1, math.MaxInt32, &cfg.MaxClients)
+		},
+		get: func(cfg *Config) string { return strconv.Itoa(cfg.MaxClients) },
+	},
+	"timeout": {
+		set: func(cfg *Config, args []string) error {
+			return parseSeconds(args, &cfg.Timeout)
+		},
+		get: func(cfg *Config) string { return formatSeconds(cfg.Timeout) },
+	},
+	"tcp-keepalive": {
+		set: func(cfg *Config, args []string) error {
+			return parseSeconds(args, &cfg.TCPKeepAlive)
+		},
+		get: func(cfg *Config) string { return formatSeconds(cfg.TCPKeepAlive) },
+	},
+	"tcp-backlog": {
+		set: func(cfg *Config, args []string) error {
+			return parseInt(args, 0, math.MaxInt32, &cfg.TCPBacklog)
+		},
+		get:       func(cfg *Config) string { return strconv.Itoa(cfg.TCPBacklog) },
+		immutable: true,
+	},
+	"proto-max-bulk-len": {
+		set: func(cfg *Config, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("wrong number of arguments")
+			}
+			n, err := parseMemory(args[0])
+			if err != nil {
+				return err
+			}
+			// Like Redis, requests must be able to carry reasonable values
+			if n < 1<<20 {
+				return fmt.Errorf("must be 1mb or greater")
+			}
+			cfg.ProtoMaxBulkLen = n
+			return nil
+		},
+		get: func(cfg *Config) string { return strconv.FormatInt(cfg.ProtoMaxBulkLen, 10) },
+	},
+	"latency-monitor-threshold": {
+		set: func(cfg *Config, args []string) error {
+			return parseInt(args, 0, math.MaxInt, &cfg.LatencyMonitorThreshold)
+		},
+		get: func(cfg *Config) string { return strconv.Itoa(cfg.LatencyMonitorThreshold) },
+	},
+}
+
+// Load builds the configuration from command line arguments, the way
+// redis-server does: an optional config file path followed by
+// "--name value" overrides.
+// example: medis /etc/medis.conf --port 7000 --execution-mode eventloop
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+
+	if len(args) > 0 && !strings.HasPrefix(args[0], "--") {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to open config file: %w", err)
+		}
+		defer file.Close()
+
+		if err := cfg.Parse(file); err != nil {
+			return nil, err
+		}
+		args = args[1:]
+	}
+
+	// Group the overrides into directives
+	var directive []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--") {
+			if directive != nil {
+				if err := cfg.Apply(directive[0], directive[1:]); err != nil {
+					return nil, err
+				}
+			}
+			directive = []string{arg[2:]}
+			continue
+		}
+		if directive == nil {
+			return nil, fmt.Errorf("unexpected argument %q", arg)
+		}
+		directive = append(directive, arg)
+	}
+	if directive != nil {
+		if err := cfg.Apply(directive[0], directive[1:]); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// Parse reads directives in the redis.conf format: one "name value..."
+// directive per line, "#" starts a comment
+func (cfg *Config) Parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		fields, err := splitArgs(line)
+		if err != nil {
+			return fmt.Errorf("config line %d: %w", lineNum, err)
+		}
+		if err := cfg.Apply(fields[0], fields[1:]); err != nil {
+			return fmt.Errorf("config line %d: %w", lineNum, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Apply sets a single directive
+func (cfg *Config) Apply(name string, args []string) error {
+	opt, ok := options[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownOption, name)
+	}
+	if err := opt.set(cfg, args); err != nil {
+		return fmt.Errorf("invalid value for %q: %w", name, err)
+	}
+	return nil
+}
+
+// Set changes a directive of the running server, the way CONFIG SET does.
+// The value is split into arguments like a config file line.
+func (cfg *Config) Set(name, value string) error {
+	opt, ok := options[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownOption, name)
+	}
+	if opt.immutable {
+		return ErrImmutableOption
+	}
+	args, err := splitArgs(value)
+	if err != nil {
+		return err
+	}
+	// An empty value is a single empty argument, like notify-keyspace-events ""
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	return opt.set(cfg, args)
+}
+
+// Get returns the value of a directive, formatted like in a config file
+func (cfg *Config) Get(name string) (string, bool) {
+	opt, ok := options[strings.ToLower(name)]
+	if !ok {
+		return "", false
+	}
+	return opt.get(cfg), true
+}
+
+// Names returns the name of every directive, in ascending order
+func Names() []string {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func parseInt(args []string, min, max int, dst *int) error {
+	if len(args) != 1 {
+		return fmt.Errorf("wrong number of arguments")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("not an integer: %s", args[0])
+	}
+	if n < min || n > max {
+		return fmt.Errorf("must be between %d and %d", min, max)
+	}
+	*dst = n
+	return nil
+}
+
+// Parse a yes or no option
+func parseYesNo(args []string, dst *bool) error {
+	if len(args) != 1 {
+		return fmt.Errorf("wrong number of arguments")
+	}
+	switch strings.ToLower(args[0]) {
+	case "yes":
+		*dst = true
+	case "no":
+		*dst = false
+	default:
+		return fmt.Errorf("argument must be 'yes' or 'no'")
+	}
+	return nil
+}
+
+func formatYesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// Parse a number of seconds
+func parseSeconds(args []string, dst *time.Duration) error {
+	var seconds int
+	if err := parseInt(args, 0, math.MaxInt32, &seconds); err != nil {
+		return err
+	}
+	*dst = time.Duration(seconds) * time.Second
+	return nil
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
+
+func parseEnum(args []string, values []string, dst *string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("wrong number of arguments")
+	}
+	value := strings.ToLower(args[0])
+	for _, v := range values {
+		if value == v {
+			*dst = v
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(values, ", "))
+}
+
+// Parse a memory size with an optional unit
+// example: 1k => 1000, 1kb => 1024, 64mb => 67108864
+func parseMemory(s string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+
+	s = strings.ToLower(s)
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSuffix(s, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid memory size: %s", s)
+	}
+	return n * multiplier, nil
+}
+
+// client-output-buffer-limit <class> <hard> <soft> <soft seconds> [<class> ...]
+func parseClientOutputBufferLimit(cfg *Config, args []string) error {
+	if len(args) == 0 || len(args)%4 != 0 {
+		return fmt.Errorf("wrong number of arguments")
+	}
+
+	// Validate everything before applying anything
+	limits := cfg.ClientOutputBufferLimit
+	for i := 0; i < len(args); i += 4 {
+		class := -1
+		name := strings.ToLower(args[i])
+		if name == "slave" {
+			name = "replica"
+		}
+		for c, className := range clientClassNames {
+			if name == className {
+				class = c
+			}
+		}
+		if class == -1 {
+			return fmt.Errorf("invalid client class: %s", args[i])
+		}
+
+		hard, err := parseMemory(args[i+1])
+		if err != nil {
+			return err
+		}
+		soft, err := parseMemory(args[i+2])
+		if err != nil {
+			return err
+		}
+		seconds, err := strconv.Atoi(args[i+3])
+		if err != nil || seconds < 0 {
+			return fmt.Errorf("invalid soft limit seconds: %s", args[i+3])
+		}
+
+		limits[class] = OutputBufferLimit{
+			Hard:        hard,
+			Soft:        soft,
+			SoftSeconds: time.Duration(seconds) * time.Second,
+		}
+	}
+
+	cfg.ClientOutputBufferLimit = limits
+	return nil
+}
+
+// Format the limits of every client class in bytes
+// example: normal 0 0 0 replica 268435456 67108864 60 pubsub 33554432 8388608 60
+func formatClientOutputBufferLimit(cfg *Config) string {
+	parts := make([]string, 0, len(clientClassNames))
+	for class, limit := range cfg.ClientOutputBufferLimit {
+		parts = append(parts, fmt.Sprintf("%s %d %d %d",
+			clientClassNames[class], limit.Hard, limit.Soft, int64(limit.SoftSeconds/time.Second)))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Split a config line into arguments, honoring single and double quotes
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote byte
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				current.WriteByte(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteByte(c)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unbalanced quotes")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,284 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig_Parse(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    func(cfg *Config) // Changes expected on top of the defaults
+		shouldError bool
+	}{
+		{
+			name:     "empty file",
+			input:    "",
+			expected: func(cfg *Config) {},
+		},
+		{
+			name:  "comments and directives",
+			input: "# medis config\nport 7000\n\nexecution-mode eventloop\n",
+			expected: func(cfg *Config) {
+				cfg.Port = 7000
+				cfg.ExecutionMode = ExecutionModeEventLoop
+			},
+		},
+		{
+			name:  "quoted value",
+			input: "execution-mode \"EventLoop\"",
+			expected: func(cfg *Config) {
+				cfg.ExecutionMode = ExecutionModeEventLoop
+			},
+		},
+		{
+			name:  "client output buffer limits",
+			input: "client-output-buffer-limit normal 1mb 512kb 10 slave 1gb 0 0",
+			expected: func(cfg *Config) {
+				cfg.ClientOutputBufferLimit[ClientClassNormal] = OutputBufferLimit{
+					Hard: 1 << 20, Soft: 512 << 10, SoftSeconds: 10 * time.Second,
+				}
+				cfg.ClientOutputBufferLimit[ClientClassReplica] = OutputBufferLimit{Hard: 1 << 30}
+			},
+		},
+		{
+			name:        "invalid client class",
+			input:       "client-output-buffer-limit master 1mb 1mb 10",
+			shouldError: true,
+		},
+		{
+			name:        "invalid buffer limit",
+			input:       "client-output-buffer-limit normal 1xb 1mb 10",
+			shouldError: true,
+		},
+		{
+			name:        "unknown option",
+			input:       "no-such-option yes",
+			shouldError: true,
+		},
+		{
+			name:        "invalid port",
+			input:       "port 70000",
+			shouldError: true,
+		},
+		{
+			name:        "invalid execution mode",
+			input:       "execution-mode fast",
+			shouldError: true,
+		},
+		{
+			name:  "keyspace events",
+			input: "notify-keyspace-events Elx",
+			expected: func(cfg *Config) {
+				cfg.NotifyKeyspaceEvents = NotifyKeyevent | NotifyList | NotifyExpired
+			},
+		},
+		{
+			name:        "invalid keyspace events",
+			input:       "notify-keyspace-events KQ",
+			shouldError: true,
+		},
+		{
+			name:  "slow log",
+			input: "slowlog-log-slower-than -1\nslowlog-max-len 1024",
+			expected: func(cfg *Config) {
+				cfg.SlowlogLogSlowerThan = -1
+				cfg.SlowlogMaxLen = 1024
+			},
+		},
+		{
+			name:  "logging",
+			input: "loglevel VERBOSE\nlogfile /var/log/medis.log\nlog-format json",
+			expected: func(cfg *Config) {
+				cfg.LogLevel = "verbose"
+				cfg.LogFile = "/var/log/medis.log"
+				cfg.LogFormat = "json"
+			},
+		},
+		{
+			name:  "shutdown timeout",
+			input: "shutdown-timeout 3",
+			expected: func(cfg *Config) {
+				cfg.ShutdownTimeout = 3 * time.Second
+			},
+		},
+		{
+			name:  "bind and protected mode",
+			input: "bind 127.0.0.1 -::1 *\nprotected-mode no",
+			expected: func(cfg *Config) {
+				cfg.Bind = []string{"127.0.0.1", "-::1", "*"}
+				cfg.ProtectedMode = false
+			},
+		},
+		{
+			name:        "invalid bind address",
+			input:       "bind 127.0.0.1 localhost",
+			shouldError: true,
+		},
+		{
+			name:        "invalid protected mode",
+			input:       "protected-mode maybe",
+			shouldError: true,
+		},
+		{
+			name:  "unix socket",
+			input: "port 0\nunixsocket /tmp/medis.sock\nunixsocketperm 770",
+			expected: func(cfg *Config) {
+				cfg.Port = 0
+				cfg.UnixSocket = "/tmp/medis.sock"
+				cfg.UnixSocketPerm = 0o770
+			},
+		},
+		{
+			name:        "invalid socket permissions",
+			input:       "unixsocketperm 800",
+			shouldError: true,
+		},
+		{
+			name:  "connection limits",
+			input: "maxclients 100\ntimeout 60\ntcp-keepalive 0\ntcp-backlog 128\nproto-max-bulk-len 1gb",
+			expected: func(cfg *Config) {
+				cfg.MaxClients = 100
+				cfg.Timeout = time.Minute
+				cfg.TCPKeepAlive = 0
+				cfg.TCPBacklog = 128
+				cfg.ProtoMaxBulkLen = 1 << 30
+			},
+		},
+		{
+			name:        "bulk length too small",
+			input:       "proto-max-bulk-len 1kb",
+			shouldError: true,
+		},
+		{
+			name:        "invalid log level",
+			input:       "loglevel trace",
+			shouldError: true,
+		},
+		{
+			name:  "latency monitor",
+			input: "latency-monitor-threshold 100",
+			expected: func(cfg *Config) {
+				cfg.LatencyMonitorThreshold = 100
+			},
+		},
+		{
+			name:        "invalid slow log threshold",
+			input:       "slowlog-log-slower-than -2",
+			shouldError: true,
+		},
+		{
+			name:        "unbalanced quotes",
+			input:       "port \"7000",
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			err := cfg.Parse(strings.NewReader(tt.input))
+			if tt.shouldError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.shouldError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.shouldError {
+				return
+			}
+			expected := Default()
+			tt.expected(expected)
+			if !reflect.DeepEqual(cfg, expected) {
+				t.Errorf("got %+v, want %+v", cfg, expected)
+			}
+		})
+	}
+}
+
+func TestConfig_Load(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "medis.conf")
+	if err := os.WriteFile(path, []byte("port 7000\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load([]string{path, "--execution-mode", "eventloop"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Port != 7000 || cfg.ExecutionMode != ExecutionModeEventLoop {
+		t.Errorf("got %+v", cfg)
+	}
+
+	// Command line overrides win over the file
+	cfg, err = Load([]string{path, "--port", "7001"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Port != 7001 {
+		t.Errorf("got port %d, want 7001", cfg.Port)
+	}
+
+	if _, err := Load([]string{"--port"}); err == nil {
+		t.Error("expected error for missing value")
+	}
+}
+
+func TestConfig_SetGet(t *testing.T) {
+	cfg := Default()
+
+	if err := cfg.Set("notify-keyspace-events", "KA"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := cfg.Get("NOTIFY-KEYSPACE-EVENTS"); got != "AK" {
+		t.Errorf("got %q, want AK", got)
+	}
+	if err := cfg.Set("notify-keyspace-events", ""); err != nil || cfg.NotifyKeyspaceEvents != 0 {
+		t.Errorf("got %v and events %v, want them cleared", err, cfg.NotifyKeyspaceEvents)
+	}
+
+	if err := cfg.Set("client-output-buffer-limit", "pubsub 64mb 16mb 30"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "normal 0 0 0 replica 268435456 67108864 60 pubsub 67108864 16777216 30"
+	if got, _ := cfg.Get("client-output-buffer-limit"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if err := cfg.Set("port", "7000"); !errors.Is(err, ErrImmutableOption) {
+		t.Errorf("got %v, want %v", err, ErrImmutableOption)
+	}
+	if err := cfg.Set("no-such-option", "1"); !errors.Is(err, ErrUnknownOption) {
+		t.Errorf("got %v, want %v", err, ErrUnknownOption)
+	}
+	if _, ok := cfg.Get("no-such-option"); ok {
+		t.Error("expected unknown option")
+	}
+}
+
+func TestKeyspaceEvents(t *testing.T) {
+	tests := []struct {
+		flags, want string
+	}{
+		{"", ""},
+		{"KEA", "AKE"},
+		{"g$lshzxetd", "A"},
+		{"Ex$", "$xE"},
+		{"Amn", "Amn"},
+	}
+	for _, tt := range tests {
+		events, err := ParseKeyspaceEvents(tt.flags)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tt.flags, err)
+		}
+		if got := events.String(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeyspaceEvents selects the keyspace notifications published, see
+// notify-keyspace-events
+type KeyspaceEvents int
+
+// Keyspace event classes, with the notify-keyspace-events flag of each
+const (
+	NotifyKeyspace KeyspaceEvents = 1 << iota // K: __keyspace@<db>__ channels
+	NotifyKeyevent                            // E: __keyevent@<db>__ channels
+	NotifyGeneric                             // g: generic commands like DEL or RENAME
+	NotifyString                              // $: string commands
+	NotifyList                                // l: list commands
+	NotifySet                                 // s: set commands
+	NotifyHash                                // h: hash commands
+	NotifyZSet                                // z: sorted set commands
+	NotifyExpired                             // x: keys removed when they expire
+	NotifyEvicted                             // e: keys evicted for maxmemory
+	NotifyStream                              // t: stream commands
+	NotifyKeyMiss                             // m: lookups of missing keys
+	NotifyModule                              // d: module key types
+	NotifyNew                                 // n: keys created
+
+	// A: every class except key misses and new keys
+	NotifyAll = NotifyGeneric | NotifyString | NotifyList | NotifySet | NotifyHash |
+		NotifyZSet | NotifyExpired | NotifyEvicted | NotifyStream | NotifyModule
+)
+
+var keyspaceEventFlags = []struct {
+	flag   byte
+	events KeyspaceEvents
+}{
+	{'g', NotifyGeneric}, {'$', NotifyString}, {'l', NotifyList}, {'s', NotifySet},
+	{'h', NotifyHash}, {'z', NotifyZSet}, {'x', NotifyExpired}, {'e', NotifyEvicted},
+	{'t', NotifyStream}, {'d', NotifyModule}, {'K', NotifyKeyspace}, {'E', NotifyKeyevent},
+	{'m', NotifyKeyMiss}, {'n', NotifyNew},
+}
+
+// ParseKeyspaceEvents parses notify-keyspace-events flags
+// example: "KEA" => every class published on both kinds of channels
+func ParseKeyspaceEvents(s string) (KeyspaceEvents, error) {
+	var events KeyspaceEvents
+	for i := 0; i < len(s); i++ {
+		if s[i] == 'A' {
+			events |= NotifyAll
+			continue
+		}
+		found := false
+		for _, f := range keyspaceEventFlags {
+			if f.flag == s[i] {
+				events |= f.events
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("invalid keyspace event flag %q", s[i])
+		}
+	}
+	return events, nil
+}
+
+// String formats the events back into flags, the way CONFIG GET shows them
+func (e KeyspaceEvents) String() string {
+	var b strings.Builder
+	if e&NotifyAll == NotifyAll {
+		b.WriteByte('A')
+	}
+	for _, f := range keyspaceEventFlags {
+		if f.events&NotifyAll != 0 && e&NotifyAll == NotifyAll {
+			continue
+		}
+		if e&f.events != 0 {
+			b.WriteByte(f.flag)
+		}
+	}
+	return b.String()
+}
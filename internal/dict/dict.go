@@ -0,0 +1,369 @@
+package dict
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"math/rand/v2"
+)
+
+const (
+	// Number of buckets a new table starts with
+	initialSize = 4
+	// Empty buckets a single rehash step may skip before giving up
+	emptyVisitsPerStep = 10
+)
+
+type entry[V any] struct {
+	key   string
+	value V
+	next  *entry[V]
+}
+
+type table[V any] struct {
+	buckets []*entry[V]
+	mask    uint64
+	used    int
+}
+
+func (t *table[V]) size() int {
+	return len(t.buckets)
+}
+
+// Dict is a hash table with incremental rehashing, modeled on the Redis dict.
+// It keeps two tables: while the dict grows or shrinks, entries are moved from
+// the old table to the new one a few buckets at a time on every operation, so
+// no single call ever pays for a full resize. The bucket layout also allows
+// O(1) random key sampling and a SCAN cursor that stays valid across resizes.
+//
+// A Dict is not safe for concurrent use.
+type Dict[V any] struct {
+	tables    [2]table[V]
+	rehashIdx int // Next bucket of tables[0] to move, -1 when not rehashing
+	seed      maphash.Seed
+}
+
+// New creates an empty dict
+func New[V any]() *Dict[V] {
+	return &Dict[V]{
+		rehashIdx: -1,
+		seed:      maphash.MakeSeed(),
+	}
+}
+
+func (d *Dict[V]) hash(key string) uint64 {
+	return maphash.String(d.seed, key)
+}
+
+func (d *Dict[V]) isRehashing() bool {
+	return d.rehashIdx != -1
+}
+
+// Len returns the number of entries in the dict
+func (d *Dict[V]) Len() int {
+	return d.tables[0].used + d.tables[1].used
+}
+
+// Get returns the value stored under key
+func (d *Dict[V]) Get(key string) (V, bool) {
+	var zero V
+	if d.Len() == 0 {
+		return zero, false
+	}
+	if d.isRehashing() {
+		d.rehashStep()
+	}
+
+	if e := d.find(key); e != nil {
+		return e.value, true
+	}
+	return zero, false
+}
+
+// Set stores value under key and reports whether the key is new
+func (d *Dict[V]) Set(key string, value V) bool {
+	if d.isRehashing() {
+		d.rehashStep()
+	}
+
+	if e := d.find(key); e != nil {
+		e.value = value
+		return false
+	}
+
+	d.expandIfNeeded()
+
+	// New entries always go to the table being filled
+	t := &d.tables[0]
+	if d.isRehashing() {
+		t = &d.tables[1]
+	}
+	idx := d.hash(key) & t.mask
+	t.buckets[idx] = &entry[V]{key: key, value: value, next: t.buckets[idx]}
+	t.used++
+	return true
+}
+
+// Delete removes key from the dict and returns the value it held
+func (d *Dict[V]) Delete(key string) (V, bool) {
+	var zero V
+	if d.Len() == 0 {
+		return zero, false
+	}
+	if d.isRehashing() {
+		d.rehashStep()
+	}
+
+	h := d.hash(key)
+	for i := range d.tables {
+		t := &d.tables[i]
+		if t.size() == 0 {
+			continue
+		}
+		idx := h & t.mask
+		var prev *entry[V]
+		for e := t.buckets[idx]; e != nil; e = e.next {
+			if e.key == key {
+				if prev == nil {
+					t.buckets[idx] = e.next
+				} else {
+					prev.next = e.next
+				}
+				t.used--
+				d.shrinkIfNeeded()
+				return e.value, true
+			}
+			prev = e
+		}
+		if !d.isRehashing() {
+			break
+		}
+	}
+	return zero, false
+}
+
+// Clear removes all entries and releases the tables
+func (d *Dict[V]) Clear() {
+	d.tables = [2]table[V]{}
+	d.rehashIdx = -1
+}
+
+// RandomKey returns a random key in O(1) expected time
+func (d *Dict[V]) RandomKey() (string, bool) {
+	if d.Len() == 0 {
+		return "", false
+	}
+	if d.isRehashing() {
+		d.rehashStep()
+	}
+
+	var head *entry[V]
+	if d.isRehashing() {
+		// Buckets of tables[0] below rehashIdx are already empty, skip them
+		s0 := d.tables[0].size()
+		span := s0 + d.tables[1].size() - d.rehashIdx
+		for head == nil {
+			i := d.rehashIdx + rand.IntN(span)
+			if i >= s0 {
+				head = d.tables[1].buckets[i-s0]
+			} else {
+				head = d.tables[0].buckets[i]
+			}
+		}
+	} else {
+		t := &d.tables[0]
+		for head == nil {
+			head = t.buckets[rand.Uint64()&t.mask]
+		}
+	}
+
+	// Pick a random element of the chain
+	n := 0
+	for e := head; e != nil; e = e.next {
+		n++
+	}
+	e := head
+	for i := rand.IntN(n); i > 0; i-- {
+		e = e.next
+	}
+	return e.key, true
+}
+
+// Scan visits the entries of one or more buckets and returns the cursor to
+// pass to the next call, 0 once the iteration is complete. Start with a
+// cursor of 0. Every key present for the whole iteration is guaranteed to be
+// visited at least once even if the dict is resized between calls. Keys may
+// be reported more than once.
+//
+// The cursor is advanced by incrementing its reversed bits, so the buckets
+// visited in a small table map exactly onto the buckets in a larger one.
+func (d *Dict[V]) Scan(cursor uint64, fn func(key string, value V)) uint64 {
+	if d.Len() == 0 {
+		return 0
+	}
+
+	if !d.isRehashing() {
+		t := &d.tables[0]
+		scanBucket(t.buckets[cursor&t.mask], fn)
+		return nextCursor(cursor, t.mask)
+	}
+
+	// Always visit the smaller table first, then every bucket of the larger
+	// table that its bucket expands to
+	small, large := &d.tables[0], &d.tables[1]
+	if small.size() > large.size() {
+		small, large = large, small
+	}
+
+	scanBucket(small.buckets[cursor&small.mask], fn)
+	for {
+		scanBucket(large.buckets[cursor&large.mask], fn)
+		cursor = nextCursor(cursor, large.mask)
+		if cursor&(small.mask^large.mask) == 0 {
+			break
+		}
+	}
+	return cursor
+}
+
+// Range calls fn for every entry until fn returns false. The dict must not be
+// modified during the iteration.
+func (d *Dict[V]) Range(fn func(key string, value V) bool) {
+	for i := range d.tables {
+		for _, head := range d.tables[i].buckets {
+			for e := head; e != nil; e = e.next {
+				if !fn(e.key, e.value) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (d *Dict[V]) find(key string) *entry[V] {
+	h := d.hash(key)
+	for i := range d.tables {
+		t := &d.tables[i]
+		if t.size() == 0 {
+			continue
+		}
+		for e := t.buckets[h&t.mask]; e != nil; e = e.next {
+			if e.key == key {
+				return e
+			}
+		}
+		if !d.isRehashing() {
+			break
+		}
+	}
+	return nil
+}
+
+// Grow once the load factor reaches 1
+func (d *Dict[V]) expandIfNeeded() {
+	if d.isRehashing() {
+		return
+	}
+	t := &d.tables[0]
+	if t.size() == 0 {
+		d.resize(initialSize)
+		return
+	}
+	if t.used >= t.size() {
+		d.resize(t.used + 1)
+	}
+}
+
+// Shrink once the table is less than 1/8 full
+func (d *Dict[V]) shrinkIfNeeded() {
+	if d.isRehashing() {
+		return
+	}
+	t := &d.tables[0]
+	if t.size() > initialSize && t.used*8 <= t.size() {
+		d.resize(t.used)
+	}
+}
+
+// Allocate a table large enough for n entries and start moving entries to it
+func (d *Dict[V]) resize(n int) {
+	size := initialSize
+	if n > initialSize {
+		size = 1 << bits.Len(uint(n-1))
+	}
+	if size == d.tables[0].size() {
+		return
+	}
+
+	t := table[V]{
+		buckets: make([]*entry[V], size),
+		mask:    uint64(size - 1),
+	}
+
+	// First allocation, nothing to rehash
+	if d.tables[0].size() == 0 {
+		d.tables[0] = t
+		return
+	}
+
+	d.tables[1] = t
+	d.rehashIdx = 0
+}
+
+func (d *Dict[V]) rehashStep() {
+	d.rehash(1)
+}
+
+// Move up to n buckets from the old table to the new one. Returns false once
+// rehashing is complete.
+func (d *Dict[V]) rehash(n int) bool {
+	emptyVisits := n * emptyVisitsPerStep
+	src, dst := &d.tables[0], &d.tables[1]
+
+	for ; n > 0 && src.used > 0; n-- {
+		for src.buckets[d.rehashIdx] == nil {
+			d.rehashIdx++
+			emptyVisits--
+			if emptyVisits == 0 {
+				return true
+			}
+		}
+
+		e := src.buckets[d.rehashIdx]
+		for e != nil {
+			next := e.next
+			idx := d.hash(e.key) & dst.mask
+			e.next = dst.buckets[idx]
+			dst.buckets[idx] = e
+			src.used--
+			dst.used++
+			e = next
+		}
+		src.buckets[d.rehashIdx] = nil
+		d.rehashIdx++
+	}
+
+	// Rehashing is complete, the new table becomes the main table
+	if src.used == 0 {
+		d.tables[0] = d.tables[1]
+		d.tables[1] = table[V]{}
+		d.rehashIdx = -1
+		// Entries may have been deleted while rehashing to the smaller table
+		d.shrinkIfNeeded()
+		return d.isRehashing()
+	}
+	return true
+}
+
+func scanBucket[V any](head *entry[V], fn func(key string, value V)) {
+	for e := head; e != nil; e = e.next {
+		fn(e.key, e.value)
+	}
+}
+
+// Increment the cursor's masked bits in reverse order
+func nextCursor(cursor, mask uint64) uint64 {
+	cursor |= ^mask
+	cursor = bits.Reverse64(cursor)
+	cursor++
+	return bits.Reverse64(cursor)
+}
@@ -0,0 +1,236 @@
+package dict
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDict_SetGetDelete(t *testing.T) {
+	d := New[int]()
+
+	if added := d.Set("a", 1); !added {
+		t.Error("expected new key to be added")
+	}
+	if added := d.Set("a", 2); added {
+		t.Error("expected existing key to be updated")
+	}
+
+	value, ok := d.Get("a")
+	if !ok || value != 2 {
+		t.Errorf("got (%d, %v), want (2, true)", value, ok)
+	}
+
+	if _, ok := d.Get("missing"); ok {
+		t.Error("expected missing key not to be found")
+	}
+
+	value, ok = d.Delete("a")
+	if !ok || value != 2 {
+		t.Errorf("got (%d, %v), want (2, true)", value, ok)
+	}
+	if _, ok := d.Delete("a"); ok {
+		t.Error("expected deleted key not to be found")
+	}
+	if d.Len() != 0 {
+		t.Errorf("got len %d, want 0", d.Len())
+	}
+}
+
+func TestDict_GrowAndShrink(t *testing.T) {
+	d := New[int]()
+	const n = 10000
+
+	for i := 0; i < n; i++ {
+		d.Set(strconv.Itoa(i), i)
+	}
+	if d.Len() != n {
+		t.Fatalf("got len %d, want %d", d.Len(), n)
+	}
+
+	// Every key must stay reachable while the tables are being rehashed
+	for i := 0; i < n; i++ {
+		value, ok := d.Get(strconv.Itoa(i))
+		if !ok || value != i {
+			t.Fatalf("key %d: got (%d, %v)", i, value, ok)
+		}
+	}
+
+	for i := 0; i < n-10; i++ {
+		if _, ok := d.Delete(strconv.Itoa(i)); !ok {
+			t.Fatalf("key %d: expected delete to succeed", i)
+		}
+	}
+	// Keep looking keys up so the incremental rehash can complete
+	for round := 0; round < 500; round++ {
+		for i := n - 10; i < n; i++ {
+			if _, ok := d.Get(strconv.Itoa(i)); !ok {
+				t.Fatalf("key %d: expected key to survive shrinking", i)
+			}
+		}
+	}
+	if size := d.tables[0].size() + d.tables[1].size(); size > 64 {
+		t.Errorf("expected tables to shrink, got %d buckets", size)
+	}
+}
+
+func TestDict_RandomKey(t *testing.T) {
+	d := New[int]()
+	if _, ok := d.RandomKey(); ok {
+		t.Error("expected no key in an empty dict")
+	}
+
+	for i := 0; i < 100; i++ {
+		d.Set(strconv.Itoa(i), i)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 2000; i++ {
+		key, ok := d.RandomKey()
+		if !ok {
+			t.Fatal("expected a key")
+		}
+		if _, exists := d.Get(key); !exists {
+			t.Fatalf("random key %q is not in the dict", key)
+		}
+		seen[key] = true
+	}
+	if len(seen) < 50 {
+		t.Errorf("expected random keys to be spread out, only saw %d distinct keys", len(seen))
+	}
+}
+
+func TestDict_ScanAcrossResize(t *testing.T) {
+	d := New[int]()
+	const n = 1000
+	for i := 0; i < n; i++ {
+		d.Set(strconv.Itoa(i), i)
+	}
+
+	seen := make(map[string]bool)
+	cursor := uint64(0)
+	extra := n
+	for {
+		cursor = d.Scan(cursor, func(key string, _ int) {
+			seen[key] = true
+		})
+		if cursor == 0 {
+			break
+		}
+		// Grow the dict mid-scan to force a rehash
+		if extra < 3*n {
+			d.Set(strconv.Itoa(extra), extra)
+			extra++
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		if !seen[strconv.Itoa(i)] {
+			t.Fatalf("key %d was not returned by the scan", i)
+		}
+	}
+}
+
+func TestDict_Range(t *testing.T) {
+	d := New[int]()
+	for i := 0; i < 100; i++ {
+		d.Set(strconv.Itoa(i), i)
+	}
+
+	sum := 0
+	d.Range(func(_ string, value int) bool {
+		sum += value
+		return true
+	})
+	if sum != 4950 {
+		t.Errorf("got sum %d, want 4950", sum)
+	}
+
+	visited := 0
+	d.Range(func(string, int) bool {
+		visited++
+		return visited < 10
+	})
+	if visited != 10 {
+		t.Errorf("expected range to stop after 10 entries, got %d", visited)
+	}
+}
+
+// Benchmarks against the builtin map used as the keyspace before
+
+func benchmarkKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "key:" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+func BenchmarkDictSet(b *testing.B) {
+	keys := benchmarkKeys(1 << 20)
+	d := New[[]byte]()
+	value := []byte("value")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.Set(keys[i&(len(keys)-1)], value)
+	}
+}
+
+func BenchmarkMapSet(b *testing.B) {
+	keys := benchmarkKeys(1 << 20)
+	m := make(map[string][]byte)
+	value := []byte("value")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m[keys[i&(len(keys)-1)]] = value
+	}
+}
+
+func BenchmarkDictGet(b *testing.B) {
+	keys := benchmarkKeys(1 << 16)
+	d := New[[]byte]()
+	for _, key := range keys {
+		d.Set(key, []byte("value"))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.Get(keys[i&(len(keys)-1)])
+	}
+}
+
+func BenchmarkMapGet(b *testing.B) {
+	keys := benchmarkKeys(1 << 16)
+	m := make(map[string][]byte)
+	for _, key := range keys {
+		m[key] = []byte("value")
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = m[keys[i&(len(keys)-1)]]
+	}
+}
+
+func BenchmarkDictRandomKey(b *testing.B) {
+	d := New[[]byte]()
+	for _, key := range benchmarkKeys(1 << 16) {
+		d.Set(key, []byte("value"))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.RandomKey()
+	}
+}
+
+func BenchmarkMapRandomKey(b *testing.B) {
+	m := make(map[string][]byte)
+	for _, key := range benchmarkKeys(1 << 16) {
+		m[key] = []byte("value")
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// The closest a map gets to a random key is the first key of a range
+		for key := range m {
+			_ = key
+			break
+		}
+	}
+}
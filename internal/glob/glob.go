@@ -0,0 +1,126 @@
+// Package glob implements the glob-style patterns Redis uses for pub/sub
+// patterns and CONFIG GET
+package glob
+
+// Patterns nested deeper than this never match, bounding the recursion
+const maxNesting = 1000
+
+// Match reports whether s matches pattern. Patterns support "*" for any
+// sequence of characters, "?" for any single character, "[abc]" for one of
+// the characters, "[^abc]" for none of them, "[a-z]" for a range and "\x"
+// for the character x literally.
+//
+// Characters are compared case-insensitively when nocase is set.
+func Match(pattern, s string, nocase bool) bool {
+	skipLongerMatches := false
+	return match(pattern, s, nocase, &skipLongerMatches, 0)
+}
+
+// A port of the Redis stringmatchlen. Once a star fails to match the rest of
+// the string at every position, no longer prefix consumed by an enclosing
+// star can match either, which keeps patterns with many stars linear.
+func match(pattern, s string, nocase bool, skipLongerMatches *bool, nesting int) bool {
+	if nesting > maxNesting {
+		return false
+	}
+
+	for len(pattern) > 0 && len(s) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for len(s) > 0 {
+				if match(pattern[1:], s, nocase, skipLongerMatches, nesting+1) {
+					return true
+				}
+				if *skipLongerMatches {
+					return false
+				}
+				s = s[1:]
+			}
+			*skipLongerMatches = true
+			return false
+		case '?':
+			s = s[1:]
+		case '[':
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			matched := false
+			for {
+				if len(pattern) == 0 {
+					// Unterminated class, the loop below consumes nothing more
+					pattern = "]"
+					break
+				}
+				if pattern[0] == '\\' && len(pattern) >= 2 {
+					pattern = pattern[1:]
+					if pattern[0] == s[0] {
+						matched = true
+					}
+				} else if pattern[0] == ']' {
+					break
+				} else if len(pattern) >= 3 && pattern[1] == '-' {
+					start, end, c := pattern[0], pattern[2], s[0]
+					if start > end {
+						start, end = end, start
+					}
+					if nocase {
+						start, end, c = lower(start), lower(end), lower(c)
+					}
+					pattern = pattern[2:]
+					if c >= start && c <= end {
+						matched = true
+					}
+				} else if equal(pattern[0], s[0], nocase) {
+					matched = true
+				}
+				pattern = pattern[1:]
+			}
+			if not {
+				matched = !matched
+			}
+			if !matched {
+				return false
+			}
+			s = s[1:]
+		default:
+			if pattern[0] == '\\' && len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			if !equal(pattern[0], s[0], nocase) {
+				return false
+			}
+			s = s[1:]
+		}
+		pattern = pattern[1:]
+
+		if len(s) == 0 {
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			break
+		}
+	}
+	return len(pattern) == 0 && len(s) == 0
+}
+
+func equal(a, b byte, nocase bool) bool {
+	if nocase {
+		return lower(a) == lower(b)
+	}
+	return a == b
+}
+
+func lower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
@@ -0,0 +1,52 @@
+package glob
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		nocase     bool
+		want       bool
+	}{
+		{"*", "", false, false}, // Like Redis, nothing matches an empty string
+		{"*", "anything", false, true},
+		{"h?llo", "hello", false, true},
+		{"h?llo", "hllo", false, false},
+		{"h*llo", "heeeello", false, true},
+		{"h[ae]llo", "hallo", false, true},
+		{"h[ae]llo", "hillo", false, false},
+		{"h[^e]llo", "hallo", false, true},
+		{"h[^e]llo", "hello", false, false},
+		{"h[a-b]llo", "hbllo", false, true},
+		{"h[b-a]llo", "hbllo", false, true},
+		{"h[a-b]llo", "hcllo", false, false},
+		{"h[A-B]llo", "hbllo", true, true},
+		{"HELLO", "hello", true, true},
+		{"HELLO", "hello", false, false},
+		{`h\*llo`, "h*llo", false, true},
+		{`h\*llo`, "hello", false, false},
+		{`h[\]]llo`, "h]llo", false, true},
+		{"h[ab", "ha", false, true},
+		{"__keyspace@*__:*", "__keyspace@0__:foo", false, true},
+		{"a*b*c", "abc", false, true},
+		{"a*b*c", "acb", false, false},
+		{"*a", "", false, false},
+		{"a**", "a", false, true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.s, tt.nocase); got != tt.want {
+			t.Errorf("Match(%q, %q, %v) = %v, want %v", tt.pattern, tt.s, tt.nocase, got, tt.want)
+		}
+	}
+}
+
+func TestMatch_ManyStars(t *testing.T) {
+	// Would take exponential time without skipping longer matches
+	pattern := strings.Repeat("a*", 30) + "b"
+	if Match(pattern, strings.Repeat("a", 60), false) {
+		t.Error("expected no match")
+	}
+}
@@ -0,0 +1,398 @@
+package keyspace
+
+import (
+	"hash/maphash"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/dict"
+)
+
+const (
+	// DefaultShards is the number of shards used by the server
+	DefaultShards = 64
+	// DefaultDatabases is the number of databases, like Redis
+	DefaultDatabases = 16
+)
+
+// The active expiration samples this many keys with an expiration time at
+// once, and samples the database again while more than
+// expireAcceptableStale percent of them were expired
+const (
+	expireKeysPerLoop     = 20
+	expireAcceptableStale = 10
+)
+
+// object is a stored value with the metadata kept about it
+type object struct {
+	value    any
+	accessed time.Time // Last read or write, for OBJECT IDLETIME
+}
+
+// Hooks are called on the changes of the keyspace that commands do not make
+// explicitly. They run with the shard of the key locked and must not access
+// the keyspace.
+type Hooks struct {
+	// Added is called when a key is created
+	Added func(db int, key string)
+	// Expired is called when a key is removed because it expired
+	Expired func(db int, key string)
+}
+
+// db holds the keys of one database living in a shard
+type db struct {
+	id      int
+	dict    *dict.Dict[*object]
+	expires *dict.Dict[time.Time] // Expiration time of the keys having one
+	hooks   *Hooks
+}
+
+// Remove key if its expiration time passed, and report whether it did
+func (d *db) expireIfNeeded(key string, now time.Time) bool {
+	at, ok := d.expires.Get(key)
+	if !ok || !now.After(at) {
+		return false
+	}
+	d.dict.Delete(key)
+	d.expires.Delete(key)
+	if d.hooks.Expired != nil {
+		d.hooks.Expired(d.id, key)
+	}
+	return true
+}
+
+// Look key up, expired keys are removed lazily when they are accessed. The
+// access time is updated when touch is set.
+func (d *db) lookup(key string, touch bool) (*object, bool) {
+	now := time.Now()
+	d.expireIfNeeded(key, now)
+	o, ok := d.dict.Get(key)
+	if ok && touch {
+		o.accessed = now
+	}
+	return o, ok
+}
+
+func (d *db) get(key string) (any, bool) {
+	if o, ok := d.lookup(key, true); ok {
+		return o.value, true
+	}
+	return nil, false
+}
+
+// Overwriting a key keeps its expiration time
+func (d *db) set(key string, value any) {
+	if o, ok := d.lookup(key, true); ok {
+		o.value = value
+		return
+	}
+	d.dict.Set(key, &object{value: value, accessed: time.Now()})
+	if d.hooks.Added != nil {
+		d.hooks.Added(d.id, key)
+	}
+}
+
+func (d *db) delete(key string) bool {
+	if d.expireIfNeeded(key, time.Now()) {
+		return false
+	}
+	d.expires.Delete(key)
+	_, ok := d.dict.Delete(key)
+	return ok
+}
+
+type shard struct {
+	mu  sync.Mutex
+	dbs []db
+}
+
+// Keyspace is a concurrent key-value store split into lock-striped shards.
+// Every key belongs to exactly one shard, so commands touching different keys
+// only contend when their keys hash to the same shard.
+//
+// Commands that touch several keys must go through Update, which locks all
+// the shards involved in ascending shard order. Since every caller acquires
+// shard locks in the same global order, two multi-key commands can never wait
+// on each other in a cycle. UpdateAll locks every shard and is meant for
+// operations that must see or modify the whole keyspace atomically.
+//
+// The keyspace is made of numbered databases. A shard holds the keys of
+// every database hashing to it, so locking a key locks it in all databases
+// and commands can move keys between databases without further locking.
+//
+// Keys may have an expiration time. Expired keys are removed when they are
+// accessed, and ActiveExpireCycle removes those nobody accesses anymore.
+type Keyspace struct {
+	shards    []shard
+	databases int
+	seed      maphash.Seed
+	hooks     Hooks
+
+	// First shard sampled by the next ActiveExpireCycle
+	nextExpireShard int
+}
+
+// New creates a keyspace of the given number of databases, split into n
+// shards
+func New(n, databases int) *Keyspace {
+	n, databases = max(1, n), max(1, databases)
+	k := &Keyspace{
+		shards:    make([]shard, n),
+		databases: databases,
+		seed:      maphash.MakeSeed(),
+	}
+	for i := range k.shards {
+		k.shards[i].dbs = make([]db, databases)
+		for j := range k.shards[i].dbs {
+			k.shards[i].dbs[j] = db{
+				id:      j,
+				dict:    dict.New[*object](),
+				expires: dict.New[time.Time](),
+				hooks:   &k.hooks,
+			}
+		}
+	}
+	return k
+}
+
+// SetHooks installs the hooks, it must be called before the keyspace is used
+func (k *Keyspace) SetHooks(hooks Hooks) {
+	k.hooks = hooks
+}
+
+// Databases returns the number of databases
+func (k *Keyspace) Databases() int {
+	return k.databases
+}
+
+func (k *Keyspace) shardIndex(key string) int {
+	return int(maphash.String(k.seed, key) % uint64(len(k.shards)))
+}
+
+// Get returns the value stored under key in database 0
+func (k *Keyspace) Get(key string) (any, bool) {
+	s := &k.shards[k.shardIndex(key)]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dbs[0].get(key)
+}
+
+// Set stores value under key in database 0
+func (k *Keyspace) Set(key string, value any) {
+	s := &k.shards[k.shardIndex(key)]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dbs[0].set(key, value)
+}
+
+// Delete removes key from database 0 and reports whether it existed
+func (k *Keyspace) Delete(key string) bool {
+	s := &k.shards[k.shardIndex(key)]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dbs[0].delete(key)
+}
+
+// Len returns the number of keys in a database. The result is not a
+// consistent snapshot unless it is called from within UpdateAll.
+func (k *Keyspace) Len(db int) int {
+	n := 0
+	for i := range k.shards {
+		s := &k.shards[i]
+		s.mu.Lock()
+		n += s.dbs[db].dict.Len()
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// ActiveExpireCycle removes expired keys that are not accessed anymore, the
+// way the Redis server cron does. Every database of every shard is sampled
+// until few of the sampled keys are expired, or until the time budget is
+// spent. It returns the number of keys removed, and must not be called
+// concurrently.
+func (k *Keyspace) ActiveExpireCycle(budget time.Duration) int {
+	start := time.Now()
+	expired := 0
+	for n := 0; n < len(k.shards) && time.Since(start) < budget; n++ {
+		// Resume where the previous cycle ran out of time
+		s := &k.shards[k.nextExpireShard]
+		k.nextExpireShard = (k.nextExpireShard + 1) % len(k.shards)
+
+		for i := range s.dbs {
+			for time.Since(start) < budget {
+				s.mu.Lock()
+				d := &s.dbs[i]
+				now := time.Now()
+				sampled, removed := 0, 0
+				for ; sampled < expireKeysPerLoop && d.expires.Len() > 0; sampled++ {
+					key, _ := d.expires.RandomKey()
+					if d.expireIfNeeded(key, now) {
+						removed++
+					}
+				}
+				s.mu.Unlock()
+
+				expired += removed
+				if sampled == 0 || removed*100/sampled <= expireAcceptableStale {
+					break
+				}
+			}
+		}
+	}
+	return expired
+}
+
+// Update runs fn with the shards owning keys locked, so fn observes and
+// modifies those keys atomically. The transaction starts in database db.
+func (k *Keyspace) Update(db int, keys []string, fn func(tx *Tx)) {
+	indexes := make([]int, 0, len(keys))
+	for _, key := range keys {
+		indexes = append(indexes, k.shardIndex(key))
+	}
+
+	// Lock every shard once, in ascending order
+	sort.Ints(indexes)
+	locked := indexes[:0]
+	for i, idx := range indexes {
+		if i > 0 && idx == indexes[i-1] {
+			continue
+		}
+		locked = append(locked, idx)
+	}
+
+	k.run(db, locked, fn)
+}
+
+// UpdateAll runs fn with every shard locked, starting in database db
+func (k *Keyspace) UpdateAll(db int, fn func(tx *Tx)) {
+	all := make([]int, len(k.shards))
+	for i := range all {
+		all[i] = i
+	}
+	k.run(db, all, fn)
+}
+
+func (k *Keyspace) run(db int, indexes []int, fn func(tx *Tx)) {
+	tx := &Tx{keyspace: k, db: db, locked: make([]bool, len(k.shards))}
+	for _, idx := range indexes {
+		k.shards[idx].mu.Lock()
+		tx.locked[idx] = true
+	}
+	defer func() {
+		for i := len(indexes) - 1; i >= 0; i-- {
+			k.shards[indexes[i]].mu.Unlock()
+		}
+	}()
+
+	fn(tx)
+}
+
+// Tx gives access to the keys locked by Update or UpdateAll. It must not be
+// used after the callback returns.
+type Tx struct {
+	keyspace *Keyspace
+	db       int // Database the keys are accessed in
+	locked   []bool
+	noTouch  bool // Get leaves the access time alone
+}
+
+// DB returns the database the transaction accesses
+func (tx *Tx) DB() int {
+	return tx.db
+}
+
+// Select switches the transaction to another database
+func (tx *Tx) Select(db int) {
+	tx.db = db
+}
+
+// SetNoTouch makes Get leave the access time of keys alone, like Peek
+func (tx *Tx) SetNoTouch(noTouch bool) {
+	tx.noTouch = noTouch
+}
+
+// Get returns the value stored under key
+func (tx *Tx) Get(key string) (any, bool) {
+	if tx.noTouch {
+		return tx.Peek(key)
+	}
+	return tx.database(key).get(key)
+}
+
+// Peek returns the value stored under key without updating its access time
+func (tx *Tx) Peek(key string) (any, bool) {
+	if o, ok := tx.database(key).lookup(key, false); ok {
+		return o.value, true
+	}
+	return nil, false
+}
+
+// IdleTime returns the time elapsed since key was last accessed
+func (tx *Tx) IdleTime(key string) (time.Duration, bool) {
+	o, ok := tx.database(key).lookup(key, false)
+	if !ok {
+		return 0, false
+	}
+	return time.Since(o.accessed), true
+}
+
+// Set stores value under key. An existing key keeps its expiration time.
+func (tx *Tx) Set(key string, value any) {
+	tx.database(key).set(key, value)
+}
+
+// Delete removes key and reports whether it existed
+func (tx *Tx) Delete(key string) bool {
+	return tx.database(key).delete(key)
+}
+
+// Expiration returns the time key expires at, if it has one
+func (tx *Tx) Expiration(key string) (time.Time, bool) {
+	d := tx.database(key)
+	if d.expireIfNeeded(key, time.Now()) {
+		return time.Time{}, false
+	}
+	return d.expires.Get(key)
+}
+
+// SetExpiration makes an existing key expire at the given time
+func (tx *Tx) SetExpiration(key string, at time.Time) {
+	d := tx.database(key)
+	if _, ok := d.lookup(key, false); ok {
+		d.expires.Set(key, at)
+	}
+}
+
+// Persist removes the expiration time of key, and reports whether it had one
+func (tx *Tx) Persist(key string) bool {
+	d := tx.database(key)
+	if d.expireIfNeeded(key, time.Now()) {
+		return false
+	}
+	_, ok := d.expires.Delete(key)
+	return ok
+}
+
+// Len returns the number of keys of the current database in the locked
+// shards
+func (tx *Tx) Len() int {
+	n := 0
+	for i, locked := range tx.locked {
+		if locked {
+			n += tx.keyspace.shards[i].dbs[tx.db].dict.Len()
+		}
+	}
+	return n
+}
+
+// Accessing a key outside of the locked set would be a data race, so treat
+// it as a programming error
+func (tx *Tx) database(key string) *db {
+	idx := tx.keyspace.shardIndex(key)
+	if !tx.locked[idx] {
+		panic("keyspace: key " + key + " was not locked by this transaction")
+	}
+	return &tx.keyspace.shards[idx].dbs[tx.db]
+}
@@ -0,0 +1,250 @@
+package keyspace
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyspace_SetGetDelete(t *testing.T) {
+	k := New(8, 1)
+
+	k.Set("a", []byte("1"))
+	value, ok := k.Get("a")
+	if !ok || string(value.([]byte)) != "1" {
+		t.Errorf("got (%v, %v), want (1, true)", value, ok)
+	}
+
+	if !k.Delete("a") {
+		t.Error("expected delete to succeed")
+	}
+	if _, ok := k.Get("a"); ok {
+		t.Error("expected deleted key not to be found")
+	}
+	if k.Delete("a") {
+		t.Error("expected second delete to fail")
+	}
+}
+
+func TestKeyspace_UpdateIsAtomic(t *testing.T) {
+	k := New(8, 1)
+	keys := []string{"x", "y", "z"}
+	for _, key := range keys {
+		k.Set(key, 0)
+	}
+
+	// Move a unit between keys concurrently, the total must stay constant
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				from, to := keys[(g+i)%3], keys[(g+i+1)%3]
+				// Vary the argument order to exercise the lock ordering
+				args := []string{from, to}
+				if i%2 == 0 {
+					args = []string{to, from}
+				}
+				k.Update(0, args, func(tx *Tx) {
+					a, _ := tx.Get(from)
+					b, _ := tx.Get(to)
+					tx.Set(from, a.(int)-1)
+					tx.Set(to, b.(int)+1)
+				})
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	total := 0
+	k.UpdateAll(0, func(tx *Tx) {
+		for _, key := range keys {
+			value, _ := tx.Get(key)
+			total += value.(int)
+		}
+	})
+	if total != 0 {
+		t.Errorf("got total %d, want 0", total)
+	}
+}
+
+func TestKeyspace_Expiration(t *testing.T) {
+	k := New(8, 1)
+	k.Set("a", 1)
+	k.Set("b", 2)
+
+	k.Update(0, []string{"a", "b", "missing"}, func(tx *Tx) {
+		tx.SetExpiration("a", time.Now().Add(-time.Millisecond))
+		tx.SetExpiration("b", time.Now().Add(time.Hour))
+		tx.SetExpiration("missing", time.Now().Add(time.Hour))
+
+		// Overwriting keeps the expiration time
+		tx.Set("b", 3)
+		if _, ok := tx.Expiration("b"); !ok {
+			t.Error("expected b to keep its expiration time")
+		}
+	})
+
+	if _, ok := k.Get("a"); ok {
+		t.Error("expected expired key not to be found")
+	}
+	k.Update(0, []string{"b", "missing"}, func(tx *Tx) {
+		if _, ok := tx.Expiration("missing"); ok {
+			t.Error("expected no expiration time for a missing key")
+		}
+		if !tx.Persist("b") || tx.Persist("b") {
+			t.Error("expected a single successful persist")
+		}
+	})
+}
+
+func TestKeyspace_ActiveExpireCycle(t *testing.T) {
+	k := New(4, 1)
+	past := time.Now().Add(-time.Second)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		k.Set(key, i)
+		if i%2 == 0 {
+			k.Update(0, []string{key}, func(tx *Tx) { tx.SetExpiration(key, past) })
+		}
+	}
+
+	// Sampling stops once few sampled keys are expired, so a handful may stay
+	expired := 0
+	for i := 0; i < 10; i++ {
+		expired += k.ActiveExpireCycle(time.Second)
+	}
+	if expired < 450 || expired > 500 || k.Len(0) != 1000-expired {
+		t.Errorf("got %d expired keys and %d remaining", expired, k.Len(0))
+	}
+}
+
+func TestKeyspace_Databases(t *testing.T) {
+	k := New(8, 2)
+	k.Update(0, []string{"a"}, func(tx *Tx) {
+		tx.Set("a", 0)
+		tx.Select(1)
+		if _, ok := tx.Get("a"); ok {
+			t.Error("expected databases to be separate")
+		}
+		tx.Set("a", 1)
+	})
+
+	if k.Len(0) != 1 || k.Len(1) != 1 {
+		t.Errorf("got %d and %d keys, want 1 and 1", k.Len(0), k.Len(1))
+	}
+	if value, _ := k.Get("a"); value != 0 {
+		t.Errorf("got %v in database 0, want 0", value)
+	}
+}
+
+func TestKeyspace_IdleTime(t *testing.T) {
+	k := New(8, 1)
+	k.Set("a", 0)
+	time.Sleep(20 * time.Millisecond)
+
+	k.Update(0, []string{"a"}, func(tx *Tx) {
+		// Peeking does not count as an access
+		tx.Peek("a")
+		if idle, _ := tx.IdleTime("a"); idle < 20*time.Millisecond {
+			t.Errorf("got idle time %v, want at least 20ms", idle)
+		}
+		tx.Get("a")
+		if idle, _ := tx.IdleTime("a"); idle >= 20*time.Millisecond {
+			t.Errorf("got idle time %v after an access", idle)
+		}
+	})
+}
+
+func TestKeyspace_UpdateRejectsUnlockedKeys(t *testing.T) {
+	k := New(64, 1)
+
+	// Find a key living in a different shard than "a"
+	other := ""
+	for i := 0; other == ""; i++ {
+		key := strconv.Itoa(i)
+		if k.shardIndex(key) != k.shardIndex("a") {
+			other = key
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected accessing an unlocked key to panic")
+		}
+	}()
+	k.Update(0, []string{"a"}, func(tx *Tx) {
+		tx.Get(other)
+	})
+}
+
+func TestKeyspace_Hooks(t *testing.T) {
+	k := New(8, 2)
+	var added, expired []string
+	k.SetHooks(Hooks{
+		Added:   func(db int, key string) { added = append(added, fmt.Sprintf("%d:%s", db, key)) },
+		Expired: func(db int, key string) { expired = append(expired, fmt.Sprintf("%d:%s", db, key)) },
+	})
+
+	k.Update(1, []string{"a"}, func(tx *Tx) {
+		tx.Set("a", 1)
+		tx.Set("a", 2) // Overwriting adds nothing
+		tx.SetExpiration("a", time.Now().Add(-time.Millisecond))
+		if _, ok := tx.Get("a"); ok {
+			t.Error("expected a to be expired")
+		}
+	})
+
+	if !reflect.DeepEqual(added, []string{"1:a"}) {
+		t.Errorf("got added %q, want [1:a]", added)
+	}
+	if !reflect.DeepEqual(expired, []string{"1:a"}) {
+		t.Errorf("got expired %q, want [1:a]", expired)
+	}
+}
+
+// Parallel GET/SET throughput with lock striping against the single mutex the
+// handler used before
+func benchmarkParallel(b *testing.B, get func(string), set func(string)) {
+	keys := make([]string, 1<<16)
+	for i := range keys {
+		keys[i] = "key:" + strconv.Itoa(i)
+		set(keys[i])
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := keys[i&(len(keys)-1)]
+			// 80% reads, 20% writes
+			if i%5 == 0 {
+				set(key)
+			} else {
+				get(key)
+			}
+			i += 7
+		}
+	})
+}
+
+func BenchmarkKeyspaceParallel(b *testing.B) {
+	k := New(DefaultShards, 1)
+	value := []byte("value")
+	benchmarkParallel(b,
+		func(key string) { k.Get(key) },
+		func(key string) { k.Set(key, value) },
+	)
+}
+
+func BenchmarkSingleMutexParallel(b *testing.B) {
+	k := New(1, 1)
+	value := []byte("value")
+	benchmarkParallel(b,
+		func(key string) { k.Get(key) },
+		func(key string) { k.Set(key, value) },
+	)
+}
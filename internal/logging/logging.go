@@ -0,0 +1,142 @@
+// Package logging sets up the log/slog logger of the server, with the log
+// levels of Redis and an output file that can be reopened for logrotate.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Levels of Redis, from the most to the least verbose
+const (
+	LevelDebug   = slog.LevelDebug
+	LevelVerbose = slog.Level(-2)
+	LevelNotice  = slog.LevelInfo
+	LevelWarning = slog.LevelWarn
+)
+
+var levelNames = map[slog.Level]string{
+	LevelDebug:      "debug",
+	LevelVerbose:    "verbose",
+	LevelNotice:     "notice",
+	LevelWarning:    "warning",
+	slog.LevelError: "error",
+}
+
+var (
+	level  slog.LevelVar
+	output = &fileWriter{}
+)
+
+// ParseLevel returns the level with the given Redis name
+func ParseLevel(name string) (slog.Level, error) {
+	for l, n := range levelNames {
+		if n == name && l != slog.LevelError {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// Setup makes the default logger write records of at least levelName, as
+// "text" or "json", to the file at path or to the standard output when path
+// is empty
+func Setup(levelName, format, path string) error {
+	if err := SetLevel(levelName); err != nil {
+		return err
+	}
+	if err := output.open(path); err != nil {
+		return err
+	}
+
+	opts := &slog.HandlerOptions{Level: &level, ReplaceAttr: replaceLevel}
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(output, opts)
+	case "json":
+		handler = slog.NewJSONHandler(output, opts)
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// SetLevel changes the level of the records written, at runtime
+func SetLevel(name string) error {
+	l, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
+// Reopen closes and opens the log file again, after logrotate moved it
+func Reopen() error {
+	return output.open(output.path)
+}
+
+// For returns the logger of a subsystem, its records carry the subsystem
+// name
+// example: For("server").Info("ready") logs subsystem=server msg=ready
+func For(subsystem string) *slog.Logger {
+	return slog.Default().With("subsystem", subsystem)
+}
+
+// Verbose logs at the verbose level, which slog has no method for
+func Verbose(logger *slog.Logger, msg string, args ...any) {
+	logger.Log(context.Background(), LevelVerbose, msg, args...)
+}
+
+// Name the levels like Redis
+func replaceLevel(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && len(groups) == 0 {
+		if name, ok := levelNames[a.Value.Any().(slog.Level)]; ok {
+			a.Value = slog.StringValue(name)
+		}
+	}
+	return a
+}
+
+// fileWriter writes to a file that may be swapped for a new one while
+// records are written
+type fileWriter struct {
+	mu   sync.Mutex
+	path string
+	file *os.File // nil for the standard output
+}
+
+func (w *fileWriter) open(path string) error {
+	var file *os.File
+	if path != "" {
+		var err error
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file != nil {
+		w.file.Close()
+	}
+	w.path, w.file = path, file
+	return nil
+}
+
+func (w *fileWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var out io.Writer = os.Stdout
+	if w.file != nil {
+		out = w.file
+	}
+	return out.Write(b)
+}
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestSetup_LevelsAndSubsystems(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "medis.log")
+	if err := Setup("verbose", "json", path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer Setup("notice", "text", "")
+
+	log := For("server")
+	log.Debug("hidden")
+	Verbose(log, "accepted", "addr", "127.0.0.1:5000")
+	log.Warn("closing")
+
+	lines := readLines(t, path)
+	if len(lines) != 2 {
+		t.Fatalf("got %q, want 2 records", lines)
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record["level"] != "verbose" || record["subsystem"] != "server" || record["msg"] != "accepted" || record["addr"] != "127.0.0.1:5000" {
+		t.Errorf("got %v", record)
+	}
+	if !strings.Contains(lines[1], `"level":"warning"`) {
+		t.Errorf("got %q, want a warning", lines[1])
+	}
+
+	// The level changes at runtime
+	if err := SetLevel("warning"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	Verbose(log, "hidden")
+	if got := readLines(t, path); len(got) != 2 {
+		t.Errorf("got %q, want verbose records left out", got)
+	}
+
+	if err := SetLevel("error"); err == nil {
+		t.Error("expected error for an unknown level")
+	}
+	if err := Setup("notice", "xml", ""); err == nil {
+		t.Error("expected error for an unknown format")
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "medis.log")
+	if err := Setup("notice", "text", path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer Setup("notice", "text", "")
+
+	log := For("server")
+	log.Info("before")
+
+	// logrotate moves the file away, then has the server reopen it
+	rotated := filepath.Join(dir, "medis.log.1")
+	if err := os.Rename(path, rotated); err != nil {
+		t.Fatal(err)
+	}
+	log.Info("still in the old file")
+	if err := Reopen(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	log.Info("after")
+
+	if got := readLines(t, rotated); len(got) != 2 || !strings.Contains(got[0], "level=notice") {
+		t.Errorf("got %q in the rotated file", got)
+	}
+	if got := readLines(t, path); len(got) != 1 || !strings.Contains(got[0], "msg=after subsystem=server") {
+		t.Errorf("got %q in the new file", got)
+	}
+}
@@ -3,6 +3,7 @@ package resp
 import (
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 // RESP (Redis Serialization Protocol) type prefixes
@@ -13,6 +14,10 @@ const (
 	BulkStringPrefix   = '$'
 	ArrayPrefix        = '*'
 	NilPrefix          = '0'
+
+	// RESP3 types, sent to clients switching protocols with HELLO 3
+	MapPrefix  = '%'
+	PushPrefix = '>'
 )
 
 // Validate the data before decoding
@@ -139,7 +144,11 @@ type BulkString struct {
 
 // Encode the BulkString to RESP format
 // example: Hello => $5\r\nHello\r\n (5 is the length of the string)
+// example: Null bulk string: Null => $-1\r\n
 func (b *BulkString) Encode() []byte {
+	if b.Data == nil {
+		return []byte("$-1\r\n")
+	}
 	return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(b.Data), b.Data))
 }
 
@@ -344,3 +353,73 @@ func (n *Nil) Decode(data []byte) error {
 func (n *Nil) Encode() []byte {
 	return []byte("0\r\n")
 }
+
+// Map is a RESP3 type holding key value pairs
+type Map struct {
+	Data []RESPData // Keys and values alternate
+}
+
+// Encode the Map to RESP3 format
+// example: {a: 1} => %1\r\n$1\r\na\r\n:1\r\n
+func (m *Map) Encode() []byte {
+	result := []byte(fmt.Sprintf("%%%d\r\n", len(m.Data)/2))
+	for _, item := range m.Data {
+		result = append(result, item.Encode()...)
+	}
+	return result
+}
+
+// Decode the Map from RESP3 format, the elements are decoded like those of
+// an array holding both keys and values
+// example: %1\r\n$1\r\na\r\n:1\r\n => {a: 1}
+func (m *Map) Decode(data []byte) error {
+	m.Data = nil
+	if err := validateData(data, MapPrefix, "map"); err != nil {
+		return err
+	}
+	end := strings.Index(string(data), "\r\n")
+	length, err := strconv.Atoi(string(data[1:end]))
+	if err != nil || length < 0 {
+		return fmt.Errorf("invalid map length: %q", data[1:end])
+	}
+
+	var a Array
+	header := fmt.Sprintf("*%d", 2*length)
+	if err := a.Decode(append([]byte(header), data[end:]...)); err != nil {
+		return err
+	}
+	m.Data = a.Data
+	return nil
+}
+
+// Push is a RESP3 type for the messages a server sends outside of command
+// replies, like pub/sub messages and invalidations
+type Push struct {
+	Data []RESPData
+}
+
+// Encode the Push to RESP3 format
+// example: [message, ch, hi] => >3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$2\r\nhi\r\n
+func (p *Push) Encode() []byte {
+	result := []byte(fmt.Sprintf(">%d\r\n", len(p.Data)))
+	for _, item := range p.Data {
+		result = append(result, item.Encode()...)
+	}
+	return result
+}
+
+// Decode the Push from RESP3 format, the elements are decoded like those of
+// an array
+func (p *Push) Decode(data []byte) error {
+	p.Data = nil
+	if err := validateData(data, PushPrefix, "push"); err != nil {
+		return err
+	}
+
+	var a Array
+	if err := a.Decode(append([]byte{ArrayPrefix}, data[1:]...)); err != nil {
+		return err
+	}
+	p.Data = a.Data
+	return nil
+}
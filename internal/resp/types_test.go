@@ -287,6 +287,13 @@ func TestBulkStringEncode(t *testing.T) {
 	}
 }
 
+func TestBulkStringEncodeNull(t *testing.T) {
+	b := &BulkString{Data: nil}
+	if result := string(b.Encode()); result != "$-1\r\n" {
+		t.Errorf("got %q, want %q", result, "$-1\r\n")
+	}
+}
+
 func TestBulkStringDecode(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -449,3 +456,45 @@ func TestArrayDecode(t *testing.T) {
 		})
 	}
 }
+
+func TestMapEncodeDecode(t *testing.T) {
+	m := &Map{Data: []RESPData{
+		&BulkString{Data: []byte("proto")},
+		&Integer{Data: 3},
+	}}
+	encoded := m.Encode()
+	if expected := []byte("%1\r\n$5\r\nproto\r\n:3\r\n"); !reflect.DeepEqual(encoded, expected) {
+		t.Errorf("Encode() = %q, expected %q", encoded, expected)
+	}
+
+	actual := &Map{}
+	if err := actual.Decode(encoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(actual, m) {
+		t.Errorf("got %v, want %v", actual, m)
+	}
+	if err := actual.Decode([]byte("*1\r\n:1\r\n")); err == nil {
+		t.Error("expected error but got none")
+	}
+}
+
+func TestPushEncodeDecode(t *testing.T) {
+	p := &Push{Data: []RESPData{
+		&BulkString{Data: []byte("message")},
+		&BulkString{Data: []byte("ch")},
+		&BulkString{Data: []byte("hi")},
+	}}
+	encoded := p.Encode()
+	if expected := []byte(">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$2\r\nhi\r\n"); !reflect.DeepEqual(encoded, expected) {
+		t.Errorf("Encode() = %q, expected %q", encoded, expected)
+	}
+
+	actual := &Push{}
+	if err := actual.Decode(encoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(actual, p) {
+		t.Errorf("got %v, want %v", actual, p)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package server
+
+import "net"
+
+// setBacklog is not supported here, the listener keeps the system backlog
+func setBacklog(listener net.Listener, backlog int) error {
+	return nil
+}
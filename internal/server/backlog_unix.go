@@ -0,0 +1,29 @@
+//go:build unix
+
+package server
+
+import (
+	"net"
+	"syscall"
+)
+
+// setBacklog sets the length of the queue of connections waiting to be
+// accepted, listening again on the socket updates it
+func setBacklog(listener net.Listener, backlog int) error {
+	tcp, ok := listener.(*net.TCPListener)
+	if !ok {
+		return nil
+	}
+	raw, err := tcp.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var listenErr error
+	err = raw.Control(func(fd uintptr) {
+		listenErr = syscall.Listen(int(fd), backlog)
+	})
+	if err != nil {
+		return err
+	}
+	return listenErr
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/command"
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/logging"
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// Replies are handed to the writer at least every replyChunkBytes, even when
+// more pipelined commands are waiting to be read
+const replyChunkBytes = 16 * 1024
+
+var (
+	errHardLimitReached = errors.New("output buffer hard limit reached")
+	errSoftLimitReached = errors.New("output buffer soft limit reached")
+)
+
+// client is the server side of a single connection. Replies are appended to
+// an output buffer and written by a dedicated writer goroutine, so a batch of
+// pipelined replies goes out in a single write and a client that does not
+// read its replies cannot stall command execution: its buffer grows instead,
+// until it crosses the output buffer limits of its class.
+type client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	class  config.ClientClass
+	limit  config.OutputBufferLimit
+	state  *command.Client // Handler state of the connection
+	log    *slog.Logger
+
+	// Bytes read ahead of the command being handled, for CLIENT LIST
+	queryBuffered atomic.Int64
+
+	mu             sync.Mutex
+	closed         bool      // The writer is stopping, nothing can be queued
+	out            []byte    // Replies not yet handed to the writer
+	writing        int       // Bytes the writer is currently sending
+	softLimitSince time.Time // When the buffer went above the soft limit
+
+	pending    chan struct{} // Wakes the writer up
+	writerDone chan struct{}
+}
+
+func newClient(conn net.Conn, cfg *config.Config) *client {
+	c := &client{
+		conn:       conn,
+		reader:     bufio.NewReader(conn),
+		log:        logging.For("server"),
+		class:      config.ClientClassNormal,
+		pending:    make(chan struct{}, 1),
+		writerDone: make(chan struct{}),
+	}
+	c.limit = cfg.ClientOutputBufferLimit[c.class]
+
+	go c.writeLoop()
+	return c
+}
+
+// queue appends a reply to the output buffer. An error means the client went
+// over its output buffer limits and must be disconnected.
+func (c *client) queue(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+
+	c.out = append(c.out, data...)
+	if err := c.checkLimits(time.Now()); err != nil {
+		return err
+	}
+
+	// Keep batches bounded when the client pipelines faster than we reply
+	if len(c.out) >= replyChunkBytes {
+		c.wakeWriter()
+	}
+	return nil
+}
+
+// flush hands the buffered replies to the writer. It is called once no more
+// input is waiting, so pipelined replies are written together.
+func (c *client) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.out) > 0 && !c.closed {
+		c.wakeWriter()
+	}
+}
+
+// push queues a message sent outside of command replies, like a pub/sub
+// message, and hands it to the writer right away. It may be called from any
+// goroutine. A client going over its limits gets its connection closed, the
+// connection goroutine then cleans up.
+func (c *client) push(msg resp.RESPData) {
+	if err := c.queue(msg.Encode()); err != nil {
+		c.log.Warn("Closing client", "addr", c.conn.RemoteAddr(), "err", err)
+		c.conn.Close()
+		return
+	}
+	c.flush()
+}
+
+// buffers reports the bytes waiting in the query and output buffers. It may
+// be called from any goroutine.
+func (c *client) buffers() (query, output int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return int(c.queryBuffered.Load()), len(c.out) + c.writing
+}
+
+// setClass moves the client to another class, subject to its limits
+func (c *client) setClass(class config.ClientClass, limit config.OutputBufferLimit) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.class = class
+	c.limit = limit
+	c.softLimitSince = time.Time{}
+}
+
+// close writes out the remaining replies and closes the connection
+func (c *client) close() {
+	c.stopWriter()
+	<-c.writerDone
+	c.conn.Close()
+}
+
+// abort closes the connection, dropping any pending reply
+func (c *client) abort() {
+	c.conn.Close()
+	c.stopWriter()
+	<-c.writerDone
+}
+
+func (c *client) stopWriter() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	close(c.pending)
+}
+
+// waitUnblocked waits for the reply of a blocking command. The connection is
+// watched meanwhile, so a client that goes away stops waiting and does not
+// consume elements pushed for it.
+func (c *client) waitUnblocked(handler *command.Handler) resp.RESPData {
+	// Replies to the commands before the blocking one must not wait with it
+	c.flush()
+
+	disconnected := make(chan struct{})
+	watcherDone := make(chan struct{})
+	go func() {
+		defer close(watcherDone)
+		// Returns early when the client pipelines commands behind the
+		// blocking one, those are handled once it is served
+		if _, err := c.reader.Peek(1); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			close(disconnected)
+		}
+	}()
+
+	reply := handler.WaitUnblocked(c.state, disconnected)
+
+	// Stop the watcher before the reader is used again
+	c.conn.SetReadDeadline(time.Now())
+	<-watcherDone
+	c.conn.SetReadDeadline(time.Time{})
+	return reply
+}
+
+func (c *client) wakeWriter() {
+	select {
+	case c.pending <- struct{}{}:
+	default: // The writer already has a wake up pending
+	}
+}
+
+// Must be called with mu held
+func (c *client) checkLimits(now time.Time) error {
+	size := int64(len(c.out) + c.writing)
+
+	if c.limit.Hard > 0 && size >= c.limit.Hard {
+		return errHardLimitReached
+	}
+
+	if c.limit.Soft > 0 && size >= c.limit.Soft {
+		if c.softLimitSince.IsZero() {
+			c.softLimitSince = now
+		} else if now.Sub(c.softLimitSince) >= c.limit.SoftSeconds {
+			return errSoftLimitReached
+		}
+	} else {
+		c.softLimitSince = time.Time{}
+	}
+	return nil
+}
+
+// writeLoop sends the buffered replies until the client is closed
+func (c *client) writeLoop() {
+	defer close(c.writerDone)
+
+	var buf []byte
+	for range c.pending {
+		// Swap buffers so replies can keep being queued during the write
+		c.mu.Lock()
+		buf, c.out = c.out, buf[:0]
+		c.writing = len(buf)
+		c.mu.Unlock()
+
+		if len(buf) == 0 {
+			continue
+		}
+		_, err := c.conn.Write(buf)
+
+		c.mu.Lock()
+		c.writing = 0
+		c.mu.Unlock()
+
+		if err != nil {
+			// Unblock the reader and discard everything queued from now on
+			c.conn.Close()
+			for range c.pending {
+			}
+			return
+		}
+	}
+
+	// Write out whatever was queued since the last wake up
+	c.mu.Lock()
+	buf = c.out
+	c.out = nil
+	c.mu.Unlock()
+	if len(buf) > 0 {
+		c.conn.Write(buf)
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/config"
+)
+
+// recordingConn records every write it receives
+type recordingConn struct {
+	net.Conn
+	mu     sync.Mutex
+	writes []string
+}
+
+func (r *recordingConn) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writes = append(r.writes, string(b))
+	return len(b), nil
+}
+
+func (r *recordingConn) Close() error {
+	return nil
+}
+
+func TestClient_BatchesPipelinedReplies(t *testing.T) {
+	conn := &recordingConn{}
+	c := newClient(conn, config.Default())
+
+	for _, reply := range []string{"+OK\r\n", ":1\r\n", "$1\r\na\r\n"} {
+		if err := c.queue([]byte(reply)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	c.flush()
+	c.close()
+
+	if len(conn.writes) != 1 {
+		t.Fatalf("got %d writes, want 1: %q", len(conn.writes), conn.writes)
+	}
+	if expected := "+OK\r\n:1\r\n$1\r\na\r\n"; conn.writes[0] != expected {
+		t.Errorf("got %q, want %q", conn.writes[0], expected)
+	}
+}
+
+func TestClient_HardLimitDisconnectsSlowConsumer(t *testing.T) {
+	// Nobody reads the other end of the pipe, so writes block forever
+	server, peer := net.Pipe()
+	defer peer.Close()
+
+	cfg := config.Default()
+	cfg.ClientOutputBufferLimit[config.ClientClassNormal] = config.OutputBufferLimit{Hard: 1024}
+	c := newClient(server, cfg)
+
+	reply := make([]byte, 100)
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		err = c.queue(reply)
+		c.flush()
+	}
+	if err != errHardLimitReached {
+		t.Fatalf("got %v, want %v", err, errHardLimitReached)
+	}
+	c.abort()
+}
+
+func TestClient_SoftLimit(t *testing.T) {
+	c := &client{limit: config.OutputBufferLimit{Soft: 10, SoftSeconds: time.Second}}
+	c.out = make([]byte, 20)
+
+	now := time.Now()
+	if err := c.checkLimits(now); err != nil {
+		t.Fatalf("unexpected error when first crossing the soft limit: %v", err)
+	}
+	if err := c.checkLimits(now.Add(500 * time.Millisecond)); err != nil {
+		t.Fatalf("unexpected error within the soft limit period: %v", err)
+	}
+
+	// Going back under the soft limit resets the timer
+	c.out = c.out[:5]
+	c.checkLimits(now.Add(600 * time.Millisecond))
+	c.out = c.out[:20]
+	if err := c.checkLimits(now.Add(1200 * time.Millisecond)); err != nil {
+		t.Fatalf("unexpected error after the timer was reset: %v", err)
+	}
+
+	if err := c.checkLimits(now.Add(2500 * time.Millisecond)); err != errSoftLimitReached {
+		t.Errorf("got %v, want %v", err, errSoftLimitReached)
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"time"
+
+	"github.com/mmnalaka/medis/internal/command"
+	"github.com/mmnalaka/medis/internal/resp"
+)
+
+// executor runs parsed commands and the background tasks against the
+// handler
+type executor interface {
+	Execute(c *command.Client, cmd *command.Command) resp.RESPData
+	Cron(period time.Duration)
+}
+
+// directExecutor runs every command on the calling connection goroutine,
+// relying on the keyspace locks for isolation
+type directExecutor struct {
+	handler *command.Handler
+}
+
+func (e *directExecutor) Execute(c *command.Client, cmd *command.Command) resp.RESPData {
+	return e.handler.Handle(c, cmd)
+}
+
+func (e *directExecutor) Cron(period time.Duration) {
+	e.handler.Cron(period)
+}
+
+type request struct {
+	client *command.Client
+	cmd    *command.Command
+	reply  chan resp.RESPData
+}
+
+// eventLoop runs every command on a single goroutine, in the order they were
+// submitted, like Redis does. Connection goroutines only read and parse
+// requests and write replies, so commands never run concurrently and their
+// effects are totally ordered. Blocked clients wait on their connection
+// goroutine, the loop only registers them and serves them. The background
+// tasks, like active expiry, run on the loop as well, between commands.
+type eventLoop struct {
+	handler  *command.Handler
+	requests chan request
+	crons    chan time.Duration
+	done     <-chan struct{}
+}
+
+// newEventLoop creates a loop that stops accepting commands once done is closed
+func newEventLoop(handler *command.Handler, done <-chan struct{}) *eventLoop {
+	return &eventLoop{
+		handler:  handler,
+		requests: make(chan request),
+		crons:    make(chan time.Duration),
+		done:     done,
+	}
+}
+
+// Run executes submitted commands until the loop is done
+func (l *eventLoop) Run() {
+	for {
+		select {
+		case req := <-l.requests:
+			req.reply <- l.handler.Handle(req.client, req.cmd)
+		case period := <-l.crons:
+			l.handler.Cron(period)
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// Execute submits the command to the loop and waits for its reply
+func (l *eventLoop) Execute(c *command.Client, cmd *command.Command) resp.RESPData {
+	req := request{client: c, cmd: cmd, reply: make(chan resp.RESPData, 1)}
+	select {
+	case l.requests <- req:
+		return <-req.reply
+	case <-l.done:
+		return &resp.Error{Data: "ERR server is shutting down"}
+	}
+}
+
+// Cron submits the background tasks to the loop, skipping them once the
+// loop is done
+func (l *eventLoop) Cron(period time.Duration) {
+	select {
+	case l.crons <- period:
+	case <-l.done:
+	}
+}
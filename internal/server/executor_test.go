@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/config"
+)
+
+var executionModes = []string{config.ExecutionModeThreaded, config.ExecutionModeEventLoop}
+
+// encode a command as a RESP array
+func encode(args ...string) string {
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+	return b.String()
+}
+
+func expectLines(t *testing.T, r *bufio.Reader, lines ...string) {
+	t.Helper()
+	for _, want := range lines {
+		if line, err := r.ReadString('\n'); line != want {
+			t.Fatalf("got %q, %v, want %q", line, err, want)
+		}
+	}
+}
+
+func TestExecutor_Modes(t *testing.T) {
+	for _, mode := range executionModes {
+		t.Run(mode, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.ExecutionMode = mode
+			cfg.NotifyKeyspaceEvents, _ = config.ParseKeyspaceEvents("Ex")
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			addr, _ := startServer(t, ctx, cfg)
+
+			t.Run("pipelining", func(t *testing.T) {
+				conn, reader := dial(t, addr, encode("SET", "p", "1")+encode("INCR", "p")+encode("GET", "p"))
+				defer conn.Close()
+				expectLines(t, reader, "+OK\r\n", ":2\r\n", "$1\r\n", "2\r\n")
+			})
+
+			t.Run("blocking", func(t *testing.T) {
+				blocked, blockedReader := dial(t, addr, encode("BLPOP", "queue", "0"))
+				defer blocked.Close()
+				timedOut, timedOutReader := dial(t, addr, encode("BLPOP", "other", "0.05"))
+				defer timedOut.Close()
+				time.Sleep(20 * time.Millisecond)
+
+				pusher, pusherReader := dial(t, addr, encode("RPUSH", "queue", "a"))
+				defer pusher.Close()
+				expectLines(t, pusherReader, ":1\r\n")
+				expectLines(t, blockedReader, "*2\r\n", "$5\r\n", "queue\r\n", "$1\r\n", "a\r\n")
+				expectLines(t, timedOutReader, "*-1\r\n")
+			})
+
+			t.Run("transactions", func(t *testing.T) {
+				conn, reader := dial(t, addr, encode("MULTI")+encode("INCR", "m")+encode("INCR", "m")+encode("EXEC"))
+				defer conn.Close()
+				expectLines(t, reader, "+OK\r\n", "+QUEUED\r\n", "+QUEUED\r\n", "*2\r\n", ":1\r\n", ":2\r\n")
+
+				// Commands of another client wait for EXEC or DISCARD
+				conn.Write([]byte(encode("MULTI") + encode("SET", "m", "queued")))
+				expectLines(t, reader, "+OK\r\n", "+QUEUED\r\n")
+				other, otherReader := dial(t, addr, encode("GET", "m"))
+				defer other.Close()
+				expectLines(t, otherReader, "$1\r\n", "2\r\n")
+				conn.Write([]byte(encode("DISCARD") + encode("MULTI") + encode("NOSUCHCOMMAND") + encode("EXEC")))
+				expectLines(t, reader, "+OK\r\n", "+OK\r\n")
+				if line, _ := reader.ReadString('\n'); !strings.HasPrefix(line, "-ERR unknown command") {
+					t.Fatalf("got %q", line)
+				}
+				expectLines(t, reader, "-EXECABORT Transaction discarded because of previous errors.\r\n")
+			})
+
+			t.Run("pubsub", func(t *testing.T) {
+				sub, subReader := dial(t, addr, encode("SUBSCRIBE", "news"))
+				defer sub.Close()
+				expectLines(t, subReader, "*3\r\n", "$9\r\n", "subscribe\r\n", "$4\r\n", "news\r\n", ":1\r\n")
+
+				pub, pubReader := dial(t, addr, encode("PUBLISH", "news", "hi"))
+				defer pub.Close()
+				expectLines(t, pubReader, ":1\r\n")
+				expectLines(t, subReader, "*3\r\n", "$7\r\n", "message\r\n", "$4\r\n", "news\r\n", "$2\r\n", "hi\r\n")
+			})
+
+			t.Run("active expiry", func(t *testing.T) {
+				sub, subReader := dial(t, addr, encode("SUBSCRIBE", "__keyevent@0__:expired"))
+				defer sub.Close()
+				expectLines(t, subReader, "*3\r\n", "$9\r\n", "subscribe\r\n", "$22\r\n", "__keyevent@0__:expired\r\n", ":1\r\n")
+
+				// The key is never read, only the cron can expire it
+				conn, reader := dial(t, addr, encode("SET", "e", "v", "PX", "10"))
+				defer conn.Close()
+				expectLines(t, reader, "+OK\r\n")
+				sub.SetReadDeadline(time.Now().Add(2 * time.Second))
+				expectLines(t, subReader, "*3\r\n", "$7\r\n", "message\r\n", "$22\r\n", "__keyevent@0__:expired\r\n", "$1\r\n", "e\r\n")
+			})
+		})
+	}
+}
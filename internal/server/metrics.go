@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/command"
+)
+
+// netStats counts the connections and the bytes they carry
+type netStats struct {
+	connections atomic.Int64 // Connections accepted
+	rejected    atomic.Int64 // Connections refused over maxclients
+	inputBytes  atomic.Int64
+	outputBytes atomic.Int64
+}
+
+// countingConn counts the bytes read from and written to a connection
+type countingConn struct {
+	net.Conn
+	stats *netStats
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.stats.inputBytes.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.stats.outputBytes.Add(int64(n))
+	return n, err
+}
+
+// Serve /metrics on metrics-port, at the bind addresses of the RESP port,
+// until the server stops
+func (s *Server) serveMetrics(ctx context.Context) error {
+	var listeners []net.Listener
+	for _, bind := range s.config.Bind {
+		listener, err := listenBind(ctx, bind, s.config.MetricsPort)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return fmt.Errorf("failed to start metrics listener: %w", err)
+		}
+		if listener != nil {
+			listeners = append(listeners, listener)
+			s.log.Info("Metrics available", "url", "http://"+listener.Addr().String()+"/metrics")
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	for _, listener := range listeners {
+		go func() {
+			if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+				s.log.Warn("Metrics server stopped", "err", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// Write the metrics in the Prometheus text exposition format. In protected
+// mode, only the requests from this host are served, like the clients of
+// the RESP port.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if s.handler.Config().ProtectedMode && !isLoopbackAddr(r.RemoteAddr) {
+		http.Error(w, "Medis is running in protected mode, metrics are only served to the loopback interface", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w, s.handler.Stats(), &s.stats)
+}
+
+func writeMetrics(w io.Writer, stats command.Stats, network *netStats) {
+	m := metricsWriter{w: w}
+
+	m.header("medis_commands_total", "counter", "Commands that ran, by command.")
+	for _, cmd := range stats.Commands {
+		m.sample("medis_commands_total", cmd.Calls, "cmd", strings.ToLower(cmd.Name))
+	}
+	m.header("medis_commands_failed_total", "counter", "Commands that ran and replied with an error, by command.")
+	for _, cmd := range stats.Commands {
+		m.sample("medis_commands_failed_total", cmd.Failed, "cmd", strings.ToLower(cmd.Name))
+	}
+	m.header("medis_commands_rejected_total", "counter", "Commands refused before running, by command.")
+	for _, cmd := range stats.Commands {
+		m.sample("medis_commands_rejected_total", cmd.Rejected, "cmd", strings.ToLower(cmd.Name))
+	}
+
+	m.header("medis_command_duration_seconds", "histogram", "Time spent running commands, by command.")
+	for _, cmd := range stats.Commands {
+		name := strings.ToLower(cmd.Name)
+		for i, bound := range command.DurationBuckets {
+			m.sample("medis_command_duration_seconds_bucket", cmd.Buckets[i], "cmd", name, "le", formatFloat(bound.Seconds()))
+		}
+		m.sample("medis_command_duration_seconds_bucket", cmd.Calls, "cmd", name, "le", "+Inf")
+		m.sample("medis_command_duration_seconds_sum", cmd.Duration.Seconds(), "cmd", name)
+		m.sample("medis_command_duration_seconds_count", cmd.Calls, "cmd", name)
+	}
+
+	m.header("medis_errors_total", "counter", "Error replies, by error prefix.")
+	prefixes := make([]string, 0, len(stats.Errors))
+	for prefix := range stats.Errors {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		m.sample("medis_errors_total", stats.Errors[prefix], "prefix", prefix)
+	}
+
+	m.header("medis_connected_clients", "gauge", "Clients connected.")
+	m.sample("medis_connected_clients", stats.ConnectedClients)
+	m.header("medis_blocked_clients", "gauge", "Clients waiting in a blocking command.")
+	m.sample("medis_blocked_clients", stats.BlockedClients)
+	m.header("medis_connections_received_total", "counter", "Connections accepted.")
+	m.sample("medis_connections_received_total", network.connections.Load())
+	m.header("medis_rejected_connections_total", "counter", "Connections refused because of maxclients.")
+	m.sample("medis_rejected_connections_total", network.rejected.Load())
+	m.header("medis_net_input_bytes_total", "counter", "Bytes read from clients.")
+	m.sample("medis_net_input_bytes_total", network.inputBytes.Load())
+	m.header("medis_net_output_bytes_total", "counter", "Bytes written to clients.")
+	m.sample("medis_net_output_bytes_total", network.outputBytes.Load())
+
+	m.header("medis_keys", "gauge", "Keys in the database, by database with keys.")
+	for db, keys := range stats.Keys {
+		if keys > 0 {
+			m.sample("medis_keys", keys, "db", "db"+strconv.Itoa(db))
+		}
+	}
+	m.header("medis_expired_keys_total", "counter", "Keys removed because they expired.")
+	m.sample("medis_expired_keys_total", stats.ExpiredKeys)
+}
+
+// metricsWriter writes lines of the text exposition format
+type metricsWriter struct {
+	w io.Writer
+}
+
+func (m metricsWriter) header(name, kind, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes a value with labels given as name, value pairs
+// example: medis_keys{db="db0"} 12
+func (m metricsWriter) sample(name string, value any, labels ...string) {
+	var line strings.Builder
+	line.WriteString(name)
+	if len(labels) > 0 {
+		line.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			line.WriteString(labels[i] + `="` + escapeLabel(labels[i+1]) + `"`)
+		}
+		line.WriteByte('}')
+	}
+	if f, ok := value.(float64); ok {
+		value = formatFloat(f)
+	}
+	fmt.Fprintf(&line, " %v\n", value)
+	io.WriteString(m.w, line.String())
+}
+
+// Whether a host:port address is on the loopback interface
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Label values escape backslashes, double quotes and line feeds
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/command"
+	"github.com/mmnalaka/medis/internal/config"
+)
+
+func TestServer_Metrics(t *testing.T) {
+	s := NewServer(config.Default())
+	c := s.handler.NewClient("127.0.0.1:5000", "127.0.0.1:6379", command.Conn{})
+	for _, args := range [][]string{
+		{"SET", "k", "v"},
+		{"SET", "k"},
+		{"LPUSH", "k", "a"},
+		{"SELECT", "2"},
+		{"SET", "other", "v"},
+		{"NOSUCHCOMMAND"},
+	} {
+		cmd := &command.Command{Name: args[0]}
+		for _, arg := range args[1:] {
+			cmd.Args = append(cmd.Args, []byte(arg))
+		}
+		s.handler.Handle(c, cmd)
+	}
+	s.stats.connections.Add(1)
+	s.stats.rejected.Add(1)
+	s.stats.inputBytes.Add(42)
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.RemoteAddr = "127.0.0.1:5000"
+	s.handleMetrics(recorder, req)
+	if got := recorder.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("got content type %q", got)
+	}
+
+	body := recorder.Body.String()
+	for _, want := range []string{
+		"# TYPE medis_commands_total counter\n",
+		`medis_commands_total{cmd="set"} 2` + "\n",
+		`medis_commands_total{cmd="lpush"} 1` + "\n",
+		`medis_commands_failed_total{cmd="lpush"} 1` + "\n",
+		`medis_commands_rejected_total{cmd="set"} 1` + "\n",
+		"# TYPE medis_command_duration_seconds histogram\n",
+		`medis_command_duration_seconds_bucket{cmd="set",le="+Inf"} 2` + "\n",
+		`medis_command_duration_seconds_bucket{cmd="set",le="1"} 2` + "\n",
+		`medis_command_duration_seconds_count{cmd="set"} 2` + "\n",
+		`medis_errors_total{prefix="ERR"} 2` + "\n",
+		`medis_errors_total{prefix="WRONGTYPE"} 1` + "\n",
+		"medis_connected_clients 1\n",
+		"medis_connections_received_total 1\n",
+		"medis_rejected_connections_total 1\n",
+		"medis_net_input_bytes_total 42\n",
+		`medis_keys{db="db0"} 1` + "\n",
+		`medis_keys{db="db2"} 1` + "\n",
+		"medis_expired_keys_total 0\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("got %q, want it to contain %q", body, want)
+		}
+	}
+	if strings.Contains(body, `db="db1"`) {
+		t.Error("expected empty databases to be left out")
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got, want := escapeLabel("a\\b\"c\nd"), `a\\b\"c\nd`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestServer_MetricsListener(t *testing.T) {
+	external := externalIP(t)
+	get := func(host string, port int) (int, error) {
+		client := http.Client{Timeout: time.Second}
+		res, err := client.Get("http://" + net.JoinHostPort(host, strconv.Itoa(port)) + "/metrics")
+		if err != nil {
+			return 0, err
+		}
+		res.Body.Close()
+		return res.StatusCode, nil
+	}
+	freePort := func() int {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		return l.Addr().(*net.TCPAddr).Port
+	}
+
+	t.Run("bind", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Bind = []string{"127.0.0.1"}
+		cfg.ProtectedMode = false
+		cfg.MetricsPort = freePort()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		startServer(t, ctx, cfg)
+
+		if status, err := get("127.0.0.1", cfg.MetricsPort); err != nil || status != http.StatusOK {
+			t.Errorf("got %d, %v on the loopback interface, want 200", status, err)
+		}
+		if _, err := get(external.String(), cfg.MetricsPort); err == nil {
+			t.Errorf("metrics served on %s, which is not a bind address", external)
+		}
+	})
+
+	t.Run("protected mode", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Bind = []string{"*"}
+		cfg.MetricsPort = freePort()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		addr, _ := startServer(t, ctx, cfg)
+
+		if status, err := get(external.String(), cfg.MetricsPort); err != nil || status != http.StatusForbidden {
+			t.Errorf("got %d, %v from %s, want 403", status, err, external)
+		}
+		if status, err := get("127.0.0.1", cfg.MetricsPort); err != nil || status != http.StatusOK {
+			t.Errorf("got %d, %v on the loopback interface, want 200", status, err)
+		}
+
+		conn, reader := dial(t, addr, "*4\r\n$6\r\nCONFIG\r\n$3\r\nSET\r\n$14\r\nprotected-mode\r\n$2\r\nno\r\n")
+		defer conn.Close()
+		if line, _ := reader.ReadString('\n'); line != "+OK\r\n" {
+			t.Fatalf("got %q", line)
+		}
+		if status, err := get(external.String(), cfg.MetricsPort); err != nil || status != http.StatusOK {
+			t.Errorf("got %d, %v from %s without protected mode, want 200", status, err, external)
+		}
+	})
+}
@@ -1,99 +1,480 @@
 package server
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/mmnalaka/medis/internal/command"
+	"github.com/mmnalaka/medis/internal/config"
+	"github.com/mmnalaka/medis/internal/logging"
 )
 
+// Period of the background tasks, 10 times per second like the Redis default
+// hz
+const cronPeriod = 100 * time.Millisecond
+
 type Server struct {
-	port     int
-	listener net.Listener
-	wg       sync.WaitGroup // WaitGroup to track active connections
-	handler  command.Handler
+	config    *config.Config
+	listeners []net.Listener // TCP and Unix socket listeners
+	wg        sync.WaitGroup // WaitGroup to track active connections
+	handler   *command.Handler
+	executor  executor
+	stats     netStats
+	log       *slog.Logger
+
+	// Open connections, no connection is added once shutdown is closed
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{}
+
+	shutdown     chan struct{} // Closed when the server starts shutting down
+	shutdownOnce sync.Once
+	shutdownNow  atomic.Bool // Close the connections without waiting
 }
 
-func NewServer(port int) *Server {
-	return &Server{
-		port:    port,
-		handler: *command.NewHandler(),
+func NewServer(cfg *config.Config) *Server {
+	s := &Server{
+		config:   cfg,
+		handler:  command.NewHandler(cfg),
+		log:      logging.For("server"),
+		conns:    make(map[net.Conn]struct{}),
+		shutdown: make(chan struct{}),
 	}
+	s.handler.OnShutdown = s.requestShutdown
+	return s
 }
 
+// Start serves clients until ctx is canceled or SHUTDOWN is called, then
+// shuts the server down and returns
 func (s *Server) Start(ctx context.Context) error {
-	addr := fmt.Sprintf(":%d", s.port)
-	listener, err := net.Listen("tcp", addr)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Pick how commands are executed. The event loop keeps running while
+	// the connections finish their commands on shutdown.
+	stopped := make(chan struct{})
+	defer close(stopped)
+	if s.config.ExecutionMode == config.ExecutionModeEventLoop {
+		loop := newEventLoop(s.handler, stopped)
+		go loop.Run()
+		s.executor = loop
+	} else {
+		s.executor = &directExecutor{handler: s.handler}
+	}
+
+	go s.cron(ctx)
+
+	if s.config.MetricsPort != 0 {
+		if err := s.serveMetrics(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := s.listen(ctx); err != nil {
+		for _, listener := range s.listeners {
+			listener.Close()
+		}
+		return err
+	}
+	s.log.Info("Server started", "execution_mode", s.config.ExecutionMode)
+
+	for _, listener := range s.listeners {
+		go s.acceptLoop(listener)
+	}
+
+	select {
+	case <-ctx.Done():
+		s.requestShutdown(false)
+	case <-s.shutdown:
+	}
+	s.closeConnections()
+	return nil
+}
+
+// Listen on the TCP port and on the Unix socket, whichever are configured
+func (s *Server) listen(ctx context.Context) error {
+	if s.config.Port == 0 && s.config.UnixSocket == "" {
+		return errors.New("configured to not listen anywhere, set port or unixsocket")
+	}
+
+	if s.config.Port != 0 {
+		for _, bind := range s.config.Bind {
+			if err := s.listenTCP(ctx, bind); err != nil {
+				return err
+			}
+		}
+	}
+
+	if path := s.config.UnixSocket; path != "" {
+		// A server that did not shut down cleanly leaves its socket behind
+		if err := removeStaleSocket(path); err != nil {
+			return err
+		}
+		var lc net.ListenConfig
+		listener, err := lc.Listen(ctx, "unix", path)
+		if err != nil {
+			return fmt.Errorf("failed to start unix socket listener: %w", err)
+		}
+		// The socket file is removed once the listener is closed
+		s.listeners = append(s.listeners, listener)
+		if perm := s.config.UnixSocketPerm; perm != 0 {
+			if err := os.Chmod(path, perm); err != nil {
+				return fmt.Errorf("failed to set unix socket permissions: %w", err)
+			}
+		}
+		s.log.Info("Listening on Unix socket", "path", path)
+	}
+	return nil
+}
+
+// Listen on a bind address for the RESP port
+func (s *Server) listenTCP(ctx context.Context, bind string) error {
+	listener, err := listenBind(ctx, bind, s.config.Port)
 	if err != nil {
 		return fmt.Errorf("failed to start listener: %w", err)
 	}
-	s.listener = listener
-	log.Printf("Server started on %s", addr)
+	if listener == nil {
+		return nil
+	}
+	s.listeners = append(s.listeners, listener)
+	if err := setBacklog(listener, s.config.TCPBacklog); err != nil {
+		s.log.Warn("Failed to set the TCP backlog", "backlog", s.config.TCPBacklog, "err", err)
+	}
+	s.log.Info("Listening on TCP", "addr", listener.Addr())
+	return nil
+}
+
+// Listen on port at a bind address. An optional address, prefixed with "-",
+// is skipped when it is not available on this host, the listener is then
+// nil.
+func listenBind(ctx context.Context, bind string, port int) (net.Listener, error) {
+	host, optional := strings.CutPrefix(bind, "-")
+	// IPv6 listeners only take IPv6 connections, not to overlap with the
+	// IPv4 ones
+	network := "tcp4"
+	switch {
+	case host == "*":
+		host = "0.0.0.0"
+	case host == "::*":
+		host, network = "::", "tcp6"
+	case strings.Contains(host, ":"):
+		network = "tcp6"
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
 
-	// Goroutine to handle shutdown when context is canceled
-	go func() {
-		<-ctx.Done() // Wait for cancellation signal
-		log.Println("Shutting down server...")
-		s.listener.Close() // Stop accepting new connections
-		s.wg.Wait()        // Wait for active connections to finish
-		log.Println("Server shutdown complete")
-	}()
+	// Keepalive is set on each connection from tcp-keepalive, which may
+	// change at runtime
+	lc := net.ListenConfig{KeepAlive: -1}
+	listener, err := lc.Listen(ctx, network, addr)
+	if optional && (errors.Is(err, syscall.EADDRNOTAVAIL) || errors.Is(err, syscall.EAFNOSUPPORT) || errors.Is(err, syscall.EPROTONOSUPPORT)) {
+		logging.For("server").Warn("Skipping unavailable bind address", "addr", addr, "err", err)
+		return nil, nil
+	}
+	return listener, err
+}
+
+// Remove the socket file at path, refusing to remove any other kind of file
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check unix socket: %w", err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("unixsocket %s exists and is not a socket", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale unix socket: %w", err)
+	}
+	return nil
+}
+
+// requestShutdown has the server shut down, now skips waiting for the
+// connections to finish their commands
+func (s *Server) requestShutdown(now bool) {
+	if now {
+		s.shutdownNow.Store(true)
+	}
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
+}
 
-	// Accept loop for handling connections
+func (s *Server) shuttingDown() bool {
+	select {
+	case <-s.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// Accept connections until the listener is closed
+func (s *Server) acceptLoop(listener net.Listener) {
 	for {
 		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
 		if err != nil {
-			select {
-			case <-ctx.Done(): // If context was canceled, exit gracefully
-				return nil
-			default:
-				log.Printf("Failed to accept connection: %v", err)
-				continue
-			}
+			s.log.Warn("Failed to accept connection", "err", err)
+			continue
 		}
 
-		// Track active connection
+		// Track active connection, unless the server is shutting down
+		s.connsMu.Lock()
+		if s.shuttingDown() {
+			s.connsMu.Unlock()
+			conn.Close()
+			return
+		}
+		cfg := s.handler.Config()
+		if cfg.ProtectedMode && !isLocal(conn) {
+			s.connsMu.Unlock()
+			go s.rejectConnection(conn, "protected mode", protectedModeError)
+			continue
+		}
+		if len(s.conns) >= cfg.MaxClients {
+			s.connsMu.Unlock()
+			s.stats.rejected.Add(1)
+			go s.rejectConnection(conn, "max number of clients reached", "-ERR max number of clients reached\r\n")
+			continue
+		}
+		s.conns[conn] = struct{}{}
+		s.stats.connections.Add(1)
 		s.wg.Add(1)
+		s.connsMu.Unlock()
 		go s.handleConnection(conn)
 	}
 }
 
+// Sent to the clients from other hosts while in protected mode
+const protectedModeError = "-DENIED Medis is running in protected mode because protected mode is enabled and there is no authentication. " +
+	"In this mode connections are only accepted from the loopback interface and the Unix socket. " +
+	"If you want to connect from external computers to Medis you may adopt one of the following solutions: " +
+	"1) Just disable protected mode sending the command 'CONFIG SET protected-mode no' from the loopback interface " +
+	"by connecting to Medis from the same host the server is running, however MAKE SURE Medis is not publicly accessible from internet if you do so. " +
+	"2) Alternatively you can just disable the protected mode by editing the Medis configuration file, and setting the protected mode option to 'no', and then restarting the server. " +
+	"3) If you started the server manually just for testing, restart it with the '--protected-mode no' option. " +
+	"NOTE: You only need to do one of the above things in order for the server to start accepting connections from the outside.\r\n"
+
+// Tell a client refused at accept time why it is disconnected. Closing a
+// socket with unread input resets the connection, which may discard the
+// reply before the client reads it, so the input is drained first.
+func (s *Server) rejectConnection(conn net.Conn, reason, reply string) {
+	defer conn.Close()
+	logging.Verbose(s.log, "Rejected connection, "+reason, "addr", conn.RemoteAddr())
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte(reply)); err != nil {
+		return
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	io.Copy(io.Discard, io.LimitReader(conn, 64*1024))
+}
+
+// Whether the client connects from this host, over the loopback interface
+// or the Unix socket
+func isLocal(conn net.Conn) bool {
+	if _, ok := conn.(*net.UnixConn); ok {
+		return true
+	}
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	return ok && addr.IP.IsLoopback()
+}
+
+func (s *Server) removeConn(conn net.Conn) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	delete(s.conns, conn)
+}
+
+// closeConnections stops accepting connections and closes the open ones.
+// Idle connections are closed right away, the others once their command is
+// done, or after shutdown-timeout at the latest. There is no persistence to
+// flush and there are no replicas to wait for.
+func (s *Server) closeConnections() {
+	s.log.Warn("Shutting down server")
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+
+	// Connections waiting for a command stop reading, and the clients
+	// blocked or paused are released
+	s.connsMu.Lock()
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.connsMu.Unlock()
+	s.handler.Shutdown()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	timeout := s.handler.Config().ShutdownTimeout
+	if s.shutdownNow.Load() {
+		timeout = 0
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		s.log.Warn("Closing connections still busy after the shutdown timeout", "timeout", timeout)
+		s.connsMu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.connsMu.Unlock()
+		<-done
+	}
+	s.log.Info("Server shutdown complete")
+}
+
+// Run the handler background tasks until the server stops, through the
+// executor so the event loop stays the only one touching the keyspace
+func (s *Server) cron(ctx context.Context) {
+	ticker := time.NewTicker(cronPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.executor.Cron(cronPeriod)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 // Handles a single client connection
 func (s *Server) handleConnection(conn net.Conn) {
 	defer s.wg.Done() // Decrement WaitGroup when function exits
-	defer conn.Close()
+	defer s.removeConn(conn)
+	cfg := s.handler.Config()
+	if tcp, ok := conn.(*net.TCPConn); ok && cfg.TCPKeepAlive > 0 {
+		tcp.SetKeepAlive(true)
+		tcp.SetKeepAlivePeriod(cfg.TCPKeepAlive)
+	}
+	_, unixSocket := conn.(*net.UnixConn)
+	conn = &countingConn{Conn: conn, stats: &s.stats}
+	c := newClient(conn, &cfg)
+
+	// Other connections may reach the client as soon as it is registered
+	hooks := command.Conn{
+		Push:    c.push,
+		Close:   func() { conn.Close() },
+		Buffers: c.buffers,
+	}
+	if unixSocket {
+		c.state = s.handler.NewUnixClient(cfg.UnixSocket, hooks)
+	} else {
+		c.state = s.handler.NewClient(conn.RemoteAddr().String(), conn.LocalAddr().String(), hooks)
+	}
+	defer s.handler.RemoveClient(c.state)
 
-	log.Printf("New connection from %s", conn.RemoteAddr())
+	logging.Verbose(s.log, "Accepted connection", "addr", c.state.Addr)
 
-	// Example: Simple echo server
-	reader := bufio.NewReader(conn)
 	for {
+		// Idle clients are disconnected after timeout, except the ones
+		// waiting for pushed messages. Shutting down sets a deadline that
+		// must not be overwritten.
+		cfg := s.handler.Config()
+		idle := cfg.Timeout > 0 && !c.state.IsSubscribed() && !c.state.IsMonitor()
+		if idle {
+			conn.SetReadDeadline(time.Now().Add(cfg.Timeout))
+			if s.shuttingDown() {
+				break
+			}
+		}
+
 		// Read the incommig command
-		data, err := command.ReadCommand(reader)
+		data, err := command.ReadCommand(c.reader, cfg.ProtoMaxBulkLen)
+		var protoErr *command.ProtocolError
+		switch {
+		case errors.As(err, &protoErr):
+			logging.Verbose(s.log, "Protocol error from client", "addr", conn.RemoteAddr(), "err", err)
+			c.queue([]byte("-ERR " + err.Error() + "\r\n"))
+		case idle && errors.Is(err, os.ErrDeadlineExceeded) && !s.shuttingDown():
+			logging.Verbose(s.log, "Closing idle client", "addr", conn.RemoteAddr())
+		case err != nil:
+			logging.Verbose(s.log, "Client closed connection", "addr", conn.RemoteAddr(), "err", err)
+		}
 		if err != nil {
-			log.Printf("Failed to read command: %v", err)
 			break
 		}
+		if idle {
+			conn.SetReadDeadline(time.Time{})
+		}
 
 		// Parse command
 		cmd, err := command.ParseCommand(data)
 		if err != nil {
-			log.Printf("Failed to parse command: %v", err)
+			logging.Verbose(s.log, "Protocol error from client", "addr", conn.RemoteAddr(), "err", err)
 			break
 		}
 
-		// Handle the command
-		respData := s.handler.Handle(cmd)
+		c.queryBuffered.Store(int64(c.reader.Buffered()))
 
-		// Write the response back to the client
-		_, err = conn.Write(respData.Encode())
-		if err != nil {
-			log.Printf("Failed to write response: %v", err)
+		// Handle the command, once CLIENT PAUSE lets it through
+		s.handler.WaitUnpaused(c.state, cmd)
+		if s.shuttingDown() {
+			break
+		}
+		respData := s.executor.Execute(c.state, cmd)
+		if c.state.IsBlocked() {
+			respData = c.waitUnblocked(s.handler)
+		}
+
+		// Commands running when the server shuts down get no reply, like
+		// SHUTDOWN itself
+		if s.shuttingDown() {
+			break
+		}
+
+		// Subscribed clients are subject to the pubsub limits, monitors to
+		// the replica ones
+		class := config.ClientClassNormal
+		switch {
+		case c.state.IsMonitor():
+			class = config.ClientClassReplica
+		case c.state.IsSubscribed():
+			class = config.ClientClassPubSub
+		}
+		if class != c.class {
+			c.setClass(class, s.handler.Config().ClientOutputBufferLimit[class])
+		}
+
+		// Queue the response, slow consumers get disconnected
+		if err := c.queue(respData.Encode()); err != nil {
+			s.log.Warn("Closing client", "addr", conn.RemoteAddr(), "err", err, "class", c.class)
+			c.abort()
+			return
+		}
+
+		// A client killing itself gets its reply before the connection closes
+		if c.state.CloseAfterReply() {
 			break
 		}
+
+		// Write the replies once every pipelined command has been handled
+		if c.reader.Buffered() == 0 {
+			c.flush()
+		}
 	}
+
+	c.close()
 }
@@ -0,0 +1,433 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmnalaka/medis/internal/config"
+)
+
+// Start a server on a free port, returning its address and the result of
+// Start once it returns
+func startServer(t *testing.T, ctx context.Context, cfg *config.Config) (string, <-chan error) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Port = l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- NewServer(cfg).Start(ctx) }()
+
+	addr := "127.0.0.1:" + strconv.Itoa(cfg.Port)
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return addr, done
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("server did not start")
+	return "", nil
+}
+
+// dial connects and sends the commands given as inline RESP arrays
+func dial(t *testing.T, addr string, commands ...string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range commands {
+		if _, err := conn.Write([]byte(cmd)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return conn, bufio.NewReader(conn)
+}
+
+func expectClosed(t *testing.T, r *bufio.Reader) {
+	t.Helper()
+	if line, err := r.ReadString('\n'); err != io.EOF {
+		t.Errorf("got %q, %v, want the connection closed", line, err)
+	}
+}
+
+func waitStopped(t *testing.T, done <-chan error, within time.Duration) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(within):
+		t.Fatal("server did not shut down")
+	}
+}
+
+func TestServer_ShutdownCommand(t *testing.T) {
+	for _, mode := range executionModes {
+		t.Run(mode, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.ExecutionMode = mode
+			addr, done := startServer(t, context.Background(), cfg)
+
+			idle, idleReader := dial(t, addr, "*1\r\n$4\r\nPING\r\n")
+			defer idle.Close()
+			if line, _ := idleReader.ReadString('\n'); line != "+PONG\r\n" {
+				t.Fatalf("got %q", line)
+			}
+			blocked, blockedReader := dial(t, addr, "*3\r\n$5\r\nBLPOP\r\n$4\r\nlist\r\n$1\r\n0\r\n")
+			defer blocked.Close()
+
+			admin, adminReader := dial(t, addr, "*2\r\n$8\r\nSHUTDOWN\r\n$4\r\nSAVE\r\n")
+			defer admin.Close()
+			if line, _ := adminReader.ReadString('\n'); line != "-ERR Errors trying to SHUTDOWN. Check logs.\r\n" {
+				t.Fatalf("got %q, want SAVE to fail", line)
+			}
+			admin.Write([]byte("*1\r\n$8\r\nSHUTDOWN\r\n"))
+
+			// Idle and blocked clients do not hold the shutdown back
+			waitStopped(t, done, 2*time.Second)
+			expectClosed(t, adminReader)
+			expectClosed(t, idleReader)
+			expectClosed(t, blockedReader)
+		})
+	}
+}
+
+func TestServer_ShutdownOnCancel(t *testing.T) {
+	for _, mode := range executionModes {
+		t.Run(mode, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.ExecutionMode = mode
+			ctx, cancel := context.WithCancel(context.Background())
+			addr, done := startServer(t, ctx, cfg)
+
+			idle, idleReader := dial(t, addr)
+			defer idle.Close()
+			// A client paused for longer than the shutdown timeout
+			paused, pausedReader := dial(t, addr, "*3\r\n$6\r\nCLIENT\r\n$5\r\nPAUSE\r\n$6\r\n100000\r\n")
+			defer paused.Close()
+			if line, _ := pausedReader.ReadString('\n'); line != "+OK\r\n" {
+				t.Fatalf("got %q", line)
+			}
+			paused.Write([]byte("*2\r\n$3\r\nGET\r\n$1\r\nk\r\n"))
+			time.Sleep(20 * time.Millisecond)
+
+			cancel()
+			waitStopped(t, done, 2*time.Second)
+			expectClosed(t, idleReader)
+			expectClosed(t, pausedReader)
+		})
+	}
+}
+
+func TestServer_MaxClients(t *testing.T) {
+	cfg := config.Default()
+	cfg.MaxClients = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, _ := startServer(t, ctx, cfg)
+
+	// The connection startServer probed with may not be gone yet
+	var first net.Conn
+	for i := 0; i < 100; i++ {
+		conn, reader := dial(t, addr, "*1\r\n$4\r\nPING\r\n")
+		if line, _ := reader.ReadString('\n'); line == "+PONG\r\n" {
+			first = conn
+			break
+		}
+		conn.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if first == nil {
+		t.Fatal("no client got in")
+	}
+	defer first.Close()
+
+	second, secondReader := dial(t, addr)
+	defer second.Close()
+	if line, _ := secondReader.ReadString('\n'); line != "-ERR max number of clients reached\r\n" {
+		t.Fatalf("got %q", line)
+	}
+	expectClosed(t, secondReader)
+}
+
+func TestServer_IdleTimeout(t *testing.T) {
+	cfg := config.Default()
+	cfg.Timeout = 100 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, _ := startServer(t, ctx, cfg)
+
+	idle, idleReader := dial(t, addr)
+	defer idle.Close()
+	subscriber, subscriberReader := dial(t, addr, "*2\r\n$9\r\nSUBSCRIBE\r\n$2\r\nch\r\n")
+	defer subscriber.Close()
+	if line, _ := subscriberReader.ReadString('\n'); line != "*3\r\n" {
+		t.Fatalf("got %q", line)
+	}
+
+	start := time.Now()
+	expectClosed(t, idleReader)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("idle client closed after %v", elapsed)
+	}
+
+	// Subscribed clients wait for messages as long as they need
+	subscriber.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	subscriberReader.Discard(subscriberReader.Buffered())
+	if _, err := subscriberReader.ReadString('\n'); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("got %v, want the subscriber still connected", err)
+	}
+}
+
+func TestServer_ProtocolLimits(t *testing.T) {
+	cfg := config.Default()
+	cfg.ProtoMaxBulkLen = 1 << 20
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, _ := startServer(t, ctx, cfg)
+
+	for _, tc := range []struct {
+		request  string
+		expected string
+	}{
+		{"*2\r\n$3\r\nGET\r\n$2000000\r\n", "-ERR Protocol error: invalid bulk length\r\n"},
+		{"*2\r\n$3\r\nGET\r\n$-5\r\n", "-ERR Protocol error: invalid bulk length\r\n"},
+		{"*99999999999\r\n", "-ERR Protocol error: invalid multibulk length\r\n"},
+		{"*x\r\n", "-ERR Protocol error: invalid multibulk length\r\n"},
+		{"*1\r\n:1\r\n", "-ERR Protocol error: expected '$', got ':'\r\n"},
+		{"$2000000\r\n", "-ERR Protocol error: invalid bulk length\r\n"},
+		{"$-5\r\n", "-ERR Protocol error: invalid bulk length\r\n"},
+		// Lines over the limit are refused without waiting for their CRLF.
+		// They fill the read buffer exactly, so the server reads all of
+		// them and the connection closes cleanly.
+		{"+" + strings.Repeat("a", 1<<20+4095), "-ERR Protocol error: too big inline request\r\n"},
+		{":" + strings.Repeat("1", 1<<20+4095), "-ERR Protocol error: too big inline request\r\n"},
+	} {
+		conn, reader := dial(t, addr, tc.request)
+		if line, _ := reader.ReadString('\n'); line != tc.expected {
+			t.Errorf("%q: got %q, want %q", tc.request, line, tc.expected)
+		}
+		expectClosed(t, reader)
+		conn.Close()
+	}
+
+	// Empty and null arrays are skipped
+	conn, reader := dial(t, addr, "*0\r\n*-1\r\n*-5\r\n*1\r\n$4\r\nPING\r\n")
+	if line, _ := reader.ReadString('\n'); line != "+PONG\r\n" {
+		t.Errorf("got %q after empty arrays, want +PONG", line)
+	}
+	conn.Close()
+
+	// A huge count alone allocates nothing, the client can send its
+	// arguments
+	conn, reader = dial(t, addr, "*100000000\r\n")
+	defer conn.Close()
+	conn.Write([]byte("$4\r\nPING\r\n"))
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := reader.ReadString('\n'); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("got %v, want the server waiting for the arguments", err)
+	}
+}
+
+func TestServer_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "medis.sock")
+	// A socket left behind by a server that did not shut down cleanly
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	cfg := config.Default()
+	cfg.Port = 0
+	cfg.UnixSocket = path
+	cfg.UnixSocketPerm = 0o700
+	done := make(chan error, 1)
+	go func() { done <- NewServer(cfg).Start(context.Background()) }()
+
+	var conn net.Conn
+	for i := 0; i < 100; i++ {
+		if conn, err = net.Dial("unix", path); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("server did not start: %v", err)
+	}
+	defer conn.Close()
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o700 {
+		t.Errorf("got %v, %v, want the socket with permissions 0700", info, err)
+	}
+
+	conn.Write([]byte("*2\r\n$6\r\nCLIENT\r\n$4\r\nINFO\r\n"))
+	reader := bufio.NewReader(conn)
+	reader.ReadString('\n')
+	info, _ := reader.ReadString('\n')
+	for _, field := range []string{" addr=" + path + ":0 ", " laddr=" + path + ":0 ", " flags=U "} {
+		if !strings.Contains(info, field) {
+			t.Errorf("got %q, want it to contain %q", info, field)
+		}
+	}
+
+	conn.Write([]byte("*1\r\n$8\r\nSHUTDOWN\r\n"))
+	waitStopped(t, done, 2*time.Second)
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v, want the socket removed on shutdown", err)
+	}
+}
+
+func TestServer_UnixSocketNotASocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "medis.sock")
+	if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Default()
+	cfg.Port = 0
+	cfg.UnixSocket = path
+	if err := NewServer(cfg).Start(context.Background()); err == nil {
+		t.Error("expected error for a file that is not a socket")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "data" {
+		t.Errorf("got %q, want the file left alone", data)
+	}
+}
+
+func TestServer_Bind(t *testing.T) {
+	cfg := config.Default()
+	// Addresses of TEST-NET-2 are assigned to no host
+	cfg.Bind = []string{"127.0.0.1", "-198.51.100.1"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, _ := startServer(t, ctx, cfg)
+
+	conn, reader := dial(t, addr, "*1\r\n$4\r\nPING\r\n")
+	defer conn.Close()
+	if line, _ := reader.ReadString('\n'); line != "+PONG\r\n" {
+		t.Errorf("got %q", line)
+	}
+
+	unavailable := config.Default()
+	unavailable.Port = cfg.Port + 1
+	unavailable.Bind = []string{"198.51.100.1"}
+	if err := NewServer(unavailable).Start(context.Background()); err == nil {
+		t.Error("expected error for an unavailable address")
+	}
+}
+
+// externalIP returns an IPv4 address of an interface besides the loopback
+// one. Clients connecting to it do not come from the loopback interface.
+func externalIP(t *testing.T) net.IP {
+	t.Helper()
+	addrs, _ := net.InterfaceAddrs()
+	for _, a := range addrs {
+		if ip, ok := a.(*net.IPNet); ok && ip.IP.To4() != nil && !ip.IP.IsLoopback() {
+			return ip.IP
+		}
+	}
+	t.Skip("no interface besides the loopback one")
+	return nil
+}
+
+func TestServer_ProtectedMode(t *testing.T) {
+	external := externalIP(t)
+
+	cfg := config.Default()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, _ := startServer(t, ctx, cfg)
+	externalAddr := net.JoinHostPort(external.String(), strconv.Itoa(cfg.Port))
+
+	conn, reader := dial(t, externalAddr, "*1\r\n$4\r\nPING\r\n")
+	defer conn.Close()
+	if line, _ := reader.ReadString('\n'); !strings.HasPrefix(line, "-DENIED Medis is running in protected mode") {
+		t.Fatalf("got %q, want the client denied", line)
+	}
+	expectClosed(t, reader)
+
+	local, localReader := dial(t, addr, "*4\r\n$6\r\nCONFIG\r\n$3\r\nSET\r\n$14\r\nprotected-mode\r\n$2\r\nno\r\n")
+	defer local.Close()
+	if line, _ := localReader.ReadString('\n'); line != "+OK\r\n" {
+		t.Fatalf("got %q", line)
+	}
+	conn, reader = dial(t, externalAddr, "*1\r\n$4\r\nPING\r\n")
+	defer conn.Close()
+	if line, _ := reader.ReadString('\n'); line != "+PONG\r\n" {
+		t.Errorf("got %q, want the client accepted", line)
+	}
+}
+
+// Connections are set up before the other connections can see them, so
+// CLIENT LIST, CLIENT KILL and PUBLISH do not race with new connections.
+// Run with -race.
+func TestServer_ClientCommandsWhileConnecting(t *testing.T) {
+	cfg := config.Default()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, _ := startServer(t, ctx, cfg)
+
+	stop := make(chan struct{})
+	connecting := make(chan struct{})
+	go func() {
+		defer close(connecting)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if conn, err := net.Dial("tcp", addr); err == nil {
+				conn.Write([]byte("*2\r\n$9\r\nSUBSCRIBE\r\n$2\r\nch\r\n"))
+				conn.Close()
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-connecting
+	}()
+
+	admin, reader := dial(t, addr)
+	defer admin.Close()
+	commands := []string{
+		"*2\r\n$6\r\nCLIENT\r\n$4\r\nLIST\r\n",
+		"*3\r\n$7\r\nPUBLISH\r\n$2\r\nch\r\n$1\r\nm\r\n",
+		"*6\r\n$6\r\nCLIENT\r\n$4\r\nKILL\r\n$4\r\nTYPE\r\n$6\r\npubsub\r\n$6\r\nSKIPME\r\n$3\r\nyes\r\n",
+		"*6\r\n$6\r\nCLIENT\r\n$4\r\nKILL\r\n$4\r\nTYPE\r\n$6\r\nnormal\r\n$6\r\nSKIPME\r\n$3\r\nyes\r\n",
+	}
+	for deadline := time.Now().Add(500 * time.Millisecond); time.Now().Before(deadline); {
+		for _, cmd := range commands {
+			admin.Write([]byte(cmd))
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Skip the client list
+			if n, err := strconv.Atoi(strings.TrimSpace(line[1:])); line[0] == '$' && err == nil {
+				if _, err := io.CopyN(io.Discard, reader, int64(n)+2); err != nil {
+					t.Fatal(err)
+				}
+			} else if line[0] != ':' {
+				t.Fatalf("got %q", line)
+			}
+		}
+	}
+}
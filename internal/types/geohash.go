@@ -0,0 +1,362 @@
+package types
+
+import "math"
+
+// Geohash parameters, identical to Redis so sorted set scores written by
+// GEOADD can be exchanged with it
+const (
+	GeoStepMax = 26 // Each coordinate is encoded with 26 bits, 52 bits total
+
+	GeoLonMin = -180.0
+	GeoLonMax = 180.0
+	// Limits of the EPSG:3857 web mercator projection
+	GeoLatMin = -85.05112878
+	GeoLatMax = 85.05112878
+
+	earthRadius = 6372797.560856 // Meters
+	mercatorMax = 20037726.37
+)
+
+// The standard geohash alphabet, with its latitude range of -90 to 90
+const (
+	geoAlphabet      = "0123456789bcdefghjkmnpqrstuvwxyz"
+	geoStdLatMin     = -90.0
+	geoStdLatMax     = 90.0
+	geoHashStringLen = 11
+)
+
+// GeoHash is an interleaved geohash of step bits per coordinate. Latitude
+// bits are in the even positions and longitude bits in the odd positions.
+type GeoHash struct {
+	Bits uint64
+	Step uint
+}
+
+// IsZero reports whether the hash was cleared from a search
+func (h GeoHash) IsZero() bool {
+	return h.Bits == 0 && h.Step == 0
+}
+
+// ScoreRange returns the range of the full precision scores falling in the
+// area of the hash, min inclusive and max exclusive
+func (h GeoHash) ScoreRange() (uint64, uint64) {
+	shift := 2 * (GeoStepMax - h.Step)
+	return h.Bits << shift, (h.Bits + 1) << shift
+}
+
+type geoArea struct {
+	minLon, maxLon float64
+	minLat, maxLat float64
+}
+
+// Spread the 32 bits of v to the even positions of a 64 bits integer
+func spreadBits(v uint32) uint64 {
+	x := uint64(v)
+	x = (x | x<<16) & 0x0000ffff0000ffff
+	x = (x | x<<8) & 0x00ff00ff00ff00ff
+	x = (x | x<<4) & 0x0f0f0f0f0f0f0f0f
+	x = (x | x<<2) & 0x3333333333333333
+	x = (x | x<<1) & 0x5555555555555555
+	return x
+}
+
+// Gather the even bits of x, the inverse of spreadBits
+func squashBits(x uint64) uint32 {
+	x &= 0x5555555555555555
+	x = (x | x>>1) & 0x3333333333333333
+	x = (x | x>>2) & 0x0f0f0f0f0f0f0f0f
+	x = (x | x>>4) & 0x00ff00ff00ff00ff
+	x = (x | x>>8) & 0x0000ffff0000ffff
+	x = (x | x>>16) & 0x00000000ffffffff
+	return uint32(x)
+}
+
+// ValidCoordinates reports whether lon and lat can be indexed
+func ValidCoordinates(lon, lat float64) bool {
+	return lon >= GeoLonMin && lon <= GeoLonMax && lat >= GeoLatMin && lat <= GeoLatMax
+}
+
+func geoEncode(lon, lat, latMin, latMax float64, step uint) GeoHash {
+	latOffset := (lat - latMin) / (latMax - latMin)
+	lonOffset := (lon - GeoLonMin) / (GeoLonMax - GeoLonMin)
+
+	// Convert to fixed point based on the step
+	latOffset *= float64(uint64(1) << step)
+	lonOffset *= float64(uint64(1) << step)
+	return GeoHash{
+		Bits: spreadBits(uint32(latOffset)) | spreadBits(uint32(lonOffset))<<1,
+		Step: step,
+	}
+}
+
+func geoDecode(h GeoHash) geoArea {
+	lat := float64(squashBits(h.Bits))
+	lon := float64(squashBits(h.Bits >> 1))
+	cells := float64(uint64(1) << h.Step)
+	return geoArea{
+		minLat: GeoLatMin + lat/cells*(GeoLatMax-GeoLatMin),
+		maxLat: GeoLatMin + (lat+1)/cells*(GeoLatMax-GeoLatMin),
+		minLon: GeoLonMin + lon/cells*(GeoLonMax-GeoLonMin),
+		maxLon: GeoLonMin + (lon+1)/cells*(GeoLonMax-GeoLonMin),
+	}
+}
+
+// GeoEncode returns the 52 bits geohash of a position, used as its score.
+// The coordinates must be valid.
+func GeoEncode(lon, lat float64) uint64 {
+	return geoEncode(lon, lat, GeoLatMin, GeoLatMax, GeoStepMax).Bits
+}
+
+// GeoDecode returns the position at the center of the area of a 52 bits
+// geohash
+func GeoDecode(bits uint64) (float64, float64) {
+	area := geoDecode(GeoHash{Bits: bits, Step: GeoStepMax})
+	lon := max(GeoLonMin, min(GeoLonMax, (area.minLon+area.maxLon)/2))
+	lat := max(GeoLatMin, min(GeoLatMax, (area.minLat+area.maxLat)/2))
+	return lon, lat
+}
+
+// GeoHashString returns the standard 11 characters geohash of a position.
+// The index uses the latitude range of the mercator projection, so the
+// position is encoded again with the standard range of -90 to 90.
+func GeoHashString(lon, lat float64) string {
+	bits := geoEncode(lon, lat, geoStdLatMin, geoStdLatMax, GeoStepMax).Bits
+	buf := make([]byte, geoHashStringLen)
+	for i := range buf {
+		// Only 52 bits are available, the last character is always 0
+		idx := 0
+		if i < geoHashStringLen-1 {
+			idx = int(bits>>(52-(i+1)*5)) & 0x1f
+		}
+		buf[i] = geoAlphabet[idx]
+	}
+	return string(buf)
+}
+
+func degToRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radToDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// Distance in meters between two latitudes on the same meridian
+func geoLatDistance(lat1, lat2 float64) float64 {
+	return earthRadius * math.Abs(degToRad(lat2)-degToRad(lat1))
+}
+
+// GeoDistance returns the distance in meters between two positions, using
+// the haversine formula
+func GeoDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	v := math.Sin((degToRad(lon2) - degToRad(lon1)) / 2)
+	if v == 0 {
+		return geoLatDistance(lat1, lat2)
+	}
+	lat1r, lat2r := degToRad(lat1), degToRad(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// GeoShape is the area of a search, a circle of Radius meters or a box of
+// Width by Height meters when IsBox is set, centered on Lon and Lat
+type GeoShape struct {
+	Lon, Lat      float64
+	IsBox         bool
+	Radius        float64
+	Width, Height float64
+}
+
+// Contains reports whether a position is in the shape, and its distance in
+// meters from the center
+func (s *GeoShape) Contains(lon, lat float64) (float64, bool) {
+	if !s.IsBox {
+		distance := GeoDistance(s.Lon, s.Lat, lon, lat)
+		return distance, distance <= s.Radius
+	}
+
+	// The latitude distance is cheaper, check it first
+	if geoLatDistance(lat, s.Lat) > s.Height/2 {
+		return 0, false
+	}
+	if GeoDistance(lon, lat, s.Lon, lat) > s.Width/2 {
+		return 0, false
+	}
+	return GeoDistance(s.Lon, s.Lat, lon, lat), true
+}
+
+// Bounding box of the shape as minimum and maximum longitude and latitude
+func (s *GeoShape) boundingBox() geoArea {
+	height, width := s.Radius, s.Radius
+	if s.IsBox {
+		height, width = s.Height/2, s.Width/2
+	}
+
+	latDelta := radToDeg(height / earthRadius)
+	lonDeltaTop := radToDeg(width / earthRadius / math.Cos(degToRad(s.Lat+latDelta)))
+	lonDeltaBottom := radToDeg(width / earthRadius / math.Cos(degToRad(s.Lat-latDelta)))
+
+	// The box is widest on the side closest to the equator
+	lonDelta := lonDeltaTop
+	if s.Lat < 0 {
+		lonDelta = lonDeltaBottom
+	}
+	return geoArea{
+		minLon: s.Lon - lonDelta,
+		maxLon: s.Lon + lonDelta,
+		minLat: s.Lat - latDelta,
+		maxLat: s.Lat + latDelta,
+	}
+}
+
+// Estimate the step of the smallest geohash cells still covering the radius
+// with the cell of the center and its neighbors
+func geoStepsByRadius(radius, lat float64) uint {
+	if radius == 0 {
+		return GeoStepMax
+	}
+	step := 1
+	for radius < mercatorMax {
+		radius *= 2
+		step++
+	}
+	// Make sure the range is included in most of the base cases
+	step -= 2
+
+	// Cells are narrower close to the poles
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+	return uint(max(1, min(GeoStepMax, step)))
+}
+
+// Move the hash by d cells along the longitude
+func (h *GeoHash) moveX(d int) {
+	if d == 0 {
+		return
+	}
+	x := h.Bits & 0xaaaaaaaaaaaaaaaa
+	y := h.Bits & 0x5555555555555555
+	zz := uint64(0x5555555555555555) >> (64 - h.Step*2)
+	if d > 0 {
+		x += zz + 1
+	} else {
+		x |= zz
+		x -= zz + 1
+	}
+	x &= 0xaaaaaaaaaaaaaaaa >> (64 - h.Step*2)
+	h.Bits = x | y
+}
+
+// Move the hash by d cells along the latitude
+func (h *GeoHash) moveY(d int) {
+	if d == 0 {
+		return
+	}
+	x := h.Bits & 0xaaaaaaaaaaaaaaaa
+	y := h.Bits & 0x5555555555555555
+	zz := uint64(0xaaaaaaaaaaaaaaaa) >> (64 - h.Step*2)
+	if d > 0 {
+		y += zz + 1
+	} else {
+		y |= zz
+		y -= zz + 1
+	}
+	y &= 0x5555555555555555 >> (64 - h.Step*2)
+	h.Bits = x | y
+}
+
+// The neighbor cells, in the order Redis scans them
+const (
+	geoNorth = iota
+	geoSouth
+	geoEast
+	geoWest
+	geoNorthEast
+	geoNorthWest
+	geoSouthEast
+	geoSouthWest
+)
+
+var geoNeighborMoves = [...][2]int{
+	geoNorth:     {0, 1},
+	geoSouth:     {0, -1},
+	geoEast:      {1, 0},
+	geoWest:      {-1, 0},
+	geoNorthEast: {1, 1},
+	geoNorthWest: {-1, 1},
+	geoSouthEast: {1, -1},
+	geoSouthWest: {-1, -1},
+}
+
+func geoNeighbors(h GeoHash) [len(geoNeighborMoves)]GeoHash {
+	var neighbors [len(geoNeighborMoves)]GeoHash
+	for i, move := range geoNeighborMoves {
+		neighbors[i] = h
+		neighbors[i].moveX(move[0])
+		neighbors[i].moveY(move[1])
+	}
+	return neighbors
+}
+
+// SearchAreas returns the geohash cells covering the shape: the cell of the
+// center followed by its neighbors, leaving out those outside the bounding
+// box and duplicates of the previous cell.
+func (s *GeoShape) SearchAreas() []GeoHash {
+	bounds := s.boundingBox()
+	radius := s.Radius
+	if s.IsBox {
+		radius = math.Hypot(s.Width/2, s.Height/2)
+	}
+
+	steps := geoStepsByRadius(radius, s.Lat)
+	hash := geoEncode(s.Lon, s.Lat, GeoLatMin, GeoLatMax, steps)
+	neighbors := geoNeighbors(hash)
+
+	// Use larger cells when the neighbors don't cover the bounding box
+	north := geoDecode(neighbors[geoNorth])
+	south := geoDecode(neighbors[geoSouth])
+	east := geoDecode(neighbors[geoEast])
+	west := geoDecode(neighbors[geoWest])
+	if steps > 1 && (north.maxLat < bounds.maxLat || south.minLat > bounds.minLat ||
+		east.maxLon < bounds.maxLon || west.minLon > bounds.minLon) {
+		steps--
+		hash = geoEncode(s.Lon, s.Lat, GeoLatMin, GeoLatMax, steps)
+		neighbors = geoNeighbors(hash)
+	}
+
+	// Exclude the neighbors entirely outside the bounding box
+	if steps >= 2 {
+		area := geoDecode(hash)
+		exclude := func(directions ...int) {
+			for _, d := range directions {
+				neighbors[d] = GeoHash{}
+			}
+		}
+		if area.minLat < bounds.minLat {
+			exclude(geoSouth, geoSouthWest, geoSouthEast)
+		}
+		if area.maxLat > bounds.maxLat {
+			exclude(geoNorth, geoNorthEast, geoNorthWest)
+		}
+		if area.minLon < bounds.minLon {
+			exclude(geoWest, geoSouthWest, geoNorthWest)
+		}
+		if area.maxLon > bounds.maxLon {
+			exclude(geoEast, geoSouthEast, geoNorthEast)
+		}
+	}
+
+	// With huge radiuses adjacent neighbors can be the same cell
+	areas := []GeoHash{hash}
+	for _, neighbor := range neighbors {
+		if !neighbor.IsZero() && neighbor != areas[len(areas)-1] {
+			areas = append(areas, neighbor)
+		}
+	}
+	return areas
+}
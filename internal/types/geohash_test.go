@@ -0,0 +1,71 @@
+package types
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGeoEncodeDecode(t *testing.T) {
+	tests := []struct {
+		lon, lat float64
+		hash     string
+	}{
+		{13.361389, 38.115556, "sqc8b49rny0"},
+		{15.087269, 37.502669, "sqdtr74hyu0"},
+		{0, 0, "s0000000000"},
+	}
+
+	for _, tt := range tests {
+		lon, lat := GeoDecode(GeoEncode(tt.lon, tt.lat))
+		if math.Abs(lon-tt.lon) > 1e-5 || math.Abs(lat-tt.lat) > 1e-5 {
+			t.Errorf("%v,%v: decoded to %v,%v", tt.lon, tt.lat, lon, lat)
+		}
+		if got := GeoHashString(lon, lat); got != tt.hash {
+			t.Errorf("%v,%v: got %q, want %q", tt.lon, tt.lat, got, tt.hash)
+		}
+	}
+}
+
+func TestGeoShape_SearchAreas(t *testing.T) {
+	shapes := []GeoShape{
+		{Lon: 15, Lat: 37, Radius: 200000},
+		{Lon: 179.9, Lat: -70, Radius: 50000},
+		{Lon: 2.35, Lat: 48.85, IsBox: true, Width: 3000, Height: 1000},
+	}
+
+	// Every position in the shape must be in one of the areas
+	for _, s := range shapes {
+		areas := s.SearchAreas()
+		for i := 0; i < 1000; i++ {
+			angle := float64(i) * 2 * math.Pi / 1000
+			lon := s.Lon + math.Cos(angle)*radToDeg(s.Radius/earthRadius)
+			lat := s.Lat + math.Sin(angle)*radToDeg(s.Radius/earthRadius)
+			if s.IsBox {
+				lon, lat = s.Lon+math.Cos(angle)*0.01, s.Lat+math.Sin(angle)*0.004
+			}
+			if _, ok := s.Contains(lon, lat); !ok || !ValidCoordinates(lon, lat) {
+				continue
+			}
+
+			score := GeoEncode(lon, lat)
+			found := false
+			for _, area := range areas {
+				min, max := area.ScoreRange()
+				found = found || (score >= min && score < max)
+			}
+			if !found {
+				t.Fatalf("%+v: position %v,%v is not covered", s, lon, lat)
+			}
+		}
+	}
+}
+
+func TestGeoDistance(t *testing.T) {
+	d := GeoDistance(13.361389, 38.115556, 15.087269, 37.502669)
+	if math.Abs(d-166274.15) > 1 {
+		t.Errorf("got %v, want about 166274", d)
+	}
+	if d := GeoDistance(10, 10, 10, 11); math.Abs(d-geoLatDistance(10, 11)) > 1e-6 {
+		t.Errorf("got %v on a meridian", d)
+	}
+}
@@ -0,0 +1,65 @@
+package types
+
+import "sort"
+
+// Hash maps fields to values. Values are never modified in place, so they
+// can be shared with replies and copies.
+type Hash struct {
+	fields map[string][]byte
+}
+
+// NewHash creates an empty hash
+func NewHash() *Hash {
+	return &Hash{fields: make(map[string][]byte)}
+}
+
+// Len returns the number of fields
+func (h *Hash) Len() int {
+	return len(h.fields)
+}
+
+// Get returns the value of field
+func (h *Hash) Get(field string) ([]byte, bool) {
+	value, ok := h.fields[field]
+	return value, ok
+}
+
+// Set stores value under field and reports whether the field is new
+func (h *Hash) Set(field string, value []byte) bool {
+	_, exists := h.fields[field]
+	h.fields[field] = value
+	return !exists
+}
+
+// Delete removes field and reports whether it was there
+func (h *Hash) Delete(field string) bool {
+	if _, ok := h.fields[field]; !ok {
+		return false
+	}
+	delete(h.fields, field)
+	return true
+}
+
+// Fields returns the field names in ascending order
+func (h *Hash) Fields() []string {
+	fields := make([]string, 0, len(h.fields))
+	for field := range h.fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Clone returns a copy of the hash sharing its values
+func (h *Hash) Clone() *Hash {
+	clone := &Hash{fields: make(map[string][]byte, len(h.fields))}
+	for field, value := range h.fields {
+		clone.fields[field] = value
+	}
+	return clone
+}
+
+// Clear removes every field
+func (h *Hash) Clear() {
+	h.fields = make(map[string][]byte)
+}
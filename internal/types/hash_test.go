@@ -0,0 +1,28 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	h := NewHash()
+	if !h.Set("b", []byte("1")) || !h.Set("a", []byte("2")) || h.Set("b", []byte("3")) {
+		t.Fatal("expected a and b to be new once")
+	}
+	if value, ok := h.Get("b"); !ok || string(value) != "3" {
+		t.Errorf("got %q, want 3", value)
+	}
+
+	clone := h.Clone()
+	if !h.Delete("a") || h.Delete("a") {
+		t.Error("expected a single successful delete")
+	}
+
+	if got := clone.Fields(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("got %q, want [a b]", got)
+	}
+	if h.Len() != 1 {
+		t.Errorf("got len %d, want 1", h.Len())
+	}
+}
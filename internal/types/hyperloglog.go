@@ -0,0 +1,581 @@
+package types
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+	"strings"
+)
+
+// HyperLogLog parameters and layout, identical to Redis so values can be
+// exchanged with it as plain strings
+const (
+	hllP         = 14             // Bits of the hash used to select a register
+	hllQ         = 64 - hllP      // Bits of the hash used to count leading zeros
+	HLLRegisters = 1 << hllP      // Number of registers, 16384
+	hllBits      = 6              // Bits per register in the dense encoding
+	hllRegMax    = 1<<hllBits - 1 // Largest register value
+	hllHdrSize   = 16
+	hllDenseSize = hllHdrSize + (HLLRegisters*hllBits+7)/8
+
+	hllDense  = 0
+	hllSparse = 1
+
+	// Sparse opcodes: ZERO 00xxxxxx, XZERO 01xxxxxx xxxxxxxx, VAL 1vvvvvxx
+	hllSparseXZeroBit    = 0x40
+	hllSparseValBit      = 0x80
+	hllSparseValMaxValue = 32
+	hllSparseValMaxLen   = 4
+	hllSparseZeroMaxLen  = 64
+	hllAlphaInf          = 0.721347520444481703680 // 0.5/ln(2)
+	hllSelfTestElements  = 1000000
+)
+
+// HLLSparseMaxBytes is the size above which a sparse HyperLogLog is
+// converted to the dense encoding
+var HLLSparseMaxBytes = 3000
+
+// ErrInvalidHLL is returned when a HyperLogLog has a corrupted encoding
+var ErrInvalidHLL = errors.New("corrupted HLL object")
+
+// HyperLogLog is the string representation of a HyperLogLog used by Redis: a
+// 16 bytes header ("HYLL", the encoding, 3 unused bytes and the cached
+// cardinality in little endian, invalid when its most significant bit is
+// set) followed by the registers, either sparse or dense.
+type HyperLogLog []byte
+
+// NewHyperLogLog returns an empty sparse HyperLogLog
+func NewHyperLogLog() HyperLogLog {
+	h := make(HyperLogLog, hllHdrSize, hllHdrSize+2)
+	copy(h, "HYLL")
+	h[4] = hllSparse
+	// A single XZERO opcode covers every register
+	return append(h, hllSparseXZeroBit|byte((HLLRegisters-1)>>8), byte((HLLRegisters-1)&0xff))
+}
+
+// Valid reports whether the header is the one of a HyperLogLog
+func (h HyperLogLog) Valid() bool {
+	if len(h) < hllHdrSize || string(h[:4]) != "HYLL" || h[4] > hllSparse {
+		return false
+	}
+	return h[4] != hllDense || len(h) == hllDenseSize
+}
+
+// IsSparse reports whether the registers use the sparse encoding
+func (h HyperLogLog) IsSparse() bool {
+	return h[4] == hllSparse
+}
+
+// CachedCount returns the cardinality cached in the header, if still valid
+func (h HyperLogLog) CachedCount() (uint64, bool) {
+	if h[15]&0x80 != 0 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(h[8:16]), true
+}
+
+// SetCachedCount stores the cardinality in the header
+func (h HyperLogLog) SetCachedCount(count uint64) {
+	binary.LittleEndian.PutUint64(h[8:16], count)
+}
+
+// InvalidateCache marks the cached cardinality as stale
+func (h HyperLogLog) InvalidateCache() {
+	h[15] |= 0x80
+}
+
+// MurmurHash64A with the byte order of little endian machines, as used by
+// Redis whatever the platform
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ uint64(len(key))*m
+
+	n := len(key) &^ 7
+	for i := 0; i < n; i += 8 {
+		k := binary.LittleEndian.Uint64(key[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+	}
+
+	tail := key[n:]
+	if len(tail) > 0 {
+		for i := len(tail) - 1; i >= 0; i-- {
+			h ^= uint64(tail[i]) << (8 * i)
+		}
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// Return the register an element maps to, and the length of the run of
+// zeros of its hash plus one
+func hllPatLen(element []byte) (int, uint8) {
+	hash := murmurHash64A(element, 0xadc83b19)
+	index := int(hash & (HLLRegisters - 1))
+	hash >>= hllP
+	hash |= 1 << hllQ // The count is at most hllQ+1
+	return index, uint8(bits.TrailingZeros64(hash) + 1)
+}
+
+// Registers are packed 6 bits each, least significant bits first
+func denseGet(registers []byte, index int) uint8 {
+	byteIndex := index * hllBits / 8
+	fb := uint(index * hllBits & 7)
+	b0 := uint(registers[byteIndex])
+	var b1 uint
+	if byteIndex+1 < len(registers) {
+		b1 = uint(registers[byteIndex+1])
+	}
+	return uint8((b0>>fb | b1<<(8-fb)) & hllRegMax)
+}
+
+func denseSet(registers []byte, index int, value uint8) {
+	byteIndex := index * hllBits / 8
+	fb := uint(index * hllBits & 7)
+	v := uint(value)
+	registers[byteIndex] &^= byte(hllRegMax << fb)
+	registers[byteIndex] |= byte(v << fb)
+	if byteIndex+1 < len(registers) {
+		registers[byteIndex+1] &^= byte(hllRegMax >> (8 - fb))
+		registers[byteIndex+1] |= byte(v >> (8 - fb))
+	}
+}
+
+// Set a dense register if count is greater, reporting whether it changed
+func denseSetMax(registers []byte, index int, count uint8) bool {
+	if denseGet(registers, index) < count {
+		denseSet(registers, index, count)
+		return true
+	}
+	return false
+}
+
+func sparseIsZero(b byte) bool  { return b&0xc0 == 0 }
+func sparseIsXZero(b byte) bool { return b&0xc0 == hllSparseXZeroBit }
+func sparseIsVal(b byte) bool   { return b&hllSparseValBit != 0 }
+func sparseZeroLen(b byte) int  { return int(b&0x3f) + 1 }
+func sparseValValue(b byte) int { return int(b>>2&0x1f) + 1 }
+func sparseValLen(b byte) int   { return int(b&0x3) + 1 }
+
+func sparseXZeroLen(b0, b1 byte) int {
+	return (int(b0&0x3f)<<8 | int(b1)) + 1
+}
+
+func sparseVal(value, length int) byte {
+	return byte((value-1)<<2|(length-1)) | hllSparseValBit
+}
+
+// Append a ZERO or XZERO opcode covering length registers
+func appendSparseZero(seq []byte, length int) []byte {
+	if length > hllSparseZeroMaxLen {
+		l := length - 1
+		return append(seq, byte(l>>8)|hllSparseXZeroBit, byte(l&0xff))
+	}
+	return append(seq, byte(length-1))
+}
+
+// Walk the sparse opcodes, calling fn with each run of registers
+func (h HyperLogLog) sparseRuns(fn func(first, length, value int)) error {
+	index := 0
+	for p := hllHdrSize; p < len(h); {
+		var length, value int
+		switch {
+		case sparseIsZero(h[p]):
+			length = sparseZeroLen(h[p])
+			p++
+		case sparseIsXZero(h[p]):
+			if p+1 >= len(h) {
+				return ErrInvalidHLL
+			}
+			length = sparseXZeroLen(h[p], h[p+1])
+			p += 2
+		default:
+			length, value = sparseValLen(h[p]), sparseValValue(h[p])
+			p++
+		}
+		if index+length > HLLRegisters {
+			return ErrInvalidHLL
+		}
+		fn(index, length, value)
+		index += length
+	}
+	if index != HLLRegisters {
+		return ErrInvalidHLL
+	}
+	return nil
+}
+
+// ToDense converts a sparse HyperLogLog to the dense encoding
+func (h *HyperLogLog) ToDense() error {
+	if !h.IsSparse() {
+		return nil
+	}
+	dense := make(HyperLogLog, hllDenseSize)
+	copy(dense, (*h)[:hllHdrSize]) // Magic and cached cardinality
+	dense[4] = hllDense
+
+	registers := dense[hllHdrSize:]
+	err := h.sparseRuns(func(first, length, value int) {
+		for i := first; value > 0 && i < first+length; i++ {
+			denseSet(registers, i, uint8(value))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	*h = dense
+	return nil
+}
+
+// Add an element, reporting whether a register changed
+func (h *HyperLogLog) Add(element []byte) (bool, error) {
+	index, count := hllPatLen(element)
+	return h.set(index, count)
+}
+
+// Set a register to count if it is greater, reporting whether it changed
+func (h *HyperLogLog) set(index int, count uint8) (bool, error) {
+	if !h.IsSparse() {
+		return denseSetMax((*h)[hllHdrSize:], index, count), nil
+	}
+	return h.sparseSet(index, count)
+}
+
+// Update a register of the sparse encoding in place, splitting the opcode
+// covering it and merging equal adjacent values afterwards, exactly as Redis
+// does so both produce the same representation. The HyperLogLog switches to
+// the dense encoding when the value or the size no longer fit.
+func (h *HyperLogLog) sparseSet(index int, count uint8) (bool, error) {
+	if count > hllSparseValMaxValue {
+		return h.promote(index, count)
+	}
+	data := *h
+
+	// Step 1: locate the opcode covering the register
+	p, prev, first, span := hllHdrSize, -1, 0, 0
+	for p < len(data) {
+		oplen := 1
+		switch {
+		case sparseIsZero(data[p]):
+			span = sparseZeroLen(data[p])
+		case sparseIsVal(data[p]):
+			span = sparseValLen(data[p])
+		default:
+			if p+1 >= len(data) {
+				return false, ErrInvalidHLL
+			}
+			span = sparseXZeroLen(data[p], data[p+1])
+			oplen = 2
+		}
+		if index <= first+span-1 {
+			break
+		}
+		prev = p
+		p += oplen
+		first += span
+	}
+	if span == 0 || p >= len(data) {
+		return false, ErrInvalidHLL
+	}
+
+	op := data[p]
+	isVal, isXZero := sparseIsVal(op), sparseIsXZero(op)
+
+	// Step 2: trivial updates of a single register opcode
+	updated := false
+	if isVal {
+		oldCount := sparseValValue(op)
+		if oldCount >= int(count) {
+			return false, nil
+		}
+		if span == 1 {
+			data[p] = sparseVal(int(count), 1)
+			updated = true
+		}
+	} else if !isXZero && span == 1 {
+		data[p] = sparseVal(int(count), 1)
+		updated = true
+	}
+
+	// Otherwise split the opcode, at worst XZERO into XZERO-VAL-XZERO
+	if !updated {
+		last := first + span - 1
+		seq := make([]byte, 0, 5)
+		if isVal {
+			value := sparseValValue(op)
+			if index != first {
+				seq = append(seq, sparseVal(value, index-first))
+			}
+			seq = append(seq, sparseVal(int(count), 1))
+			if index != last {
+				seq = append(seq, sparseVal(value, last-index))
+			}
+		} else {
+			if index != first {
+				seq = appendSparseZero(seq, index-first)
+			}
+			seq = append(seq, sparseVal(int(count), 1))
+			if index != last {
+				seq = appendSparseZero(seq, last-index)
+			}
+		}
+
+		// Step 3: substitute the new sequence for the old opcode
+		oldLen := 1
+		if isXZero {
+			oldLen = 2
+		}
+		delta := len(seq) - oldLen
+		if delta > 0 && len(data)+delta > HLLSparseMaxBytes {
+			return h.promote(index, count)
+		}
+		replaced := make(HyperLogLog, 0, len(data)+delta)
+		replaced = append(replaced, data[:p]...)
+		replaced = append(replaced, seq...)
+		data = append(replaced, data[p+oldLen:]...)
+	}
+
+	// Step 4: merge adjacent VAL opcodes with the same value, scanning up to
+	// 5 opcodes from the one before the update
+	p = hllHdrSize
+	if prev >= 0 {
+		p = prev
+	}
+	for scan := 5; p < len(data) && scan > 0; scan-- {
+		switch {
+		case sparseIsXZero(data[p]):
+			p += 2
+			continue
+		case sparseIsZero(data[p]):
+			p++
+			continue
+		}
+		if p+1 < len(data) && sparseIsVal(data[p+1]) {
+			v1, v2 := sparseValValue(data[p]), sparseValValue(data[p+1])
+			length := sparseValLen(data[p]) + sparseValLen(data[p+1])
+			if v1 == v2 && length <= hllSparseValMaxLen {
+				data[p+1] = sparseVal(v1, length)
+				data = append(data[:p], data[p+1:]...)
+				// Try to merge the merged value with the next one too
+				continue
+			}
+		}
+		p++
+	}
+
+	data.InvalidateCache()
+	*h = data
+	return true, nil
+}
+
+// Switch to the dense encoding to set a register the sparse one cannot hold
+func (h *HyperLogLog) promote(index int, count uint8) (bool, error) {
+	if err := h.ToDense(); err != nil {
+		return false, err
+	}
+	return denseSetMax((*h)[hllHdrSize:], index, count), nil
+}
+
+// MergeInto raises registers to the values of the HyperLogLog registers
+func (h HyperLogLog) MergeInto(registers []uint8) error {
+	if !h.IsSparse() {
+		dense := h[hllHdrSize:]
+		for i := range registers {
+			registers[i] = max(registers[i], denseGet(dense, i))
+		}
+		return nil
+	}
+	return h.sparseRuns(func(first, length, value int) {
+		for i := first; value > 0 && i < first+length; i++ {
+			registers[i] = max(registers[i], uint8(value))
+		}
+	})
+}
+
+// SetRegisters raises the registers of the HyperLogLog to the given values
+func (h *HyperLogLog) SetRegisters(registers []uint8) error {
+	for i, value := range registers {
+		if value == 0 {
+			continue
+		}
+		if _, err := h.set(i, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Registers returns the value of every register
+func (h HyperLogLog) Registers() ([]uint8, error) {
+	registers := make([]uint8, HLLRegisters)
+	if err := h.MergeInto(registers); err != nil {
+		return nil, err
+	}
+	return registers, nil
+}
+
+// Count estimates the cardinality from the registers, ignoring the cache
+func (h HyperLogLog) Count() (uint64, error) {
+	var histogram [64]int
+	if !h.IsSparse() {
+		dense := h[hllHdrSize:]
+		for i := 0; i < HLLRegisters; i++ {
+			histogram[denseGet(dense, i)]++
+		}
+	} else {
+		err := h.sparseRuns(func(first, length, value int) {
+			histogram[value] += length
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return estimate(&histogram), nil
+}
+
+// CountRegisters estimates the cardinality of raw register values
+func CountRegisters(registers []uint8) uint64 {
+	var histogram [64]int
+	for _, value := range registers {
+		histogram[value]++
+	}
+	return estimate(&histogram)
+}
+
+// Cardinality estimation from the register histogram, using the improved
+// estimator of Otmar Ertl like Redis
+func estimate(histogram *[64]int) uint64 {
+	m := float64(HLLRegisters)
+	z := m * hllTau((m-float64(histogram[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histogram[0])/m)
+	return uint64(math.Round(hllAlphaInf * m * m / z))
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
+
+// DecodeSparse describes the sparse opcodes, "z:len" for ZERO, "Z:len" for
+// XZERO and "v:value,len" for VAL
+func (h HyperLogLog) DecodeSparse() string {
+	var parts []string
+	for p := hllHdrSize; p < len(h); {
+		switch {
+		case sparseIsZero(h[p]):
+			parts = append(parts, fmt.Sprintf("z:%d", sparseZeroLen(h[p])))
+			p++
+		case sparseIsXZero(h[p]) && p+1 < len(h):
+			parts = append(parts, fmt.Sprintf("Z:%d", sparseXZeroLen(h[p], h[p+1])))
+			p += 2
+		case sparseIsXZero(h[p]):
+			p++
+		default:
+			parts = append(parts, fmt.Sprintf("v:%d,%d", sparseValValue(h[p]), sparseValLen(h[p])))
+			p++
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// HyperLogLogSelfTest checks the register encoding and that the estimates of
+// the sparse and dense encodings agree and stay within the expected error
+func HyperLogLogSelfTest() error {
+	// Registers keep their value and do not affect their neighbours
+	dense := make([]byte, hllDenseSize-hllHdrSize)
+	expected := make([]uint8, HLLRegisters)
+	for cycle := 0; cycle < 100; cycle++ {
+		for i := range expected {
+			expected[i] = uint8(rand.Intn(hllRegMax + 1))
+			denseSet(dense, i, expected[i])
+		}
+		for i, want := range expected {
+			if got := denseGet(dense, i); got != want {
+				return fmt.Errorf("register %d should be %d but is %d", i, want, got)
+			}
+		}
+	}
+
+	denseHLL := NewHyperLogLog()
+	if err := denseHLL.ToDense(); err != nil {
+		return err
+	}
+	sparseHLL := NewHyperLogLog()
+	relErr := 1.04 / math.Sqrt(HLLRegisters)
+	seed := rand.Uint64()
+	element := make([]byte, 8)
+	checkpoint := uint64(1)
+	for j := uint64(1); j <= hllSelfTestElements; j++ {
+		binary.LittleEndian.PutUint64(element, j^seed)
+		denseHLL.Add(element)
+		if _, err := sparseHLL.Add(element); err != nil {
+			return err
+		}
+		if j != checkpoint {
+			continue
+		}
+
+		if j < uint64(HLLSparseMaxBytes/2) && !sparseHLL.IsSparse() {
+			return errors.New("sparse encoding not used")
+		}
+		denseCount, _ := denseHLL.Count()
+		sparseCount, err := sparseHLL.Count()
+		if err != nil {
+			return err
+		}
+		if denseCount != sparseCount {
+			return errors.New("dense/sparse disagree")
+		}
+
+		// Allow up to 5 times the standard error, and a unit for the
+		// smallest cardinalities where collisions are likely
+		maxErr := math.Max(relErr*5*float64(checkpoint), 1)
+		if diff := math.Abs(float64(denseCount) - float64(checkpoint)); diff > maxErr {
+			return fmt.Errorf("too big error. card:%d abserr:%f", denseCount, diff)
+		}
+		checkpoint *= 10
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package types
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestHyperLogLog_New(t *testing.T) {
+	h := NewHyperLogLog()
+	if !h.Valid() || !h.IsSparse() {
+		t.Fatal("expected a valid sparse HyperLogLog")
+	}
+	if got, want := string(h), "HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x7f\xff"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if count, ok := h.CachedCount(); !ok || count != 0 {
+		t.Errorf("got cached count %d (valid %v), want 0", count, ok)
+	}
+}
+
+func TestHyperLogLog_SparseSet(t *testing.T) {
+	h := NewHyperLogLog()
+	steps := []struct {
+		index int
+		count uint8
+		want  string
+	}{
+		{0, 3, "v:3,1 Z:16383"},
+		{1, 3, "v:3,2 Z:16382"}, // Merged with the previous value
+		{100, 2, "v:3,2 Z:98 v:2,1 Z:16283"},
+		{10, 1, "v:3,2 z:8 v:1,1 Z:89 v:2,1 Z:16283"},
+		{100, 1, "v:3,2 z:8 v:1,1 Z:89 v:2,1 Z:16283"}, // Not greater
+	}
+
+	for _, step := range steps {
+		h.set(step.index, step.count)
+		if got := h.DecodeSparse(); got != step.want {
+			t.Errorf("after setting %d to %d: got %q, want %q", step.index, step.count, got, step.want)
+		}
+	}
+
+	registers, err := h.Registers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registers[0] != 3 || registers[1] != 3 || registers[10] != 1 || registers[100] != 2 || registers[2] != 0 {
+		t.Errorf("unexpected registers %v", registers[:11])
+	}
+}
+
+func TestHyperLogLog_Promotion(t *testing.T) {
+	// Values above 32 cannot be represented by the sparse encoding
+	h := NewHyperLogLog()
+	if changed, err := h.set(5, 40); !changed || err != nil {
+		t.Fatalf("got changed %v and error %v", changed, err)
+	}
+	if h.IsSparse() || len(h) != hllDenseSize {
+		t.Fatal("expected the dense encoding")
+	}
+	if registers, _ := h.Registers(); registers[5] != 40 {
+		t.Errorf("got register %d, want 40", registers[5])
+	}
+
+	// Nor can it grow above HLLSparseMaxBytes
+	h = NewHyperLogLog()
+	for i := 0; h.IsSparse(); i++ {
+		if _, err := h.Add([]byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+		if h.IsSparse() && len(h) > HLLSparseMaxBytes {
+			t.Fatalf("sparse encoding grew to %d bytes", len(h))
+		}
+	}
+}
+
+func TestHyperLogLog_Count(t *testing.T) {
+	sparse, dense := NewHyperLogLog(), NewHyperLogLog()
+	dense.ToDense()
+	for i := 0; i < 1000; i++ {
+		sparse.Add([]byte(strconv.Itoa(i)))
+		dense.Add([]byte(strconv.Itoa(i)))
+	}
+
+	sparseCount, err := sparse.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	denseCount, _ := dense.Count()
+	if sparseCount != denseCount {
+		t.Errorf("sparse count %d differs from dense count %d", sparseCount, denseCount)
+	}
+	if math.Abs(float64(denseCount)-1000) > 1000*0.05 {
+		t.Errorf("got count %d, want about 1000", denseCount)
+	}
+
+	sparse.InvalidateCache()
+	if _, ok := sparse.CachedCount(); ok {
+		t.Error("expected the cached count to be invalid")
+	}
+	sparse.SetCachedCount(sparseCount)
+	if count, ok := sparse.CachedCount(); !ok || count != sparseCount {
+		t.Errorf("got cached count %d, want %d", count, sparseCount)
+	}
+}
+
+func TestHyperLogLog_Corrupted(t *testing.T) {
+	h := NewHyperLogLog()
+	h = h[:len(h)-1] // Truncated XZERO opcode
+	if _, err := h.Count(); err != ErrInvalidHLL {
+		t.Errorf("got error %v, want %v", err, ErrInvalidHLL)
+	}
+	if HyperLogLog("HYLL\x00").Valid() {
+		t.Error("expected a short header to be invalid")
+	}
+}
+
+func TestHyperLogLogSelfTest(t *testing.T) {
+	if err := HyperLogLogSelfTest(); err != nil {
+		t.Fatal(err)
+	}
+}
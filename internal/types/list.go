@@ -0,0 +1,148 @@
+package types
+
+// List is a double-ended queue of byte strings backed by a ring buffer, so
+// pushing and popping at both ends is O(1) amortized
+type List struct {
+	items [][]byte
+	head  int // Index of the first element in items
+	size  int
+}
+
+// NewList creates an empty list
+func NewList() *List {
+	return &List{}
+}
+
+// Len returns the number of elements
+func (l *List) Len() int {
+	return l.size
+}
+
+// Clone returns a copy of the list sharing its elements, which are never
+// modified in place
+func (l *List) Clone() *List {
+	return &List{items: l.Range(0, -1), size: l.size}
+}
+
+// Clear removes every element
+func (l *List) Clear() {
+	*l = List{}
+}
+
+// PushLeft inserts value at the head of the list
+func (l *List) PushLeft(value []byte) {
+	l.grow()
+	l.head = (l.head - 1 + len(l.items)) % len(l.items)
+	l.items[l.head] = value
+	l.size++
+}
+
+// PushRight appends value at the tail of the list
+func (l *List) PushRight(value []byte) {
+	l.grow()
+	l.items[(l.head+l.size)%len(l.items)] = value
+	l.size++
+}
+
+// PopLeft removes and returns the head of the list
+func (l *List) PopLeft() ([]byte, bool) {
+	if l.size == 0 {
+		return nil, false
+	}
+	value := l.items[l.head]
+	l.items[l.head] = nil
+	l.head = (l.head + 1) % len(l.items)
+	l.size--
+	l.shrink()
+	return value, true
+}
+
+// PopRight removes and returns the tail of the list
+func (l *List) PopRight() ([]byte, bool) {
+	if l.size == 0 {
+		return nil, false
+	}
+	idx := (l.head + l.size - 1) % len(l.items)
+	value := l.items[idx]
+	l.items[idx] = nil
+	l.size--
+	l.shrink()
+	return value, true
+}
+
+// Index returns the element at index, negative indexes count from the tail
+func (l *List) Index(index int) ([]byte, bool) {
+	if index < 0 {
+		index += l.size
+	}
+	if index < 0 || index >= l.size {
+		return nil, false
+	}
+	return l.items[(l.head+index)%len(l.items)], true
+}
+
+// Range returns the elements between start and stop inclusive. Negative
+// indexes count from the tail and out of range indexes are clamped, like
+// LRANGE does.
+func (l *List) Range(start, stop int) [][]byte {
+	start, stop, ok := NormalizeRange(start, stop, l.size)
+	if !ok {
+		return [][]byte{}
+	}
+
+	result := make([][]byte, 0, stop-start+1)
+	for i := start; i <= stop; i++ {
+		result = append(result, l.items[(l.head+i)%len(l.items)])
+	}
+	return result
+}
+
+// Double the ring buffer when it is full
+func (l *List) grow() {
+	if l.size < len(l.items) {
+		return
+	}
+	size := 2 * len(l.items)
+	if size == 0 {
+		size = 4
+	}
+	l.resize(size)
+}
+
+// Halve the ring buffer when it is mostly empty
+func (l *List) shrink() {
+	if len(l.items) > 16 && l.size <= len(l.items)/4 {
+		l.resize(len(l.items) / 2)
+	}
+}
+
+func (l *List) resize(size int) {
+	items := make([][]byte, size)
+	for i := 0; i < l.size; i++ {
+		items[i] = l.items[(l.head+i)%len(l.items)]
+	}
+	l.items = items
+	l.head = 0
+}
+
+// NormalizeRange converts a start/stop pair that may use negative indexes
+// into absolute inclusive bounds for a sequence of the given length. It
+// reports false when the range is empty.
+func NormalizeRange(start, stop, length int) (int, int, bool) {
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop || start >= length {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
@@ -0,0 +1,84 @@
+package types
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestList_PushPop(t *testing.T) {
+	l := NewList()
+	for i := 0; i < 100; i++ {
+		l.PushRight([]byte(strconv.Itoa(i)))
+	}
+	l.PushLeft([]byte("head"))
+
+	if l.Len() != 101 {
+		t.Fatalf("got len %d, want 101", l.Len())
+	}
+	if value, _ := l.PopLeft(); string(value) != "head" {
+		t.Errorf("got %q, want head", value)
+	}
+	if value, _ := l.PopRight(); string(value) != "99" {
+		t.Errorf("got %q, want 99", value)
+	}
+
+	// Drain the list through both ends
+	for l.Len() > 0 {
+		if _, ok := l.PopLeft(); !ok {
+			t.Fatal("expected an element")
+		}
+		l.PopRight()
+	}
+	if _, ok := l.PopLeft(); ok {
+		t.Error("expected an empty list")
+	}
+}
+
+func TestList_Range(t *testing.T) {
+	l := NewList()
+	for _, v := range []string{"c", "b", "a"} {
+		l.PushLeft([]byte(v))
+	}
+
+	tests := []struct {
+		name        string
+		start, stop int
+		expected    []string
+	}{
+		{name: "whole list", start: 0, stop: -1, expected: []string{"a", "b", "c"}},
+		{name: "negative indexes", start: -2, stop: -1, expected: []string{"b", "c"}},
+		{name: "clamped stop", start: 1, stop: 100, expected: []string{"b", "c"}},
+		{name: "empty range", start: 2, stop: 1, expected: []string{}},
+		{name: "start out of range", start: 5, stop: 10, expected: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := []string{}
+			for _, v := range l.Range(tt.start, tt.stop) {
+				result = append(result, string(v))
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("got %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestList_Clone(t *testing.T) {
+	l := NewList()
+	for _, v := range []string{"a", "b", "c"} {
+		l.PushRight([]byte(v))
+	}
+	clone := l.Clone()
+	l.PopLeft()
+	clone.PushRight([]byte("d"))
+
+	if got := clone.Range(0, -1); !reflect.DeepEqual(got, [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")}) {
+		t.Errorf("got %q, want [a b c d]", got)
+	}
+	if l.Len() != 2 {
+		t.Errorf("got len %d, want 2", l.Len())
+	}
+}
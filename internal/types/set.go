@@ -0,0 +1,63 @@
+package types
+
+// Set is an unordered collection of unique members
+type Set struct {
+	members map[string]struct{}
+}
+
+// NewSet creates an empty set
+func NewSet() *Set {
+	return &Set{members: make(map[string]struct{})}
+}
+
+// Len returns the number of members
+func (s *Set) Len() int {
+	return len(s.members)
+}
+
+// Add inserts member and reports whether it was not already there
+func (s *Set) Add(member string) bool {
+	if _, ok := s.members[member]; ok {
+		return false
+	}
+	s.members[member] = struct{}{}
+	return true
+}
+
+// Remove deletes member and reports whether it was there
+func (s *Set) Remove(member string) bool {
+	if _, ok := s.members[member]; !ok {
+		return false
+	}
+	delete(s.members, member)
+	return true
+}
+
+// Contains reports whether member belongs to the set
+func (s *Set) Contains(member string) bool {
+	_, ok := s.members[member]
+	return ok
+}
+
+// Members returns the members in no particular order
+func (s *Set) Members() []string {
+	members := make([]string, 0, len(s.members))
+	for member := range s.members {
+		members = append(members, member)
+	}
+	return members
+}
+
+// Clone returns a copy of the set
+func (s *Set) Clone() *Set {
+	clone := &Set{members: make(map[string]struct{}, len(s.members))}
+	for member := range s.members {
+		clone.members[member] = struct{}{}
+	}
+	return clone
+}
+
+// Clear removes every member
+func (s *Set) Clear() {
+	s.members = make(map[string]struct{})
+}
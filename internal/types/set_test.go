@@ -0,0 +1,31 @@
+package types
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	s := NewSet()
+	if !s.Add("a") || !s.Add("b") || s.Add("a") {
+		t.Fatal("expected a and b to be added once")
+	}
+	if !s.Contains("a") || s.Contains("c") {
+		t.Error("unexpected membership")
+	}
+
+	clone := s.Clone()
+	if !s.Remove("a") || s.Remove("a") {
+		t.Error("expected a single successful remove")
+	}
+
+	members := clone.Members()
+	sort.Strings(members)
+	if !reflect.DeepEqual(members, []string{"a", "b"}) {
+		t.Errorf("got %q, want [a b]", members)
+	}
+	if s.Len() != 1 {
+		t.Errorf("got len %d, want 1", s.Len())
+	}
+}
@@ -0,0 +1,427 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StreamID identifies a stream entry: milliseconds and a sequence number
+// for entries created within the same millisecond
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MaxStreamID is greater than any other ID
+var MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+func (id StreamID) String() string {
+	return fmt.Sprintf("%d-%d", id.Ms, id.Seq)
+}
+
+// Less reports whether id sorts before other
+func (id StreamID) Less(other StreamID) bool {
+	return id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq)
+}
+
+// IsZero reports whether id is 0-0
+func (id StreamID) IsZero() bool {
+	return id.Ms == 0 && id.Seq == 0
+}
+
+// Next returns the smallest ID greater than id
+func (id StreamID) Next() (StreamID, bool) {
+	if id.Seq < math.MaxUint64 {
+		return StreamID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	}
+	if id.Ms < math.MaxUint64 {
+		return StreamID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+// Prev returns the greatest ID smaller than id
+func (id StreamID) Prev() (StreamID, bool) {
+	if id.Seq > 0 {
+		return StreamID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	}
+	if id.Ms > 0 {
+		return StreamID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// ParseStreamID parses "ms-seq" or "ms", in which case the sequence is
+// missingSeq
+func ParseStreamID(s string, missingSeq uint64) (StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, fmt.Errorf("invalid stream ID: %s", s)
+	}
+	if !hasSeq {
+		return StreamID{Ms: ms, Seq: missingSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return StreamID{}, fmt.Errorf("invalid stream ID: %s", s)
+	}
+	return StreamID{Ms: ms, Seq: seq}, nil
+}
+
+// StreamEntry is a stream item made of field/value pairs
+type StreamEntry struct {
+	ID     StreamID
+	Fields [][]byte // field, value, field, value...
+}
+
+// PendingEntry is an entry delivered to a consumer and not acknowledged yet
+type PendingEntry struct {
+	ID            StreamID
+	Consumer      *Consumer
+	DeliveryTime  time.Time
+	DeliveryCount int64
+}
+
+// Consumer is a named member of a consumer group
+type Consumer struct {
+	Name       string
+	SeenTime   time.Time // Last interaction
+	ActiveTime time.Time // Last successful read or claim
+	Pending    map[StreamID]*PendingEntry
+}
+
+// ConsumerGroup tracks the entries delivered to its consumers
+type ConsumerGroup struct {
+	Name        string
+	LastID      StreamID // Last entry delivered to the group
+	EntriesRead int64    // Entries delivered so far, -1 when unknown
+	Pending     map[StreamID]*PendingEntry
+	Consumers   map[string]*Consumer
+}
+
+// Stream is an append-only log of entries ordered by ID. Entries are kept in
+// a slice since they are appended in ID order, so lookups and ranges are
+// binary searches.
+type Stream struct {
+	entries      []StreamEntry
+	LastID       StreamID // Greatest ID ever added
+	MaxDeletedID StreamID // Greatest ID ever deleted
+	EntriesAdded int64    // Entries ever added
+	Groups       map[string]*ConsumerGroup
+}
+
+// NewStream creates an empty stream
+func NewStream() *Stream {
+	return &Stream{Groups: make(map[string]*ConsumerGroup)}
+}
+
+// Len returns the number of entries
+func (s *Stream) Len() int {
+	return len(s.entries)
+}
+
+// Clone returns a copy of the stream and its consumer groups, sharing the
+// entry fields which are never modified in place
+func (s *Stream) Clone() *Stream {
+	clone := &Stream{
+		entries:      append([]StreamEntry(nil), s.entries...),
+		LastID:       s.LastID,
+		MaxDeletedID: s.MaxDeletedID,
+		EntriesAdded: s.EntriesAdded,
+		Groups:       make(map[string]*ConsumerGroup, len(s.Groups)),
+	}
+	for name, g := range s.Groups {
+		group := clone.NewGroup(name, g.LastID, g.EntriesRead)
+		for _, c := range g.Consumers {
+			consumer, _ := group.Consumer(c.Name, true)
+			consumer.SeenTime, consumer.ActiveTime = c.SeenTime, c.ActiveTime
+		}
+		for id, pe := range g.Pending {
+			entry := *pe
+			entry.Consumer = group.Consumers[pe.Consumer.Name]
+			group.Pending[id] = &entry
+			entry.Consumer.Pending[id] = &entry
+		}
+	}
+	return clone
+}
+
+// Clear removes every entry and consumer group
+func (s *Stream) Clear() {
+	s.entries = nil
+	s.Groups = make(map[string]*ConsumerGroup)
+}
+
+// Append adds an entry, id must be greater than LastID
+func (s *Stream) Append(id StreamID, fields [][]byte) {
+	s.entries = append(s.entries, StreamEntry{ID: id, Fields: fields})
+	s.LastID = id
+	s.EntriesAdded++
+}
+
+// First returns the entry with the smallest ID
+func (s *Stream) First() (StreamEntry, bool) {
+	if len(s.entries) == 0 {
+		return StreamEntry{}, false
+	}
+	return s.entries[0], true
+}
+
+// Last returns the entry with the greatest ID
+func (s *Stream) Last() (StreamEntry, bool) {
+	if len(s.entries) == 0 {
+		return StreamEntry{}, false
+	}
+	return s.entries[len(s.entries)-1], true
+}
+
+// Index of the first entry with an ID >= id
+func (s *Stream) search(id StreamID) int {
+	return sort.Search(len(s.entries), func(i int) bool {
+		return !s.entries[i].ID.Less(id)
+	})
+}
+
+// Get returns the entry with the given ID
+func (s *Stream) Get(id StreamID) (StreamEntry, bool) {
+	i := s.search(id)
+	if i < len(s.entries) && s.entries[i].ID == id {
+		return s.entries[i], true
+	}
+	return StreamEntry{}, false
+}
+
+// Range returns up to count entries with start <= ID <= end, from the end
+// when reverse is set. A count <= 0 means no limit.
+func (s *Stream) Range(start, end StreamID, count int, reverse bool) []StreamEntry {
+	from, to := s.search(start), s.search(end)
+	if to < len(s.entries) && s.entries[to].ID == end {
+		to++
+	}
+	if from >= to {
+		return nil
+	}
+
+	n := to - from
+	if count > 0 && count < n {
+		n = count
+	}
+	result := make([]StreamEntry, 0, n)
+	for i := 0; i < n; i++ {
+		if reverse {
+			result = append(result, s.entries[to-1-i])
+		} else {
+			result = append(result, s.entries[from+i])
+		}
+	}
+	return result
+}
+
+// Delete removes the entry with the given ID
+func (s *Stream) Delete(id StreamID) bool {
+	i := s.search(id)
+	if i >= len(s.entries) || s.entries[i].ID != id {
+		return false
+	}
+	s.entries = append(s.entries[:i], s.entries[i+1:]...)
+	if s.MaxDeletedID.Less(id) {
+		s.MaxDeletedID = id
+	}
+	return true
+}
+
+// TrimMaxLen evicts the oldest entries until at most maxLen remain, evicting
+// no more than limit entries when limit > 0. It returns the number evicted.
+func (s *Stream) TrimMaxLen(maxLen int, limit int) int {
+	n := len(s.entries) - maxLen
+	return s.trimFront(n, limit)
+}
+
+// TrimMinID evicts the entries with an ID smaller than minID, evicting no
+// more than limit entries when limit > 0. It returns the number evicted.
+func (s *Stream) TrimMinID(minID StreamID, limit int) int {
+	return s.trimFront(s.search(minID), limit)
+}
+
+func (s *Stream) trimFront(n int, limit int) int {
+	if limit > 0 && n > limit {
+		n = limit
+	}
+	if n <= 0 {
+		return 0
+	}
+	if last := s.entries[n-1].ID; s.MaxDeletedID.Less(last) {
+		s.MaxDeletedID = last
+	}
+	s.entries = append(s.entries[:0:0], s.entries[n:]...)
+	return n
+}
+
+// NewGroup creates a consumer group starting after lastID
+func (s *Stream) NewGroup(name string, lastID StreamID, entriesRead int64) *ConsumerGroup {
+	g := &ConsumerGroup{
+		Name:        name,
+		LastID:      lastID,
+		EntriesRead: entriesRead,
+		Pending:     make(map[StreamID]*PendingEntry),
+		Consumers:   make(map[string]*Consumer),
+	}
+	s.Groups[name] = g
+	return g
+}
+
+// hasTombstonesFrom reports whether an entry with an ID >= start may have
+// been deleted, as far as MaxDeletedID tells
+func (s *Stream) hasTombstonesFrom(start StreamID) bool {
+	first, ok := s.First()
+	if !ok || s.MaxDeletedID.IsZero() || s.MaxDeletedID.Less(first.ID) {
+		return false
+	}
+	return !s.MaxDeletedID.Less(start)
+}
+
+// EntriesReadAt returns the number of entries added up to id, -1 when
+// deleted entries make it unknown
+func (s *Stream) EntriesReadAt(id StreamID) int64 {
+	if s.EntriesAdded == 0 {
+		return 0
+	}
+	if id == s.LastID || (len(s.entries) == 0 && id.Less(s.LastID)) {
+		return s.EntriesAdded
+	}
+	if s.LastID.Less(id) {
+		return -1
+	}
+	// Without deletions past the first entry, the entries before it were
+	// all trimmed and those after it all remain
+	first, _ := s.First()
+	if s.MaxDeletedID.IsZero() || s.MaxDeletedID.Less(first.ID) {
+		switch {
+		case id.Less(first.ID):
+			return s.EntriesAdded - int64(len(s.entries))
+		case id == first.ID:
+			return s.EntriesAdded - int64(len(s.entries)) + 1
+		}
+	}
+	return -1
+}
+
+// Read moves the group past id, counting the entry as read while the count
+// is still known
+func (g *ConsumerGroup) Read(s *Stream, id StreamID) {
+	if g.EntriesRead >= 0 && !s.hasTombstonesFrom(id) {
+		g.EntriesRead++
+	} else if s.EntriesAdded > 0 {
+		g.EntriesRead = s.EntriesReadAt(id)
+	}
+	g.LastID = id
+}
+
+// Lag returns the number of entries the group has yet to read, false when
+// deleted entries make it unknown
+func (s *Stream) Lag(g *ConsumerGroup) (int64, bool) {
+	if s.EntriesAdded == 0 {
+		return 0, true
+	}
+	if g.EntriesRead >= 0 && !s.hasTombstonesFrom(g.LastID) {
+		return s.EntriesAdded - g.EntriesRead, true
+	}
+	if read := s.EntriesReadAt(g.LastID); read >= 0 {
+		return s.EntriesAdded - read, true
+	}
+	return 0, false
+}
+
+// SortedGroups returns the consumer groups ordered by name
+func (s *Stream) SortedGroups() []*ConsumerGroup {
+	groups := make([]*ConsumerGroup, 0, len(s.Groups))
+	for _, g := range s.Groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// Consumer returns the named consumer, creating it when create is set
+func (g *ConsumerGroup) Consumer(name string, create bool) (*Consumer, bool) {
+	if c, ok := g.Consumers[name]; ok {
+		return c, false
+	}
+	if !create {
+		return nil, false
+	}
+	now := time.Now()
+	c := &Consumer{
+		Name:     name,
+		SeenTime: now,
+		Pending:  make(map[StreamID]*PendingEntry),
+	}
+	g.Consumers[name] = c
+	return c, true
+}
+
+// SortedConsumers returns the consumers ordered by name
+func (g *ConsumerGroup) SortedConsumers() []*Consumer {
+	consumers := make([]*Consumer, 0, len(g.Consumers))
+	for _, c := range g.Consumers {
+		consumers = append(consumers, c)
+	}
+	sort.Slice(consumers, func(i, j int) bool { return consumers[i].Name < consumers[j].Name })
+	return consumers
+}
+
+// DeleteConsumer removes a consumer with its pending entries and returns how
+// many entries were pending
+func (g *ConsumerGroup) DeleteConsumer(name string) (int, bool) {
+	c, ok := g.Consumers[name]
+	if !ok {
+		return 0, false
+	}
+	for id := range c.Pending {
+		delete(g.Pending, id)
+	}
+	delete(g.Consumers, name)
+	return len(c.Pending), true
+}
+
+// Deliver records the entry as delivered to consumer, moving it from its
+// previous owner if it was already pending
+func (g *ConsumerGroup) Deliver(id StreamID, consumer *Consumer, now time.Time) *PendingEntry {
+	p, ok := g.Pending[id]
+	if !ok {
+		p = &PendingEntry{ID: id}
+		g.Pending[id] = p
+	} else if p.Consumer != nil {
+		delete(p.Consumer.Pending, id)
+	}
+	p.Consumer = consumer
+	p.DeliveryTime = now
+	consumer.Pending[id] = p
+	return p
+}
+
+// Ack removes an entry from the pending entries
+func (g *ConsumerGroup) Ack(id StreamID) bool {
+	p, ok := g.Pending[id]
+	if !ok {
+		return false
+	}
+	delete(p.Consumer.Pending, id)
+	delete(g.Pending, id)
+	return true
+}
+
+// SortedPending returns the pending entries ordered by ID
+func SortedPending(pending map[StreamID]*PendingEntry) []*PendingEntry {
+	entries := make([]*PendingEntry, 0, len(pending))
+	for _, p := range pending {
+		entries = append(entries, p)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID.Less(entries[j].ID) })
+	return entries
+}
@@ -0,0 +1,167 @@
+package types
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func streamIDs(entries []StreamEntry) []StreamID {
+	ids := make([]StreamID, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+func TestParseStreamID(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    StreamID
+		wantErr bool
+	}{
+		{"1-2", StreamID{1, 2}, false},
+		{"5", StreamID{5, 7}, false},
+		{"18446744073709551615-18446744073709551615", MaxStreamID, false},
+		{"1-", StreamID{}, true},
+		{"-1", StreamID{}, true},
+		{"a-1", StreamID{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseStreamID(tt.input, 7)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStream_RangeAndDelete(t *testing.T) {
+	s := NewStream()
+	for i := uint64(1); i <= 5; i++ {
+		s.Append(StreamID{Ms: i}, [][]byte{[]byte("f"), []byte("v")})
+	}
+
+	got := streamIDs(s.Range(StreamID{Ms: 2}, StreamID{Ms: 4}, 0, false))
+	if want := []StreamID{{2, 0}, {3, 0}, {4, 0}}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	got = streamIDs(s.Range(StreamID{}, MaxStreamID, 2, true))
+	if want := []StreamID{{5, 0}, {4, 0}}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if !s.Delete(StreamID{Ms: 3}) || s.Delete(StreamID{Ms: 3}) {
+		t.Error("expected a single successful delete")
+	}
+	if _, ok := s.Get(StreamID{Ms: 3}); ok {
+		t.Error("deleted entry still found")
+	}
+	if s.Len() != 4 || s.MaxDeletedID != (StreamID{Ms: 3}) {
+		t.Errorf("got len %d and max deleted %v", s.Len(), s.MaxDeletedID)
+	}
+}
+
+func TestStream_Trim(t *testing.T) {
+	s := NewStream()
+	for i := uint64(1); i <= 10; i++ {
+		s.Append(StreamID{Ms: i}, nil)
+	}
+
+	if n := s.TrimMaxLen(8, 0); n != 2 {
+		t.Errorf("got %d evictions, want 2", n)
+	}
+	if n := s.TrimMinID(StreamID{Ms: 7}, 3); n != 3 {
+		t.Errorf("got %d evictions with a limit, want 3", n)
+	}
+	if first, _ := s.First(); first.ID != (StreamID{Ms: 6}) {
+		t.Errorf("got first entry %v, want 6-0", first.ID)
+	}
+	if s.EntriesAdded != 10 || s.LastID != (StreamID{Ms: 10}) {
+		t.Errorf("got %d entries added and last ID %v", s.EntriesAdded, s.LastID)
+	}
+}
+
+func TestConsumerGroup_DeliverAndAck(t *testing.T) {
+	s := NewStream()
+	g := s.NewGroup("g", StreamID{}, 0)
+	alice, _ := g.Consumer("alice", true)
+	bob, _ := g.Consumer("bob", true)
+
+	now := time.Now()
+	g.Deliver(StreamID{Ms: 1}, alice, now)
+	g.Deliver(StreamID{Ms: 2}, alice, now)
+
+	// Delivering again moves the entry to its new owner
+	g.Deliver(StreamID{Ms: 1}, bob, now)
+	if len(alice.Pending) != 1 || len(bob.Pending) != 1 || len(g.Pending) != 2 {
+		t.Fatalf("got %d, %d and %d pending entries", len(alice.Pending), len(bob.Pending), len(g.Pending))
+	}
+
+	if !g.Ack(StreamID{Ms: 1}) || g.Ack(StreamID{Ms: 1}) {
+		t.Error("expected a single successful ack")
+	}
+	if pending, ok := g.DeleteConsumer("alice"); !ok || pending != 1 {
+		t.Errorf("got %d pending entries for the deleted consumer, want 1", pending)
+	}
+	if len(g.Pending) != 0 {
+		t.Errorf("got %d pending entries, want 0", len(g.Pending))
+	}
+}
+
+func TestStream_Clone(t *testing.T) {
+	s := NewStream()
+	s.Append(StreamID{Ms: 1}, [][]byte{[]byte("f"), []byte("v")})
+	g := s.NewGroup("g", StreamID{}, 0)
+	alice, _ := g.Consumer("alice", true)
+	g.Deliver(StreamID{Ms: 1}, alice, time.Now())
+
+	clone := s.Clone()
+	g.Ack(StreamID{Ms: 1})
+	s.Delete(StreamID{Ms: 1})
+
+	if clone.Len() != 1 || clone.LastID != s.LastID {
+		t.Fatalf("got %d entries and last ID %v", clone.Len(), clone.LastID)
+	}
+	cg := clone.Groups["g"]
+	pe, ok := cg.Pending[StreamID{Ms: 1}]
+	if !ok || pe.Consumer != cg.Consumers["alice"] || cg.Consumers["alice"].Pending[StreamID{Ms: 1}] != pe {
+		t.Error("expected the pending entry to be owned by the cloned consumer")
+	}
+}
+
+func TestStream_Lag(t *testing.T) {
+	s := NewStream()
+	g := s.NewGroup("g", StreamID{}, 0)
+	if lag, ok := s.Lag(g); !ok || lag != 0 {
+		t.Errorf("got lag %d, %v on an empty stream", lag, ok)
+	}
+	for i := uint64(1); i <= 4; i++ {
+		s.Append(StreamID{Ms: i}, nil)
+	}
+	g.Read(s, StreamID{Ms: 1})
+	if lag, ok := s.Lag(g); !ok || lag != 3 {
+		t.Errorf("got lag %d, %v, want 3", lag, ok)
+	}
+
+	// Trimmed entries do not count, the first entry is known to be the 2nd
+	s.TrimMaxLen(3, 0)
+	if n := s.EntriesReadAt(StreamID{Ms: 2}); n != 2 {
+		t.Errorf("got %d entries read at the first entry, want 2", n)
+	}
+	s.Delete(StreamID{Ms: 3})
+	if _, ok := s.Lag(g); ok {
+		t.Error("expected an unknown lag past a deleted entry")
+	}
+	if n := s.EntriesReadAt(StreamID{Ms: 2}); n != -1 {
+		t.Errorf("got %d entries read before a deleted entry, want -1", n)
+	}
+	if n := s.EntriesReadAt(StreamID{Ms: 4}); n != 4 {
+		t.Errorf("got %d entries read at the last entry, want 4", n)
+	}
+}
@@ -0,0 +1,304 @@
+package types
+
+import "math/rand/v2"
+
+const (
+	maxLevel    = 32
+	levelChance = 0.25
+)
+
+// Member is an element of a sorted set
+type Member struct {
+	Name  string
+	Score float64
+}
+
+// Elements are ordered by score, then by name
+func (m Member) less(score float64, name string) bool {
+	return m.Score < score || (m.Score == score && m.Name < name)
+}
+
+type skiplistLevel struct {
+	forward *skiplistNode
+	span    int // Number of nodes skipped by the forward pointer
+}
+
+type skiplistNode struct {
+	Member
+	backward *skiplistNode
+	levels   []skiplistLevel
+}
+
+// SortedSet is a set of unique members ordered by score. Like the Redis zset
+// it pairs a map for O(1) score lookups with a skiplist whose spans give
+// O(log n) access by rank.
+type SortedSet struct {
+	scores map[string]float64
+	header *skiplistNode
+	tail   *skiplistNode
+	level  int
+}
+
+// NewSortedSet creates an empty sorted set
+func NewSortedSet() *SortedSet {
+	return &SortedSet{
+		scores: make(map[string]float64),
+		header: &skiplistNode{levels: make([]skiplistLevel, maxLevel)},
+		level:  1,
+	}
+}
+
+// Len returns the number of members
+func (z *SortedSet) Len() int {
+	return len(z.scores)
+}
+
+// Clone returns a copy of the sorted set
+func (z *SortedSet) Clone() *SortedSet {
+	clone := NewSortedSet()
+	for node := z.header.levels[0].forward; node != nil; node = node.levels[0].forward {
+		clone.Add(node.Name, node.Score)
+	}
+	return clone
+}
+
+// Clear removes every member, unlinking the skiplist nodes
+func (z *SortedSet) Clear() {
+	for node := z.header.levels[0].forward; node != nil; {
+		next := node.levels[0].forward
+		node.backward, node.levels = nil, nil
+		node = next
+	}
+	*z = *NewSortedSet()
+}
+
+// Score returns the score of member
+func (z *SortedSet) Score(member string) (float64, bool) {
+	score, ok := z.scores[member]
+	return score, ok
+}
+
+// Add inserts member or updates its score, and reports whether it is new
+func (z *SortedSet) Add(member string, score float64) bool {
+	if old, ok := z.scores[member]; ok {
+		if old != score {
+			z.delete(member, old)
+			z.insert(member, score)
+			z.scores[member] = score
+		}
+		return false
+	}
+	z.insert(member, score)
+	z.scores[member] = score
+	return true
+}
+
+// Remove deletes member and reports whether it existed
+func (z *SortedSet) Remove(member string) bool {
+	score, ok := z.scores[member]
+	if !ok {
+		return false
+	}
+	z.delete(member, score)
+	delete(z.scores, member)
+	return true
+}
+
+// Rank returns the 0-based position of member in ascending order
+func (z *SortedSet) Rank(member string) (int, bool) {
+	score, ok := z.scores[member]
+	if !ok {
+		return 0, false
+	}
+
+	// Walk every node sorting at or before the member
+	rank := 0
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		for f := x.levels[i].forward; f != nil && (f.less(score, member) || f.Name == member); f = x.levels[i].forward {
+			rank += x.levels[i].span
+			x = f
+		}
+	}
+	return rank - 1, true
+}
+
+// PopMin removes and returns the member with the lowest score
+func (z *SortedSet) PopMin() (Member, bool) {
+	first := z.header.levels[0].forward
+	if first == nil {
+		return Member{}, false
+	}
+	m := first.Member
+	z.Remove(m.Name)
+	return m, true
+}
+
+// PopMax removes and returns the member with the highest score
+func (z *SortedSet) PopMax() (Member, bool) {
+	if z.tail == nil {
+		return Member{}, false
+	}
+	m := z.tail.Member
+	z.Remove(m.Name)
+	return m, true
+}
+
+// Range returns the members between ranks start and stop inclusive, in
+// ascending order or descending order when reverse is set. Negative ranks
+// count from the end.
+func (z *SortedSet) Range(start, stop int, reverse bool) []Member {
+	start, stop, ok := NormalizeRange(start, stop, z.Len())
+	if !ok {
+		return []Member{}
+	}
+
+	result := make([]Member, 0, stop-start+1)
+	var x *skiplistNode
+	if reverse {
+		x = z.byRank(z.Len() - start)
+	} else {
+		x = z.byRank(start + 1)
+	}
+	for i := start; i <= stop && x != nil; i++ {
+		result = append(result, x.Member)
+		if reverse {
+			x = x.backward
+		} else {
+			x = x.levels[0].forward
+		}
+	}
+	return result
+}
+
+// RangeByScore returns the members with a score between min and max
+// inclusive, in ascending order
+func (z *SortedSet) RangeByScore(min, max float64) []Member {
+	// Find the last node scoring below min
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && x.levels[i].forward.Score < min {
+			x = x.levels[i].forward
+		}
+	}
+
+	result := []Member{}
+	for x = x.levels[0].forward; x != nil && x.Score <= max; x = x.levels[0].forward {
+		result = append(result, x.Member)
+	}
+	return result
+}
+
+// Find the node at the given 1-based rank
+func (z *SortedSet) byRank(rank int) *skiplistNode {
+	traversed := 0
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && traversed+x.levels[i].span <= rank {
+			traversed += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+func randomLevel() int {
+	level := 1
+	for level < maxLevel && rand.Float64() < levelChance {
+		level++
+	}
+	return level
+}
+
+func (z *SortedSet) insert(name string, score float64) {
+	var update [maxLevel]*skiplistNode
+	var rank [maxLevel]int
+
+	// Find the insert position at every level, counting the rank on the way
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		if i < z.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.levels[i].forward != nil && x.levels[i].forward.less(score, name) {
+			rank[i] += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	if level > z.level {
+		for i := z.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = z.header
+			update[i].levels[i].span = z.Len()
+		}
+		z.level = level
+	}
+
+	x = &skiplistNode{
+		Member: Member{Name: name, Score: score},
+		levels: make([]skiplistLevel, level),
+	}
+	for i := 0; i < level; i++ {
+		x.levels[i].forward = update[i].levels[i].forward
+		update[i].levels[i].forward = x
+
+		x.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+
+	// Levels above the new node now skip one more node
+	for i := level; i < z.level; i++ {
+		update[i].levels[i].span++
+	}
+
+	if update[0] != z.header {
+		x.backward = update[0]
+	}
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x
+	} else {
+		z.tail = x
+	}
+}
+
+func (z *SortedSet) delete(name string, score float64) {
+	var update [maxLevel]*skiplistNode
+
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && x.levels[i].forward.less(score, name) {
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.levels[0].forward
+	if x == nil || x.Score != score || x.Name != name {
+		return
+	}
+
+	for i := 0; i < z.level; i++ {
+		if update[i].levels[i].forward == x {
+			update[i].levels[i].span += x.levels[i].span - 1
+			update[i].levels[i].forward = x.levels[i].forward
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x.backward
+	} else {
+		z.tail = x.backward
+	}
+
+	for z.level > 1 && z.header.levels[z.level-1].forward == nil {
+		z.level--
+	}
+}
@@ -0,0 +1,109 @@
+package types
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestSortedSet_AddRemove(t *testing.T) {
+	z := NewSortedSet()
+	if !z.Add("a", 1) {
+		t.Error("expected a new member")
+	}
+	if z.Add("a", 3) {
+		t.Error("expected an existing member")
+	}
+	z.Add("b", 2)
+
+	if score, _ := z.Score("a"); score != 3 {
+		t.Errorf("got score %v, want 3", score)
+	}
+	if rank, _ := z.Rank("a"); rank != 1 {
+		t.Errorf("got rank %d, want 1", rank)
+	}
+
+	if !z.Remove("a") || z.Remove("a") {
+		t.Error("expected a single successful remove")
+	}
+	if z.Len() != 1 {
+		t.Errorf("got len %d, want 1", z.Len())
+	}
+}
+
+func TestSortedSet_Order(t *testing.T) {
+	z := NewSortedSet()
+	var expected []Member
+	for i := 0; i < 500; i++ {
+		// Collide scores to check the ordering by name
+		m := Member{Name: "m" + strconv.Itoa(i), Score: float64((i * 37) % 100)}
+		z.Add(m.Name, m.Score)
+		expected = append(expected, m)
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		return expected[i].less(expected[j].Score, expected[j].Name)
+	})
+
+	if got := z.Range(0, -1, false); !reflect.DeepEqual(got, expected) {
+		t.Fatal("range does not return members in order")
+	}
+	for i, m := range expected {
+		if rank, _ := z.Rank(m.Name); rank != i {
+			t.Fatalf("member %s: got rank %d, want %d", m.Name, rank, i)
+		}
+	}
+
+	reversed := z.Range(0, 2, true)
+	want := []Member{expected[499], expected[498], expected[497]}
+	if !reflect.DeepEqual(reversed, want) {
+		t.Errorf("got %v, want %v", reversed, want)
+	}
+
+	if m, _ := z.PopMin(); m != expected[0] {
+		t.Errorf("got %v, want %v", m, expected[0])
+	}
+	if m, _ := z.PopMax(); m != expected[499] {
+		t.Errorf("got %v, want %v", m, expected[499])
+	}
+	if got := z.Range(0, -1, false); !reflect.DeepEqual(got, expected[1:499]) {
+		t.Error("range does not match after popping")
+	}
+}
+
+func TestSortedSet_RangeByScore(t *testing.T) {
+	z := NewSortedSet()
+	for i := 0; i < 100; i++ {
+		z.Add("m"+strconv.Itoa(i), float64(i/2))
+	}
+
+	got := z.RangeByScore(10, 11)
+	want := []Member{{"m20", 10}, {"m21", 10}, {"m22", 11}, {"m23", 11}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := z.RangeByScore(60, 70); len(got) != 0 {
+		t.Errorf("got %v, want no members", got)
+	}
+	if got := z.RangeByScore(math.Inf(-1), math.Inf(1)); len(got) != 100 {
+		t.Errorf("got %d members, want 100", len(got))
+	}
+}
+
+func TestSortedSet_Clone(t *testing.T) {
+	z := NewSortedSet()
+	z.Add("a", 1)
+	z.Add("b", 2)
+	clone := z.Clone()
+	z.Remove("a")
+	clone.Add("c", 0)
+
+	want := []Member{{Name: "c", Score: 0}, {Name: "a", Score: 1}, {Name: "b", Score: 2}}
+	if got := clone.Range(0, -1, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if z.Len() != 1 {
+		t.Errorf("got len %d, want 1", z.Len())
+	}
+}